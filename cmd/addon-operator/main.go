@@ -61,6 +61,49 @@ func main() {
 		})
 	app.DefineStartCommandFlags(kpApp, startCmd)
 
+	// render modules without a cluster
+	renderCmd := kpApp.Command("render", "Render charts of modules with static and config values without a cluster.").
+		Action(func(c *kingpin.ParseContext) error {
+			sh_app.SetupLogging(config.NewConfig())
+
+			err := addon_operator.RenderModules()
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+			return nil
+		})
+	app.DefineRenderCommandFlags(renderCmd)
+
+	// validate modules tree without a cluster
+	lintCmd := kpApp.Command("lint", "Check modules, hooks configuration, OpenAPI schemas and static values without a cluster.").
+		Action(func(c *kingpin.ParseContext) error {
+			sh_app.SetupLogging(config.NewConfig())
+
+			err := addon_operator.LintModules()
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+			return nil
+		})
+	app.DefineLintCommandFlags(lintCmd)
+
+	// run shell hook with fixtures and compare outputs with golden files
+	hookCmd := sh_app.CommandWithDefaultUsageTemplate(kpApp, "hook", "Actions for hooks.")
+	hookTestCmd := hookCmd.Command("test", "Run a shell hook with a binding context and values from fixtures and compare outputs with golden files.").
+		Action(func(c *kingpin.ParseContext) error {
+			sh_app.SetupLogging(config.NewConfig())
+
+			err := addon_operator.TestHook()
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+			return nil
+		})
+	app.DefineHookTestCommandFlags(hookTestCmd)
+
 	debug.DefineDebugCommands(kpApp)
 	app.DefineDebugCommands(kpApp)
 
@@ -0,0 +1,124 @@
+package addon_operator
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DriftRepairMaxAttempts is a number of ModuleRun tasks queued to repair the same drift.
+	DriftRepairMaxAttempts = 5
+	// DriftRepairBackoff is a delay before the second repair attempt. The delay is doubled for each next attempt.
+	DriftRepairBackoff = 30 * time.Second
+	// DriftRepairMaxBackoff limits the delay between repair attempts.
+	DriftRepairMaxBackoff = 10 * time.Minute
+)
+
+// DriftRepairs limits ModuleRun tasks queued to repair drifted resources of modules with
+// the "repair" drift policy. Another controller can revert repaired fields immediately,
+// so repair attempts are delayed with an exponential backoff and stopped after
+// MaxAttempts until the drift is resolved.
+type DriftRepairs struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+
+	m       sync.Mutex
+	modules map[string]*driftRepair
+}
+
+type driftRepair struct {
+	attempts    int
+	lastAttempt time.Time
+	retry       *time.Timer
+}
+
+func NewDriftRepairs(maxAttempts int, backoff time.Duration, maxBackoff time.Duration) *DriftRepairs {
+	return &DriftRepairs{
+		MaxAttempts: maxAttempts,
+		Backoff:     backoff,
+		MaxBackoff:  maxBackoff,
+		modules:     make(map[string]*driftRepair),
+	}
+}
+
+// Next returns a delay before the next repair attempt. It returns false if attempts are exhausted.
+func (d *DriftRepairs) Next(moduleName string, now time.Time) (time.Duration, bool) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	repair, has := d.modules[moduleName]
+	if !has || repair.attempts == 0 {
+		return 0, true
+	}
+	if repair.attempts >= d.MaxAttempts {
+		return 0, false
+	}
+	backoff := d.Backoff << (repair.attempts - 1)
+	if backoff > d.MaxBackoff || backoff <= 0 {
+		backoff = d.MaxBackoff
+	}
+	delay := repair.lastAttempt.Add(backoff).Sub(now)
+	if delay < 0 {
+		delay = 0
+	}
+	return delay, true
+}
+
+// Attempt saves a repair attempt.
+func (d *DriftRepairs) Attempt(moduleName string, now time.Time) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	repair := d.get(moduleName)
+	repair.attempts++
+	repair.lastAttempt = now
+}
+
+// Attempts returns a number of repair attempts for the current drift.
+func (d *DriftRepairs) Attempts(moduleName string) int {
+	d.m.Lock()
+	defer d.m.Unlock()
+	if repair, has := d.modules[moduleName]; has {
+		return repair.attempts
+	}
+	return 0
+}
+
+// Retry calls fn after the delay. It returns false if the retry is already scheduled.
+func (d *DriftRepairs) Retry(moduleName string, delay time.Duration, fn func()) bool {
+	d.m.Lock()
+	defer d.m.Unlock()
+	repair := d.get(moduleName)
+	if repair.retry != nil {
+		return false
+	}
+	repair.retry = time.AfterFunc(delay, func() {
+		d.m.Lock()
+		repair.retry = nil
+		d.m.Unlock()
+		fn()
+	})
+	return true
+}
+
+// Reset forgets attempts when the drift is resolved.
+func (d *DriftRepairs) Reset(moduleName string) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	repair, has := d.modules[moduleName]
+	if !has {
+		return
+	}
+	if repair.retry != nil {
+		repair.retry.Stop()
+	}
+	delete(d.modules, moduleName)
+}
+
+func (d *DriftRepairs) get(moduleName string) *driftRepair {
+	repair, has := d.modules[moduleName]
+	if !has {
+		repair = &driftRepair{}
+		d.modules[moduleName] = repair
+	}
+	return repair
+}
@@ -0,0 +1,53 @@
+package addon_operator
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_DriftRepairs(t *testing.T) {
+	g := NewWithT(t)
+
+	d := NewDriftRepairs(3, time.Minute, 3*time.Minute)
+	now := time.Now()
+
+	// First repair is not delayed.
+	delay, ok := d.Next("module-a", now)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(delay).To(Equal(time.Duration(0)))
+	d.Attempt("module-a", now)
+
+	delay, ok = d.Next("module-a", now.Add(10*time.Second))
+	g.Expect(ok).To(BeTrue())
+	g.Expect(delay).To(Equal(50 * time.Second))
+
+	// Backoff is doubled.
+	now = now.Add(time.Minute)
+	d.Attempt("module-a", now)
+	delay, ok = d.Next("module-a", now)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(delay).To(Equal(2 * time.Minute))
+
+	// Attempts are exhausted.
+	d.Attempt("module-a", now.Add(2*time.Minute))
+	_, ok = d.Next("module-a", now.Add(time.Hour))
+	g.Expect(ok).To(BeFalse())
+	g.Expect(d.Attempts("module-a")).To(Equal(3))
+
+	// Other modules are not affected.
+	delay, ok = d.Next("module-b", now)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(delay).To(Equal(time.Duration(0)))
+
+	// Retry is scheduled once and is canceled when drift is resolved.
+	called := make(chan struct{}, 2)
+	g.Expect(d.Retry("module-a", time.Hour, func() { called <- struct{}{} })).To(BeTrue())
+	g.Expect(d.Retry("module-a", time.Hour, func() { called <- struct{}{} })).To(BeFalse())
+	d.Reset("module-a")
+	g.Expect(d.Attempts("module-a")).To(Equal(0))
+	g.Expect(d.Retry("module-a", time.Millisecond, func() { called <- struct{}{} })).To(BeTrue())
+	g.Eventually(called, "1s").Should(Receive())
+	g.Consistently(called, "100ms").ShouldNot(Receive())
+}
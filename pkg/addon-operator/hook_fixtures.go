@@ -0,0 +1,223 @@
+package addon_operator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	sh_app "github.com/flant/shell-operator/pkg/app"
+	"github.com/pmezard/go-difflib/difflib"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+
+	"github.com/flant/addon-operator/pkg/app"
+	"github.com/flant/addon-operator/pkg/module_manager"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// Input files of a hook test case directory.
+const (
+	hookFixtureBindingContextFile = "binding-context.json"
+	hookFixtureValuesFile         = "values.yaml"
+	hookFixtureConfigValuesFile   = "config-values.yaml"
+)
+
+// Golden files with outputs of the hook. An absent golden file means an empty output.
+const (
+	hookGoldenValuesPatchFile       = "values-patch.yaml"
+	hookGoldenConfigValuesPatchFile = "config-values-patch.yaml"
+	hookGoldenMetricsFile           = "metrics.yaml"
+	hookGoldenKubernetesPatchFile   = "kubernetes-patch.yaml"
+)
+
+var hookGoldenFiles = []string{
+	hookGoldenValuesPatchFile,
+	hookGoldenConfigValuesPatchFile,
+	hookGoldenMetricsFile,
+	hookGoldenKubernetesPatchFile,
+}
+
+// TestHook runs a shell hook with fixtures from test case directories and compares outputs with golden files.
+func TestHook() error {
+	if err := os.MkdirAll(sh_app.TempDir, os.FileMode(0777)); err != nil {
+		return fmt.Errorf("create temp dir: %v", err)
+	}
+	tempDir, err := ioutil.TempDir(sh_app.TempDir, "hook-test-")
+	if err != nil {
+		return fmt.Errorf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	mm := module_manager.NewMainModuleManager()
+	mm.WithDirectories(app.HookTestModulesDir, app.HookTestGlobalHooksDir, tempDir)
+
+	failed := 0
+	for _, caseDir := range app.HookTestCases {
+		logEntry := log.WithField("hook", app.HookTestName).WithField("case", caseDir)
+
+		diff, err := runHookTestCase(mm, app.HookTestName, caseDir, app.HookTestUpdateGolden)
+		if err != nil {
+			failed++
+			logEntry.Errorf("Hook test failed: %v", err)
+			continue
+		}
+		if diff != "" {
+			failed++
+			fmt.Print(diff)
+			logEntry.Errorf("Hook outputs differ from golden files")
+			continue
+		}
+		logEntry.Infof("Hook test passed")
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d hook test cases failed", failed, len(app.HookTestCases))
+	}
+	return nil
+}
+
+type hookFixtureRunner interface {
+	RunHookWithFixture(hookName string, fixture module_manager.HookFixture) (*module_manager.HookResult, error)
+}
+
+// runHookTestCase runs the hook with fixtures from caseDir and returns a diff with golden files.
+// Golden files are rewritten if update is true.
+func runHookTestCase(mm hookFixtureRunner, hookName string, caseDir string, update bool) (string, error) {
+	fixture, err := loadHookFixture(caseDir)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := mm.RunHookWithFixture(hookName, *fixture)
+	if err != nil {
+		return "", fmt.Errorf("run hook: %v", err)
+	}
+
+	outputs, err := hookOutputs(result)
+	if err != nil {
+		return "", err
+	}
+
+	diffs := make([]string, 0)
+	for _, fileName := range hookGoldenFiles {
+		path := filepath.Join(caseDir, fileName)
+
+		if update {
+			if err := writeGoldenFile(path, outputs[fileName]); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		expected, err := readOptionalFile(path)
+		if err != nil {
+			return "", err
+		}
+		if string(expected) == outputs[fileName] {
+			continue
+		}
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(string(expected)),
+			B:        difflib.SplitLines(outputs[fileName]),
+			FromFile: path,
+			ToFile:   "hook output",
+			Context:  3,
+		})
+		if err != nil {
+			return "", err
+		}
+		diffs = append(diffs, diff)
+	}
+
+	return strings.Join(diffs, ""), nil
+}
+
+func loadHookFixture(caseDir string) (*module_manager.HookFixture, error) {
+	bindingContext, err := ioutil.ReadFile(filepath.Join(caseDir, hookFixtureBindingContextFile))
+	if err != nil {
+		return nil, fmt.Errorf("read binding context: %v", err)
+	}
+
+	fixture := &module_manager.HookFixture{BindingContext: bindingContext}
+
+	for fileName, values := range map[string]*utils.Values{
+		hookFixtureValuesFile:       &fixture.Values,
+		hookFixtureConfigValuesFile: &fixture.ConfigValues,
+	} {
+		data, err := readOptionalFile(filepath.Join(caseDir, fileName))
+		if err != nil {
+			return nil, err
+		}
+		*values, err = utils.NewValuesFromBytes(data)
+		if err != nil {
+			return nil, fmt.Errorf("load %s: %v", fileName, err)
+		}
+	}
+
+	return fixture, nil
+}
+
+// hookOutputs returns outputs of the hook in the format of golden files.
+func hookOutputs(result *module_manager.HookResult) (map[string]string, error) {
+	outputs := make(map[string]string)
+
+	toYaml := func(fileName string, obj interface{}, isEmpty bool) error {
+		if isEmpty {
+			outputs[fileName] = ""
+			return nil
+		}
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return fmt.Errorf("marshal %s: %v", fileName, err)
+		}
+		outputs[fileName] = string(data)
+		return nil
+	}
+
+	for fileName, patchType := range map[string]utils.ValuesPatchType{
+		hookGoldenValuesPatchFile:       utils.MemoryValuesPatch,
+		hookGoldenConfigValuesPatchFile: utils.ConfigMapPatch,
+	} {
+		var operations []*utils.ValuesPatchOperation
+		if patch := result.Patches[patchType]; patch != nil {
+			operations = patch.Operations
+		}
+		if err := toYaml(fileName, operations, len(operations) == 0); err != nil {
+			return nil, err
+		}
+	}
+	if err := toYaml(hookGoldenMetricsFile, result.Metrics, len(result.Metrics) == 0); err != nil {
+		return nil, err
+	}
+
+	// Kubernetes patch can be a stream of JSON objects or YAML documents, so it is compared as is.
+	kubernetesPatch := strings.TrimSpace(string(result.KubernetesPatchBytes))
+	if kubernetesPatch != "" {
+		kubernetesPatch += "\n"
+	}
+	outputs[hookGoldenKubernetesPatchFile] = kubernetesPatch
+
+	return outputs, nil
+}
+
+// readOptionalFile returns nil if the file is absent.
+func readOptionalFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// writeGoldenFile writes the output or removes the file if the output is empty.
+func writeGoldenFile(path string, output string) error {
+	if output == "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return ioutil.WriteFile(path, []byte(output), 0644)
+}
@@ -0,0 +1,58 @@
+package addon_operator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/flant/addon-operator/pkg/module_manager"
+)
+
+func Test_RunHookTestCase(t *testing.T) {
+	g := NewWithT(t)
+
+	rootDir := filepath.Join("testdata", "hook_test")
+	mm := module_manager.NewMainModuleManager()
+	mm.WithDirectories(filepath.Join(rootDir, "modules"), filepath.Join(rootDir, "global-hooks"), t.TempDir())
+
+	hookName := "001-module/hooks/hook.sh"
+
+	for _, caseName := range []string{"sync", "event"} {
+		diff, err := runHookTestCase(mm, hookName, filepath.Join(rootDir, "cases", caseName), false)
+		g.Expect(err).ShouldNot(HaveOccurred(), caseName)
+		g.Expect(diff).To(BeEmpty(), caseName)
+	}
+
+	// Golden files of the 'sync' case copied with a wrong values patch and a stale kubernetes patch.
+	caseDir := t.TempDir()
+	for _, fileName := range []string{hookFixtureBindingContextFile, hookFixtureValuesFile, hookFixtureConfigValuesFile, hookGoldenMetricsFile} {
+		data, err := ioutil.ReadFile(filepath.Join(rootDir, "cases", "sync", fileName))
+		g.Expect(err).ShouldNot(HaveOccurred())
+		g.Expect(ioutil.WriteFile(filepath.Join(caseDir, fileName), data, 0644)).Should(Succeed())
+	}
+	g.Expect(ioutil.WriteFile(filepath.Join(caseDir, hookGoldenValuesPatchFile), []byte("operations: []\n"), 0644)).Should(Succeed())
+	g.Expect(ioutil.WriteFile(filepath.Join(caseDir, hookGoldenKubernetesPatchFile), []byte("{}\n"), 0644)).Should(Succeed())
+
+	diff, err := runHookTestCase(mm, hookName, caseDir, false)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(diff).To(ContainSubstring(hookGoldenValuesPatchFile))
+	g.Expect(diff).To(ContainSubstring(hookGoldenKubernetesPatchFile))
+	g.Expect(diff).ToNot(ContainSubstring(hookGoldenMetricsFile))
+
+	// Update mode rewrites golden files and removes files for empty outputs.
+	diff, err = runHookTestCase(mm, hookName, caseDir, true)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(diff).To(BeEmpty())
+	_, err = os.Stat(filepath.Join(caseDir, hookGoldenKubernetesPatchFile))
+	g.Expect(os.IsNotExist(err)).To(BeTrue())
+
+	diff, err = runHookTestCase(mm, hookName, caseDir, false)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(diff).To(BeEmpty())
+
+	_, err = runHookTestCase(mm, "001-module/hooks/unknown.sh", caseDir, false)
+	g.Expect(err).Should(HaveOccurred())
+}
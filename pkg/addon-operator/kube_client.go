@@ -1,9 +1,13 @@
 package addon_operator
 
 import (
+	"fmt"
+
 	"github.com/flant/addon-operator/pkg/app"
 	klient "github.com/flant/kube-client/client"
 	sh_app "github.com/flant/shell-operator/pkg/app"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 // Important! These labels should be consistent with similar labels in ShellOperator!
@@ -29,3 +33,21 @@ func (op *AddonOperator) InitHelmMonitorKubeClient() (klient.Client, error) {
 	}
 	return client, nil
 }
+
+// InitHelmMonitorMetadataClient initializes a client for informers of helm monitor.
+// Informers request only metadata of objects, so API server does not send full objects.
+// Config is loaded the same way as for the kube client: from kubeconfig or from in-cluster environment.
+func (op *AddonOperator) InitHelmMonitorMetadataClient() (metadata.Interface, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = sh_app.KubeConfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: sh_app.KubeContext}
+
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes config: %s", err)
+	}
+	config.QPS = app.HelmMonitorKubeClientQps
+	config.Burst = app.HelmMonitorKubeClientBurst
+
+	return metadata.NewForConfig(config)
+}
@@ -0,0 +1,164 @@
+package addon_operator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/flant/addon-operator/pkg/app"
+)
+
+// WarmBindingsEventsDropPeriod is a period to drop events saved by warm monitors on a standby replica.
+const WarmBindingsEventsDropPeriod = time.Minute
+
+// LeaderElection holds the Lease in the namespace of addon-operator. Only the leader
+// starts queues, schedules, helm and hooks. Standby replicas are initialized the same way
+// as the leader (modules and hooks are loaded, config values are read, clients are ready),
+// discover modules and keep informers for kubernetes bindings warm, so the leader
+// starts to handle events without waiting for the initial List of monitored resources.
+type LeaderElection struct {
+	elector  *leaderelection.LeaderElector
+	identity string
+	isLeader int32
+	stopping int32
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// InitLeaderElection creates a LeaderElection for the Lease from app settings. onStartedLeading
+// is called once when the Lease is acquired.
+func (op *AddonOperator) InitLeaderElection(onStartedLeading func()) error {
+	identity := app.LeaderElectionIdentity
+	if identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("get hostname for leader election identity: %v", err)
+		}
+		identity = hostname
+	}
+
+	le := &LeaderElection{
+		identity: identity,
+		done:     make(chan struct{}),
+	}
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta: metav1.ObjectMeta{
+				Name:      app.LeaderElectionLeaseName,
+				Namespace: app.Namespace,
+			},
+			Client: op.KubeClient.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{
+				Identity: identity,
+			},
+		},
+		LeaseDuration:   app.LeaderElectionLeaseDuration,
+		RenewDeadline:   app.LeaderElectionRenewDeadline,
+		RetryPeriod:     app.LeaderElectionRetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            app.LeaderElectionLeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(_ context.Context) {
+				log.Infof("Leader election: Lease '%s' is acquired by '%s'", app.LeaderElectionLeaseName, identity)
+				atomic.StoreInt32(&le.isLeader, 1)
+				op.MetricStorage.GaugeSet("{PREFIX}leader", 1.0, map[string]string{})
+				onStartedLeading()
+			},
+			OnStoppedLeading: func() {
+				wasLeader := atomic.SwapInt32(&le.isLeader, 0) == 1
+				op.MetricStorage.GaugeSet("{PREFIX}leader", 0.0, map[string]string{})
+				if atomic.LoadInt32(&le.stopping) == 1 {
+					log.Infof("Leader election: stopped")
+					return
+				}
+				if wasLeader {
+					// Queues and informers can not be stopped gracefully, so restart the process as a standby replica.
+					log.Errorf("Leader election: Lease '%s' is lost, exit", app.LeaderElectionLeaseName)
+					os.Exit(1)
+				}
+			},
+			OnNewLeader: func(identity string) {
+				log.Infof("Leader election: current leader is '%s'", identity)
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("init leader election: %v", err)
+	}
+	le.elector = elector
+
+	op.LeaderElection = le
+	return nil
+}
+
+// StartStandby starts monitors for kubernetes bindings of global hooks and discovered modules
+// before the Lease is acquired. Events are not handled until Start is called by the leader.
+func (op *AddonOperator) StartStandby() {
+	logEntry := log.WithField("operator.component", "standby")
+	err := op.ModuleManager.WarmUpKubernetesBindings(map[string]string{"operator.component": "standby"})
+	if err != nil {
+		// Not fatal: the leader starts monitors that are not warm.
+		logEntry.Errorf("Warm up kubernetes bindings: %v", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(WarmBindingsEventsDropPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-op.ctx.Done():
+				return
+			case <-ticker.C:
+				if op.LeaderElection != nil && op.LeaderElection.IsLeader() {
+					return
+				}
+				op.ModuleManager.DropWarmKubernetesEvents()
+			}
+		}
+	}()
+}
+
+// Start runs the election loop in background.
+func (le *LeaderElection) Start(ctx context.Context) {
+	ctx, le.cancel = context.WithCancel(ctx)
+	go func() {
+		defer close(le.done)
+		le.elector.Run(ctx)
+	}()
+}
+
+// Stop releases the Lease, so a standby replica can take over without waiting for the Lease expiration.
+func (le *LeaderElection) Stop(timeout time.Duration) {
+	if le.cancel == nil {
+		return
+	}
+	atomic.StoreInt32(&le.stopping, 1)
+	le.cancel()
+	select {
+	case <-le.done:
+	case <-time.After(timeout):
+		log.Warnf("Leader election: Lease is not released in %s", timeout)
+	}
+}
+
+func (le *LeaderElection) IsLeader() bool {
+	return atomic.LoadInt32(&le.isLeader) == 1
+}
+
+// Leader returns an identity of the current leader or an empty string if the leader is unknown.
+func (le *LeaderElection) Leader() string {
+	return le.elector.GetLeader()
+}
+
+func (le *LeaderElection) Identity() string {
+	return le.identity
+}
@@ -0,0 +1,61 @@
+package addon_operator
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	klient "github.com/flant/kube-client/client"
+	"github.com/flant/shell-operator/pkg/metric_storage"
+	. "github.com/onsi/gomega"
+
+	"github.com/flant/addon-operator/pkg/app"
+)
+
+func Test_LeaderElection_Takeover(t *testing.T) {
+	g := NewWithT(t)
+
+	defer func(namespace string, leaseDuration, renewDeadline, retryPeriod time.Duration) {
+		app.Namespace = namespace
+		app.LeaderElectionLeaseDuration = leaseDuration
+		app.LeaderElectionRenewDeadline = renewDeadline
+		app.LeaderElectionRetryPeriod = retryPeriod
+		app.LeaderElectionIdentity = ""
+	}(app.Namespace, app.LeaderElectionLeaseDuration, app.LeaderElectionRenewDeadline, app.LeaderElectionRetryPeriod)
+	app.Namespace = "addon-operator"
+	app.LeaderElectionLeaseDuration = 10 * time.Second
+	app.LeaderElectionRenewDeadline = 5 * time.Second
+	app.LeaderElectionRetryPeriod = 100 * time.Millisecond
+
+	kubeClient := klient.NewFake(nil)
+
+	newReplica := func(identity string, started *int32) *AddonOperator {
+		op := NewAddonOperator()
+		op.WithContext(context.Background())
+		op.KubeClient = kubeClient
+		op.MetricStorage = metric_storage.NewMetricStorage()
+		app.LeaderElectionIdentity = identity
+		g.Expect(op.InitLeaderElection(func() { atomic.AddInt32(started, 1) })).Should(Succeed())
+		return op
+	}
+
+	var firstStarted, secondStarted int32
+	first := newReplica("replica-1", &firstStarted)
+	first.LeaderElection.Start(first.ctx)
+	g.Eventually(first.LeaderElection.IsLeader, "5s", "50ms").Should(BeTrue())
+
+	second := newReplica("replica-2", &secondStarted)
+	second.LeaderElection.Start(second.ctx)
+	g.Eventually(second.LeaderElection.Leader, "5s", "50ms").Should(Equal("replica-1"))
+	g.Consistently(second.LeaderElection.IsLeader, "500ms", "50ms").Should(BeFalse())
+	g.Expect(atomic.LoadInt32(&secondStarted)).To(Equal(int32(0)))
+
+	// Stopped leader releases the Lease, so the standby takes over before the Lease expiration.
+	first.LeaderElection.Stop(5 * time.Second)
+	g.Eventually(second.LeaderElection.IsLeader, "5s", "50ms").Should(BeTrue())
+	g.Expect(atomic.LoadInt32(&firstStarted)).To(Equal(int32(1)))
+	g.Expect(atomic.LoadInt32(&secondStarted)).To(Equal(int32(1)))
+
+	second.LeaderElection.Stop(5 * time.Second)
+}
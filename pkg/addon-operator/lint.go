@@ -0,0 +1,145 @@
+package addon_operator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/flant/addon-operator/pkg/app"
+	"github.com/flant/addon-operator/pkg/module_manager"
+)
+
+// LintModules checks modules and global hooks directories without starting anything.
+// Issues are printed to stdout in the format from the --output flag.
+// An error is returned if there are issues with the error level.
+func LintModules() error {
+	mm := module_manager.NewMainModuleManager()
+	mm.WithDirectories(app.LintModulesDir, app.LintGlobalHooksDir, "")
+
+	issues := mm.Lint()
+
+	var err error
+	switch app.LintOutputFormat {
+	case "json":
+		err = writeLintJSON(os.Stdout, issues)
+	case "sarif":
+		err = writeLintSARIF(os.Stdout, issues)
+	default:
+		err = writeLintText(os.Stdout, issues)
+	}
+	if err != nil {
+		return fmt.Errorf("write lint results: %v", err)
+	}
+
+	if errorsCount := module_manager.LintErrorsCount(issues); errorsCount > 0 {
+		return fmt.Errorf("modules tree has %d errors", errorsCount)
+	}
+	return nil
+}
+
+func writeLintText(w io.Writer, issues []module_manager.LintIssue) error {
+	for _, issue := range issues {
+		subject := issue.Path
+		if issue.Module != "" {
+			subject = fmt.Sprintf("module '%s': %s", issue.Module, subject)
+		}
+		if _, err := fmt.Fprintf(w, "%s [%s] %s: %s\n", issue.Level, issue.Rule, subject, issue.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeLintJSON(w io.Writer, issues []module_manager.LintIssue) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(issues)
+}
+
+// SARIF 2.1.0 log with a subset of fields used by code scanning tools.
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name    string      `json:"name"`
+	Version string      `json:"version"`
+	Rules   []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+func writeLintSARIF(w io.Writer, issues []module_manager.LintIssue) error {
+	rules := make([]sarifRule, 0, len(module_manager.LintRules))
+	for id, description := range module_manager.LintRules {
+		rules = append(rules, sarifRule{ID: id, ShortDescription: sarifMessage{Text: description}})
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].ID < rules[j].ID
+	})
+
+	results := make([]sarifResult, 0, len(issues))
+	for _, issue := range issues {
+		result := sarifResult{
+			RuleID:  issue.Rule,
+			Level:   issue.Level,
+			Message: sarifMessage{Text: issue.Message},
+		}
+		if issue.Path != "" {
+			result.Locations = []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: issue.Path}},
+			}}
+		}
+		results = append(results, result)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs: []sarifRun{{
+			Tool:    sarifTool{Driver: sarifDriver{Name: app.AppName, Version: app.Version, Rules: rules}},
+			Results: results,
+		}},
+	})
+}
@@ -0,0 +1,47 @@
+package addon_operator
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/flant/addon-operator/pkg/module_manager"
+)
+
+func Test_WriteLintSARIF(t *testing.T) {
+	g := NewWithT(t)
+
+	issues := []module_manager.LintIssue{
+		{
+			Rule:    module_manager.LintRuleEnabledScript,
+			Level:   module_manager.LintLevelError,
+			Message: "enabled script is not executable",
+			Path:    "modules/010-module/enabled",
+			Module:  "module",
+		},
+		{
+			Rule:    module_manager.LintRuleModuleDependencies,
+			Level:   module_manager.LintLevelError,
+			Message: "modules dependency cycle",
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	g.Expect(writeLintSARIF(buf, issues)).Should(Succeed())
+
+	var res sarifLog
+	g.Expect(json.Unmarshal(buf.Bytes(), &res)).Should(Succeed())
+	g.Expect(res.Version).To(Equal("2.1.0"))
+	g.Expect(res.Runs).To(HaveLen(1))
+	g.Expect(res.Runs[0].Tool.Driver.Rules).To(HaveLen(len(module_manager.LintRules)))
+
+	results := res.Runs[0].Results
+	g.Expect(results).To(HaveLen(2))
+	g.Expect(results[0].RuleID).To(Equal(module_manager.LintRuleEnabledScript))
+	g.Expect(results[0].Level).To(Equal("error"))
+	g.Expect(results[0].Locations).To(HaveLen(1))
+	g.Expect(results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI).To(Equal("modules/010-module/enabled"))
+	g.Expect(results[1].Locations).To(BeEmpty())
+}
@@ -0,0 +1,246 @@
+package addon_operator
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	sh_task "github.com/flant/shell-operator/pkg/task"
+	log "github.com/sirupsen/logrus"
+
+	. "github.com/flant/shell-operator/pkg/hook/binding_context"
+	. "github.com/flant/shell-operator/pkg/hook/types"
+
+	"github.com/flant/addon-operator/pkg/task"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+type MaintenanceMode string
+
+const (
+	// MaintenanceOff is a normal operation.
+	MaintenanceOff MaintenanceMode = "off"
+	// MaintenanceHelm suspends helm upgrades and deletes: ModuleRun, ModuleDelete and ModulePurge tasks.
+	MaintenanceHelm MaintenanceMode = "helm"
+	// MaintenanceAll suspends helm upgrades and deletes and runs of all hooks.
+	MaintenanceAll MaintenanceMode = "all"
+)
+
+func ParseMaintenanceMode(mode string) (MaintenanceMode, error) {
+	switch MaintenanceMode(mode) {
+	case "", MaintenanceOff:
+		return MaintenanceOff, nil
+	case MaintenanceHelm, MaintenanceAll:
+		return MaintenanceMode(mode), nil
+	}
+	return MaintenanceOff, fmt.Errorf("unknown maintenance mode '%s', expect one of: off, helm, all", mode)
+}
+
+// Maintenance keeps the maintenance mode and tasks deferred until the maintenance ends.
+// Informers, schedules and queues keep working in maintenance mode.
+type Maintenance struct {
+	m       sync.Mutex
+	mode    MaintenanceMode
+	since   time.Time
+	pending []sh_task.Task
+}
+
+func NewMaintenance() *Maintenance {
+	return &Maintenance{
+		mode:    MaintenanceOff,
+		pending: make([]sh_task.Task, 0),
+	}
+}
+
+func (mt *Maintenance) Mode() MaintenanceMode {
+	mt.m.Lock()
+	defer mt.m.Unlock()
+	return mt.mode
+}
+
+func (mt *Maintenance) Since() time.Time {
+	mt.m.Lock()
+	defer mt.m.Unlock()
+	return mt.since
+}
+
+// SetMode changes the maintenance mode and returns the previous mode.
+// Deferred tasks are returned when the maintenance ends.
+func (mt *Maintenance) SetMode(mode MaintenanceMode) (MaintenanceMode, []sh_task.Task) {
+	mt.m.Lock()
+	defer mt.m.Unlock()
+	prevMode := mt.mode
+	if prevMode == mode {
+		return prevMode, nil
+	}
+	mt.mode = mode
+	if mode != MaintenanceOff {
+		mt.since = time.Now()
+		return prevMode, nil
+	}
+	mt.since = time.Time{}
+	pending := mt.pending
+	mt.pending = make([]sh_task.Task, 0)
+	return prevMode, pending
+}
+
+// shouldDefer returns true if the task should not run in the maintenance mode.
+func shouldDefer(mode MaintenanceMode, t sh_task.Task) bool {
+	switch t.GetType() {
+	case task.ModuleRun, task.ModuleDelete, task.ModulePurge:
+		return mode != MaintenanceOff
+	case task.GlobalHookRun, task.ModuleHookRun:
+		return mode == MaintenanceAll
+	}
+	return false
+}
+
+// Defer saves the task to run after the maintenance. It returns false if the task should run
+// in the current mode. Deferred runs are collapsed: ModuleRun and ModuleDelete replace previous
+// ModuleRun and ModuleDelete of the same module, and a hook run replaces the previous run
+// of the same schedule binding. Binding contexts of kubernetes events are merged into the last
+// run of the same hook binding, so the hook gets all events. Synchronization is not collapsed.
+func (mt *Maintenance) Defer(t sh_task.Task) bool {
+	mt.m.Lock()
+	defer mt.m.Unlock()
+
+	if !shouldDefer(mt.mode, t) {
+		return false
+	}
+
+	key := maintenanceTaskKey(t)
+	if key == "" {
+		mt.pending = append(mt.pending, t)
+		return true
+	}
+
+	pending := make([]sh_task.Task, 0, len(mt.pending)+1)
+	for _, pt := range mt.pending {
+		if maintenanceTaskKey(pt) != key {
+			pending = append(pending, pt)
+			continue
+		}
+		// Keep onStartup hooks of the first ModuleRun.
+		if t.GetType() == task.ModuleRun && pt.GetType() == task.ModuleRun {
+			hm := task.HookMetadataAccessor(t)
+			if task.HookMetadataAccessor(pt).OnStartupHooks && !hm.OnStartupHooks {
+				hm.OnStartupHooks = true
+				t.UpdateMetadata(hm)
+			}
+		}
+		// Keep events of the previous run.
+		if isHookRun(t) && task.HookMetadataAccessor(t).BindingType != Schedule {
+			prevHm := task.HookMetadataAccessor(pt)
+			hm := task.HookMetadataAccessor(t)
+			hm.BindingContext = append(append([]BindingContext{}, prevHm.BindingContext...), hm.BindingContext...)
+			hm.MonitorIDs = append(append([]string{}, prevHm.MonitorIDs...), hm.MonitorIDs...)
+			t.UpdateMetadata(hm)
+		}
+	}
+	mt.pending = append(pending, t)
+	return true
+}
+
+// Pending returns deferred tasks.
+func (mt *Maintenance) Pending() []sh_task.Task {
+	mt.m.Lock()
+	defer mt.m.Unlock()
+	return append([]sh_task.Task{}, mt.pending...)
+}
+
+func isHookRun(t sh_task.Task) bool {
+	return t.GetType() == task.GlobalHookRun || t.GetType() == task.ModuleHookRun
+}
+
+func maintenanceTaskKey(t sh_task.Task) string {
+	hm := task.HookMetadataAccessor(t)
+	switch t.GetType() {
+	case task.ModuleRun, task.ModuleDelete:
+		return "module/" + hm.ModuleName
+	case task.ModulePurge:
+		return "purge/" + hm.ModuleName
+	case task.GlobalHookRun, task.ModuleHookRun:
+		if hm.IsSynchronization() || len(hm.BindingContext) == 0 {
+			return ""
+		}
+		return "hook/" + hm.HookName + "/" + hm.BindingContext[0].Binding
+	}
+	return ""
+}
+
+// SetMaintenanceMode changes the maintenance mode. Deferred tasks are queued at the
+// head of their queues in the original order when the maintenance ends.
+func (op *AddonOperator) SetMaintenanceMode(mode MaintenanceMode) {
+	prevMode, pending := op.Maintenance.SetMode(mode)
+	if prevMode == mode {
+		return
+	}
+
+	for _, m := range []MaintenanceMode{MaintenanceHelm, MaintenanceAll} {
+		value := 0.0
+		if m == mode {
+			value = 1.0
+		}
+		op.MetricStorage.GaugeSet("{PREFIX}maintenance", value, map[string]string{"mode": string(m)})
+	}
+	op.MetricStorage.GaugeSet("{PREFIX}maintenance_pending_tasks", float64(len(op.Maintenance.Pending())), map[string]string{})
+
+	if mode != MaintenanceOff {
+		log.Warnf("Maintenance mode '%s' is started", mode)
+		return
+	}
+	log.Infof("Maintenance mode '%s' is finished, queue %d deferred tasks", prevMode, len(pending))
+
+	for i := len(pending) - 1; i >= 0; i-- {
+		t := pending[i]
+		q := op.TaskQueues.GetByName(t.GetQueueName())
+		if q == nil {
+			log.WithFields(utils.LabelsToLogFields(t.GetLogLabels())).
+				Warnf("Deferred task %s is dropped: queue '%s' is not found", t.GetDescription(), t.GetQueueName())
+			continue
+		}
+		if t.GetType() == task.ModuleRun {
+			// There is no ParallelModuleRunsWait task for the deferred ModuleRun.
+			hm := task.HookMetadataAccessor(t)
+			hm.ParallelHelmPhase = false
+			t.UpdateMetadata(hm)
+		}
+		q.AddFirst(t.WithQueuedAt(time.Now()))
+	}
+}
+
+// DeferMaintenanceTask saves the task to run after the maintenance. It returns
+// true if the task is deferred and should be removed from the queue.
+func (op *AddonOperator) DeferMaintenanceTask(t sh_task.Task, logLabels map[string]string) bool {
+	if !op.Maintenance.Defer(t) {
+		return false
+	}
+	op.MetricStorage.GaugeSet("{PREFIX}maintenance_pending_tasks", float64(len(op.Maintenance.Pending())), map[string]string{})
+	log.WithFields(utils.LabelsToLogFields(logLabels)).
+		Infof("Maintenance mode '%s', defer task %s", op.Maintenance.Mode(), t.GetDescription())
+	return true
+}
+
+// MaintenanceStatus returns the maintenance mode and deferred tasks for the debug endpoint.
+func (op *AddonOperator) MaintenanceStatus() map[string]interface{} {
+	pendingTasks := make([]map[string]string, 0)
+	for _, t := range op.Maintenance.Pending() {
+		hm := task.HookMetadataAccessor(t)
+		pendingTasks = append(pendingTasks, map[string]string{
+			"queue":       t.GetQueueName(),
+			"type":        string(t.GetType()),
+			"module":      hm.ModuleName,
+			"hook":        hm.HookName,
+			"description": t.GetDescription(),
+		})
+	}
+
+	status := map[string]interface{}{
+		"mode":         op.Maintenance.Mode(),
+		"pendingTasks": pendingTasks,
+	}
+	if since := op.Maintenance.Since(); !since.IsZero() {
+		status["since"] = since.Format(time.RFC3339)
+	}
+	return status
+}
@@ -0,0 +1,131 @@
+package addon_operator
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/flant/shell-operator/pkg/hook/binding_context"
+	. "github.com/flant/shell-operator/pkg/hook/types"
+	. "github.com/flant/shell-operator/pkg/kube_events_manager/types"
+	"github.com/flant/shell-operator/pkg/metric_storage"
+	sh_task "github.com/flant/shell-operator/pkg/task"
+	"github.com/flant/shell-operator/pkg/task/queue"
+	. "github.com/onsi/gomega"
+
+	"github.com/flant/addon-operator/pkg/task"
+)
+
+func Test_ParseMaintenanceMode(t *testing.T) {
+	g := NewWithT(t)
+
+	mode, err := ParseMaintenanceMode("")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(mode).To(Equal(MaintenanceOff))
+
+	mode, err = ParseMaintenanceMode("all")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(mode).To(Equal(MaintenanceAll))
+
+	_, err = ParseMaintenanceMode("on")
+	g.Expect(err).Should(HaveOccurred())
+}
+
+func Test_Maintenance_DeferAndResume(t *testing.T) {
+	g := NewWithT(t)
+
+	// Queues are not started with the canceled context, so tasks stay in queues.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	op := NewAddonOperator()
+	op.MetricStorage = metric_storage.NewMetricStorage()
+	op.TaskQueues = queue.NewTaskQueueSet()
+	op.TaskQueues.WithContext(ctx)
+	op.TaskQueues.WithMainName("main")
+	op.TaskQueues.NewNamedQueue("main", op.TaskHandler)
+	op.TaskQueues.GetMain().AddLast(sh_task.NewTask(task.DiscoverModulesState))
+
+	newModuleRun := func(moduleName string, onStartup bool) sh_task.Task {
+		return sh_task.NewTask(task.ModuleRun).
+			WithQueueName("main").
+			WithMetadata(task.HookMetadata{ModuleName: moduleName, OnStartupHooks: onStartup, ParallelHelmPhase: true})
+	}
+	newHookRun := func(hookName string, binding string) sh_task.Task {
+		return sh_task.NewTask(task.GlobalHookRun).
+			WithQueueName("main").
+			WithMetadata(task.HookMetadata{HookName: hookName, BindingType: Schedule, BindingContext: []BindingContext{{Binding: binding}}})
+	}
+
+	// Nothing is deferred in normal operation.
+	g.Expect(op.DeferMaintenanceTask(newModuleRun("module-a", false), nil)).To(BeFalse())
+
+	// Only helm tasks are deferred in the 'helm' mode.
+	op.SetMaintenanceMode(MaintenanceHelm)
+	g.Expect(op.DeferMaintenanceTask(newModuleRun("module-a", true), nil)).To(BeTrue())
+	g.Expect(op.DeferMaintenanceTask(newHookRun("hook-a", "schedule"), nil)).To(BeFalse())
+	g.Expect(op.DeferMaintenanceTask(sh_task.NewTask(task.ModuleDelete).
+		WithQueueName("main").
+		WithMetadata(task.HookMetadata{ModuleName: "module-b"}), nil)).To(BeTrue())
+
+	// Hook runs are deferred in the 'all' mode, runs of the same binding are collapsed.
+	op.SetMaintenanceMode(MaintenanceAll)
+	g.Expect(op.DeferMaintenanceTask(newHookRun("hook-a", "schedule"), nil)).To(BeTrue())
+	g.Expect(op.DeferMaintenanceTask(newHookRun("hook-a", "schedule"), nil)).To(BeTrue())
+	// ModuleRun replaces the deferred ModuleRun of the same module and keeps onStartup hooks.
+	g.Expect(op.DeferMaintenanceTask(newModuleRun("module-a", false), nil)).To(BeTrue())
+
+	pending := op.Maintenance.Pending()
+	g.Expect(pending).To(HaveLen(3))
+	g.Expect(pending[0].GetType()).To(Equal(task.ModuleDelete))
+	g.Expect(pending[1].GetType()).To(Equal(task.GlobalHookRun))
+	g.Expect(pending[2].GetType()).To(Equal(task.ModuleRun))
+	g.Expect(task.HookMetadataAccessor(pending[2]).OnStartupHooks).To(BeTrue())
+
+	status := op.MaintenanceStatus()
+	g.Expect(status["mode"]).To(Equal(MaintenanceAll))
+	g.Expect(status["pendingTasks"]).To(HaveLen(3))
+
+	// Deferred tasks are queued at the head of the queue in the original order.
+	op.SetMaintenanceMode(MaintenanceOff)
+	g.Expect(op.Maintenance.Pending()).To(BeEmpty())
+
+	types := make([]sh_task.TaskType, 0)
+	op.TaskQueues.GetMain().Iterate(func(t sh_task.Task) {
+		types = append(types, t.GetType())
+	})
+	g.Expect(types).To(Equal([]sh_task.TaskType{task.ModuleDelete, task.GlobalHookRun, task.ModuleRun, task.DiscoverModulesState}))
+	g.Expect(task.HookMetadataAccessor(pending[2]).ParallelHelmPhase).To(BeFalse())
+}
+
+func Test_Maintenance_DeferEvents(t *testing.T) {
+	g := NewWithT(t)
+
+	mt := NewMaintenance()
+	mt.SetMode(MaintenanceAll)
+
+	newEventRun := func(watchEvent WatchEventType, monitorID string) sh_task.Task {
+		bc := BindingContext{Binding: "pods", Type: TypeEvent, WatchEvent: watchEvent}
+		bc.Metadata.BindingType = OnKubernetesEvent
+		return sh_task.NewTask(task.ModuleHookRun).
+			WithQueueName("main").
+			WithMetadata(task.HookMetadata{
+				HookName:       "module-a/hooks/pods",
+				ModuleName:     "module-a",
+				BindingType:    OnKubernetesEvent,
+				BindingContext: []BindingContext{bc},
+				MonitorIDs:     []string{monitorID},
+			})
+	}
+
+	// Events of the same binding are not lost.
+	g.Expect(mt.Defer(newEventRun(WatchEventAdded, "monitor-1"))).To(BeTrue())
+	g.Expect(mt.Defer(newEventRun(WatchEventDeleted, "monitor-1"))).To(BeTrue())
+
+	pending := mt.Pending()
+	g.Expect(pending).To(HaveLen(1))
+	hm := task.HookMetadataAccessor(pending[0])
+	g.Expect(hm.BindingContext).To(HaveLen(2))
+	g.Expect(hm.BindingContext[0].WatchEvent).To(Equal(WatchEventAdded))
+	g.Expect(hm.BindingContext[1].WatchEvent).To(Equal(WatchEventDeleted))
+	g.Expect(hm.MonitorIDs).To(Equal([]string{"monitor-1", "monitor-1"}))
+}
@@ -16,6 +16,12 @@ func RegisterAddonOperatorMetrics(metricStorage *metric_storage.MetricStorage) {
 		"kind":    "",
 	})
 	RegisterHookMetrics(metricStorage)
+
+	// leader election
+	metricStorage.RegisterGauge("{PREFIX}leader", map[string]string{})
+
+	// state checkpoints
+	metricStorage.RegisterCounter("{PREFIX}state_checkpoint_errors_total", map[string]string{})
 }
 
 var buckets_1msTo10s = []float64{
@@ -76,6 +82,8 @@ func RegisterHookMetrics(metricStorage *metric_storage.MetricStorage) {
 	metricStorage.RegisterCounter("{PREFIX}module_hook_allowed_errors_total", moduleHookLabels)
 	metricStorage.RegisterCounter("{PREFIX}module_hook_errors_total", moduleHookLabels)
 	metricStorage.RegisterCounter("{PREFIX}module_hook_success_total", moduleHookLabels)
+	metricStorage.RegisterCounter("{PREFIX}module_hook_timeouts_total", moduleHookLabels)
+	metricStorage.RegisterCounter("{PREFIX}module_hook_abandoned_total", moduleHookLabels)
 
 	// global hook running
 	globalHookLabels := map[string]string{
@@ -100,6 +108,31 @@ func RegisterHookMetrics(metricStorage *metric_storage.MetricStorage) {
 	metricStorage.RegisterCounter("{PREFIX}global_hook_allowed_errors_total", globalHookLabels)
 	metricStorage.RegisterCounter("{PREFIX}global_hook_errors_total", globalHookLabels)
 	metricStorage.RegisterCounter("{PREFIX}global_hook_success_total", globalHookLabels)
+	metricStorage.RegisterCounter("{PREFIX}global_hook_timeouts_total", globalHookLabels)
+	metricStorage.RegisterCounter("{PREFIX}global_hook_abandoned_total", globalHookLabels)
+
+	// failed tasks with exhausted retry policy
+	metricStorage.RegisterCounter("{PREFIX}task_retries_exhausted_total", map[string]string{
+		"module": "",
+		"hook":   "",
+		"action": "",
+	})
+
+	// modules with ModuleRun tasks in quarantine queues
+	metricStorage.RegisterGauge("{PREFIX}module_quarantined", map[string]string{"module": ""})
+
+	// paused modules
+	metricStorage.RegisterGauge("{PREFIX}module_paused", map[string]string{"module": ""})
+
+	// conflicting modules that keep their current state
+	metricStorage.RegisterGauge("{PREFIX}module_conflict", map[string]string{"module": ""})
+
+	// ModuleDelete and ModulePurge tasks waiting for the deletion confirmation
+	metricStorage.RegisterGauge("{PREFIX}module_deletion_unconfirmed", map[string]string{"module": ""})
+
+	// maintenance mode
+	metricStorage.RegisterGauge("{PREFIX}maintenance", map[string]string{"mode": ""})
+	metricStorage.RegisterGauge("{PREFIX}maintenance_pending_tasks", map[string]string{})
 
 	// converge duration
 	metricStorage.RegisterCounter("{PREFIX}convergence_seconds", map[string]string{"activation": ""})
@@ -113,6 +146,9 @@ func RegisterHookMetrics(metricStorage *metric_storage.MetricStorage) {
 			"activation": "",
 		},
 		buckets_1msTo10s)
+	metricStorage.RegisterCounter("{PREFIX}module_helm_rollbacks_total", map[string]string{"module": "", "policy": ""})
+	metricStorage.RegisterCounter("{PREFIX}module_helm_rollback_errors_total", map[string]string{"module": ""})
+	metricStorage.RegisterGauge("{PREFIX}module_drifted_resources", map[string]string{"module": ""})
 	metricStorage.RegisterHistogram(
 		"{PREFIX}helm_operation_seconds",
 		map[string]string{
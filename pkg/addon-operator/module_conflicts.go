@@ -0,0 +1,36 @@
+package addon_operator
+
+import (
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/flant/addon-operator/pkg/module_events"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// ReportModuleConflicts reports conflicting modules found by DiscoverModulesState. Conflicting
+// modules keep their current state, so the conflict is reported with a metric and an event
+// until one of the modules is disabled in the config. Discovery runs in the main queue, so
+// reported conflicts are not guarded.
+func (op *AddonOperator) ReportModuleConflicts(conflicts map[string][]string, logLabels map[string]string) {
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
+
+	for moduleName, conflictsWith := range conflicts {
+		if _, reported := op.ModuleConflicts[moduleName]; !reported {
+			op.EventRecorder.ModuleEvent(moduleName, v1.EventTypeWarning, module_events.ModuleConflict,
+				"Module conflicts with modules %s, it keeps the current state", strings.Join(conflictsWith, ", "))
+		}
+		logEntry.Warnf("Module '%s' conflicts with modules %v, disable one of them in the config", moduleName, conflictsWith)
+		op.MetricStorage.GaugeSet("{PREFIX}module_conflict", 1.0, map[string]string{"module": moduleName})
+	}
+
+	for moduleName := range op.ModuleConflicts {
+		if _, has := conflicts[moduleName]; !has {
+			op.MetricStorage.GaugeSet("{PREFIX}module_conflict", 0.0, map[string]string{"module": moduleName})
+		}
+	}
+
+	op.ModuleConflicts = conflicts
+}
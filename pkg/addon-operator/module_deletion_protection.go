@@ -0,0 +1,175 @@
+package addon_operator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	sh_task "github.com/flant/shell-operator/pkg/task"
+	"github.com/flant/shell-operator/pkg/task/queue"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/flant/addon-operator/pkg/app"
+	"github.com/flant/addon-operator/pkg/kube_config_manager"
+	"github.com/flant/addon-operator/pkg/module_manager"
+	"github.com/flant/addon-operator/pkg/task"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// DeletionConfirmationAnnotation is an annotation of the config ConfigMap (or GlobalConfig/global
+// for the 'crd' config source) with a comma separated list of modules which releases can be
+// deleted despite the 'confirm' deletion protection.
+const DeletionConfirmationAnnotation = "addon-operator.flant.com/confirm-deletion"
+
+// DeletionConfirmationCheckInterval is a delay between checks of the confirmation annotation.
+var DeletionConfirmationCheckInterval = 15 * time.Second
+
+func DeletionQueueName(moduleName string) string {
+	return fmt.Sprintf("deletion-module-%s", moduleName)
+}
+
+// ProtectModuleDeletion moves ModuleDelete and ModulePurge tasks with the 'confirm' deletion protection
+// into the per-module deletion queue until the deletion is confirmed, so other tasks in the main
+// queue are not blocked. It returns false if the task should run as usual.
+func (op *AddonOperator) ProtectModuleDeletion(t sh_task.Task, logLabels map[string]string) (queue.TaskResult, bool) {
+	if op.deletionProtection(t) != module_manager.DeletionProtectionConfirm {
+		return queue.TaskResult{}, false
+	}
+
+	hm := task.HookMetadataAccessor(t)
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
+	queueName := DeletionQueueName(hm.ModuleName)
+
+	if op.isDeletionCanceled(t) {
+		logEntry.Infof("Module '%s' is enabled again, drop the task %s", hm.ModuleName, t.GetDescription())
+		op.MetricStorage.GaugeSet("{PREFIX}module_deletion_unconfirmed", 0.0, map[string]string{"module": hm.ModuleName})
+		return queue.TaskResult{Status: "Success"}, true
+	}
+
+	confirmed, err := op.IsDeletionConfirmed(hm.ModuleName)
+	if err != nil {
+		logEntry.Errorf("Check deletion confirmation for module '%s': %v", hm.ModuleName, err)
+	}
+	if confirmed {
+		logEntry.Infof("Deletion of module '%s' is confirmed", hm.ModuleName)
+		op.MetricStorage.GaugeSet("{PREFIX}module_deletion_unconfirmed", 0.0, map[string]string{"module": hm.ModuleName})
+		return queue.TaskResult{}, false
+	}
+
+	if t.GetQueueName() == queueName {
+		return queue.TaskResult{Status: "Repeat", DelayBeforeNextTask: DeletionConfirmationCheckInterval}, true
+	}
+
+	logEntry.Warnf("Module '%s' has deletionProtection '%s', wait for the module in the '%s' annotation of %s. Move %s to the queue '%s'",
+		hm.ModuleName, module_manager.DeletionProtectionConfirm, DeletionConfirmationAnnotation, configObjectName(), t.GetType(), queueName)
+	op.MetricStorage.GaugeSet("{PREFIX}module_deletion_unconfirmed", 1.0, map[string]string{"module": hm.ModuleName})
+
+	q := op.TaskQueues.GetByName(queueName)
+	if q == nil {
+		op.TaskQueues.NewNamedQueue(queueName, op.TaskHandler)
+		q = op.TaskQueues.GetByName(queueName)
+		q.Start()
+	}
+
+	hasTask := false
+	q.Iterate(func(qt sh_task.Task) {
+		if qt.GetType() == t.GetType() {
+			hasTask = true
+		}
+	})
+	if !hasTask {
+		newLabels := utils.MergeLabels(t.GetLogLabels(), map[string]string{"queue": queueName})
+		delete(newLabels, "task.id")
+		newTask := sh_task.NewTask(t.GetType()).
+			WithLogLabels(newLabels).
+			WithQueueName(queueName).
+			WithMetadata(hm).
+			WithQueuedAt(time.Now())
+		q.AddLast(newTask)
+	}
+
+	return queue.TaskResult{Status: "Success"}, true
+}
+
+// IsDeletionConfirmed returns true if the module is listed in the confirmation annotation of
+// the config object: the ConfigMap or GlobalConfig/global, depending on the config source.
+func (op *AddonOperator) IsDeletionConfirmed(moduleName string) (bool, error) {
+	annotation, err := op.KubeConfigManager.ConfigAnnotation(DeletionConfirmationAnnotation)
+	if err != nil {
+		return false, err
+	}
+	for _, name := range ParseModuleNames(annotation) {
+		if name == moduleName {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ConsumeDeletionConfirmation removes the module from the confirmation annotation after
+// the confirmed deletion, so the next deletion of the module should be confirmed again.
+func (op *AddonOperator) ConsumeDeletionConfirmation(t sh_task.Task, logLabels map[string]string) {
+	if op.deletionProtection(t) != module_manager.DeletionProtectionConfirm {
+		return
+	}
+	hm := task.HookMetadataAccessor(t)
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
+
+	annotation, err := op.KubeConfigManager.ConfigAnnotation(DeletionConfirmationAnnotation)
+	if err != nil {
+		logEntry.Errorf("Remove deletion confirmation for module '%s': %v", hm.ModuleName, err)
+		return
+	}
+	names := make([]string, 0)
+	for _, name := range ParseModuleNames(annotation) {
+		if name != hm.ModuleName {
+			names = append(names, name)
+		}
+	}
+	err = op.KubeConfigManager.SetConfigAnnotation(DeletionConfirmationAnnotation, strings.Join(names, ","))
+	if err != nil {
+		logEntry.Errorf("Remove deletion confirmation for module '%s': %v", hm.ModuleName, err)
+		return
+	}
+	logEntry.Infof("Deletion confirmation for module '%s' is used and removed", hm.ModuleName)
+}
+
+// deletionProtection returns a protection policy from module.yaml for ModuleDelete
+// and a global policy for ModulePurge, as the module directory is already removed.
+func (op *AddonOperator) deletionProtection(t sh_task.Task) string {
+	hm := task.HookMetadataAccessor(t)
+	switch t.GetType() {
+	case task.ModuleDelete:
+		module := op.ModuleManager.GetModule(hm.ModuleName)
+		if module == nil {
+			return module_manager.DeletionProtectionNone
+		}
+		return module.Definition.ModuleDeletionProtection()
+	case task.ModulePurge:
+		return app.PurgeProtection
+	}
+	return module_manager.DeletionProtectionNone
+}
+
+// isDeletionCanceled returns true if the module is enabled again while the deletion is waiting
+// for the confirmation. Modules are loaded at start, so ModulePurge is never canceled.
+func (op *AddonOperator) isDeletionCanceled(t sh_task.Task) bool {
+	if t.GetType() != task.ModuleDelete {
+		return false
+	}
+	hm := task.HookMetadataAccessor(t)
+	for _, moduleName := range op.ModuleManager.GetModuleNamesInOrder() {
+		if moduleName == hm.ModuleName {
+			return true
+		}
+	}
+	return false
+}
+
+// configObjectName returns a name of the object with the confirmation annotation for logs.
+func configObjectName() string {
+	if app.ConfigSource == "crd" {
+		return fmt.Sprintf("%s/%s", kube_config_manager.GlobalConfigKind, kube_config_manager.GlobalConfigName)
+	}
+	return fmt.Sprintf("cm/%s", app.ConfigMapName)
+}
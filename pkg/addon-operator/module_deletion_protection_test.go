@@ -0,0 +1,146 @@
+package addon_operator
+
+import (
+	"context"
+	"testing"
+
+	klient "github.com/flant/kube-client/client"
+	"github.com/flant/shell-operator/pkg/metric_storage"
+	sh_task "github.com/flant/shell-operator/pkg/task"
+	"github.com/flant/shell-operator/pkg/task/queue"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/flant/addon-operator/pkg/app"
+	"github.com/flant/addon-operator/pkg/kube_config_manager"
+	"github.com/flant/addon-operator/pkg/task"
+)
+
+func Test_ProtectModuleDeletion_Purge(t *testing.T) {
+	g := NewWithT(t)
+
+	defer func(namespace string, configMapName string, purgeProtection string) {
+		app.Namespace = namespace
+		app.ConfigMapName = configMapName
+		app.PurgeProtection = purgeProtection
+	}(app.Namespace, app.ConfigMapName, app.PurgeProtection)
+	app.Namespace = "default"
+	app.ConfigMapName = "addon-operator"
+	app.PurgeProtection = "confirm"
+
+	// Deletion queues are not started with the canceled context, so tasks stay in queues.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	op := NewAddonOperator()
+	op.KubeClient = klient.NewFake(nil)
+	op.KubeConfigManager = kube_config_manager.NewKubeConfigManager()
+	op.KubeConfigManager.WithKubeClient(op.KubeClient)
+	op.KubeConfigManager.WithNamespace(app.Namespace)
+	op.KubeConfigManager.WithConfigMapName(app.ConfigMapName)
+	op.MetricStorage = metric_storage.NewMetricStorage()
+	op.TaskQueues = queue.NewTaskQueueSet()
+	op.TaskQueues.WithContext(ctx)
+	op.TaskQueues.WithMainName("main")
+
+	newPurge := func(queueName string) sh_task.Task {
+		return sh_task.NewTask(task.ModulePurge).
+			WithQueueName(queueName).
+			WithMetadata(task.HookMetadata{ModuleName: "module-a"})
+	}
+
+	// Not confirmed purge is moved from the main queue into the deletion queue.
+	res, handled := op.ProtectModuleDeletion(newPurge("main"), nil)
+	g.Expect(handled).To(BeTrue())
+	g.Expect(res.Status).To(Equal("Success"))
+	g.Expect(op.TaskQueues.GetByName(DeletionQueueName("module-a")).Length()).To(Equal(1))
+
+	// Moved task is not duplicated.
+	_, handled = op.ProtectModuleDeletion(newPurge("main"), nil)
+	g.Expect(handled).To(BeTrue())
+	g.Expect(op.TaskQueues.GetByName(DeletionQueueName("module-a")).Length()).To(Equal(1))
+
+	// Task in the deletion queue waits for the confirmation.
+	res, handled = op.ProtectModuleDeletion(newPurge(DeletionQueueName("module-a")), nil)
+	g.Expect(handled).To(BeTrue())
+	g.Expect(res.Status).To(Equal("Repeat"))
+	g.Expect(res.DelayBeforeNextTask).To(Equal(DeletionConfirmationCheckInterval))
+
+	// Confirmed task runs as usual.
+	cm := &v1.ConfigMap{}
+	cm.Name = "addon-operator"
+	cm.Annotations = map[string]string{DeletionConfirmationAnnotation: "module-b, module-a"}
+	_, err := op.KubeClient.CoreV1().ConfigMaps("default").Create(context.TODO(), cm, metav1.CreateOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	_, handled = op.ProtectModuleDeletion(newPurge(DeletionQueueName("module-a")), nil)
+	g.Expect(handled).To(BeFalse())
+
+	// Confirmation is removed after the deletion, the next deletion should be confirmed again.
+	op.ConsumeDeletionConfirmation(newPurge(DeletionQueueName("module-a")), nil)
+	cm, err = op.KubeClient.CoreV1().ConfigMaps("default").Get(context.TODO(), "addon-operator", metav1.GetOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(cm.Annotations).To(HaveKeyWithValue(DeletionConfirmationAnnotation, "module-b"))
+	res, handled = op.ProtectModuleDeletion(newPurge(DeletionQueueName("module-a")), nil)
+	g.Expect(handled).To(BeTrue())
+	g.Expect(res.Status).To(Equal("Repeat"))
+
+	// Purge is not protected by default.
+	app.PurgeProtection = "none"
+	cm.Annotations = nil
+	_, err = op.KubeClient.CoreV1().ConfigMaps("default").Update(context.TODO(), cm, metav1.UpdateOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	_, handled = op.ProtectModuleDeletion(newPurge("main"), nil)
+	g.Expect(handled).To(BeFalse())
+}
+
+func Test_ProtectModuleDeletion_CrdConfigSource(t *testing.T) {
+	g := NewWithT(t)
+
+	defer func(configSource string, purgeProtection string) {
+		app.ConfigSource = configSource
+		app.PurgeProtection = purgeProtection
+	}(app.ConfigSource, app.PurgeProtection)
+	app.ConfigSource = "crd"
+	app.PurgeProtection = "confirm"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	op := NewAddonOperator()
+	op.KubeClient = klient.NewFake(nil)
+	op.KubeConfigManager = kube_config_manager.NewCrdKubeConfigManager()
+	op.KubeConfigManager.WithKubeClient(op.KubeClient)
+	op.MetricStorage = metric_storage.NewMetricStorage()
+	op.TaskQueues = queue.NewTaskQueueSet()
+	op.TaskQueues.WithContext(ctx)
+	op.TaskQueues.WithMainName("main")
+
+	purge := sh_task.NewTask(task.ModulePurge).
+		WithQueueName(DeletionQueueName("module-a")).
+		WithMetadata(task.HookMetadata{ModuleName: "module-a"})
+
+	// No GlobalConfig, deletion is not confirmed.
+	res, handled := op.ProtectModuleDeletion(purge, nil)
+	g.Expect(handled).To(BeTrue())
+	g.Expect(res.Status).To(Equal("Repeat"))
+
+	globalConfig := &unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{}}}
+	globalConfig.SetAPIVersion(kube_config_manager.ConfigGroup + "/" + kube_config_manager.ConfigVersion)
+	globalConfig.SetKind(kube_config_manager.GlobalConfigKind)
+	globalConfig.SetName(kube_config_manager.GlobalConfigName)
+	globalConfig.SetAnnotations(map[string]string{DeletionConfirmationAnnotation: "module-a"})
+	globalConfigs := op.KubeClient.Dynamic().Resource(kube_config_manager.GlobalConfigGVR)
+	_, err := globalConfigs.Create(context.TODO(), globalConfig, metav1.CreateOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	_, handled = op.ProtectModuleDeletion(purge, nil)
+	g.Expect(handled).To(BeFalse())
+
+	op.ConsumeDeletionConfirmation(purge, nil)
+	globalConfig, err = globalConfigs.Get(context.TODO(), kube_config_manager.GlobalConfigName, metav1.GetOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(globalConfig.GetAnnotations()).ShouldNot(HaveKey(DeletionConfirmationAnnotation))
+}
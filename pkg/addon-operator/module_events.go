@@ -0,0 +1,28 @@
+package addon_operator
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/flant/addon-operator/pkg/app"
+	"github.com/flant/addon-operator/pkg/module_events"
+)
+
+// InitEventRecorder creates a recorder for Kubernetes Events if events are enabled.
+func (op *AddonOperator) InitEventRecorder() error {
+	if !app.EventsEnabled {
+		return nil
+	}
+	podName := app.PodName
+	if podName == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("get hostname for events: %v", err)
+		}
+		podName = hostname
+	}
+	podRef := module_events.OperatorPodReference(op.KubeClient, app.Namespace, podName)
+	op.EventRecorder = module_events.NewRecorder(op.KubeClient, app.AppName, podRef, app.ModuleStatusEnabled)
+	op.ModuleManager.WithEventRecorder(op.EventRecorder)
+	return nil
+}
@@ -0,0 +1,173 @@
+package addon_operator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	sh_task "github.com/flant/shell-operator/pkg/task"
+	log "github.com/sirupsen/logrus"
+	uuid "gopkg.in/satori/go.uuid.v1"
+
+	"github.com/flant/addon-operator/pkg/task"
+	"github.com/flant/addon-operator/pkg/tracing"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// PausedModules keeps a set of modules that are not reconciled: ModuleRun and
+// ModuleHookRun tasks of these modules are dropped and their resources monitors
+// are paused. Helm releases of paused modules are left as is.
+type PausedModules struct {
+	m       sync.Mutex
+	modules map[string]time.Time
+}
+
+func NewPausedModules() *PausedModules {
+	return &PausedModules{
+		modules: make(map[string]time.Time),
+	}
+}
+
+// Add pauses the module. It returns false if the module is already paused.
+func (p *PausedModules) Add(moduleName string) bool {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if _, has := p.modules[moduleName]; has {
+		return false
+	}
+	p.modules[moduleName] = time.Now()
+	return true
+}
+
+// Remove resumes the module. It returns false if the module is not paused.
+func (p *PausedModules) Remove(moduleName string) bool {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if _, has := p.modules[moduleName]; !has {
+		return false
+	}
+	delete(p.modules, moduleName)
+	return true
+}
+
+func (p *PausedModules) Has(moduleName string) bool {
+	p.m.Lock()
+	defer p.m.Unlock()
+	_, has := p.modules[moduleName]
+	return has
+}
+
+// List returns sorted names of paused modules.
+func (p *PausedModules) List() []string {
+	p.m.Lock()
+	defer p.m.Unlock()
+	names := make([]string, 0, len(p.modules))
+	for name := range p.modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseModuleNames returns module names from the comma separated list.
+func ParseModuleNames(list string) []string {
+	names := make([]string, 0)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// PauseModule stops reconciling of the module until ResumeModule is called.
+func (op *AddonOperator) PauseModule(moduleName string) error {
+	if op.ModuleManager.GetModule(moduleName) == nil {
+		return fmt.Errorf("module '%s' is not found", moduleName)
+	}
+	if !op.PausedModules.Add(moduleName) {
+		return nil
+	}
+	op.HelmResourcesManager.PauseMonitor(moduleName)
+	op.MetricStorage.GaugeSet("{PREFIX}module_paused", 1.0, map[string]string{"module": moduleName})
+	log.Infof("Module '%s' is paused", moduleName)
+	return nil
+}
+
+// ResumeModule resumes the resources monitor of the paused module and queues
+// ModuleRun to apply changes made while the module was paused.
+func (op *AddonOperator) ResumeModule(moduleName string) error {
+	module := op.ModuleManager.GetModule(moduleName)
+	if module == nil {
+		return fmt.Errorf("module '%s' is not found", moduleName)
+	}
+	if !op.PausedModules.Remove(moduleName) {
+		return nil
+	}
+	op.HelmResourcesManager.ResumeMonitor(moduleName)
+	op.MetricStorage.GaugeSet("{PREFIX}module_paused", 0.0, map[string]string{"module": moduleName})
+	log.Infof("Module '%s' is resumed", moduleName)
+
+	if !module.State.Enabled || QueueHasPendingModuleRunTask(op.TaskQueues.GetMain(), moduleName) {
+		return nil
+	}
+
+	logLabels := map[string]string{
+		"event.id": uuid.NewV4().String(),
+		"module":   moduleName,
+		"queue":    "main",
+	}
+	tracing.RecordEvent(logLabels, "ResumeModule")
+	newTask := sh_task.NewTask(task.ModuleRun).
+		WithLogLabels(logLabels).
+		WithQueueName("main").
+		WithMetadata(task.HookMetadata{
+			EventDescription: "ResumeModule",
+			ModuleName:       moduleName,
+			OnStartupHooks:   !module.State.OnStartupDone,
+		})
+	op.TaskQueues.GetMain().AddLast(newTask.WithQueuedAt(time.Now()))
+	log.WithFields(utils.LabelsToLogFields(logLabels)).
+		Infof("queue task %s", newTask.GetDescription())
+	return nil
+}
+
+// SkipPausedModuleTask returns true if the task is a ModuleRun or a ModuleHookRun of
+// the paused module. Such task should be dropped from the queue.
+func (op *AddonOperator) SkipPausedModuleTask(t sh_task.Task, logLabels map[string]string) bool {
+	if t.GetType() != task.ModuleRun && t.GetType() != task.ModuleHookRun {
+		return false
+	}
+	hm := task.HookMetadataAccessor(t)
+	if !op.PausedModules.Has(hm.ModuleName) {
+		return false
+	}
+
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
+	logEntry.Infof("Module '%s' is paused, drop task %s", hm.ModuleName, t.GetDescription())
+
+	switch t.GetType() {
+	case task.ModuleRun:
+		// The monitor is resumed by the ModuleRun started before the pause.
+		op.HelmResourcesManager.PauseMonitor(hm.ModuleName)
+	case task.ModuleHookRun:
+		// Dropped Synchronization should not block ModuleRun after resume.
+		if !hm.IsSynchronization() {
+			break
+		}
+		taskHook := op.ModuleManager.GetModuleHook(hm.HookName)
+		if taskHook == nil {
+			break
+		}
+		if state, ok := taskHook.KubernetesBindingSynchronizationState[hm.KubernetesBindingId]; ok {
+			state.Done = true
+		}
+		for _, monitorID := range hm.MonitorIDs {
+			taskHook.HookController.UnlockKubernetesEventsFor(monitorID)
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package addon_operator
+
+import (
+	"testing"
+
+	sh_task "github.com/flant/shell-operator/pkg/task"
+	. "github.com/onsi/gomega"
+
+	"github.com/flant/addon-operator/pkg/helm_resources_manager"
+	"github.com/flant/addon-operator/pkg/task"
+)
+
+func Test_ParseModuleNames(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(ParseModuleNames("")).To(BeEmpty())
+	g.Expect(ParseModuleNames("module-a, module-b,,")).To(Equal([]string{"module-a", "module-b"}))
+}
+
+func Test_SkipPausedModuleTask(t *testing.T) {
+	g := NewWithT(t)
+
+	op := NewAddonOperator()
+	op.HelmResourcesManager = helm_resources_manager.NewHelmResourcesManager()
+
+	g.Expect(op.PausedModules.Add("module-a")).To(BeTrue())
+	g.Expect(op.PausedModules.Add("module-a")).To(BeFalse())
+	g.Expect(op.PausedModules.Add("module-b")).To(BeTrue())
+	g.Expect(op.PausedModules.List()).To(Equal([]string{"module-a", "module-b"}))
+
+	newTask := func(taskType sh_task.TaskType, moduleName string) sh_task.Task {
+		return sh_task.NewTask(taskType).
+			WithQueueName("main").
+			WithMetadata(task.HookMetadata{ModuleName: moduleName, HookName: moduleName + "/hooks/hook.sh"})
+	}
+
+	// ModuleRun and hook tasks of paused modules are dropped.
+	g.Expect(op.SkipPausedModuleTask(newTask(task.ModuleRun, "module-a"), nil)).To(BeTrue())
+	g.Expect(op.SkipPausedModuleTask(newTask(task.ModuleHookRun, "module-b"), nil)).To(BeTrue())
+	// ModuleDelete is not affected: disabled module is deleted as usual.
+	g.Expect(op.SkipPausedModuleTask(newTask(task.ModuleDelete, "module-a"), nil)).To(BeFalse())
+	g.Expect(op.SkipPausedModuleTask(newTask(task.ModuleRun, "module-c"), nil)).To(BeFalse())
+
+	g.Expect(op.PausedModules.Remove("module-a")).To(BeTrue())
+	g.Expect(op.PausedModules.Remove("module-a")).To(BeFalse())
+	g.Expect(op.SkipPausedModuleTask(newTask(task.ModuleRun, "module-a"), nil)).To(BeFalse())
+	g.Expect(op.PausedModules.Has("module-b")).To(BeTrue())
+}
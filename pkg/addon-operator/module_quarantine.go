@@ -0,0 +1,229 @@
+package addon_operator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	sh_task "github.com/flant/shell-operator/pkg/task"
+	"github.com/flant/shell-operator/pkg/task/queue"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/flant/addon-operator/pkg/task"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// ModuleQuarantine keeps a set of modules which ModuleRun tasks are failed Threshold times
+// in the main queue. ModuleRun and ModuleHookRun tasks of these modules are moved into per-module
+// quarantine queues, so the failed module does not block other modules and afterAll hooks.
+type ModuleQuarantine struct {
+	Threshold int
+
+	m       sync.Mutex
+	modules map[string]time.Time
+}
+
+func NewModuleQuarantine(threshold int) *ModuleQuarantine {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &ModuleQuarantine{
+		Threshold: threshold,
+		modules:   make(map[string]time.Time),
+	}
+}
+
+// ShouldQuarantine returns true if the task in the main queue is failed enough times.
+func (q *ModuleQuarantine) ShouldQuarantine(failedAttempts int) bool {
+	return failedAttempts >= q.Threshold
+}
+
+// Add puts the module into quarantine. It returns false if the module is already quarantined.
+func (q *ModuleQuarantine) Add(moduleName string) bool {
+	q.m.Lock()
+	defer q.m.Unlock()
+	if _, has := q.modules[moduleName]; has {
+		return false
+	}
+	q.modules[moduleName] = time.Now()
+	return true
+}
+
+// Release removes the module from quarantine. It returns false if the module is not quarantined.
+func (q *ModuleQuarantine) Release(moduleName string) bool {
+	q.m.Lock()
+	defer q.m.Unlock()
+	if _, has := q.modules[moduleName]; !has {
+		return false
+	}
+	delete(q.modules, moduleName)
+	return true
+}
+
+func (q *ModuleQuarantine) Has(moduleName string) bool {
+	q.m.Lock()
+	defer q.m.Unlock()
+	_, has := q.modules[moduleName]
+	return has
+}
+
+// List returns sorted names of quarantined modules.
+func (q *ModuleQuarantine) List() []string {
+	q.m.Lock()
+	defer q.m.Unlock()
+	names := make([]string, 0, len(q.modules))
+	for name := range q.modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func QuarantineQueueName(moduleName string) string {
+	return fmt.Sprintf("quarantine-module-%s", moduleName)
+}
+
+// QuarantineFailedModuleRun moves the failed ModuleRun task from the main queue into the
+// quarantine queue of its module if the task is failed enough times. The result for the
+// main queue is Success, so next tasks in the main queue can run.
+func (op *AddonOperator) QuarantineFailedModuleRun(t sh_task.Task, res queue.TaskResult, logLabels map[string]string) queue.TaskResult {
+	if op.ModuleQuarantine == nil || res.Status != "Fail" || t.GetQueueName() != "main" {
+		return res
+	}
+
+	failedAttempts := t.GetFailureCount() + 1
+	if !op.ModuleQuarantine.ShouldQuarantine(failedAttempts) {
+		return res
+	}
+
+	hm := task.HookMetadataAccessor(t)
+	log.WithFields(utils.LabelsToLogFields(logLabels)).
+		Warnf("ModuleRun is failed %d times, move module '%s' to the queue '%s'", failedAttempts, hm.ModuleName, QuarantineQueueName(hm.ModuleName))
+
+	op.moveToQuarantine(t)
+	return queue.TaskResult{Status: "Success"}
+}
+
+// RedirectToQuarantine moves ModuleRun and ModuleHookRun tasks of the quarantined module
+// into the quarantine queue, so hooks of the module run after the successful ModuleRun.
+// Synchronization tasks are not moved: ModuleRun waits for them. It returns true if the task is moved.
+func (op *AddonOperator) RedirectToQuarantine(t sh_task.Task, logLabels map[string]string) bool {
+	if op.ModuleQuarantine == nil {
+		return false
+	}
+	switch t.GetType() {
+	case task.ModuleRun:
+		if t.GetQueueName() != "main" {
+			return false
+		}
+	case task.ModuleHookRun:
+	default:
+		return false
+	}
+
+	hm := task.HookMetadataAccessor(t)
+	if !op.ModuleQuarantine.Has(hm.ModuleName) || t.GetQueueName() == QuarantineQueueName(hm.ModuleName) {
+		return false
+	}
+	if t.GetType() == task.ModuleHookRun && hm.IsSynchronization() {
+		return false
+	}
+
+	log.WithFields(utils.LabelsToLogFields(logLabels)).
+		Infof("Module '%s' is quarantined, move %s to the queue '%s'", hm.ModuleName, t.GetType(), QuarantineQueueName(hm.ModuleName))
+
+	op.moveToQuarantine(t)
+	return true
+}
+
+// moveToQuarantine queues a copy of the task into the quarantine queue. ModuleRun is merged
+// into the pending ModuleRun in the quarantine queue: the module is run with actual values
+// anyway. The first task is not merged as it can be executed already.
+func (op *AddonOperator) moveToQuarantine(t sh_task.Task) {
+	hm := task.HookMetadataAccessor(t)
+	queueName := QuarantineQueueName(hm.ModuleName)
+
+	if op.ModuleQuarantine.Add(hm.ModuleName) {
+		op.MetricStorage.GaugeSet("{PREFIX}module_quarantined", 1.0, map[string]string{"module": hm.ModuleName})
+	}
+
+	q := op.TaskQueues.GetByName(queueName)
+	if q == nil {
+		op.TaskQueues.NewNamedQueue(queueName, op.TaskHandler)
+		q = op.TaskQueues.GetByName(queueName)
+		q.Start()
+	}
+
+	if t.GetType() == task.ModuleRun {
+		// Helm phase is run in the quarantine queue, not in the pool of the main queue.
+		hm.ParallelHelmPhase = false
+		if mergePendingModuleRun(q, hm) {
+			return
+		}
+	}
+
+	newLabels := utils.MergeLabels(t.GetLogLabels(), map[string]string{"queue": queueName})
+	delete(newLabels, "task.id")
+	newTask := sh_task.NewTask(t.GetType()).
+		WithLogLabels(newLabels).
+		WithQueueName(queueName).
+		WithMetadata(hm).
+		WithQueuedAt(time.Now())
+	q.AddLast(newTask)
+}
+
+// mergePendingModuleRun merges onStartup flag and event description of the ModuleRun into
+// the pending ModuleRun of the same module. It returns false if there is no pending ModuleRun.
+func mergePendingModuleRun(q *queue.TaskQueue, hm task.HookMetadata) bool {
+	merged := false
+	first := true
+	q.Iterate(func(qt sh_task.Task) {
+		if first {
+			first = false
+			return
+		}
+		if merged || qt.GetType() != task.ModuleRun {
+			return
+		}
+		pending := task.HookMetadataAccessor(qt)
+		if pending.ModuleName != hm.ModuleName {
+			return
+		}
+		pending.OnStartupHooks = pending.OnStartupHooks || hm.OnStartupHooks
+		if hm.EventDescription != "" && !strings.Contains(pending.EventDescription, hm.EventDescription) {
+			pending.EventDescription += "." + hm.EventDescription
+		}
+		qt.UpdateMetadata(pending)
+		merged = true
+	})
+	return merged
+}
+
+// ReleaseFromQuarantine returns the module to the main queue after the successful run
+// in the quarantine queue.
+func (op *AddonOperator) ReleaseFromQuarantine(t sh_task.Task, logLabels map[string]string) {
+	hm := task.HookMetadataAccessor(t)
+	if op.ModuleQuarantine == nil || t.GetQueueName() != QuarantineQueueName(hm.ModuleName) {
+		return
+	}
+	if op.ModuleQuarantine.Release(hm.ModuleName) {
+		op.MetricStorage.GaugeSet("{PREFIX}module_quarantined", 0.0, map[string]string{"module": hm.ModuleName})
+		log.WithFields(utils.LabelsToLogFields(logLabels)).
+			Infof("Module '%s' is released from quarantine", hm.ModuleName)
+	}
+}
+
+// RemoveQuarantineQueue releases the deleted module and removes its quarantine queue.
+func (op *AddonOperator) RemoveQuarantineQueue(moduleName string) {
+	if op.ModuleQuarantine == nil {
+		return
+	}
+	if op.ModuleQuarantine.Release(moduleName) {
+		op.MetricStorage.GaugeSet("{PREFIX}module_quarantined", 0.0, map[string]string{"module": moduleName})
+	}
+	if op.TaskQueues.GetByName(QuarantineQueueName(moduleName)) != nil {
+		op.TaskQueues.Remove(QuarantineQueueName(moduleName))
+	}
+}
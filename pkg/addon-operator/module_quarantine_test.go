@@ -0,0 +1,113 @@
+package addon_operator
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/flant/shell-operator/pkg/hook/binding_context"
+	. "github.com/flant/shell-operator/pkg/hook/types"
+	. "github.com/flant/shell-operator/pkg/kube_events_manager/types"
+	"github.com/flant/shell-operator/pkg/metric_storage"
+	sh_task "github.com/flant/shell-operator/pkg/task"
+	"github.com/flant/shell-operator/pkg/task/queue"
+	. "github.com/onsi/gomega"
+
+	"github.com/flant/addon-operator/pkg/task"
+)
+
+func Test_ModuleQuarantine(t *testing.T) {
+	g := NewWithT(t)
+
+	// Quarantine queues are not started with the canceled context, so tasks stay in queues.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	op := NewAddonOperator()
+	op.MetricStorage = metric_storage.NewMetricStorage()
+	op.TaskQueues = queue.NewTaskQueueSet()
+	op.TaskQueues.WithContext(ctx)
+	op.TaskQueues.WithMainName("main")
+	op.ModuleQuarantine = NewModuleQuarantine(3)
+
+	newModuleRun := func(moduleName string, queueName string) sh_task.Task {
+		return sh_task.NewTask(task.ModuleRun).
+			WithQueueName(queueName).
+			WithMetadata(task.HookMetadata{ModuleName: moduleName, ParallelHelmPhase: true})
+	}
+	failed := queue.TaskResult{Status: "Fail"}
+
+	// Module stays in the main queue until the threshold is reached.
+	moduleRun := newModuleRun("module-a", "main")
+	moduleRun.IncrementFailureCount()
+	res := op.QuarantineFailedModuleRun(moduleRun, failed, nil)
+	g.Expect(res.Status).To(Equal("Fail"))
+	g.Expect(op.ModuleQuarantine.List()).To(BeEmpty())
+
+	moduleRun.IncrementFailureCount()
+	res = op.QuarantineFailedModuleRun(moduleRun, failed, nil)
+	g.Expect(res.Status).To(Equal("Success"))
+	g.Expect(op.ModuleQuarantine.List()).To(Equal([]string{"module-a"}))
+
+	q := op.TaskQueues.GetByName(QuarantineQueueName("module-a"))
+	g.Expect(q).ShouldNot(BeNil())
+	g.Expect(q.Length()).To(Equal(1))
+	quarantined := q.GetFirst()
+	g.Expect(quarantined.GetQueueName()).To(Equal(QuarantineQueueName("module-a")))
+	g.Expect(quarantined.GetFailureCount()).To(Equal(0))
+	g.Expect(task.HookMetadataAccessor(quarantined).ParallelHelmPhase).To(BeFalse())
+
+	// Next ModuleRun in the main queue is redirected. The first task can be running already,
+	// so the ModuleRun is queued after it.
+	g.Expect(op.RedirectToQuarantine(newModuleRun("module-a", "main"), nil)).To(BeTrue())
+	g.Expect(op.RedirectToQuarantine(newModuleRun("module-b", "main"), nil)).To(BeFalse())
+	g.Expect(q.Length()).To(Equal(2))
+
+	// ModuleRun is merged into the pending ModuleRun, onStartup hooks are kept.
+	onStartupRun := newModuleRun("module-a", "main")
+	onStartupRun.UpdateMetadata(task.HookMetadata{ModuleName: "module-a", OnStartupHooks: true, EventDescription: "ModuleEnabled"})
+	g.Expect(op.RedirectToQuarantine(onStartupRun, nil)).To(BeTrue())
+	g.Expect(q.Length()).To(Equal(2))
+	pending := task.HookMetadataAccessor(q.GetLast())
+	g.Expect(pending.OnStartupHooks).To(BeTrue())
+	g.Expect(pending.EventDescription).To(ContainSubstring("ModuleEnabled"))
+	g.Expect(task.HookMetadataAccessor(q.GetFirst()).OnStartupHooks).To(BeFalse())
+
+	// Hook runs of the quarantined module are redirected, except Synchronization.
+	newHookRun := func(moduleName string, queueName string, bindingType BindingType) sh_task.Task {
+		bc := BindingContext{Binding: "hook-binding"}
+		bc.Metadata.BindingType = bindingType
+		if bindingType == OnKubernetesEvent {
+			bc.Type = TypeSynchronization
+		}
+		return sh_task.NewTask(task.ModuleHookRun).
+			WithQueueName(queueName).
+			WithMetadata(task.HookMetadata{ModuleName: moduleName, BindingType: bindingType, BindingContext: []BindingContext{bc}})
+	}
+	g.Expect(op.RedirectToQuarantine(newHookRun("module-a", "main", Schedule), nil)).To(BeTrue())
+	g.Expect(op.RedirectToQuarantine(newHookRun("module-a", "hooks-queue", Schedule), nil)).To(BeTrue())
+	g.Expect(op.RedirectToQuarantine(newHookRun("module-a", "main", OnKubernetesEvent), nil)).To(BeFalse())
+	g.Expect(op.RedirectToQuarantine(newHookRun("module-b", "main", Schedule), nil)).To(BeFalse())
+	g.Expect(op.RedirectToQuarantine(newHookRun("module-a", QuarantineQueueName("module-a"), Schedule), nil)).To(BeFalse())
+	g.Expect(q.Length()).To(Equal(4))
+	g.Expect(q.GetLast().GetType()).To(Equal(task.ModuleHookRun))
+	g.Expect(q.GetLast().GetQueueName()).To(Equal(QuarantineQueueName("module-a")))
+
+	// Failures in the quarantine queue do not move the task again.
+	quarantined.IncrementFailureCount()
+	quarantined.IncrementFailureCount()
+	res = op.QuarantineFailedModuleRun(quarantined, failed, nil)
+	g.Expect(res.Status).To(Equal("Fail"))
+
+	// Successful run in the main queue does not release the module.
+	op.ReleaseFromQuarantine(newModuleRun("module-a", "main"), nil)
+	g.Expect(op.ModuleQuarantine.Has("module-a")).To(BeTrue())
+
+	op.ReleaseFromQuarantine(quarantined, nil)
+	g.Expect(op.ModuleQuarantine.Has("module-a")).To(BeFalse())
+
+	// Disabled module is released and its queue is removed.
+	op.ModuleQuarantine.Add("module-a")
+	op.RemoveQuarantineQueue("module-a")
+	g.Expect(op.ModuleQuarantine.List()).To(BeEmpty())
+	g.Expect(op.TaskQueues.GetByName(QuarantineQueueName("module-a"))).To(BeNil())
+}
@@ -0,0 +1,128 @@
+package addon_operator
+
+import (
+	"fmt"
+	"sync"
+
+	sh_task "github.com/flant/shell-operator/pkg/task"
+)
+
+// ModuleRunResult is a result of the helm phase started in the ModuleRunPool.
+type ModuleRunResult struct {
+	ModuleName    string
+	Task          sh_task.Task
+	ValuesChanged bool
+	Err           error
+}
+
+type moduleRun struct {
+	result ModuleRunResult
+	done   chan struct{}
+}
+
+// ModuleRunPool runs helm phases of modules concurrently with a limited number of workers.
+//
+// Runs submitted between two Results calls form a batch. A run of a module waits
+// until runs of its required modules from the same batch are finished. If a required
+// module is failed, the run is not started and is reported as failed.
+type ModuleRunPool struct {
+	m     sync.Mutex
+	sem   chan struct{}
+	runs  map[string]*moduleRun
+	order []string
+}
+
+func NewModuleRunPool(workers int) *ModuleRunPool {
+	if workers < 1 {
+		workers = 1
+	}
+	return &ModuleRunPool{
+		sem:   make(chan struct{}, workers),
+		runs:  make(map[string]*moduleRun),
+		order: make([]string, 0),
+	}
+}
+
+// Submit starts runFn in background. requires is a list of modules that should be
+// finished before runFn is started.
+func (p *ModuleRunPool) Submit(moduleName string, requires []string, t sh_task.Task, runFn func() (bool, error)) {
+	p.m.Lock()
+	deps := make(map[string]*moduleRun)
+	for _, required := range requires {
+		if run, has := p.runs[required]; has {
+			deps[required] = run
+		}
+	}
+	// Run of the same module in one batch should not start until the previous run is finished.
+	prev, hasPrev := p.runs[moduleName]
+	if !hasPrev {
+		p.order = append(p.order, moduleName)
+	}
+	run := &moduleRun{
+		result: ModuleRunResult{ModuleName: moduleName, Task: t},
+		done:   make(chan struct{}),
+	}
+	p.runs[moduleName] = run
+	p.m.Unlock()
+
+	go func() {
+		defer close(run.done)
+
+		if hasPrev {
+			<-prev.done
+		}
+		for _, required := range requires {
+			dep, has := deps[required]
+			if !has {
+				continue
+			}
+			<-dep.done
+			if dep.result.Err != nil {
+				run.result.Err = fmt.Errorf("required module '%s' is failed: %v", required, dep.result.Err)
+				return
+			}
+		}
+
+		p.sem <- struct{}{}
+		defer func() { <-p.sem }()
+		run.result.ValuesChanged, run.result.Err = runFn()
+	}()
+}
+
+// Running returns a number of submitted runs that are not finished yet.
+func (p *ModuleRunPool) Running() int {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	running := 0
+	for _, run := range p.runs {
+		select {
+		case <-run.done:
+		default:
+			running++
+		}
+	}
+	return running
+}
+
+// Results returns results of finished runs in order of submission and starts a new batch.
+// Runs that are not finished yet stay in the pool.
+func (p *ModuleRunPool) Results() []ModuleRunResult {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	results := make([]ModuleRunResult, 0, len(p.order))
+	order := make([]string, 0)
+	for _, moduleName := range p.order {
+		run := p.runs[moduleName]
+		select {
+		case <-run.done:
+			results = append(results, run.result)
+			delete(p.runs, moduleName)
+		default:
+			order = append(order, moduleName)
+		}
+	}
+	p.order = order
+	return results
+}
@@ -0,0 +1,114 @@
+package addon_operator
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+// Test_ModuleRunPool_Dependencies checks that a module waits for required modules
+// and independent modules run concurrently.
+func Test_ModuleRunPool_Dependencies(t *testing.T) {
+	g := NewWithT(t)
+
+	pool := NewModuleRunPool(2)
+
+	var m sync.Mutex
+	finished := make([]string, 0)
+	release := map[string]chan struct{}{
+		"cert-manager": make(chan struct{}),
+		"monitoring":   make(chan struct{}),
+		"ingress":      make(chan struct{}),
+	}
+	runFn := func(moduleName string, err error) func() (bool, error) {
+		return func() (bool, error) {
+			<-release[moduleName]
+			m.Lock()
+			finished = append(finished, moduleName)
+			m.Unlock()
+			return moduleName == "monitoring", err
+		}
+	}
+
+	pool.Submit("cert-manager", nil, nil, runFn("cert-manager", nil))
+	pool.Submit("monitoring", nil, nil, runFn("monitoring", nil))
+	pool.Submit("ingress", []string{"cert-manager"}, nil, runFn("ingress", nil))
+
+	g.Expect(pool.Running()).To(Equal(3))
+
+	// ingress is not started before cert-manager, monitoring runs concurrently.
+	close(release["ingress"])
+	close(release["monitoring"])
+	g.Eventually(pool.Running, "5s", "10ms").Should(Equal(2))
+	g.Consistently(pool.Running, "100ms", "10ms").Should(Equal(2))
+
+	close(release["cert-manager"])
+	g.Eventually(pool.Running, "5s", "10ms").Should(Equal(0))
+	g.Expect(finished).To(Equal([]string{"monitoring", "cert-manager", "ingress"}))
+
+	results := pool.Results()
+	g.Expect(results).To(HaveLen(3))
+	g.Expect(results[0].ModuleName).To(Equal("cert-manager"))
+	g.Expect(results[1].ModuleName).To(Equal("monitoring"))
+	g.Expect(results[1].ValuesChanged).To(BeTrue())
+	g.Expect(results[2].ModuleName).To(Equal("ingress"))
+
+	// Next batch is empty.
+	g.Expect(pool.Results()).To(BeEmpty())
+}
+
+// Test_ModuleRunPool_FailedRequirement checks that a module is not started if a required module is failed.
+func Test_ModuleRunPool_FailedRequirement(t *testing.T) {
+	g := NewWithT(t)
+
+	pool := NewModuleRunPool(4)
+
+	ingressStarted := false
+	pool.Submit("cert-manager", nil, nil, func() (bool, error) {
+		return false, fmt.Errorf("helm upgrade failed")
+	})
+	pool.Submit("ingress", []string{"cert-manager"}, nil, func() (bool, error) {
+		ingressStarted = true
+		return false, nil
+	})
+
+	g.Eventually(pool.Running, "5s", "10ms").Should(Equal(0))
+	g.Expect(ingressStarted).To(BeFalse())
+
+	results := pool.Results()
+	g.Expect(results).To(HaveLen(2))
+	g.Expect(results[0].Err).To(MatchError("helm upgrade failed"))
+	g.Expect(results[1].Err).To(MatchError(ContainSubstring("required module 'cert-manager' is failed")))
+}
+
+// Test_ModuleRunPool_Workers checks that a number of concurrent runs is limited.
+func Test_ModuleRunPool_Workers(t *testing.T) {
+	g := NewWithT(t)
+
+	pool := NewModuleRunPool(2)
+
+	var m sync.Mutex
+	current, max := 0, 0
+	for i := 0; i < 6; i++ {
+		pool.Submit(fmt.Sprintf("module-%d", i), nil, nil, func() (bool, error) {
+			m.Lock()
+			current++
+			if current > max {
+				max = current
+			}
+			m.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			m.Lock()
+			current--
+			m.Unlock()
+			return false, nil
+		})
+	}
+
+	g.Eventually(pool.Running, "5s", "10ms").Should(Equal(0))
+	g.Expect(max).To(Equal(2))
+	g.Expect(pool.Results()).To(HaveLen(6))
+}
@@ -0,0 +1,80 @@
+package addon_operator
+
+import (
+	"time"
+
+	"github.com/flant/addon-operator/pkg/module_status_manager"
+)
+
+// SetModuleStatusEnabled reports that module is enabled and ModuleRun is queued.
+func (op *AddonOperator) SetModuleStatusEnabled(moduleName string) {
+	if op.ModuleStatusManager == nil {
+		return
+	}
+	op.ModuleStatusManager.UpdateStatus(moduleName, func(status *module_status_manager.ModuleStatus) {
+		status.Enabled = true
+		// Keep Failed phase with the error message until the next ModuleRun.
+		if status.Phase != module_status_manager.ModuleFailed {
+			status.Phase = module_status_manager.ModuleEnabled
+			status.Message = ""
+		}
+	})
+}
+
+// SetModuleStatusAfterRun reports a result of the ModuleRun task.
+func (op *AddonOperator) SetModuleStatusAfterRun(moduleName string, runErr error) {
+	if op.ModuleStatusManager == nil {
+		return
+	}
+	if runErr != nil {
+		op.ModuleStatusManager.UpdateStatus(moduleName, func(status *module_status_manager.ModuleStatus) {
+			status.Enabled = true
+			status.Phase = module_status_manager.ModuleFailed
+			status.Message = runErr.Error()
+		})
+		return
+	}
+
+	// The revision is saved by the helm phase, module without chart has no revision.
+	revision := ""
+	phase := module_status_manager.ModuleReady
+	message := ""
+	module := op.ModuleManager.GetModule(moduleName)
+	if module != nil {
+		revision = module.State.HelmRevision.Get()
+		// Rollback state is reset after a successful upgrade, so the upgrade was skipped.
+		if rollback := module.State.HelmRollback; rollback != nil {
+			phase = module_status_manager.ModuleRolledBack
+			message = rollback.String()
+		}
+	}
+
+	op.ModuleStatusManager.UpdateStatus(moduleName, func(status *module_status_manager.ModuleStatus) {
+		status.Enabled = true
+		status.Phase = phase
+		status.Message = message
+		status.HelmRevision = revision
+		status.LastConvergeTime = time.Now()
+	})
+}
+
+// SetModuleStatusAfterDelete reports a result of the ModuleDelete task.
+func (op *AddonOperator) SetModuleStatusAfterDelete(moduleName string, deleteErr error) {
+	if op.ModuleStatusManager == nil {
+		return
+	}
+	if deleteErr != nil {
+		op.ModuleStatusManager.UpdateStatus(moduleName, func(status *module_status_manager.ModuleStatus) {
+			status.Enabled = false
+			status.Phase = module_status_manager.ModuleFailed
+			status.Message = deleteErr.Error()
+		})
+		return
+	}
+	op.ModuleStatusManager.UpdateStatus(moduleName, func(status *module_status_manager.ModuleStatus) {
+		status.Enabled = false
+		status.Phase = module_status_manager.ModuleDisabled
+		status.Message = ""
+		status.HelmRevision = ""
+	})
+}
@@ -25,15 +25,21 @@ import (
 	"github.com/go-chi/chi"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 	uuid "gopkg.in/satori/go.uuid.v1"
+	v1 "k8s.io/api/core/v1"
 
 	"github.com/flant/addon-operator/pkg/app"
 	"github.com/flant/addon-operator/pkg/helm"
 	"github.com/flant/addon-operator/pkg/helm_resources_manager"
+	hr_types "github.com/flant/addon-operator/pkg/helm_resources_manager/types"
 	. "github.com/flant/addon-operator/pkg/hook/types"
 	"github.com/flant/addon-operator/pkg/kube_config_manager"
+	"github.com/flant/addon-operator/pkg/module_events"
 	"github.com/flant/addon-operator/pkg/module_manager"
+	"github.com/flant/addon-operator/pkg/module_status_manager"
 	"github.com/flant/addon-operator/pkg/task"
+	"github.com/flant/addon-operator/pkg/tracing"
 	"github.com/flant/addon-operator/pkg/utils"
 )
 
@@ -55,6 +61,36 @@ type AddonOperator struct {
 
 	HelmResourcesManager helm_resources_manager.HelmResourcesManager
 
+	// ModuleStatusManager writes module statuses into Module resources. It is nil if module status is disabled.
+	ModuleStatusManager module_status_manager.ModuleStatusManager
+
+	// EventRecorder emits Kubernetes Events about modules and hooks. It is nil if events are disabled.
+	EventRecorder *module_events.Recorder
+
+	// ModuleRunPool runs helm phases of modules concurrently. It is nil if parallel module runs are disabled.
+	ModuleRunPool *ModuleRunPool
+
+	// ModuleQuarantine moves ModuleRun tasks of failing modules out of the main queue. It is nil if quarantine is disabled.
+	ModuleQuarantine *ModuleQuarantine
+
+	// PausedModules are not reconciled until resumed.
+	PausedModules *PausedModules
+
+	// ModuleConflicts are conflicting modules reported by the last DiscoverModulesState.
+	ModuleConflicts map[string][]string
+
+	// DriftRepairs limits ModuleRun tasks queued to repair drifted resources.
+	DriftRepairs *DriftRepairs
+
+	// Maintenance defers helm upgrades and deletes, and optionally hooks, until the maintenance ends.
+	Maintenance *Maintenance
+
+	// LeaderElection holds the Lease for the leader replica. It is nil if leader election is disabled.
+	LeaderElection *LeaderElection
+
+	// StateCheckpointer saves module states and pending tasks to resume after restart. It is nil if checkpoints are disabled.
+	StateCheckpointer *StateCheckpointer
+
 	// converge state
 	StartupConvergeStarted bool
 	StartupConvergeDone    bool
@@ -67,6 +103,9 @@ type AddonOperator struct {
 func NewAddonOperator() *AddonOperator {
 	return &AddonOperator{
 		ShellOperator: &shell_operator.ShellOperator{},
+		PausedModules: NewPausedModules(),
+		Maintenance:   NewMaintenance(),
+		DriftRepairs:  NewDriftRepairs(DriftRepairMaxAttempts, DriftRepairBackoff, DriftRepairMaxBackoff),
 	}
 }
 
@@ -162,8 +201,12 @@ func (op *AddonOperator) InitModuleManager() error {
 		return err
 	}
 
-	// Initializing ConfigMap storage for values
-	op.KubeConfigManager = kube_config_manager.NewKubeConfigManager()
+	// Initializing storage for values: ConfigMap or custom resources
+	if app.ConfigSource == "crd" {
+		op.KubeConfigManager = kube_config_manager.NewCrdKubeConfigManager()
+	} else {
+		op.KubeConfigManager = kube_config_manager.NewKubeConfigManager()
+	}
 	op.KubeConfigManager.WithKubeClient(op.KubeClient)
 	op.KubeConfigManager.WithContext(op.ctx)
 	op.KubeConfigManager.WithNamespace(app.Namespace)
@@ -198,13 +241,54 @@ func (op *AddonOperator) InitModuleManager() error {
 		log.Errorf("MAIN Fatal: initialize kube client for helm: %s\n", err)
 		return err
 	}
+	helmMonitorMetadataClient, err := op.InitHelmMonitorMetadataClient()
+	if err != nil {
+		log.Errorf("MAIN Fatal: initialize metadata client for helm resources monitor: %s\n", err)
+		return err
+	}
 	// Init helm resources manager.
 	op.HelmResourcesManager = helm_resources_manager.NewHelmResourcesManager()
 	op.HelmResourcesManager.WithContext(op.ctx)
 	op.HelmResourcesManager.WithKubeClient(helmMonitorKubeClient)
+	op.HelmResourcesManager.WithMetadataClient(helmMonitorMetadataClient)
 	op.HelmResourcesManager.WithDefaultNamespace(app.Namespace)
 	op.ModuleManager.WithHelmResourcesManager(op.HelmResourcesManager)
 
+	if app.ModuleStatusEnabled {
+		op.ModuleStatusManager = module_status_manager.NewModuleStatusManager()
+		op.ModuleStatusManager.WithContext(op.ctx)
+		op.ModuleStatusManager.WithKubeClient(op.KubeClient)
+	}
+
+	err = op.InitEventRecorder()
+	if err != nil {
+		return err
+	}
+
+	if app.ParallelModuleRuns > 1 {
+		op.ModuleRunPool = NewModuleRunPool(app.ParallelModuleRuns)
+	}
+
+	if app.ModuleQuarantineThreshold > 0 {
+		op.ModuleQuarantine = NewModuleQuarantine(app.ModuleQuarantineThreshold)
+	}
+
+	maintenanceMode, err := ParseMaintenanceMode(app.MaintenanceMode)
+	if err != nil {
+		return err
+	}
+	op.SetMaintenanceMode(maintenanceMode)
+
+	for _, moduleName := range ParseModuleNames(app.PausedModules) {
+		if err := op.PauseModule(moduleName); err != nil {
+			logEntry.Warnf("Pause module: %v", err)
+		}
+	}
+
+	if app.StateConfigMapName != "" {
+		op.StateCheckpointer = NewStateCheckpointer(op.KubeClient, app.Namespace, app.StateConfigMapName)
+	}
+
 	return nil
 }
 
@@ -230,81 +314,96 @@ func (op *AddonOperator) NeedAddCrontabTask(hook *module_manager.CommonHook) boo
 	return false
 }
 
-func (op *AddonOperator) DefineEventHandlers() {
-	op.ManagerEventsHandler.WithScheduleEventHandler(func(crontab string) []sh_task.Task {
-		logLabels := map[string]string{
-			"event.id": uuid.NewV4().String(),
-			"binding":  string(Schedule),
-		}
-		logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
-		logEntry.Debugf("Create tasks for 'schedule' event '%s'", crontab)
+// CreateScheduleTasks returns tasks for hooks with schedule bindings for the crontab.
+// filterFn selects hooks and bindings, nil means all.
+func (op *AddonOperator) CreateScheduleTasks(crontab string, logLabels map[string]string, filterFn func(hookName string, bindingName string) bool) []sh_task.Task {
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
 
-		var tasks []sh_task.Task
-		err := op.ModuleManager.HandleScheduleEvent(crontab,
-			func(globalHook *module_manager.GlobalHook, info controller.BindingExecutionInfo) {
-				if !op.NeedAddCrontabTask(globalHook.CommonHook) {
-					return
-				}
+	var tasks []sh_task.Task
+	err := op.ModuleManager.HandleScheduleEvent(crontab,
+		func(globalHook *module_manager.GlobalHook, info controller.BindingExecutionInfo) {
+			if !op.NeedAddCrontabTask(globalHook.CommonHook) {
+				return
+			}
+			if filterFn != nil && !filterFn(globalHook.GetName(), info.Binding) {
+				return
+			}
 
-				hookLabels := utils.MergeLabels(logLabels, map[string]string{
-					"hook":      globalHook.GetName(),
-					"hook.type": "module",
-					"queue":     info.QueueName,
+			hookLabels := utils.MergeLabels(logLabels, map[string]string{
+				"hook":      globalHook.GetName(),
+				"hook.type": "module",
+				"queue":     info.QueueName,
+			})
+			if len(info.BindingContext) > 0 {
+				hookLabels["binding.name"] = info.BindingContext[0].Binding
+			}
+			delete(hookLabels, "task.id")
+			newTask := sh_task.NewTask(task.GlobalHookRun).
+				WithLogLabels(hookLabels).
+				WithQueueName(info.QueueName).
+				WithMetadata(task.HookMetadata{
+					EventDescription:         "Schedule",
+					HookName:                 globalHook.GetName(),
+					BindingType:              Schedule,
+					BindingContext:           info.BindingContext,
+					AllowFailure:             info.AllowFailure,
+					ReloadAllOnValuesChanges: true,
 				})
-				if len(info.BindingContext) > 0 {
-					hookLabels["binding.name"] = info.BindingContext[0].Binding
-				}
-				delete(hookLabels, "task.id")
-				newTask := sh_task.NewTask(task.GlobalHookRun).
-					WithLogLabels(hookLabels).
-					WithQueueName(info.QueueName).
-					WithMetadata(task.HookMetadata{
-						EventDescription:         "Schedule",
-						HookName:                 globalHook.GetName(),
-						BindingType:              Schedule,
-						BindingContext:           info.BindingContext,
-						AllowFailure:             info.AllowFailure,
-						ReloadAllOnValuesChanges: true,
-					})
 
-				tasks = append(tasks, newTask)
-			},
-			func(module *module_manager.Module, moduleHook *module_manager.ModuleHook, info controller.BindingExecutionInfo) {
-				if !op.NeedAddCrontabTask(moduleHook.CommonHook) {
-					return
-				}
+			tasks = append(tasks, newTask)
+		},
+		func(module *module_manager.Module, moduleHook *module_manager.ModuleHook, info controller.BindingExecutionInfo) {
+			if !op.NeedAddCrontabTask(moduleHook.CommonHook) {
+				return
+			}
+			if filterFn != nil && !filterFn(moduleHook.GetName(), info.Binding) {
+				return
+			}
 
-				hookLabels := utils.MergeLabels(logLabels, map[string]string{
-					"module":    module.Name,
-					"hook":      moduleHook.GetName(),
-					"hook.type": "module",
-					"queue":     info.QueueName,
+			hookLabels := utils.MergeLabels(logLabels, map[string]string{
+				"module":    module.Name,
+				"hook":      moduleHook.GetName(),
+				"hook.type": "module",
+				"queue":     info.QueueName,
+			})
+			if len(info.BindingContext) > 0 {
+				hookLabels["binding.name"] = info.BindingContext[0].Binding
+			}
+			delete(hookLabels, "task.id")
+			newTask := sh_task.NewTask(task.ModuleHookRun).
+				WithLogLabels(hookLabels).
+				WithQueueName(info.QueueName).
+				WithMetadata(task.HookMetadata{
+					EventDescription: "Schedule",
+					ModuleName:       module.Name,
+					HookName:         moduleHook.GetName(),
+					BindingType:      Schedule,
+					BindingContext:   info.BindingContext,
+					AllowFailure:     info.AllowFailure,
 				})
-				if len(info.BindingContext) > 0 {
-					hookLabels["binding.name"] = info.BindingContext[0].Binding
-				}
-				delete(hookLabels, "task.id")
-				newTask := sh_task.NewTask(task.ModuleHookRun).
-					WithLogLabels(hookLabels).
-					WithQueueName(info.QueueName).
-					WithMetadata(task.HookMetadata{
-						EventDescription: "Schedule",
-						ModuleName:       module.Name,
-						HookName:         moduleHook.GetName(),
-						BindingType:      Schedule,
-						BindingContext:   info.BindingContext,
-						AllowFailure:     info.AllowFailure,
-					})
 
-				tasks = append(tasks, newTask)
-			})
+			tasks = append(tasks, newTask)
+		})
 
-		if err != nil {
-			logEntry.Errorf("handle schedule event '%s': %s", crontab, err)
-			return []sh_task.Task{}
+	if err != nil {
+		logEntry.Errorf("handle schedule event '%s': %s", crontab, err)
+		return []sh_task.Task{}
+	}
+
+	return tasks
+}
+
+func (op *AddonOperator) DefineEventHandlers() {
+	op.ManagerEventsHandler.WithScheduleEventHandler(func(crontab string) []sh_task.Task {
+		logLabels := map[string]string{
+			"event.id": uuid.NewV4().String(),
+			"binding":  string(Schedule),
 		}
+		logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
+		logEntry.Debugf("Create tasks for 'schedule' event '%s'", crontab)
+		tracing.RecordEvent(logLabels, "ScheduleEvent", attribute.String("crontab", crontab))
 
-		return tasks
+		return op.CreateScheduleTasks(crontab, logLabels, nil)
 	})
 
 	op.ManagerEventsHandler.WithKubeEventHandler(func(kubeEvent types.KubeEvent) []sh_task.Task {
@@ -314,6 +413,7 @@ func (op *AddonOperator) DefineEventHandlers() {
 		}
 		logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
 		logEntry.Debugf("Create tasks for 'kubernetes' event '%s'", kubeEvent.String())
+		tracing.RecordEvent(logLabels, "KubernetesEvent", attribute.String("kube_event", kubeEvent.String()))
 
 		var tasks []sh_task.Task
 		op.ModuleManager.HandleKubeEvent(kubeEvent,
@@ -386,6 +486,10 @@ func (op *AddonOperator) Start() {
 	// Start emit "live" metrics
 	op.RunAddonOperatorMetrics()
 
+	// Restore module states and pending tasks saved before restart.
+	op.RestoreStateCheckpoint()
+	op.StartStateCheckpoints()
+
 	// Prepopulate main queue with onStartup tasks and enable kubernetes bindings tasks.
 	op.PrepopulateMainQueue(op.TaskQueues)
 	// Start main task queue handler
@@ -401,6 +505,10 @@ func (op *AddonOperator) Start() {
 	//op.HookManager.EnableScheduleBindings()
 	op.ScheduleManager.Start()
 
+	if op.ModuleStatusManager != nil {
+		op.ModuleStatusManager.Start()
+	}
+
 	op.ModuleManager.Start()
 	op.StartModuleManagerEventHandler()
 }
@@ -409,7 +517,9 @@ func (op *AddonOperator) Start() {
 // and tasks to enable kubernetes bindings.
 func (op *AddonOperator) PrepopulateMainQueue(tqs *queue.TaskQueueSet) {
 	onStartupLabels := map[string]string{}
+	onStartupLabels["event.id"] = uuid.NewV4().String()
 	onStartupLabels["event.type"] = "OperatorStartup"
+	tracing.RecordEvent(onStartupLabels, "OperatorStartup")
 
 	// create onStartup for global hooks
 	logEntry := log.WithFields(utils.LabelsToLogFields(onStartupLabels))
@@ -755,6 +865,7 @@ func (op *AddonOperator) StartModuleManagerEventHandler() {
 					eventLogEntry.WithFields(utils.LabelsToLogFields(newTask.LogLabels)).
 						Infof("queue task %s - module manager is in ambiguous state", newTask.GetDescription())
 				}
+				tracing.RecordEvent(logLabels, logLabels["event.type"])
 			case absentResourcesEvent := <-op.HelmResourcesManager.Ch():
 				logLabels := map[string]string{
 					"event.id": uuid.NewV4().String(),
@@ -768,6 +879,9 @@ func (op *AddonOperator) StartModuleManagerEventHandler() {
 				// Do not add ModuleRun task if it is already queued.
 				hasTask := QueueHasPendingModuleRunTask(op.TaskQueues.GetMain(), absentResourcesEvent.ModuleName)
 				if !hasTask {
+					tracing.RecordEvent(logLabels, "DetectAbsentHelmResources", attribute.Int("absent_resources", len(absentResourcesEvent.Absent)))
+					op.EventRecorder.ModuleEvent(absentResourcesEvent.ModuleName, v1.EventTypeWarning, module_events.HelmResourcesAbsent,
+						"%d resources of the release are absent, queue ModuleRun to repair", len(absentResourcesEvent.Absent))
 					newTask := sh_task.NewTask(task.ModuleRun).
 						WithLogLabels(logLabels).
 						WithQueueName("main").
@@ -781,21 +895,117 @@ func (op *AddonOperator) StartModuleManagerEventHandler() {
 				} else {
 					eventLogEntry.Infof("Got %d absent module resources, ModuleRun task already queued", len(absentResourcesEvent.Absent))
 				}
+			case driftEvent := <-op.HelmResourcesManager.DriftCh():
+				op.HandleDriftedResources(driftEvent)
 			}
 		}
 	}()
 }
 
+// HandleDriftedResources reports resources changed in cluster and queues ModuleRun
+// to repair them if the module has the "repair" drift policy.
+func (op *AddonOperator) HandleDriftedResources(event hr_types.DriftedResourcesEvent) {
+	logLabels := map[string]string{
+		"event.id": uuid.NewV4().String(),
+		"module":   event.ModuleName,
+	}
+	eventLogEntry := log.WithField("operator.component", "handleManagerEvents").
+		WithFields(utils.LabelsToLogFields(logLabels))
+
+	m := op.ModuleManager.GetModule(event.ModuleName)
+	if m == nil {
+		return
+	}
+	policy := m.Definition.HelmDriftPolicy()
+	if policy == module_manager.HelmDriftIgnore {
+		return
+	}
+
+	op.MetricStorage.GaugeSet("{PREFIX}module_drifted_resources", float64(len(event.Drifted)), map[string]string{"module": event.ModuleName})
+	for _, drift := range event.Drifted {
+		eventLogEntry.Warnf("Resource %s is drifted from the release manifest: fields %s are changed by %s",
+			drift.Id(), strings.Join(drift.Fields, ", "), strings.Join(drift.Managers, ", "))
+	}
+
+	if policy != module_manager.HelmDriftRepair {
+		return
+	}
+	if len(event.Drifted) == 0 {
+		op.DriftRepairs.Reset(event.ModuleName)
+		return
+	}
+
+	// Do not add ModuleRun task if it is already queued.
+	if QueueHasPendingModuleRunTask(op.TaskQueues.GetMain(), event.ModuleName) {
+		eventLogEntry.Infof("Got %d drifted module resources, ModuleRun task already queued", len(event.Drifted))
+		return
+	}
+
+	now := time.Now()
+	delay, canRepair := op.DriftRepairs.Next(event.ModuleName, now)
+	if !canRepair {
+		eventLogEntry.Warnf("Got %d drifted module resources, %d repair attempts are failed: repair is stopped until drift is resolved",
+			len(event.Drifted), op.DriftRepairs.Attempts(event.ModuleName))
+		return
+	}
+	if delay > 0 {
+		moduleName := event.ModuleName
+		if op.DriftRepairs.Retry(moduleName, delay, func() {
+			op.HandleDriftedResources(hr_types.DriftedResourcesEvent{
+				ModuleName: moduleName,
+				Drifted:    op.HelmResourcesManager.DriftedResources(moduleName),
+			})
+		}) {
+			eventLogEntry.Infof("Got %d drifted module resources, delay repair for %s", len(event.Drifted), delay.String())
+		}
+		return
+	}
+	op.DriftRepairs.Attempt(event.ModuleName, now)
+	tracing.RecordEvent(logLabels, "DetectDriftedHelmResources", attribute.Int("drifted_resources", len(event.Drifted)))
+	op.EventRecorder.ModuleEvent(event.ModuleName, v1.EventTypeWarning, module_events.HelmResourcesDrifted,
+		"%d resources are drifted from the release manifest, queue ModuleRun to repair", len(event.Drifted))
+	newTask := sh_task.NewTask(task.ModuleRun).
+		WithLogLabels(logLabels).
+		WithQueueName("main").
+		WithMetadata(task.HookMetadata{
+			EventDescription: "DetectDriftedHelmResources",
+			ModuleName:       event.ModuleName,
+		})
+	op.TaskQueues.GetMain().AddLast(newTask.WithQueuedAt(time.Now()))
+	eventLogEntry.WithFields(utils.LabelsToLogFields(newTask.LogLabels)).
+		Infof("queue task %s - got %d drifted module resources", newTask.GetDescription(), len(event.Drifted))
+}
+
 // TasksRunner handle tasks in queue.
 func (op *AddonOperator) TaskHandler(t sh_task.Task) queue.TaskResult {
 	var taskLogLabels = utils.MergeLabels(map[string]string{
 		"operator.component": "taskRunner",
 	}, t.GetLogLabels())
+
+	span := tracing.StartTaskSpan(t.GetId(), taskLogLabels, string(t.GetType()), taskSpanAttributes(t)...)
+	res := op.handleTask(t, taskLogLabels)
+	tracing.EndTaskSpan(t.GetId(), span, res.Status, taskFailureMessage(t))
+	return res
+}
+
+func (op *AddonOperator) handleTask(t sh_task.Task, taskLogLabels map[string]string) queue.TaskResult {
 	var taskLogEntry = log.WithFields(utils.LabelsToLogFields(taskLogLabels))
 	var res queue.TaskResult
 
 	op.UpdateWaitInQueueMetric(t)
 
+	if op.SkipPausedModuleTask(t, taskLogLabels) {
+		return queue.TaskResult{Status: "Success"}
+	}
+
+	if op.DeferMaintenanceTask(t, taskLogLabels) {
+		return queue.TaskResult{Status: "Success"}
+	}
+
+	if op.RedirectToQuarantine(t, taskLogLabels) {
+		return queue.TaskResult{Status: "Success"}
+	}
+
 	switch t.GetType() {
 	case task.GlobalHookRun:
 		res = op.HandleGlobalHookRun(t, taskLogLabels)
@@ -967,14 +1177,28 @@ func (op *AddonOperator) TaskHandler(t sh_task.Task) queue.TaskResult {
 	case task.ModuleRun:
 		res = op.HandleModuleRun(t, taskLogLabels)
 
+	case task.ParallelModuleRunsWait:
+		res = op.HandleParallelModuleRunsWait(t, taskLogLabels)
+
 	case task.ModuleDelete:
+		if protectRes, handled := op.ProtectModuleDeletion(t, taskLogLabels); handled {
+			res = protectRes
+			break
+		}
 		// TODO wait while module's tasks in other queues are done.
 		hm := task.HookMetadataAccessor(t)
 		taskLogEntry.Infof("Module delete '%s'", hm.ModuleName)
 		// Remove all hooks from parallel queues.
 		op.DrainModuleQueues(hm.ModuleName)
+		op.RemoveQuarantineQueue(hm.ModuleName)
 		err := op.ModuleManager.DeleteModule(hm.ModuleName, t.GetLogLabels())
+		op.SetModuleStatusAfterDelete(hm.ModuleName, err)
 		if err != nil {
+			// State is reset only after a successful delete.
+			if module := op.ModuleManager.GetModule(hm.ModuleName); module != nil {
+				module.State.RunStatus.Finish(err)
+			}
+			op.EventRecorder.ModuleEvent(hm.ModuleName, v1.EventTypeWarning, module_events.ModuleDeleteFailed, "Module delete failed: %v", err)
 			op.MetricStorage.CounterAdd("{PREFIX}module_delete_errors_total", 1.0, map[string]string{"module": hm.ModuleName})
 			taskLogEntry.Errorf("Module delete failed, requeue task to retry after delay. Failed count is %d. Error: %s", t.GetFailureCount()+1, err)
 			t.UpdateFailureMessage(err.Error())
@@ -982,6 +1206,8 @@ func (op *AddonOperator) TaskHandler(t sh_task.Task) queue.TaskResult {
 			res.Status = "Fail"
 		} else {
 			taskLogEntry.Infof("Module delete success '%s'", hm.ModuleName)
+			op.ConsumeDeletionConfirmation(t, taskLogLabels)
+			op.EventRecorder.ModuleEvent(hm.ModuleName, v1.EventTypeNormal, module_events.ModuleDisabled, "Module is disabled")
 			res.Status = "Success"
 		}
 
@@ -989,16 +1215,34 @@ func (op *AddonOperator) TaskHandler(t sh_task.Task) queue.TaskResult {
 		res = op.HandleModuleHookRun(t, taskLogLabels)
 
 	case task.ModulePurge:
+		if protectRes, handled := op.ProtectModuleDeletion(t, taskLogLabels); handled {
+			res = protectRes
+			break
+		}
 		// Purge is for unknown modules, so error is just ignored.
 		taskLogEntry.Infof("Module purge start")
 		hm := task.HookMetadataAccessor(t)
 
+		if app.HelmDryRun {
+			taskLogEntry.Infof("Module purge is skipped in dry-run mode")
+			res.Status = "Success"
+			break
+		}
+
+		if app.PurgeProtection == module_manager.DeletionProtectionOrphan {
+			taskLogEntry.Warnf("Module purge is skipped: release '%s' is orphaned by the purge protection", hm.ModuleName)
+			res.Status = "Success"
+			break
+		}
+
 		err := helm.NewClient(t.GetLogLabels()).DeleteRelease(hm.ModuleName)
 		if err != nil {
 			taskLogEntry.Warnf("Module purge failed, no retry. Error: %s", err)
 		} else {
 			taskLogEntry.Infof("Module purge success")
 		}
+		// Purge is not retried, so the confirmation is used anyway.
+		op.ConsumeDeletionConfirmation(t, taskLogLabels)
 		res.Status = "Success"
 
 	case task.ModuleManagerRetry:
@@ -1297,20 +1541,39 @@ func (op *AddonOperator) HandleModuleRun(t sh_task.Task, labels map[string]strin
 
 	// Phase with helm hooks and helm chart.
 	if moduleRunErr == nil && module.State.OnStartupDone && module.State.SynchronizationDone {
+		// Result is handled by the ParallelModuleRunsWait task.
+		if hm.ParallelHelmPhase && op.ModuleRunPool != nil {
+			logEntry.Info("ModuleRun 'Helm' phase is started in background")
+			// The task span is ended before the helm phase, keep it as a parent for helm spans.
+			runLabels := tracing.WithTaskSpanLabels(t.GetLogLabels())
+			op.ModuleRunPool.Submit(hm.ModuleName, module.Definition.Requires, t, func() (bool, error) {
+				valuesChanged, err := module.Run(runLabels)
+				module.State.RunStatus.Finish(err)
+				return valuesChanged, err
+			})
+			res.Status = "Success"
+			return
+		}
+
 		logEntry.Info("ModuleRun 'Helm' phase")
 		// run beforeHelm, helm, afterHelm
 		valuesChanged, moduleRunErr = module.Run(t.GetLogLabels())
 	}
 
+	module.State.RunStatus.Finish(moduleRunErr)
+	op.SetModuleStatusAfterRun(hm.ModuleName, moduleRunErr)
+
 	if moduleRunErr != nil {
 		op.MetricStorage.CounterAdd("{PREFIX}module_run_errors_total", 1.0, map[string]string{"module": hm.ModuleName})
 		logEntry.WithField("module.state", "failed").
 			Errorf("ModuleRun failed. Requeue task to retry after delay. Failed count is %d. Error: %s", t.GetFailureCount()+1, moduleRunErr)
 		t.UpdateFailureMessage(moduleRunErr.Error())
 		t.WithQueuedAt(time.Now())
-		res.Status = "Fail"
+		res = op.HandleTaskFailure(t, labels)
+		res = op.QuarantineFailedModuleRun(t, res, labels)
 	} else {
 		res.Status = "Success"
+		op.ReleaseFromQuarantine(t, labels)
 		if valuesChanged {
 			logEntry.WithField("module.state", "restart").
 				Infof("ModuleRun success, values changed, restart module")
@@ -1336,6 +1599,68 @@ func (op *AddonOperator) HandleModuleRun(t sh_task.Task, labels map[string]strin
 	return
 }
 
+// HandleParallelModuleRunsWait waits until helm phases started by ModuleRun tasks
+// are finished. Failed modules and modules with changed values are queued
+// as usual ModuleRun tasks to run before next tasks in the main queue.
+func (op *AddonOperator) HandleParallelModuleRunsWait(t sh_task.Task, labels map[string]string) (res queue.TaskResult) {
+	logEntry := log.WithFields(utils.LabelsToLogFields(labels))
+
+	res.Status = "Success"
+	if op.ModuleRunPool == nil {
+		return
+	}
+
+	if running := op.ModuleRunPool.Running(); running > 0 {
+		// Throttle debug messages: print state every 5s
+		if time.Now().UnixNano()%5000000000 == 0 {
+			logEntry.Debugf("Wait for %d modules in background", running)
+		}
+		t.WithQueuedAt(time.Now())
+		res.Status = "Repeat"
+		return
+	}
+
+	newTasks := make([]sh_task.Task, 0)
+	for _, result := range op.ModuleRunPool.Results() {
+		runLabels := result.Task.GetLogLabels()
+		runLogEntry := log.WithFields(utils.LabelsToLogFields(runLabels))
+
+		op.SetModuleStatusAfterRun(result.ModuleName, result.Err)
+
+		hm := task.HookMetadataAccessor(result.Task)
+		hm.OnStartupHooks = false
+		hm.ParallelHelmPhase = false
+
+		if result.Err != nil {
+			op.MetricStorage.CounterAdd("{PREFIX}module_run_errors_total", 1.0, map[string]string{"module": result.ModuleName})
+			runLogEntry.WithField("module.state", "failed").
+				Errorf("ModuleRun failed in background. Queue ModuleRun task to retry. Error: %s", result.Err)
+		} else if result.ValuesChanged {
+			runLogEntry.WithField("module.state", "restart").
+				Infof("ModuleRun success in background, values changed, restart module")
+			if !strings.Contains(hm.EventDescription, "AfterHelmHooksChangeModuleValues") {
+				hm.EventDescription += ".AfterHelmHooksChangeModuleValues"
+			}
+		} else {
+			runLogEntry.WithField("module.state", "ready").
+				Infof("ModuleRun success in background, module is ready")
+			continue
+		}
+
+		newLabels := utils.MergeLabels(runLabels)
+		delete(newLabels, "task.id")
+		newTask := sh_task.NewTask(task.ModuleRun).
+			WithLogLabels(newLabels).
+			WithQueueName(t.GetQueueName()).
+			WithMetadata(hm)
+		newTasks = append(newTasks, newTask.WithQueuedAt(time.Now()))
+	}
+
+	logEntry.Infof("Modules in background are done, %d ModuleRun tasks are queued", len(newTasks))
+	res.HeadTasks = newTasks
+	return
+}
+
 func (op *AddonOperator) HandleModuleHookRun(t sh_task.Task, labels map[string]string) (res queue.TaskResult) {
 	defer trace.StartRegion(context.Background(), "ModuleHookRun").End()
 
@@ -1445,9 +1770,10 @@ func (op *AddonOperator) HandleModuleHookRun(t sh_task.Task, labels map[string]s
 
 	if shouldRunHook {
 		// Module hook can recreate helm objects, so pause resources monitor.
-		// Parallel hooks can interfere, so pause-resume only for hooks in the main queue.
+		// Parallel hooks can interfere, so pause-resume only for hooks in the main queue
+		// and in the quarantine queue of the module: they run sequentially with ModuleRun.
 		// FIXME pause-resume for parallel hooks
-		if t.GetQueueName() == "main" {
+		if t.GetQueueName() == "main" || t.GetQueueName() == QuarantineQueueName(hm.ModuleName) {
 			op.HelmResourcesManager.PauseMonitor(hm.ModuleName)
 			defer op.HelmResourcesManager.ResumeMonitor(hm.ModuleName)
 		}
@@ -1467,7 +1793,7 @@ func (op *AddonOperator) HandleModuleHookRun(t sh_task.Task, labels map[string]s
 				logEntry.Errorf("Module hook failed, requeue task to retry after delay. Failed count is %d. Error: %s", t.GetFailureCount()+1, err)
 				t.UpdateFailureMessage(err.Error())
 				t.WithQueuedAt(time.Now())
-				res.Status = "Fail"
+				res = op.HandleTaskFailure(t, labels)
 			}
 		} else {
 			success = 1.0
@@ -1619,7 +1945,7 @@ func (op *AddonOperator) HandleGlobalHookRun(t sh_task.Task, labels map[string]s
 				logEntry.Errorf("Global hook failed, requeue task to retry after delay. Failed count is %d. Error: %s", t.GetFailureCount()+1, err)
 				t.UpdateFailureMessage(err.Error())
 				t.WithQueuedAt(time.Now())
-				res.Status = "Fail"
+				res = op.HandleTaskFailure(t, labels)
 			}
 		} else {
 			// Calculate new checksum of *Enabled values.
@@ -1744,6 +2070,7 @@ func (op *AddonOperator) RunDiscoverModulesState(discoverTask sh_task.Task, logL
 	if err != nil {
 		return nil, err
 	}
+	op.ReportModuleConflicts(modulesState.ConflictingModules, logLabels)
 
 	var newTasks []sh_task.Task
 
@@ -1755,6 +2082,7 @@ func (op *AddonOperator) RunDiscoverModulesState(discoverTask sh_task.Task, logL
 	}
 
 	// queue ModuleRun tasks for enabled modules
+	parallelHelmPhase := op.ModuleRunPool != nil && len(modulesState.EnabledModules) > 1
 	for _, moduleName := range modulesState.EnabledModules {
 		newLogLabels := utils.MergeLabels(logLabels)
 		newLogLabels["module"] = moduleName
@@ -1766,18 +2094,39 @@ func (op *AddonOperator) RunDiscoverModulesState(discoverTask sh_task.Task, logL
 			for _, name := range modulesState.NewlyEnabledModules {
 				if name == moduleName {
 					runOnStartupHooks = true
+					// All modules are newly enabled on startup, report only changes.
+					op.EventRecorder.ModuleEvent(moduleName, v1.EventTypeNormal, module_events.ModuleEnabled, "Module is enabled")
 					break
 				}
 			}
 		}
 
 		newTask := sh_task.NewTask(task.ModuleRun).
+			WithLogLabels(newLogLabels).
+			WithQueueName("main").
+			WithMetadata(task.HookMetadata{
+				EventDescription:  eventDescription,
+				ModuleName:        moduleName,
+				OnStartupHooks:    runOnStartupHooks,
+				ParallelHelmPhase: parallelHelmPhase,
+			})
+		newTasks = append(newTasks, newTask)
+		op.SetModuleStatusEnabled(moduleName)
+
+		logEntry.WithFields(utils.LabelsToLogFields(newTask.LogLabels)).
+			Infof("queue task %s", newTask.GetDescription())
+	}
+
+	// Wait for helm phases started in background before ModuleDelete and afterAll hooks.
+	if parallelHelmPhase {
+		newLogLabels := utils.MergeLabels(logLabels)
+		delete(newLogLabels, "task.id")
+
+		newTask := sh_task.NewTask(task.ParallelModuleRunsWait).
 			WithLogLabels(newLogLabels).
 			WithQueueName("main").
 			WithMetadata(task.HookMetadata{
 				EventDescription: eventDescription,
-				ModuleName:       moduleName,
-				OnStartupHooks:   runOnStartupHooks,
 			})
 		newTasks = append(newTasks, newTask)
 
@@ -1919,6 +2268,10 @@ func (op *AddonOperator) SetupDebugServerHandles() {
 		return op.ModuleManager.GlobalValues()
 	})
 
+	op.DebugServer.Route("/global/provenance.{format:(json|yaml)}", func(_ *http.Request) (interface{}, error) {
+		return op.ModuleManager.GlobalValuesProvenance()
+	})
+
 	op.DebugServer.Route("/global/config.{format:(json|yaml)}", func(_ *http.Request) (interface{}, error) {
 		return op.ModuleManager.GlobalConfigValues(), nil
 	})
@@ -1927,6 +2280,10 @@ func (op *AddonOperator) SetupDebugServerHandles() {
 		return op.ModuleManager.GlobalValuesPatches(), nil
 	})
 
+	op.DebugServer.Route("/global/patches/history.{format:(json|yaml)}", func(_ *http.Request) (interface{}, error) {
+		return op.ModuleManager.GlobalValuesPatchHistory(), nil
+	})
+
 	op.DebugServer.Route("/global/snapshots.{format:(json|yaml)}", func(r *http.Request) (interface{}, error) {
 		kubeHookNames := op.ModuleManager.GetGlobalHooksInOrder(OnKubernetesEvent)
 		snapshots := make(map[string]interface{})
@@ -1938,11 +2295,27 @@ func (op *AddonOperator) SetupDebugServerHandles() {
 		return snapshots, nil
 	})
 
+	op.DebugServer.Route("/maintenance.{format:(json|yaml)}", func(_ *http.Request) (interface{}, error) {
+		return op.MaintenanceStatus(), nil
+	})
+
+	op.DebugServer.RoutePOST("/maintenance/{mode:(off|helm|all)}", func(r *http.Request) (interface{}, error) {
+		mode, err := ParseMaintenanceMode(chi.URLParam(r, "mode"))
+		if err != nil {
+			return nil, err
+		}
+		op.SetMaintenanceMode(mode)
+		return op.MaintenanceStatus(), nil
+	})
+
 	op.DebugServer.Route("/module/list.{format:(json|yaml|text)}", func(_ *http.Request) (interface{}, error) {
-		return map[string][]string{"enabledModules": op.ModuleManager.GetModuleNamesInOrder()}, nil
+		return map[string][]string{
+			"enabledModules": op.ModuleManager.GetModuleNamesInOrder(),
+			"pausedModules":  op.PausedModules.List(),
+		}, nil
 	})
 
-	op.DebugServer.Route("/module/{name}/{type:(config|values)}.{format:(json|yaml)}", func(r *http.Request) (interface{}, error) {
+	op.DebugServer.Route("/module/{name}/{type:(config|values|provenance)}.{format:(json|yaml)}", func(r *http.Request) (interface{}, error) {
 		modName := chi.URLParam(r, "name")
 		valType := chi.URLParam(r, "type")
 
@@ -1956,10 +2329,54 @@ func (op *AddonOperator) SetupDebugServerHandles() {
 			return m.ConfigValues(), nil
 		case "values":
 			return m.Values()
+		case "provenance":
+			return m.ValuesProvenance()
 		}
 		return "no values", nil
 	})
 
+	op.DebugServer.Route("/module/{name}/info.{format:(json|yaml)}", func(r *http.Request) (interface{}, error) {
+		modName := chi.URLParam(r, "name")
+
+		m := op.ModuleManager.GetModule(modName)
+		if m == nil {
+			return nil, fmt.Errorf("Module not found")
+		}
+
+		return map[string]interface{}{
+			"name":               m.Name,
+			"path":               m.Path,
+			"enabled":            m.State.Enabled,
+			"paused":             op.PausedModules.Has(m.Name),
+			"requires":           m.Definition.Requires,
+			"conflicts":          m.Definition.Conflicts,
+			"rollbackPolicy":     m.Definition.HelmRollbackPolicy(),
+			"helmRollback":       m.State.HelmRollback,
+			"driftPolicy":        m.Definition.HelmDriftPolicy(),
+			"deletionProtection": m.Definition.ModuleDeletionProtection(),
+			"drifted":            op.HelmResourcesManager.DriftedResources(m.Name),
+		}, nil
+	})
+
+	op.DebugServer.RoutePOST("/module/{name}/{action:(pause|resume)}", func(r *http.Request) (interface{}, error) {
+		modName := chi.URLParam(r, "name")
+
+		var err error
+		switch chi.URLParam(r, "action") {
+		case "pause":
+			err = op.PauseModule(modName)
+		case "resume":
+			err = op.ResumeModule(modName)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"name":   modName,
+			"paused": op.PausedModules.Has(modName),
+		}, nil
+	})
+
 	op.DebugServer.Route("/module/{name}/render", func(r *http.Request) (interface{}, error) {
 		modName := chi.URLParam(r, "name")
 
@@ -1978,6 +2395,17 @@ func (op *AddonOperator) SetupDebugServerHandles() {
 		return helmCl.Render(m.Name, m.Path, []string{valuesPath}, nil, app.Namespace)
 	})
 
+	op.DebugServer.Route("/module/{name}/diff.{format:(json|yaml|text)}", func(r *http.Request) (interface{}, error) {
+		modName := chi.URLParam(r, "name")
+
+		m := op.ModuleManager.GetModule(modName)
+		if m == nil {
+			return nil, fmt.Errorf("Module not found")
+		}
+
+		return m.HelmDiff(map[string]string{"module": m.Name})
+	})
+
 	op.DebugServer.Route("/module/{name}/patches.json", func(r *http.Request) (interface{}, error) {
 		modName := chi.URLParam(r, "name")
 
@@ -1989,6 +2417,17 @@ func (op *AddonOperator) SetupDebugServerHandles() {
 		return m.ValuesPatches(), nil
 	})
 
+	op.DebugServer.Route("/module/{name}/patches/history.{format:(json|yaml)}", func(r *http.Request) (interface{}, error) {
+		modName := chi.URLParam(r, "name")
+
+		m := op.ModuleManager.GetModule(modName)
+		if m == nil {
+			return nil, fmt.Errorf("Module not found")
+		}
+
+		return m.ValuesPatchHistory(), nil
+	})
+
 	op.DebugServer.Route("/module/resource-monitor.{format:(json|yaml)}", func(_ *http.Request) (interface{}, error) {
 		dump := map[string]interface{}{}
 
@@ -2050,6 +2489,11 @@ func (op *AddonOperator) SetupHttpServerHandles() {
 	})
 
 	http.HandleFunc("/ready", func(w http.ResponseWriter, request *http.Request) {
+		if op.LeaderElection != nil && !op.LeaderElection.IsLeader() {
+			w.WriteHeader(500)
+			_, _ = w.Write([]byte(fmt.Sprintf("Standby, leader is '%s'\n", op.LeaderElection.Leader())))
+			return
+		}
 		if op.IsStartupConvergeDone() {
 			w.WriteHeader(200)
 			_, _ = w.Write([]byte("Startup converge done.\n"))
@@ -2082,8 +2526,20 @@ func (op *AddonOperator) SetupHttpServerHandles() {
 			}
 		}
 
+		if op.ModuleQuarantine != nil {
+			if quarantined := op.ModuleQuarantine.List(); len(quarantined) > 0 {
+				statusLines = append(statusLines, fmt.Sprintf("QUARANTINED_MODULES: %s", strings.Join(quarantined, ", ")))
+			}
+		}
+
+		if mode := op.Maintenance.Mode(); mode != MaintenanceOff {
+			statusLines = append(statusLines, fmt.Sprintf("MAINTENANCE: %s, %d deferred tasks", mode, len(op.Maintenance.Pending())))
+		}
+
 		_, _ = writer.Write([]byte(strings.Join(statusLines, "\n") + "\n"))
 	})
+
+	http.HandleFunc("/status/v1", op.handleStatusV1)
 }
 
 func (op *AddonOperator) MainQueueHasConvergeTasks() int {
@@ -2091,7 +2547,7 @@ func (op *AddonOperator) MainQueueHasConvergeTasks() int {
 	op.TaskQueues.GetMain().Iterate(func(t sh_task.Task) {
 		ttype := t.GetType()
 		switch ttype {
-		case task.ModuleRun, task.DiscoverModulesState, task.ModuleDelete, task.ModulePurge, task.ModuleManagerRetry, task.ReloadAllModules, task.GlobalHookEnableKubernetesBindings, task.GlobalHookEnableScheduleBindings:
+		case task.ModuleRun, task.ParallelModuleRunsWait, task.DiscoverModulesState, task.ModuleDelete, task.ModulePurge, task.ModuleManagerRetry, task.ReloadAllModules, task.GlobalHookEnableKubernetesBindings, task.GlobalHookEnableScheduleBindings:
 			convergeTasks++
 			return
 		}
@@ -2132,6 +2588,7 @@ func (op *AddonOperator) CheckConvergeStatus(t sh_task.Task) {
 		if !op.IsStartupConvergeDone() && op.StartupConvergeStarted {
 			logEntry.Infof("First converge is finished. Operator is ready now.")
 			op.SetStartupConvergeDone()
+			op.ResumePendingTasks()
 		}
 		if op.ConvergeStarted != 0 {
 			convergeSeconds := time.Duration(time.Now().UnixNano() - op.ConvergeStarted).Seconds()
@@ -2145,6 +2602,18 @@ func (op *AddonOperator) CheckConvergeStatus(t sh_task.Task) {
 func (op *AddonOperator) Shutdown() {
 	op.KubeConfigManager.Stop()
 	op.ShellOperator.Shutdown()
+	// Standby replica has nothing to save.
+	if op.LeaderElection == nil || op.LeaderElection.IsLeader() {
+		op.SaveStateCheckpoint()
+	}
+	// Release the Lease after queues are stopped.
+	if op.LeaderElection != nil {
+		op.LeaderElection.Stop(5 * time.Second)
+	}
+	op.EventRecorder.Stop()
+	if err := tracing.Shutdown(5 * time.Second); err != nil {
+		log.Warnf("Send spans before shutdown: %v", err)
+	}
 }
 
 func DefaultOperator() *AddonOperator {
@@ -2169,6 +2638,12 @@ func InitAndStart(operator *AddonOperator) error {
 		return err
 	}
 
+	err = tracing.Init(app.TracingExporter, app.TracingEndpoint, app.TracingInsecure)
+	if err != nil {
+		log.Errorf("INIT tracing failed: %v", err)
+		return err
+	}
+
 	// Create a default 'main' Kubernetes client if not initialized externally.
 	// Register metrics for kubernetes client with the default custom label "component".
 	if operator.KubeClient == nil {
@@ -2198,6 +2673,19 @@ func InitAndStart(operator *AddonOperator) error {
 		return err
 	}
 
+	if app.LeaderElection {
+		err = operator.InitLeaderElection(operator.Start)
+		if err != nil {
+			log.Errorf("INIT leader election failed: %v", err)
+			return err
+		}
+		// Informers are started before the election to be ready when the Lease is acquired.
+		operator.StartStandby()
+		log.Infof("Wait for Lease '%s' in namespace '%s' as '%s'", app.LeaderElectionLeaseName, app.Namespace, operator.LeaderElection.Identity())
+		operator.LeaderElection.Start(operator.ctx)
+		return nil
+	}
+
 	operator.Start()
 	return nil
 }
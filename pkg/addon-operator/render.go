@@ -0,0 +1,81 @@
+package addon_operator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	sh_app "github.com/flant/shell-operator/pkg/app"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/flant/addon-operator/pkg/app"
+	"github.com/flant/addon-operator/pkg/helm/helm3lib"
+	"github.com/flant/addon-operator/pkg/module_manager"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// RenderModules renders charts of modules without a cluster. Values are prepared from
+// static values and config values files, hooks and enabled scripts are not executed.
+func RenderModules() error {
+	configValues := make(utils.Values)
+	for _, path := range app.RenderConfigValuesFiles {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read config values: %v", err)
+		}
+		values, err := utils.NewValuesFromBytes(data)
+		if err != nil {
+			return fmt.Errorf("config values file '%s': %v", path, err)
+		}
+		configValues = utils.MergeValues(configValues, values)
+	}
+
+	if err := os.MkdirAll(sh_app.TempDir, os.FileMode(0777)); err != nil {
+		return fmt.Errorf("create temp dir: %v", err)
+	}
+	tempDir, err := ioutil.TempDir(sh_app.TempDir, "render-")
+	if err != nil {
+		return fmt.Errorf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	mm := module_manager.NewMainModuleManager()
+	mm.WithDirectories(app.RenderModulesDir, app.RenderGlobalHooksDir, tempDir)
+
+	if err := mm.InitOffline(configValues); err != nil {
+		return fmt.Errorf("init modules: %v", err)
+	}
+
+	renders, err := mm.RenderModules(app.RenderModules, func(releaseName string, chartPath string, valuesPath string) (string, error) {
+		return helm3lib.RenderClientOnly(releaseName, chartPath, []string{valuesPath}, app.Namespace)
+	})
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, render := range renders {
+		if render.Error != "" {
+			failed++
+			log.Errorf("Module '%s' render failed: %s", render.Module, render.Error)
+			continue
+		}
+
+		if app.RenderOutputDir != "" {
+			path := filepath.Join(app.RenderOutputDir, render.Module+".yaml")
+			if err := ioutil.WriteFile(path, []byte(render.Manifests), 0644); err != nil {
+				return fmt.Errorf("write manifests of module '%s': %v", render.Module, err)
+			}
+			log.Infof("Module '%s' is rendered into %s", render.Module, path)
+			continue
+		}
+
+		fmt.Printf("---\n# Module: %s\n%s\n", render.Module, render.Manifests)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d modules failed to render", failed, len(renders))
+	}
+	return nil
+}
@@ -0,0 +1,330 @@
+package addon_operator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	klient "github.com/flant/kube-client/client"
+	sh_task "github.com/flant/shell-operator/pkg/task"
+	"github.com/flant/shell-operator/pkg/task/queue"
+	log "github.com/sirupsen/logrus"
+	uuid "gopkg.in/satori/go.uuid.v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	. "github.com/flant/shell-operator/pkg/hook/types"
+
+	"github.com/flant/addon-operator/pkg/app"
+	"github.com/flant/addon-operator/pkg/module_manager"
+	"github.com/flant/addon-operator/pkg/task"
+	"github.com/flant/addon-operator/pkg/tracing"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+const (
+	StateCheckpointVersion = 1
+	stateCheckpointKey     = "state.json"
+)
+
+// StateCheckpoint is a state of addon-operator that is saved to resume work after restart.
+type StateCheckpoint struct {
+	Version       int                                        `json:"version"`
+	Modules       map[string]module_manager.ModuleCheckpoint `json:"modules"`
+	PendingTasks  []PendingTaskCheckpoint                    `json:"pendingTasks,omitempty"`
+	PausedModules []string                                   `json:"pausedModules,omitempty"`
+	Maintenance   MaintenanceMode                            `json:"maintenance,omitempty"`
+}
+
+// PendingTaskCheckpoint is a queued run of the hook with the schedule binding. Other tasks
+// are not saved: ModuleRun tasks and Synchronization are queued by the startup converge anyway.
+// Queued runs of hooks with kubernetes bindings are lost: hooks get the current state of objects
+// in Synchronization after restart, but not events for objects deleted in between.
+type PendingTaskCheckpoint struct {
+	Queue   string `json:"queue"`
+	Module  string `json:"module,omitempty"`
+	Hook    string `json:"hook"`
+	Binding string `json:"binding"`
+}
+
+// StateCheckpointer stores StateCheckpoint in the ConfigMap.
+type StateCheckpointer struct {
+	KubeClient    klient.Client
+	Namespace     string
+	ConfigMapName string
+
+	m         sync.Mutex
+	lastSaved []byte
+	// Pending tasks from the loaded checkpoint. They are saved again until resumed.
+	restoredTasks []PendingTaskCheckpoint
+}
+
+func NewStateCheckpointer(kubeClient klient.Client, namespace string, configMapName string) *StateCheckpointer {
+	return &StateCheckpointer{
+		KubeClient:    kubeClient,
+		Namespace:     namespace,
+		ConfigMapName: configMapName,
+	}
+}
+
+// Load returns a saved checkpoint or nil if the ConfigMap is not found.
+func (c *StateCheckpointer) Load() (*StateCheckpoint, error) {
+	obj, err := c.KubeClient.CoreV1().ConfigMaps(c.Namespace).Get(context.TODO(), c.ConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, has := obj.Data[stateCheckpointKey]
+	if !has {
+		return nil, nil
+	}
+
+	checkpoint := new(StateCheckpoint)
+	if err := json.Unmarshal([]byte(data), checkpoint); err != nil {
+		return nil, fmt.Errorf("unmarshal %s: %v", stateCheckpointKey, err)
+	}
+	if checkpoint.Version != StateCheckpointVersion {
+		return nil, fmt.Errorf("unsupported checkpoint version %d, expect %d", checkpoint.Version, StateCheckpointVersion)
+	}
+	c.m.Lock()
+	c.lastSaved = []byte(data)
+	c.restoredTasks = checkpoint.PendingTasks
+	c.m.Unlock()
+	return checkpoint, nil
+}
+
+// RestoredPendingTasks returns pending tasks from the loaded checkpoint that are not resumed yet.
+func (c *StateCheckpointer) RestoredPendingTasks() []PendingTaskCheckpoint {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return append([]PendingTaskCheckpoint{}, c.restoredTasks...)
+}
+
+// PopRestoredPendingTasks returns pending tasks from the loaded checkpoint only once.
+func (c *StateCheckpointer) PopRestoredPendingTasks() []PendingTaskCheckpoint {
+	c.m.Lock()
+	defer c.m.Unlock()
+	tasks := c.restoredTasks
+	c.restoredTasks = nil
+	return tasks
+}
+
+// Save writes the checkpoint into the ConfigMap. The ConfigMap is not updated if the checkpoint is not changed.
+func (c *StateCheckpointer) Save(checkpoint *StateCheckpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	if bytes.Equal(data, c.lastSaved) {
+		return nil
+	}
+
+	cmClient := c.KubeClient.CoreV1().ConfigMaps(c.Namespace)
+	obj, err := cmClient.Get(context.TODO(), c.ConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		obj = &v1.ConfigMap{}
+		obj.Name = c.ConfigMapName
+		obj.Data = map[string]string{stateCheckpointKey: string(data)}
+		_, err = cmClient.Create(context.TODO(), obj, metav1.CreateOptions{})
+	} else if err == nil {
+		if obj.Data == nil {
+			obj.Data = make(map[string]string)
+		}
+		obj.Data[stateCheckpointKey] = string(data)
+		_, err = cmClient.Update(context.TODO(), obj, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return err
+	}
+
+	c.lastSaved = data
+	return nil
+}
+
+// RestoreStateCheckpoint loads the checkpoint before the startup converge. Helm phase of unchanged modules
+// is skipped on the first run and pending schedule tasks are resumed after the startup converge.
+func (op *AddonOperator) RestoreStateCheckpoint() {
+	if op.StateCheckpointer == nil {
+		return
+	}
+
+	modules := make(map[string]module_manager.ModuleCheckpoint)
+	checkpoint, err := op.StateCheckpointer.Load()
+	switch {
+	case err != nil:
+		log.Errorf("Load state checkpoint from cm/%s: %v. Start from scratch.", op.StateCheckpointer.ConfigMapName, err)
+	case checkpoint == nil:
+		log.Infof("State checkpoint cm/%s is not found. Start from scratch.", op.StateCheckpointer.ConfigMapName)
+	default:
+		log.Infof("State checkpoint cm/%s is loaded: %d modules, %d pending tasks", op.StateCheckpointer.ConfigMapName, len(checkpoint.Modules), len(checkpoint.PendingTasks))
+		for moduleName, moduleCheckpoint := range checkpoint.Modules {
+			modules[moduleName] = moduleCheckpoint
+		}
+		for _, moduleName := range checkpoint.PausedModules {
+			if err := op.PauseModule(moduleName); err != nil {
+				log.Warnf("Restore paused module: %v", err)
+			}
+		}
+		// Maintenance mode from the environment takes precedence.
+		if app.MaintenanceMode == "" {
+			if mode, err := ParseMaintenanceMode(string(checkpoint.Maintenance)); err != nil {
+				log.Warnf("Restore maintenance mode: %v", err)
+			} else {
+				op.SetMaintenanceMode(mode)
+			}
+		}
+	}
+	op.ModuleManager.RestoreModuleCheckpoints(modules)
+}
+
+// StartStateCheckpoints saves the checkpoint periodically.
+func (op *AddonOperator) StartStateCheckpoints() {
+	if op.StateCheckpointer == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(app.StateCheckpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-op.ctx.Done():
+				return
+			case <-ticker.C:
+				op.SaveStateCheckpoint()
+			}
+		}
+	}()
+}
+
+func (op *AddonOperator) SaveStateCheckpoint() {
+	if op.StateCheckpointer == nil {
+		return
+	}
+	err := op.StateCheckpointer.Save(op.CollectStateCheckpoint())
+	if err != nil {
+		op.MetricStorage.CounterAdd("{PREFIX}state_checkpoint_errors_total", 1.0, map[string]string{})
+		log.Errorf("Save state checkpoint into cm/%s: %v", op.StateCheckpointer.ConfigMapName, err)
+	}
+}
+
+// CollectStateCheckpoint returns states of modules and pending schedule tasks from all queues.
+func (op *AddonOperator) CollectStateCheckpoint() *StateCheckpoint {
+	checkpoint := &StateCheckpoint{
+		Version:       StateCheckpointVersion,
+		Modules:       op.ModuleManager.ModuleCheckpoints(),
+		PendingTasks:  make([]PendingTaskCheckpoint, 0),
+		PausedModules: op.PausedModules.List(),
+		Maintenance:   op.Maintenance.Mode(),
+	}
+
+	// Restored tasks are not resumed until the startup converge is done.
+	seen := make(map[PendingTaskCheckpoint]bool)
+	if op.StateCheckpointer != nil {
+		for _, pending := range op.StateCheckpointer.RestoredPendingTasks() {
+			seen[pending] = true
+			checkpoint.PendingTasks = append(checkpoint.PendingTasks, pending)
+		}
+	}
+	op.TaskQueues.Iterate(func(q *queue.TaskQueue) {
+		q.Iterate(func(t sh_task.Task) {
+			if t.GetType() != task.GlobalHookRun && t.GetType() != task.ModuleHookRun {
+				return
+			}
+			hm := task.HookMetadataAccessor(t)
+			if hm.BindingType != Schedule || len(hm.BindingContext) == 0 {
+				return
+			}
+			pending := PendingTaskCheckpoint{
+				Queue:   t.GetQueueName(),
+				Module:  hm.ModuleName,
+				Hook:    hm.HookName,
+				Binding: hm.BindingContext[0].Binding,
+			}
+			if !seen[pending] {
+				seen[pending] = true
+				checkpoint.PendingTasks = append(checkpoint.PendingTasks, pending)
+			}
+		})
+	})
+
+	return checkpoint
+}
+
+// ResumePendingTasks queues restored schedule tasks. Tasks for removed hooks,
+// bindings and disabled modules are ignored.
+func (op *AddonOperator) ResumePendingTasks() {
+	if op.StateCheckpointer == nil {
+		return
+	}
+	pendingTasks := op.StateCheckpointer.PopRestoredPendingTasks()
+
+	logLabels := map[string]string{
+		"event.id": uuid.NewV4().String(),
+		"binding":  string(Schedule),
+	}
+	if len(pendingTasks) > 0 {
+		tracing.RecordEvent(logLabels, "ResumePendingTasks")
+	}
+
+	for _, pending := range pendingTasks {
+		crontab := op.scheduleCrontab(pending)
+		if crontab == "" {
+			log.Warnf("Pending task for hook '%s' binding '%s' is not resumed: schedule binding is not found", pending.Hook, pending.Binding)
+			continue
+		}
+
+		tasks := op.CreateScheduleTasks(crontab, logLabels, func(hookName string, bindingName string) bool {
+			return hookName == pending.Hook && bindingName == pending.Binding
+		})
+		for _, t := range tasks {
+			q := op.TaskQueues.GetByName(t.GetQueueName())
+			if q == nil {
+				log.Warnf("Pending task for hook '%s' is not resumed: queue '%s' is not found", pending.Hook, t.GetQueueName())
+				continue
+			}
+			log.WithFields(utils.LabelsToLogFields(t.GetLogLabels())).
+				Infof("Resume pending task %s", t.GetDescription())
+			q.AddLast(t.WithQueuedAt(time.Now()))
+		}
+	}
+}
+
+// scheduleCrontab returns a crontab of the hook binding or an empty string if
+// the hook or the binding is not found or the module is disabled.
+func (op *AddonOperator) scheduleCrontab(pending PendingTaskCheckpoint) string {
+	var schedules []ScheduleConfig
+	if pending.Module == "" {
+		h := op.ModuleManager.GetGlobalHook(pending.Hook)
+		if h == nil || h.Config == nil {
+			return ""
+		}
+		schedules = h.Config.Schedules
+	} else {
+		module := op.ModuleManager.GetModule(pending.Module)
+		if module == nil || !module.State.Enabled {
+			return ""
+		}
+		h := op.ModuleManager.GetModuleHook(pending.Hook)
+		if h == nil || h.Config == nil {
+			return ""
+		}
+		schedules = h.Config.Schedules
+	}
+
+	for _, schedule := range schedules {
+		if schedule.BindingName == pending.Binding {
+			return schedule.ScheduleEntry.Crontab
+		}
+	}
+	return ""
+}
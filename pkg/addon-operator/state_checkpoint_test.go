@@ -0,0 +1,64 @@
+package addon_operator
+
+import (
+	"context"
+	"testing"
+
+	klient "github.com/flant/kube-client/client"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/flant/addon-operator/pkg/module_manager"
+)
+
+func Test_StateCheckpointer_SaveLoad(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeClient := klient.NewFake(nil)
+	checkpointer := NewStateCheckpointer(kubeClient, "default", "addon-operator-state")
+
+	// No ConfigMap: start from scratch.
+	checkpoint, err := checkpointer.Load()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(checkpoint).To(BeNil())
+
+	saved := &StateCheckpoint{
+		Version: StateCheckpointVersion,
+		Modules: map[string]module_manager.ModuleCheckpoint{
+			"module-one": {HelmChecksum: "abc"},
+		},
+		PendingTasks: []PendingTaskCheckpoint{
+			{Queue: "main", Hook: "hook.sh", Binding: "every-minute"},
+		},
+	}
+	g.Expect(checkpointer.Save(saved)).Should(Succeed())
+
+	cm, err := kubeClient.CoreV1().ConfigMaps("default").Get(context.TODO(), "addon-operator-state", metav1.GetOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(cm.Data).To(HaveKey(stateCheckpointKey))
+
+	// Unchanged checkpoint is not written: deleted ConfigMap is not recreated.
+	g.Expect(kubeClient.CoreV1().ConfigMaps("default").Delete(context.TODO(), "addon-operator-state", metav1.DeleteOptions{})).Should(Succeed())
+	g.Expect(checkpointer.Save(saved)).Should(Succeed())
+	_, err = kubeClient.CoreV1().ConfigMaps("default").Get(context.TODO(), "addon-operator-state", metav1.GetOptions{})
+	g.Expect(err).Should(HaveOccurred())
+	_, err = kubeClient.CoreV1().ConfigMaps("default").Create(context.TODO(), cm, metav1.CreateOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// Checkpoint is loaded after restart and pending tasks are returned once.
+	restarted := NewStateCheckpointer(kubeClient, "default", "addon-operator-state")
+	checkpoint, err = restarted.Load()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(checkpoint).To(Equal(saved))
+	g.Expect(restarted.RestoredPendingTasks()).To(Equal(saved.PendingTasks))
+	g.Expect(restarted.PopRestoredPendingTasks()).To(Equal(saved.PendingTasks))
+	g.Expect(restarted.PopRestoredPendingTasks()).To(BeEmpty())
+	g.Expect(restarted.RestoredPendingTasks()).To(BeEmpty())
+
+	// Checkpoint of the unknown version is ignored.
+	cm.Data[stateCheckpointKey] = `{"version":100}`
+	_, err = kubeClient.CoreV1().ConfigMaps("default").Update(context.TODO(), cm, metav1.UpdateOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	_, err = NewStateCheckpointer(kubeClient, "default", "addon-operator-state").Load()
+	g.Expect(err).Should(HaveOccurred())
+}
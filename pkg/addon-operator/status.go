@@ -0,0 +1,201 @@
+package addon_operator
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/flant/addon-operator/pkg/module_manager"
+	"github.com/flant/addon-operator/pkg/task"
+)
+
+const StatusAPIVersion = "v1"
+
+// Values of StartupConvergeStatus.Status.
+const (
+	StartupConvergeWaitTasks  = "WaitTasks"
+	StartupConvergeInProgress = "InProgress"
+	StartupConvergeDone       = "Done"
+)
+
+// Status is a response of the /status/v1 endpoint. New fields can be added,
+// existing fields are not changed or removed within the API version.
+type Status struct {
+	APIVersion string `json:"apiVersion"`
+	// Converged is true if startup converge is done and there are no converge tasks in the main queue.
+	Converged       bool                  `json:"converged"`
+	StartupConverge StartupConvergeStatus `json:"startupConverge"`
+	Converge        ConvergeStatus        `json:"converge"`
+	// CurrentTask is the first task in the main queue. It is nil if the queue is empty.
+	CurrentTask *CurrentTaskStatus `json:"currentTask,omitempty"`
+	Maintenance MaintenanceStatus  `json:"maintenance"`
+	Modules     []ModuleRunStatus  `json:"modules"`
+}
+
+type StartupConvergeStatus struct {
+	Status  string `json:"status"`
+	Started bool   `json:"started"`
+	Done    bool   `json:"done"`
+}
+
+type ConvergeStatus struct {
+	InProgress bool `json:"inProgress"`
+	// Tasks is a number of converge tasks in the main queue.
+	Tasks int `json:"tasks"`
+}
+
+type CurrentTaskStatus struct {
+	ID           string    `json:"id"`
+	Type         string    `json:"type"`
+	Queue        string    `json:"queue"`
+	Description  string    `json:"description"`
+	Module       string    `json:"module,omitempty"`
+	Hook         string    `json:"hook,omitempty"`
+	FailureCount int       `json:"failureCount"`
+	QueuedAt     time.Time `json:"queuedAt"`
+}
+
+type MaintenanceStatus struct {
+	Mode          string `json:"mode"`
+	DeferredTasks int    `json:"deferredTasks"`
+}
+
+type ModuleRunStatus struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	// EnabledSource is a layer that determines the enabled state:
+	// default, static, config, dynamic, enabled-script or requirements.
+	EnabledSource string `json:"enabledSource"`
+	// Phase is one of Pending, RunningHooks, Helm, Done, Failed or Disabled.
+	Phase                  string     `json:"phase"`
+	LastError              string     `json:"lastError,omitempty"`
+	LastRunTime            *time.Time `json:"lastRunTime,omitempty"`
+	LastRunDurationSeconds float64    `json:"lastRunDurationSeconds"`
+	Paused                 bool       `json:"paused"`
+	Quarantined            bool       `json:"quarantined"`
+}
+
+// Status returns the converge state and run phases of modules.
+func (op *AddonOperator) Status() Status {
+	convergeTasks := op.MainQueueHasConvergeTasks()
+
+	status := Status{
+		APIVersion: StatusAPIVersion,
+		StartupConverge: StartupConvergeStatus{
+			Started: op.StartupConvergeStarted,
+			Done:    op.IsStartupConvergeDone(),
+		},
+		Converge: ConvergeStatus{
+			InProgress: convergeTasks > 0,
+			Tasks:      convergeTasks,
+		},
+		Maintenance: MaintenanceStatus{
+			Mode:          string(op.Maintenance.Mode()),
+			DeferredTasks: len(op.Maintenance.Pending()),
+		},
+		Modules: make([]ModuleRunStatus, 0),
+	}
+
+	// The same logic as in /status/converge: startup converge is done when its tasks are gone.
+	switch {
+	case status.StartupConverge.Done:
+		status.StartupConverge.Status = StartupConvergeDone
+	case !status.StartupConverge.Started:
+		status.StartupConverge.Status = StartupConvergeWaitTasks
+	case convergeTasks > 0:
+		status.StartupConverge.Status = StartupConvergeInProgress
+	default:
+		status.StartupConverge.Status = StartupConvergeDone
+	}
+	status.Converged = status.StartupConverge.Status == StartupConvergeDone && convergeTasks == 0
+
+	mainQueue := op.TaskQueues.GetMain()
+	if t := mainQueue.GetFirst(); t != nil {
+		status.CurrentTask = &CurrentTaskStatus{
+			ID:           t.GetId(),
+			Type:         string(t.GetType()),
+			Queue:        t.GetQueueName(),
+			Description:  t.GetDescription(),
+			FailureCount: t.GetFailureCount(),
+			QueuedAt:     t.GetQueuedAt(),
+		}
+		// Not all tasks have hook metadata, HookMetadataAccessor logs an error for them.
+		if hm, ok := t.GetMetadata().(task.HookMetadata); ok {
+			status.CurrentTask.Module = hm.ModuleName
+			status.CurrentTask.Hook = hm.HookName
+		}
+	}
+
+	enabledModules := make(map[string]bool)
+	for _, name := range op.ModuleManager.GetModuleNamesInOrder() {
+		enabledModules[name] = true
+	}
+	quarantined := make(map[string]bool)
+	if op.ModuleQuarantine != nil {
+		for _, name := range op.ModuleQuarantine.List() {
+			quarantined[name] = true
+		}
+	}
+
+	enabledSources := op.ModuleManager.ModuleEnabledSources()
+	moduleNames := make([]string, 0, len(enabledSources))
+	for name := range enabledSources {
+		moduleNames = append(moduleNames, name)
+	}
+	sort.Strings(moduleNames)
+
+	for _, name := range moduleNames {
+		module := op.ModuleManager.GetModule(name)
+		if module == nil {
+			continue
+		}
+		info := module.State.RunStatus.Get()
+		enabled := enabledModules[name]
+
+		moduleStatus := ModuleRunStatus{
+			Name:          name,
+			Enabled:       enabled,
+			EnabledSource: enabledSources[name],
+			Phase:         string(moduleRunPhase(info, enabled, QueueHasPendingModuleRunTask(mainQueue, name))),
+			LastError:     info.LastError,
+			Paused:        op.PausedModules.Has(name),
+			Quarantined:   quarantined[name],
+		}
+		if !info.LastRunTime.IsZero() {
+			lastRunTime := info.LastRunTime
+			moduleStatus.LastRunTime = &lastRunTime
+			moduleStatus.LastRunDurationSeconds = info.LastRunDuration.Seconds()
+		}
+		status.Modules = append(status.Modules, moduleStatus)
+	}
+
+	return status
+}
+
+// moduleRunPhase returns a phase of the module for the status. Failed phase is kept for
+// disabled modules: it is the failed ModuleDelete.
+func moduleRunPhase(info module_manager.ModuleRunInfo, enabled bool, hasPendingRun bool) module_manager.ModuleRunPhase {
+	switch {
+	case info.Phase.IsRunning():
+		return info.Phase
+	case !enabled && info.Phase == module_manager.ModuleRunFailed:
+		return module_manager.ModuleRunFailed
+	case !enabled:
+		return module_manager.ModuleRunDisabled
+	case info.Phase == "" || hasPendingRun:
+		return module_manager.ModuleRunPending
+	}
+	return info.Phase
+}
+
+func (op *AddonOperator) handleStatusV1(writer http.ResponseWriter, _ *http.Request) {
+	data, err := json.Marshal(op.Status())
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		_, _ = writer.Write([]byte(err.Error()))
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	_, _ = writer.Write(data)
+}
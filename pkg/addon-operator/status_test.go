@@ -0,0 +1,29 @@
+package addon_operator
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/flant/addon-operator/pkg/module_manager"
+)
+
+func Test_ModuleRunPhase(t *testing.T) {
+	g := NewWithT(t)
+
+	never := module_manager.ModuleRunInfo{}
+	running := module_manager.ModuleRunInfo{Phase: module_manager.ModuleRunHelm}
+	done := module_manager.ModuleRunInfo{Phase: module_manager.ModuleRunDone}
+	failed := module_manager.ModuleRunInfo{Phase: module_manager.ModuleRunFailed, LastError: "hook failed"}
+
+	g.Expect(moduleRunPhase(never, true, false)).To(Equal(module_manager.ModuleRunPending))
+	g.Expect(moduleRunPhase(never, false, false)).To(Equal(module_manager.ModuleRunDisabled))
+	g.Expect(moduleRunPhase(running, true, true)).To(Equal(module_manager.ModuleRunHelm))
+	g.Expect(moduleRunPhase(done, true, false)).To(Equal(module_manager.ModuleRunDone))
+	// Queued ModuleRun is pending, e.g. after values change.
+	g.Expect(moduleRunPhase(done, true, true)).To(Equal(module_manager.ModuleRunPending))
+	g.Expect(moduleRunPhase(failed, true, false)).To(Equal(module_manager.ModuleRunFailed))
+	// Failed ModuleDelete.
+	g.Expect(moduleRunPhase(failed, false, false)).To(Equal(module_manager.ModuleRunFailed))
+	g.Expect(moduleRunPhase(done, false, false)).To(Equal(module_manager.ModuleRunDisabled))
+}
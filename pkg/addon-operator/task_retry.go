@@ -0,0 +1,124 @@
+package addon_operator
+
+import (
+	"fmt"
+	"time"
+
+	sh_task "github.com/flant/shell-operator/pkg/task"
+	"github.com/flant/shell-operator/pkg/task/queue"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/flant/addon-operator/pkg/task"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// TaskRetryPolicy returns a retry policy for ModuleRun, ModuleHookRun and GlobalHookRun tasks.
+// Module hook without own policy uses the policy of its module. Nil means that the task
+// is retried forever with the default delay of the queue.
+func (op *AddonOperator) TaskRetryPolicy(t sh_task.Task) *utils.RetryPolicy {
+	hm := task.HookMetadataAccessor(t)
+
+	switch t.GetType() {
+	case task.GlobalHookRun:
+		if h := op.ModuleManager.GetGlobalHook(hm.HookName); h != nil && h.Config != nil {
+			return h.Config.RetryPolicy
+		}
+	case task.ModuleHookRun:
+		if h := op.ModuleManager.GetModuleHook(hm.HookName); h != nil && h.Config != nil && h.Config.RetryPolicy != nil {
+			return h.Config.RetryPolicy
+		}
+		if m := op.ModuleManager.GetModule(hm.ModuleName); m != nil {
+			return m.Definition.TaskRetryPolicy()
+		}
+	case task.ModuleRun:
+		if m := op.ModuleManager.GetModule(hm.ModuleName); m != nil {
+			return m.Definition.TaskRetryPolicy()
+		}
+	}
+	return nil
+}
+
+// HandleTaskFailure returns a result for the failed task according to its retry policy.
+// The task is failed with the policy delay until attempts are exhausted. Then the task
+// is failed with the max delay, or is dropped from the queue, or its module is disabled.
+func (op *AddonOperator) HandleTaskFailure(t sh_task.Task, logLabels map[string]string) queue.TaskResult {
+	res := queue.TaskResult{Status: "Fail"}
+
+	policy := op.TaskRetryPolicy(t)
+	if policy == nil {
+		return res
+	}
+
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
+	hm := task.HookMetadataAccessor(t)
+
+	// Show the policy in the queue dump.
+	hm.RetryPolicy = policy
+	t.UpdateMetadata(hm)
+
+	failedAttempts := t.GetFailureCount() + 1
+	if !policy.IsExhausted(failedAttempts) {
+		res.DelayBeforeNextTask = policy.Delay(failedAttempts)
+		logEntry.Infof("Retry task after %s, failed attempts: %d, retry policy: %s", res.DelayBeforeNextTask, failedAttempts, policy)
+		return res
+	}
+
+	action := policy.ExhaustedAction()
+	if action == utils.RetryDisableModule && hm.ModuleName == "" {
+		action = utils.RetrySkip
+	}
+
+	op.MetricStorage.CounterAdd("{PREFIX}task_retries_exhausted_total", 1.0, map[string]string{
+		"module": hm.ModuleName,
+		"hook":   hm.HookName,
+		"action": action,
+	})
+
+	switch action {
+	case utils.RetrySkip:
+		logEntry.Errorf("Task is failed %d times, skip it. Retry policy: %s", failedAttempts, policy)
+		res.Status = "Success"
+	case utils.RetryDisableModule:
+		logEntry.Errorf("Task is failed %d times, disable module '%s'. Retry policy: %s", failedAttempts, hm.ModuleName, policy)
+		err := op.disableFailedModule(hm.ModuleName, logLabels)
+		if err != nil {
+			logEntry.Errorf("Disable module '%s': %v", hm.ModuleName, err)
+			res.DelayBeforeNextTask = policy.Delay(failedAttempts)
+			return res
+		}
+		res.Status = "Success"
+	default:
+		res.DelayBeforeNextTask = policy.Delay(failedAttempts)
+		logEntry.Warnf("Task is failed %d times, keep retrying after %s. Retry policy: %s", failedAttempts, res.DelayBeforeNextTask, policy)
+	}
+	return res
+}
+
+// disableFailedModule sets <moduleName>Enabled to false in dynamic enabled values
+// and queues ReloadAllModules task to stop the module.
+func (op *AddonOperator) disableFailedModule(moduleName string, logLabels map[string]string) error {
+	enabledPatch := utils.ValuesPatch{Operations: []*utils.ValuesPatchOperation{
+		{
+			Op:    "add",
+			Path:  fmt.Sprintf("/%sEnabled", utils.ModuleNameToValuesKey(moduleName)),
+			Value: false,
+		},
+	}}
+	err := op.ModuleManager.ApplyEnabledPatch(enabledPatch)
+	if err != nil {
+		return err
+	}
+
+	reloadLabels := utils.MergeLabels(logLabels)
+	delete(reloadLabels, "task.id")
+	reloadAllModulesTask := sh_task.NewTask(task.ReloadAllModules).
+		WithLogLabels(reloadLabels).
+		WithQueueName("main").
+		WithMetadata(task.HookMetadata{
+			EventDescription: fmt.Sprintf("RetryPolicy-DisableModule(%s)", moduleName),
+			OnStartupHooks:   false,
+		}).
+		WithQueuedAt(time.Now())
+	op.TaskQueues.GetMain().AddLast(reloadAllModulesTask)
+	return nil
+}
@@ -0,0 +1,21 @@
+#!/bin/bash -e
+
+if [[ "$1" == "--config" ]]; then
+  echo '{"configVersion": "v1", "kubernetes": [{"name": "pods", "apiVersion": "v1", "kind": "Pod"}]}'
+  exit 0
+fi
+
+replicas=1
+if grep -q '"replicas":3' "$CONFIG_VALUES_PATH"; then
+  replicas=3
+fi
+
+if grep -q '"type": *"Synchronization"' "$BINDING_CONTEXT_PATH"; then
+  echo "[{\"op\": \"add\", \"path\": \"/module/internal/replicas\", \"value\": ${replicas}}]" > "$VALUES_JSON_PATCH_PATH"
+  echo '{"name": "module_hook_runs", "action": "add", "value": 1}' > "$METRICS_PATH"
+  exit 0
+fi
+
+cat > "$KUBERNETES_PATCH_PATH" <<EOP
+{"operation": "Delete", "kind": "Pod", "namespace": "default", "name": "pod-0"}
+EOP
@@ -0,0 +1,52 @@
+package addon_operator
+
+import (
+	"strings"
+
+	sh_task "github.com/flant/shell-operator/pkg/task"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/flant/addon-operator/pkg/task"
+)
+
+// taskSpanAttributes returns attributes of the task span from the task metadata.
+// Tasks like DiscoverModulesState may have no metadata.
+func taskSpanAttributes(t sh_task.Task) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("task.type", string(t.GetType())),
+		attribute.String("queue", t.GetQueueName()),
+		attribute.Int("task.failure_count", t.GetFailureCount()),
+	}
+
+	hm, ok := t.GetMetadata().(task.HookMetadata)
+	if !ok {
+		return attrs
+	}
+	if hm.EventDescription != "" {
+		attrs = append(attrs, attribute.String("event.description", hm.EventDescription))
+	}
+	if hm.ModuleName != "" {
+		attrs = append(attrs, attribute.String("module", hm.ModuleName))
+	}
+	if hm.HookName != "" {
+		attrs = append(attrs, attribute.String("hook", hm.HookName))
+	}
+	if hm.BindingType != "" {
+		attrs = append(attrs, attribute.String("binding", string(hm.BindingType)))
+	}
+	if len(hm.BindingContext) > 0 {
+		names := make([]string, 0, len(hm.BindingContext))
+		for _, bc := range hm.BindingContext {
+			names = append(names, bc.Binding)
+		}
+		attrs = append(attrs, attribute.String("binding.names", strings.Join(names, ",")))
+	}
+	return attrs
+}
+
+func taskFailureMessage(t sh_task.Task) string {
+	if bt, ok := t.(*sh_task.BaseTask); ok {
+		return bt.FailureMessage
+	}
+	return ""
+}
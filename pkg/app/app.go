@@ -26,6 +26,7 @@ var TillerMaxHistory int32 = 0
 var Helm3HistoryMax int32 = 10
 var Helm3Timeout time.Duration = 5 * time.Minute
 var HelmIgnoreRelease = ""
+var HelmDryRun = false
 var HelmMonitorKubeClientQpsDefault = "5" // DefaultQPS from k8s.io/client-go/rest/config.go
 var HelmMonitorKubeClientQps float32
 var HelmMonitorKubeClientBurstDefault = "10" // DefaultBurst from k8s.io/client-go/rest/config.go
@@ -33,7 +34,28 @@ var HelmMonitorKubeClientBurst int
 
 var Namespace = ""
 var ConfigMapName = "addon-operator"
+var ConfigSource = "configmap"
+var ModuleStatusEnabled = false
+var EventsEnabled = false
+var PodName = ""
+var ParallelModuleRuns = 0
+var ModuleQuarantineThreshold = 0
+var PausedModules = ""
+var PurgeProtection = "none"
+var MaintenanceMode = ""
+var StateConfigMapName = ""
+var StateCheckpointInterval = 30 * time.Second
+var LeaderElection = false
+var LeaderElectionLeaseName = "addon-operator-leader"
+var LeaderElectionIdentity = ""
+var LeaderElectionLeaseDuration = 15 * time.Second
+var LeaderElectionRenewDeadline = 10 * time.Second
+var LeaderElectionRetryPeriod = 2 * time.Second
 var ValuesChecksumsAnnotation = "addon-operator/values-checksums"
+var ValuesPatchHistorySize = 50
+var TracingExporter = "none"
+var TracingEndpoint = ""
+var TracingInsecure = false
 
 var GlobalHooksDir = "global-hooks"
 var ModulesDir = "modules"
@@ -41,6 +63,25 @@ var DefaultTempDir = "/tmp/addon-operator"
 
 var DefaultDebugUnixSocket = "/var/run/addon-operator/debug.socket"
 
+// Settings for the render command.
+var RenderModulesDir = ModulesDir
+var RenderGlobalHooksDir = GlobalHooksDir
+var RenderConfigValuesFiles []string
+var RenderModules []string
+var RenderOutputDir = ""
+
+// Settings for the hook test command.
+var HookTestModulesDir = ModulesDir
+var HookTestGlobalHooksDir = GlobalHooksDir
+var HookTestName = ""
+var HookTestCases []string
+var HookTestUpdateGolden = false
+
+// Settings for the lint command.
+var LintModulesDir = ModulesDir
+var LintGlobalHooksDir = GlobalHooksDir
+var LintOutputFormat = "text"
+
 // DefineStartCommandFlags init global flags with default values
 func DefineStartCommandFlags(kpApp *kingpin.Application, cmd *kingpin.CmdClause) {
 	cmd.Flag("tmp-dir", "a path to store temporary files with data for hooks").
@@ -98,6 +139,11 @@ func DefineStartCommandFlags(kpApp *kingpin.Application, cmd *kingpin.CmdClause)
 		Envar("HELM_IGNORE_RELEASE").
 		StringVar(&HelmIgnoreRelease)
 
+	cmd.Flag("helm-dry-run", "Do not install, upgrade or delete helm releases. Changes are only logged as a diff. Can be set with $ADDON_OPERATOR_HELM_DRY_RUN.").
+		Envar("ADDON_OPERATOR_HELM_DRY_RUN").
+		Default(strconv.FormatBool(HelmDryRun)).
+		BoolVar(&HelmDryRun)
+
 	// Rate limit settings for kube client used by Helm resources monitor.
 	cmd.Flag("helm-monitor-kube-client-qps", "QPS for a rate limiter of a kubernetes client for Helm resources monitor. Can be set with $HELM_MONITOR_KUBE_CLIENT_QPS.").
 		Envar("HELM_MONITOR_KUBE_CLIENT_QPS").
@@ -113,6 +159,111 @@ func DefineStartCommandFlags(kpApp *kingpin.Application, cmd *kingpin.CmdClause)
 		Default(ConfigMapName).
 		StringVar(&ConfigMapName)
 
+	cmd.Flag("config-source", "Where to store values: 'configmap' for a ConfigMap or 'crd' for ModuleConfig and GlobalConfig custom resources.").
+		Envar("ADDON_OPERATOR_CONFIG_SOURCE").
+		Default(ConfigSource).
+		EnumVar(&ConfigSource, "configmap", "crd")
+
+	cmd.Flag("module-status", "Write module status into Module custom resources.").
+		Envar("ADDON_OPERATOR_MODULE_STATUS").
+		Default(strconv.FormatBool(ModuleStatusEnabled)).
+		BoolVar(&ModuleStatusEnabled)
+
+	cmd.Flag("parallel-module-runs", "Number of workers to run helm phases of independent modules concurrently during converge. 0 or 1 runs modules one after another.").
+		Envar("ADDON_OPERATOR_PARALLEL_MODULE_RUNS").
+		Default(strconv.Itoa(ParallelModuleRuns)).
+		IntVar(&ParallelModuleRuns)
+
+	cmd.Flag("module-quarantine-threshold", "Number of ModuleRun failures in the main queue after which the module is moved to its own quarantine queue, so other modules can converge. 0 disables quarantine.").
+		Envar("ADDON_OPERATOR_MODULE_QUARANTINE_THRESHOLD").
+		Default(strconv.Itoa(ModuleQuarantineThreshold)).
+		IntVar(&ModuleQuarantineThreshold)
+
+	cmd.Flag("events", "Emit Kubernetes Events about enabled and disabled modules, helm upgrades, hook failures and absent resources. Events are attached to Module resources if module statuses are enabled, otherwise to the operator Pod.").
+		Envar("ADDON_OPERATOR_EVENTS_ENABLED").
+		Default(strconv.FormatBool(EventsEnabled)).
+		BoolVar(&EventsEnabled)
+
+	cmd.Flag("pod-name", "A name of the operator Pod for Kubernetes Events. Default is the hostname.").
+		Envar("ADDON_OPERATOR_POD_NAME").
+		Default(PodName).
+		StringVar(&PodName)
+
+	cmd.Flag("paused-modules", "A comma separated list of modules to pause at start. ModuleRun and hook tasks of paused modules are dropped, their helm releases are left as is.").
+		Envar("ADDON_OPERATOR_PAUSED_MODULES").
+		Default(PausedModules).
+		StringVar(&PausedModules)
+
+	cmd.Flag("purge-protection", "A deletion protection for releases of removed modules: 'none' deletes releases, 'confirm' waits for the confirmation annotation, 'orphan' keeps releases.").
+		Envar("ADDON_OPERATOR_PURGE_PROTECTION").
+		Default(PurgeProtection).
+		EnumVar(&PurgeProtection, "none", "confirm", "orphan")
+
+	cmd.Flag("maintenance", "Start in the maintenance mode: 'helm' defers helm upgrades and deletes, 'all' also defers hooks. Deferred tasks are queued when the maintenance ends.").
+		Envar("ADDON_OPERATOR_MAINTENANCE").
+		Default(MaintenanceMode).
+		StringVar(&MaintenanceMode)
+
+	cmd.Flag("state-configmap", "A name of the ConfigMap to save module states and pending tasks to resume after restart. Empty name disables checkpoints.").
+		Envar("ADDON_OPERATOR_STATE_CONFIGMAP").
+		Default(StateConfigMapName).
+		StringVar(&StateConfigMapName)
+
+	cmd.Flag("state-checkpoint-interval", "An interval to save module states and pending tasks into the state ConfigMap.").
+		Envar("ADDON_OPERATOR_STATE_CHECKPOINT_INTERVAL").
+		Default(StateCheckpointInterval.String()).
+		DurationVar(&StateCheckpointInterval)
+
+	cmd.Flag("leader-election", "Run hooks and modules only in the replica that holds the Lease in the namespace. Other replicas wait as standby.").
+		Envar("ADDON_OPERATOR_LEADER_ELECTION").
+		Default(strconv.FormatBool(LeaderElection)).
+		BoolVar(&LeaderElection)
+
+	cmd.Flag("leader-election-lease-name", "A name of the Lease object for the leader election.").
+		Envar("ADDON_OPERATOR_LEADER_ELECTION_LEASE_NAME").
+		Default(LeaderElectionLeaseName).
+		StringVar(&LeaderElectionLeaseName)
+
+	cmd.Flag("leader-election-identity", "An identity of the replica in the Lease. Default is the hostname, i.e. the Pod name.").
+		Envar("ADDON_OPERATOR_LEADER_ELECTION_IDENTITY").
+		Default(LeaderElectionIdentity).
+		StringVar(&LeaderElectionIdentity)
+
+	cmd.Flag("leader-election-lease-duration", "A duration that standby replicas wait before taking over the Lease of the stopped leader.").
+		Envar("ADDON_OPERATOR_LEADER_ELECTION_LEASE_DURATION").
+		Default(LeaderElectionLeaseDuration.String()).
+		DurationVar(&LeaderElectionLeaseDuration)
+
+	cmd.Flag("leader-election-renew-deadline", "A duration that the leader retries to renew the Lease before giving up the leadership.").
+		Envar("ADDON_OPERATOR_LEADER_ELECTION_RENEW_DEADLINE").
+		Default(LeaderElectionRenewDeadline.String()).
+		DurationVar(&LeaderElectionRenewDeadline)
+
+	cmd.Flag("leader-election-retry-period", "A duration between attempts to acquire or renew the Lease.").
+		Envar("ADDON_OPERATOR_LEADER_ELECTION_RETRY_PERIOD").
+		Default(LeaderElectionRetryPeriod.String()).
+		DurationVar(&LeaderElectionRetryPeriod)
+
+	cmd.Flag("values-patch-history", "A number of the last applied values patches to keep for global values and for each module. Zero disables the history.").
+		Envar("ADDON_OPERATOR_VALUES_PATCH_HISTORY").
+		Default(strconv.Itoa(ValuesPatchHistorySize)).
+		IntVar(&ValuesPatchHistorySize)
+
+	cmd.Flag("tracing-exporter", "An exporter for OpenTelemetry spans of tasks, hooks and helm operations: 'none' disables tracing, 'otlp-grpc', 'otlp-http' or 'stdout'.").
+		Envar("ADDON_OPERATOR_TRACING_EXPORTER").
+		Default(TracingExporter).
+		EnumVar(&TracingExporter, "none", "otlp-grpc", "otlp-http", "stdout")
+
+	cmd.Flag("tracing-endpoint", "An address of the OTLP collector, e.g. 'localhost:4317'. Default is the exporter default or OTEL_EXPORTER_OTLP_ENDPOINT.").
+		Envar("ADDON_OPERATOR_TRACING_ENDPOINT").
+		Default(TracingEndpoint).
+		StringVar(&TracingEndpoint)
+
+	cmd.Flag("tracing-insecure", "Send spans to the OTLP collector without TLS.").
+		Envar("ADDON_OPERATOR_TRACING_INSECURE").
+		Default(strconv.FormatBool(TracingInsecure)).
+		BoolVar(&TracingInsecure)
+
 	sh_app.DefineKubeClientFlags(cmd)
 	sh_app.DefineJqFlags(cmd)
 	sh_app.DefineLoggingFlags(cmd)
@@ -120,3 +271,90 @@ func DefineStartCommandFlags(kpApp *kingpin.Application, cmd *kingpin.CmdClause)
 	sh_app.DebugUnixSocket = DefaultDebugUnixSocket
 	sh_app.DefineDebugFlags(kpApp, cmd)
 }
+
+// DefineRenderCommandFlags init flags for the offline render command.
+func DefineRenderCommandFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("modules-dir", "A path to the modules directory.").
+		Envar("MODULES_DIR").
+		Default(RenderModulesDir).
+		StringVar(&RenderModulesDir)
+
+	cmd.Flag("global-hooks-dir", "A path to the global hooks directory with OpenAPI schemas for global values.").
+		Envar("GLOBAL_HOOKS_DIR").
+		Default(RenderGlobalHooksDir).
+		StringVar(&RenderGlobalHooksDir)
+
+	cmd.Flag("config-values", "A YAML file with config values in the ConfigMap format: 'global' section, module sections and '<module>Enabled' flags. Can be repeated, later files override earlier ones.").
+		Short('f').
+		ExistingFilesVar(&RenderConfigValuesFiles)
+
+	cmd.Flag("module", "A module to render. Can be repeated. Modules enabled by config are rendered if not set.").
+		Short('m').
+		StringsVar(&RenderModules)
+
+	cmd.Flag("output-dir", "Write manifests of each module into '<module>.yaml' in this directory instead of stdout.").
+		StringVar(&RenderOutputDir)
+
+	cmd.Flag("namespace", "A namespace for releases.").
+		Envar("ADDON_OPERATOR_NAMESPACE").
+		Default("default").
+		StringVar(&Namespace)
+
+	cmd.Flag("tmp-dir", "a path to store temporary files with values").
+		Envar("ADDON_OPERATOR_TMP_DIR").
+		Default(DefaultTempDir).
+		StringVar(&sh_app.TempDir)
+
+	sh_app.DefineLoggingFlags(cmd)
+}
+
+// DefineLintCommandFlags init flags for the lint command.
+func DefineLintCommandFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("modules-dir", "A path to the modules directory.").
+		Envar("MODULES_DIR").
+		Default(LintModulesDir).
+		StringVar(&LintModulesDir)
+
+	cmd.Flag("global-hooks-dir", "A path to the global hooks directory.").
+		Envar("GLOBAL_HOOKS_DIR").
+		Default(LintGlobalHooksDir).
+		StringVar(&LintGlobalHooksDir)
+
+	cmd.Flag("output", "Output format: text, json or sarif.").
+		Short('o').
+		Default(LintOutputFormat).
+		EnumVar(&LintOutputFormat, "text", "json", "sarif")
+
+	sh_app.DefineLoggingFlags(cmd)
+}
+
+// DefineHookTestCommandFlags init flags for the hook test command.
+func DefineHookTestCommandFlags(cmd *kingpin.CmdClause) {
+	cmd.Arg("hook_name", "A shell hook name: a path relative to the global hooks directory or to the modules directory, e.g. '001-module/hooks/hook.sh'.").
+		Required().
+		StringVar(&HookTestName)
+
+	cmd.Arg("case_dir", "A directory with fixtures and golden files. Can be repeated.").
+		Required().
+		ExistingDirsVar(&HookTestCases)
+
+	cmd.Flag("modules-dir", "A path to the modules directory.").
+		Envar("MODULES_DIR").
+		Default(HookTestModulesDir).
+		StringVar(&HookTestModulesDir)
+
+	cmd.Flag("global-hooks-dir", "A path to the global hooks directory.").
+		Envar("GLOBAL_HOOKS_DIR").
+		Default(HookTestGlobalHooksDir).
+		StringVar(&HookTestGlobalHooksDir)
+
+	cmd.Flag("update", "Write hook outputs into golden files instead of comparing.").
+		BoolVar(&HookTestUpdateGolden)
+
+	cmd.Flag("tmp-dir", "a path to store temporary files for hooks").
+		Envar("ADDON_OPERATOR_TMP_DIR").
+		Default(DefaultTempDir).
+		StringVar(&sh_app.TempDir)
+
+	sh_app.DefineLoggingFlags(cmd)
+}
@@ -25,15 +25,23 @@ func DefineDebugCommands(kpApp *kingpin.Application) {
 	AddOutputJsonYamlFlag(globalListCmd)
 	sh_app.DefineDebugUnixSocketFlag(globalListCmd)
 
+	var valuesProvenance bool
 	globalValuesCmd := globalCmd.Command("values", "Dump current global values.").
 		Action(func(c *kingpin.ParseContext) error {
-			dump, err := Global(sh_debug.DefaultClient()).Values(sh_debug.OutputFormat)
+			var dump []byte
+			var err error
+			if valuesProvenance {
+				dump, err = Global(sh_debug.DefaultClient()).Provenance(sh_debug.OutputFormat)
+			} else {
+				dump, err = Global(sh_debug.DefaultClient()).Values(sh_debug.OutputFormat)
+			}
 			if err != nil {
 				return err
 			}
 			fmt.Println(string(dump))
 			return nil
 		})
+	globalValuesCmd.Flag("provenance", "Dump leaves of values with their sources: values.yaml, ConfigMap, schema defaults or a hook patch.").BoolVar(&valuesProvenance)
 	// -o json|yaml and --debug-unix-socket <file>
 	AddOutputJsonYamlFlag(globalValuesCmd)
 	sh_app.DefineDebugUnixSocketFlag(globalValuesCmd)
@@ -51,15 +59,23 @@ func DefineDebugCommands(kpApp *kingpin.Application) {
 	AddOutputJsonYamlFlag(globalConfigCmd)
 	sh_app.DefineDebugUnixSocketFlag(globalConfigCmd)
 
+	var patchesHistory bool
 	globalPatchesCmd := globalCmd.Command("patches", "Dump global value patches.").
 		Action(func(c *kingpin.ParseContext) error {
-			dump, err := Global(sh_debug.DefaultClient()).Patches()
+			var dump []byte
+			var err error
+			if patchesHistory {
+				dump, err = Global(sh_debug.DefaultClient()).PatchesHistory()
+			} else {
+				dump, err = Global(sh_debug.DefaultClient()).Patches()
+			}
 			if err != nil {
 				return err
 			}
 			fmt.Println(string(dump))
 			return nil
 		})
+	globalPatchesCmd.Flag("history", "Dump the last applied patches with time, hook and binding.").BoolVar(&patchesHistory)
 	// --debug-unix-socket <file>
 	sh_app.DefineDebugUnixSocketFlag(globalPatchesCmd)
 
@@ -78,7 +94,7 @@ func DefineDebugCommands(kpApp *kingpin.Application) {
 
 	moduleCmd := sh_app.CommandWithDefaultUsageTemplate(kpApp, "module", "List modules and dump their values")
 
-	moduleListCmd := moduleCmd.Command("list", "List available modules and their enabled status.").
+	moduleListCmd := moduleCmd.Command("list", "List available modules and their enabled and paused status.").
 		Action(func(c *kingpin.ParseContext) error {
 			modules, err := Module(sh_debug.DefaultClient()).List(sh_debug.OutputFormat)
 			if err != nil {
@@ -94,7 +110,13 @@ func DefineDebugCommands(kpApp *kingpin.Application) {
 	var moduleName string
 	moduleValuesCmd := moduleCmd.Command("values", "Dump module values by name.").
 		Action(func(c *kingpin.ParseContext) error {
-			dump, err := Module(sh_debug.DefaultClient()).Name(moduleName).Values(sh_debug.OutputFormat)
+			var dump []byte
+			var err error
+			if valuesProvenance {
+				dump, err = Module(sh_debug.DefaultClient()).Name(moduleName).Provenance(sh_debug.OutputFormat)
+			} else {
+				dump, err = Module(sh_debug.DefaultClient()).Name(moduleName).Values(sh_debug.OutputFormat)
+			}
 			if err != nil {
 				return err
 			}
@@ -102,10 +124,25 @@ func DefineDebugCommands(kpApp *kingpin.Application) {
 			return nil
 		})
 	moduleValuesCmd.Arg("module_name", "").Required().StringVar(&moduleName)
+	moduleValuesCmd.Flag("provenance", "Dump leaves of values with their sources: values.yaml, ConfigMap, schema defaults or a hook patch.").BoolVar(&valuesProvenance)
 	// -o json|yaml and --debug-unix-socket <file>
 	AddOutputJsonYamlFlag(moduleValuesCmd)
 	sh_app.DefineDebugUnixSocketFlag(moduleValuesCmd)
 
+	moduleInfoCmd := moduleCmd.Command("info", "Dump module info by name: dependencies, rollback and drift policies, the last helm rollback and drifted resources.").
+		Action(func(c *kingpin.ParseContext) error {
+			dump, err := Module(sh_debug.DefaultClient()).Name(moduleName).Info(sh_debug.OutputFormat)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(dump))
+			return nil
+		})
+	moduleInfoCmd.Arg("module_name", "").Required().StringVar(&moduleName)
+	// -o json|yaml and --debug-unix-socket <file>
+	AddOutputJsonYamlFlag(moduleInfoCmd)
+	sh_app.DefineDebugUnixSocketFlag(moduleInfoCmd)
+
 	moduleRenderCmd := moduleCmd.Command("render", "Render module manifests.").
 		Action(func(c *kingpin.ParseContext) error {
 			dump, err := Module(sh_debug.DefaultClient()).Name(moduleName).Render()
@@ -119,6 +156,20 @@ func DefineDebugCommands(kpApp *kingpin.Application) {
 	AddOutputJsonYamlFlag(moduleRenderCmd)
 	sh_app.DefineDebugUnixSocketFlag(moduleRenderCmd)
 
+	moduleDiffCmd := moduleCmd.Command("diff", "Show changes between the deployed helm release and module manifests rendered with current values.").
+		Action(func(c *kingpin.ParseContext) error {
+			dump, err := Module(sh_debug.DefaultClient()).Name(moduleName).Diff(sh_debug.OutputFormat)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(dump))
+			return nil
+		})
+	moduleDiffCmd.Arg("module_name", "").Required().StringVar(&moduleName)
+	// -o json|yaml|text and --debug-unix-socket <file>
+	sh_debug.AddOutputJsonYamlTextFlag(moduleDiffCmd)
+	sh_app.DefineDebugUnixSocketFlag(moduleDiffCmd)
+
 	moduleConfigCmd := moduleCmd.Command("config", "Dump module config values by name.").
 		Action(func(c *kingpin.ParseContext) error {
 			dump, err := Module(sh_debug.DefaultClient()).Name(moduleName).Config(sh_debug.OutputFormat)
@@ -135,7 +186,13 @@ func DefineDebugCommands(kpApp *kingpin.Application) {
 
 	modulePatchesCmd := moduleCmd.Command("patches", "Dump module value patches by name.").
 		Action(func(c *kingpin.ParseContext) error {
-			dump, err := Module(sh_debug.DefaultClient()).Name(moduleName).Patches()
+			var dump []byte
+			var err error
+			if patchesHistory {
+				dump, err = Module(sh_debug.DefaultClient()).Name(moduleName).PatchesHistory()
+			} else {
+				dump, err = Module(sh_debug.DefaultClient()).Name(moduleName).Patches()
+			}
 			if err != nil {
 				return err
 			}
@@ -143,6 +200,7 @@ func DefineDebugCommands(kpApp *kingpin.Application) {
 			return nil
 		})
 	modulePatchesCmd.Arg("module_name", "").Required().StringVar(&moduleName)
+	modulePatchesCmd.Flag("history", "Dump the last applied patches with time, hook and binding.").BoolVar(&patchesHistory)
 	// --debug-unix-socket <file>
 	sh_app.DefineDebugUnixSocketFlag(modulePatchesCmd)
 
@@ -160,6 +218,32 @@ func DefineDebugCommands(kpApp *kingpin.Application) {
 	AddOutputJsonYamlFlag(moduleResourceMonitorCmd)
 	sh_app.DefineDebugUnixSocketFlag(moduleResourceMonitorCmd)
 
+	modulePauseCmd := moduleCmd.Command("pause", "Stop reconciling the module: drop its ModuleRun and hook tasks and pause the resources monitor. The helm release is left as is.").
+		Action(func(c *kingpin.ParseContext) error {
+			dump, err := Module(sh_debug.DefaultClient()).Name(moduleName).Pause()
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(dump))
+			return nil
+		})
+	modulePauseCmd.Arg("module_name", "").Required().StringVar(&moduleName)
+	// --debug-unix-socket <file>
+	sh_app.DefineDebugUnixSocketFlag(modulePauseCmd)
+
+	moduleResumeCmd := moduleCmd.Command("resume", "Resume reconciling the paused module.").
+		Action(func(c *kingpin.ParseContext) error {
+			dump, err := Module(sh_debug.DefaultClient()).Name(moduleName).Resume()
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(dump))
+			return nil
+		})
+	moduleResumeCmd.Arg("module_name", "").Required().StringVar(&moduleName)
+	// --debug-unix-socket <file>
+	sh_app.DefineDebugUnixSocketFlag(moduleResumeCmd)
+
 	moduleSnapshotsCmd := moduleCmd.Command("snapshots", "Dump snapshots for all hooks.").
 		Action(func(c *kingpin.ParseContext) error {
 			out, err := Module(sh_debug.DefaultClient()).Name(moduleName).Snapshots(sh_debug.OutputFormat)
@@ -173,6 +257,51 @@ func DefineDebugCommands(kpApp *kingpin.Application) {
 	// -o json|yaml and --debug-unix-socket <file>
 	AddOutputJsonYamlFlag(moduleSnapshotsCmd)
 	sh_app.DefineDebugUnixSocketFlag(moduleSnapshotsCmd)
+
+	maintenanceCmd := sh_app.CommandWithDefaultUsageTemplate(kpApp, "maintenance", "Manage the maintenance mode")
+
+	maintenanceStatusCmd := maintenanceCmd.Command("status", "Dump the maintenance mode and deferred tasks.").
+		Action(func(c *kingpin.ParseContext) error {
+			out, err := Maintenance(sh_debug.DefaultClient()).Status(sh_debug.OutputFormat)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(out))
+			return nil
+		})
+	// -o json|yaml and --debug-unix-socket <file>
+	AddOutputJsonYamlFlag(maintenanceStatusCmd)
+	sh_app.DefineDebugUnixSocketFlag(maintenanceStatusCmd)
+
+	var maintenanceHooks bool
+	maintenanceOnCmd := maintenanceCmd.Command("on", "Start the maintenance: defer helm upgrades and deletes.").
+		Action(func(c *kingpin.ParseContext) error {
+			mode := "helm"
+			if maintenanceHooks {
+				mode = "all"
+			}
+			out, err := Maintenance(sh_debug.DefaultClient()).Set(mode)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(out))
+			return nil
+		})
+	maintenanceOnCmd.Flag("hooks", "Defer runs of all hooks too.").BoolVar(&maintenanceHooks)
+	// --debug-unix-socket <file>
+	sh_app.DefineDebugUnixSocketFlag(maintenanceOnCmd)
+
+	maintenanceOffCmd := maintenanceCmd.Command("off", "Finish the maintenance and queue deferred tasks.").
+		Action(func(c *kingpin.ParseContext) error {
+			out, err := Maintenance(sh_debug.DefaultClient()).Set("off")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(out))
+			return nil
+		})
+	// --debug-unix-socket <file>
+	sh_app.DefineDebugUnixSocketFlag(maintenanceOffCmd)
 }
 
 func AddOutputJsonYamlFlag(cmd *kingpin.CmdClause) {
@@ -199,6 +328,11 @@ func (gr *GlobalRequest) Values(format string) ([]byte, error) {
 	return gr.client.Get(url)
 }
 
+func (gr *GlobalRequest) Provenance(format string) ([]byte, error) {
+	url := fmt.Sprintf("http://unix/global/provenance.%s", format)
+	return gr.client.Get(url)
+}
+
 func (gr *GlobalRequest) Config(format string) ([]byte, error) {
 	url := fmt.Sprintf("http://unix/global/config.%s", format)
 	return gr.client.Get(url)
@@ -208,6 +342,10 @@ func (gr *GlobalRequest) Patches() ([]byte, error) {
 	return gr.client.Get("http://unix/global/patches.json")
 }
 
+func (gr *GlobalRequest) PatchesHistory() ([]byte, error) {
+	return gr.client.Get("http://unix/global/patches/history.json")
+}
+
 func (gr *GlobalRequest) Snapshots(format string) ([]byte, error) {
 	url := fmt.Sprintf("http://unix/global/snapshots.%s", format)
 	return gr.client.Get(url)
@@ -242,22 +380,70 @@ func (mr *ModuleRequest) Values(format string) ([]byte, error) {
 	return mr.client.Get(url)
 }
 
+func (mr *ModuleRequest) Provenance(format string) ([]byte, error) {
+	url := fmt.Sprintf("http://unix/module/%s/provenance.%s", mr.name, format)
+	return mr.client.Get(url)
+}
+
+func (mr *ModuleRequest) Info(format string) ([]byte, error) {
+	url := fmt.Sprintf("http://unix/module/%s/info.%s", mr.name, format)
+	return mr.client.Get(url)
+}
+
 func (mr *ModuleRequest) Render() ([]byte, error) {
 	url := fmt.Sprintf("http://unix/module/%s/render", mr.name)
 	return mr.client.Get(url)
 }
 
+func (mr *ModuleRequest) Diff(format string) ([]byte, error) {
+	url := fmt.Sprintf("http://unix/module/%s/diff.%s", mr.name, format)
+	return mr.client.Get(url)
+}
+
 func (mr *ModuleRequest) Patches() ([]byte, error) {
 	url := fmt.Sprintf("http://unix/module/%s/patches.json", mr.name)
 	return mr.client.Get(url)
 }
 
+func (mr *ModuleRequest) PatchesHistory() ([]byte, error) {
+	url := fmt.Sprintf("http://unix/module/%s/patches/history.json", mr.name)
+	return mr.client.Get(url)
+}
+
 func (mr *ModuleRequest) Config(format string) ([]byte, error) {
 	url := fmt.Sprintf("http://unix/module/%s/config.%s", mr.name, format)
 	return mr.client.Get(url)
 }
 
+func (mr *ModuleRequest) Pause() ([]byte, error) {
+	url := fmt.Sprintf("http://unix/module/%s/pause", mr.name)
+	return mr.client.Post(url, nil)
+}
+
+func (mr *ModuleRequest) Resume() ([]byte, error) {
+	url := fmt.Sprintf("http://unix/module/%s/resume", mr.name)
+	return mr.client.Post(url, nil)
+}
+
 func (mr *ModuleRequest) Snapshots(format string) ([]byte, error) {
 	url := fmt.Sprintf("http://unix/module/%s/snapshots.%s", mr.name, format)
 	return mr.client.Get(url)
 }
+
+type MaintenanceRequest struct {
+	client *sh_debug.Client
+}
+
+func Maintenance(client *sh_debug.Client) *MaintenanceRequest {
+	return &MaintenanceRequest{client: client}
+}
+
+func (mr *MaintenanceRequest) Status(format string) ([]byte, error) {
+	url := fmt.Sprintf("http://unix/maintenance.%s", format)
+	return mr.client.Get(url)
+}
+
+func (mr *MaintenanceRequest) Set(mode string) ([]byte, error) {
+	url := fmt.Sprintf("http://unix/maintenance/%s", mode)
+	return mr.client.Post(url, nil)
+}
@@ -7,9 +7,12 @@ type HelmClient interface {
 	DeleteSingleFailedRevision(releaseName string) error
 	DeleteOldFailedRevisions(releaseName string) error
 	LastReleaseStatus(releaseName string) (string, string, error)
+	LastDeployedRevision(releaseName string) (string, error)
 	UpgradeRelease(releaseName string, chart string, valuesPaths []string, setValues []string, namespace string) error
+	RollbackRelease(releaseName string, revision string) error
 	Render(releaseName string, chart string, valuesPaths []string, setValues []string, namespace string) (string, error)
 	GetReleaseValues(releaseName string) (utils.Values, error)
+	GetReleaseManifest(releaseName string) (string, error)
 	DeleteRelease(releaseName string) error
 	ListReleases(labelSelector map[string]string) ([]string, error)
 	ListReleasesNames(labelSelector map[string]string) ([]string, error)
@@ -0,0 +1,269 @@
+package helm
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/flant/kube-client/manifest"
+	"github.com/pmezard/go-difflib/difflib"
+	"sigs.k8s.io/yaml"
+)
+
+type ResourceChangeAction string
+
+const (
+	ResourceAdded   ResourceChangeAction = "added"
+	ResourceRemoved ResourceChangeAction = "removed"
+	ResourceChanged ResourceChangeAction = "changed"
+)
+
+// ResourceChange is a change of one resource between the deployed release and the new render.
+type ResourceChange struct {
+	Action    ResourceChangeAction `json:"action"`
+	Kind      string               `json:"kind"`
+	Namespace string               `json:"namespace"`
+	Name      string               `json:"name"`
+	// Diff is a unified diff of the resource YAML.
+	Diff string `json:"diff,omitempty"`
+}
+
+func (c ResourceChange) Id() string {
+	return fmt.Sprintf("%s/%s/%s", c.Namespace, c.Kind, c.Name)
+}
+
+// ReleaseDiff is a resource-level difference between the deployed release manifest and the new render.
+type ReleaseDiff struct {
+	Release string           `json:"release"`
+	Changes []ResourceChange `json:"changes"`
+}
+
+func (d ReleaseDiff) IsEmpty() bool {
+	return len(d.Changes) == 0
+}
+
+// Summary returns a number of added, changed and removed resources.
+func (d ReleaseDiff) Summary() string {
+	counts := map[ResourceChangeAction]int{}
+	for _, change := range d.Changes {
+		counts[change.Action]++
+	}
+	return fmt.Sprintf("%d to add, %d to change, %d to remove", counts[ResourceAdded], counts[ResourceChanged], counts[ResourceRemoved])
+}
+
+// ChangesString returns the summary and a list of changed resources without diffs.
+func (d ReleaseDiff) ChangesString() string {
+	return d.format(false)
+}
+
+// String returns a human readable diff. It is used for logging and for the text output of the debug endpoint.
+func (d ReleaseDiff) String() string {
+	return d.format(true)
+}
+
+func (d ReleaseDiff) format(withDiff bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "helm release '%s': %s\n", d.Release, d.Summary())
+	for _, change := range d.Changes {
+		fmt.Fprintf(&b, "%s %s\n", change.Action, change.Id())
+		if withDiff && change.Diff != "" {
+			b.WriteString(change.Diff)
+		}
+	}
+	return b.String()
+}
+
+// DiffManifests compares manifests of the deployed release with rendered manifests.
+// Resources without namespace are considered to be in defaultNamespace.
+// Values of Secrets are redacted, only changed keys are shown.
+func DiffManifests(releaseName string, deployed string, rendered string, defaultNamespace string) (ReleaseDiff, error) {
+	res := ReleaseDiff{
+		Release: releaseName,
+		Changes: make([]ResourceChange, 0),
+	}
+
+	deployedManifests, err := manifest.ListFromYamlDocs(deployed)
+	if err != nil {
+		return res, fmt.Errorf("parse deployed manifests: %v", err)
+	}
+	renderedManifests, err := manifest.ListFromYamlDocs(rendered)
+	if err != nil {
+		return res, fmt.Errorf("parse rendered manifests: %v", err)
+	}
+
+	deployedById := make(map[string]manifest.Manifest)
+	for _, m := range deployedManifests {
+		deployedById[manifestId(m, defaultNamespace)] = m
+	}
+	renderedById := make(map[string]manifest.Manifest)
+	for _, m := range renderedManifests {
+		renderedById[manifestId(m, defaultNamespace)] = m
+	}
+
+	for id, m := range renderedById {
+		oldM, has := deployedById[id]
+		if !has {
+			diff, err := manifestsUnifiedDiff(id, nil, m)
+			if err != nil {
+				return res, err
+			}
+			res.Changes = append(res.Changes, newResourceChange(ResourceAdded, m, defaultNamespace, diff))
+			continue
+		}
+		diff, err := manifestsUnifiedDiff(id, oldM, m)
+		if err != nil {
+			return res, err
+		}
+		if diff != "" {
+			res.Changes = append(res.Changes, newResourceChange(ResourceChanged, m, defaultNamespace, diff))
+		}
+	}
+
+	for id, m := range deployedById {
+		if _, has := renderedById[id]; has {
+			continue
+		}
+		diff, err := manifestsUnifiedDiff(id, m, nil)
+		if err != nil {
+			return res, err
+		}
+		res.Changes = append(res.Changes, newResourceChange(ResourceRemoved, m, defaultNamespace, diff))
+	}
+
+	sort.Slice(res.Changes, func(i, j int) bool {
+		return res.Changes[i].Id() < res.Changes[j].Id()
+	})
+
+	return res, nil
+}
+
+func manifestId(m manifest.Manifest, defaultNamespace string) string {
+	return fmt.Sprintf("%s/%s/%s", m.Namespace(defaultNamespace), m.Kind(), m.Name())
+}
+
+func newResourceChange(action ResourceChangeAction, m manifest.Manifest, defaultNamespace string, diff string) ResourceChange {
+	return ResourceChange{
+		Action:    action,
+		Kind:      m.Kind(),
+		Namespace: m.Namespace(defaultNamespace),
+		Name:      m.Name(),
+		Diff:      diff,
+	}
+}
+
+// manifestsUnifiedDiff returns a unified diff of manifests in YAML. nil manifest is an empty document.
+// Manifests are marshaled with sorted keys, so the order of fields in templates does not matter.
+func manifestsUnifiedDiff(id string, a, b manifest.Manifest) (string, error) {
+	a, b = redactSecrets(a, b)
+	aYaml, err := manifestYaml(a)
+	if err != nil {
+		return "", err
+	}
+	bYaml, err := manifestYaml(b)
+	if err != nil {
+		return "", err
+	}
+	if aYaml == bYaml {
+		return "", nil
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(aYaml),
+		B:        difflib.SplitLines(bYaml),
+		FromFile: "deployed/" + id,
+		ToFile:   "rendered/" + id,
+		Context:  3,
+	})
+}
+
+func manifestYaml(m manifest.Manifest) (string, error) {
+	if m == nil {
+		return "", nil
+	}
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return "", fmt.Errorf("marshal manifest: %v", err)
+	}
+	return string(data), nil
+}
+
+// Secret fields with values.
+var secretDataFields = []string{"data", "stringData"}
+
+// redactSecrets replaces values in data and stringData of Secrets as helm diff does:
+// unchanged values are the same placeholder in both manifests, changed values are
+// different placeholders with the size of the value. Manifests are copied.
+func redactSecrets(a, b manifest.Manifest) (manifest.Manifest, manifest.Manifest) {
+	if !isSecret(a) && !isSecret(b) {
+		return a, b
+	}
+	a, b = copySecret(a), copySecret(b)
+	for _, field := range secretDataFields {
+		aData := secretData(a, field)
+		bData := secretData(b, field)
+		keys := make(map[string]struct{})
+		for key := range aData {
+			keys[key] = struct{}{}
+		}
+		for key := range bData {
+			keys[key] = struct{}{}
+		}
+		for key := range keys {
+			aValue, aHas := aData[key]
+			bValue, bHas := bData[key]
+			if aHas && bHas && reflect.DeepEqual(aValue, bValue) {
+				aData[key] = redactedValue("REDACTED", aValue)
+				bData[key] = redactedValue("REDACTED", bValue)
+				continue
+			}
+			if aHas {
+				aData[key] = redactedValue("--------", aValue)
+			}
+			if bHas {
+				bData[key] = redactedValue("++++++++", bValue)
+			}
+		}
+	}
+	return a, b
+}
+
+func isSecret(m manifest.Manifest) bool {
+	return m != nil && m.Kind() == "Secret"
+}
+
+// copySecret copies the Secret manifest with its data and stringData maps.
+func copySecret(m manifest.Manifest) manifest.Manifest {
+	if !isSecret(m) {
+		return m
+	}
+	res := make(manifest.Manifest, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+	for _, field := range secretDataFields {
+		data, ok := m[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		dataCopy := make(map[string]interface{}, len(data))
+		for k, v := range data {
+			dataCopy[k] = v
+		}
+		res[field] = dataCopy
+	}
+	return res
+}
+
+// secretData returns data or stringData map of the Secret. It returns nil for other kinds.
+func secretData(m manifest.Manifest, field string) map[string]interface{} {
+	if !isSecret(m) {
+		return nil
+	}
+	data, _ := m[field].(map[string]interface{})
+	return data
+}
+
+func redactedValue(placeholder string, value interface{}) string {
+	return fmt.Sprintf("%s # (%d bytes)", placeholder, len(fmt.Sprintf("%v", value)))
+}
@@ -0,0 +1,147 @@
+package helm
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_DiffManifests(t *testing.T) {
+	g := NewWithT(t)
+
+	deployed := `
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  replicas: "1"
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: web
+spec:
+  ports:
+  - port: 80
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: legacy
+`
+	rendered := `
+---
+# Field order does not matter.
+apiVersion: v1
+kind: Service
+metadata:
+  namespace: web
+  name: web
+spec:
+  ports:
+  - port: 80
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  replicas: "2"
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: web
+`
+
+	diff, err := DiffManifests("web", deployed, rendered, "default-ns")
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	g.Expect(diff.Release).To(Equal("web"))
+	g.Expect(diff.Changes).To(HaveLen(3))
+
+	g.Expect(diff.Changes[0].Action).To(Equal(ResourceChanged))
+	g.Expect(diff.Changes[0].Id()).To(Equal("default-ns/ConfigMap/settings"))
+	g.Expect(diff.Changes[0].Diff).To(ContainSubstring(`-  replicas: "1"`))
+	g.Expect(diff.Changes[0].Diff).To(ContainSubstring(`+  replicas: "2"`))
+
+	g.Expect(diff.Changes[1].Action).To(Equal(ResourceRemoved))
+	g.Expect(diff.Changes[1].Id()).To(Equal("default-ns/Secret/legacy"))
+
+	g.Expect(diff.Changes[2].Action).To(Equal(ResourceAdded))
+	g.Expect(diff.Changes[2].Id()).To(Equal("web/Deployment/web"))
+
+	g.Expect(diff.Summary()).To(Equal("1 to add, 1 to change, 1 to remove"))
+	g.Expect(diff.String()).To(HavePrefix("helm release 'web': 1 to add, 1 to change, 1 to remove\n"))
+}
+
+func Test_DiffManifests_NoChanges(t *testing.T) {
+	g := NewWithT(t)
+
+	manifests := `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+`
+	diff, err := DiffManifests("web", manifests, manifests, "default-ns")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(diff.IsEmpty()).To(BeTrue())
+}
+
+func Test_DiffManifests_RedactSecrets(t *testing.T) {
+	g := NewWithT(t)
+
+	deployed := `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: creds
+data:
+  password: b2xkLXBhc3N3b3Jk
+  user: YWRtaW4=
+stringData:
+  token: old-token
+`
+	rendered := `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: creds
+  labels:
+    app: web
+data:
+  password: bmV3LXBhc3N3b3Jk
+  user: YWRtaW4=
+stringData:
+  token: old-token
+  key: new-key
+`
+	diff, err := DiffManifests("web", deployed, rendered, "default-ns")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(diff.Changes).To(HaveLen(1))
+
+	text := diff.String()
+	for _, secret := range []string{"b2xkLXBhc3N3b3Jk", "bmV3LXBhc3N3b3Jk", "YWRtaW4=", "old-token", "new-key"} {
+		g.Expect(text).ShouldNot(ContainSubstring(secret))
+	}
+	g.Expect(text).To(ContainSubstring("-  password: '-------- # (16 bytes)'"))
+	g.Expect(text).To(ContainSubstring("+  password: '++++++++ # (16 bytes)'"))
+	g.Expect(text).To(ContainSubstring("+  key: '++++++++ # (7 bytes)'"))
+	g.Expect(text).To(ContainSubstring("   user: 'REDACTED # (8 bytes)'"))
+	g.Expect(text).To(ContainSubstring("+    app: web"))
+
+	// Unchanged Secret has no diff.
+	diff, err = DiffManifests("web", deployed, deployed, "default-ns")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(diff.IsEmpty()).To(BeTrue())
+
+	// Summary for info logs has no diff.
+	diff, err = DiffManifests("web", deployed, rendered, "default-ns")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(diff.ChangesString()).To(Equal("helm release 'web': 0 to add, 1 to change, 0 to remove\nchanged default-ns/Secret/creds\n"))
+}
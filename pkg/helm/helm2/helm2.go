@@ -213,6 +213,30 @@ func (h *Helm2Client) LastReleaseStatus(releaseName string) (revision string, st
 	return
 }
 
+// LastDeployedRevision returns the latest revision with DEPLOYED or SUPERSEDED status.
+// Empty string is returned if there is no such revision.
+func (h *Helm2Client) LastDeployedRevision(releaseName string) (string, error) {
+	stdout, stderr, err := h.Cmd("history", releaseName)
+	if err != nil {
+		return "", fmt.Errorf("cannot get history for release '%s'\n%v %v", releaseName, stdout, stderr)
+	}
+
+	revision := ""
+	// Skip header line, revisions are sorted in ascending order.
+	historyLines := strings.Split(stdout, "\n")
+	for _, line := range historyLines[1:] {
+		fields := strings.SplitN(line, "\t", 5)
+		if len(fields) < 3 {
+			continue
+		}
+		status := strings.ToLower(strings.TrimSpace(fields[2]))
+		if status == "deployed" || status == "superseded" {
+			revision = strings.TrimSpace(fields[0])
+		}
+	}
+	return revision, nil
+}
+
 func (h *Helm2Client) UpgradeRelease(releaseName string, chart string, valuesPaths []string, setValues []string, namespace string) error {
 	args := make([]string, 0)
 	args = append(args, "upgrade")
@@ -259,6 +283,25 @@ func (h *Helm2Client) GetReleaseValues(releaseName string) (utils.Values, error)
 	return values, nil
 }
 
+func (h *Helm2Client) GetReleaseManifest(releaseName string) (string, error) {
+	stdout, stderr, err := h.Cmd("get", "manifest", releaseName)
+	if err != nil {
+		return "", fmt.Errorf("cannot get manifest of helm release %s: %s\n%s %s", releaseName, err, stdout, stderr)
+	}
+
+	return stdout, nil
+}
+
+func (h *Helm2Client) RollbackRelease(releaseName string, revision string) error {
+	h.LogEntry.Infof("helm release '%s': execute helm rollback to revision %s", releaseName, revision)
+
+	stdout, stderr, err := h.Cmd("rollback", releaseName, revision)
+	if err != nil {
+		return fmt.Errorf("helm rollback %s %s invocation error: %v\n%v %v", releaseName, revision, err, stdout, stderr)
+	}
+	return nil
+}
+
 func (h *Helm2Client) DeleteRelease(releaseName string) (err error) {
 	h.LogEntry.Debugf("helm release '%s': execute helm delete --purge", releaseName)
 
@@ -159,6 +159,32 @@ func (h *Helm3Client) LastReleaseStatus(releaseName string) (revision string, st
 	return
 }
 
+// LastDeployedRevision returns the latest revision with deployed or superseded status.
+// Empty string is returned if there is no such revision.
+func (h *Helm3Client) LastDeployedRevision(releaseName string) (string, error) {
+	stdout, stderr, err := h.cmd("history", releaseName, "--namespace", h.Namespace, "--output", "yaml")
+	if err != nil {
+		return "", fmt.Errorf("cannot get history for release '%s'\n%v %v", releaseName, stdout, stderr)
+	}
+
+	var historyInfo []map[string]interface{}
+
+	err = k8syaml.Unmarshal([]byte(stdout), &historyInfo)
+	if err != nil {
+		return "", fmt.Errorf("helm history returns invalid json: %v", err)
+	}
+
+	// Revisions are sorted in ascending order.
+	revision := ""
+	for _, info := range historyInfo {
+		status := strings.ToLower(fmt.Sprintf("%v", info["status"]))
+		if status == "deployed" || status == "superseded" {
+			revision = fmt.Sprintf("%v", info["revision"])
+		}
+	}
+	return revision, nil
+}
+
 func (h *Helm3Client) UpgradeRelease(releaseName string, chart string, valuesPaths []string, setValues []string, namespace string) error {
 	args := make([]string, 0)
 	args = append(args, "upgrade")
@@ -225,6 +251,44 @@ func (h *Helm3Client) GetReleaseValues(releaseName string) (utils.Values, error)
 	return values, nil
 }
 
+func (h *Helm3Client) GetReleaseManifest(releaseName string) (string, error) {
+	args := make([]string, 0)
+	args = append(args, "get")
+	args = append(args, "manifest")
+	args = append(args, releaseName)
+
+	args = append(args, "--namespace")
+	args = append(args, h.Namespace)
+
+	stdout, stderr, err := h.cmd(args...)
+	if err != nil {
+		return "", fmt.Errorf("cannot get manifest of helm release %s: %s\n%s %s", releaseName, err, stdout, stderr)
+	}
+
+	return stdout, nil
+}
+
+func (h *Helm3Client) RollbackRelease(releaseName string, revision string) error {
+	h.LogEntry.Infof("helm release '%s': execute helm rollback to revision %s", releaseName, revision)
+
+	args := make([]string, 0)
+	args = append(args, "rollback")
+	args = append(args, releaseName)
+	args = append(args, revision)
+
+	args = append(args, "--namespace")
+	args = append(args, h.Namespace)
+
+	args = append(args, "--timeout")
+	args = append(args, Options.Timeout.String())
+
+	stdout, stderr, err := h.cmd(args...)
+	if err != nil {
+		return fmt.Errorf("helm rollback %s %s invocation error: %v\n%v %v", releaseName, revision, err, stdout, stderr)
+	}
+	return nil
+}
+
 func (h *Helm3Client) DeleteRelease(releaseName string) (err error) {
 	h.LogEntry.Debugf("helm release '%s': execute helm uninstall", releaseName)
 
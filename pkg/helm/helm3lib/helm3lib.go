@@ -200,6 +200,50 @@ func (h *LibClient) UpgradeRelease(releaseName string, chartName string, valuesP
 	return nil
 }
 
+// LastDeployedRevision returns the latest revision with deployed or superseded status.
+// Empty string is returned if there is no such revision.
+func (h *LibClient) LastDeployedRevision(releaseName string) (string, error) {
+	releases, err := actionConfig.Releases.History(releaseName)
+	if err != nil {
+		return "", fmt.Errorf("cannot get history for release '%s': %v", releaseName, err)
+	}
+
+	version := 0
+	for _, rel := range releases {
+		if rel.Info == nil {
+			continue
+		}
+		if rel.Info.Status == release.StatusDeployed || rel.Info.Status == release.StatusSuperseded {
+			if rel.Version > version {
+				version = rel.Version
+			}
+		}
+	}
+	if version == 0 {
+		return "", nil
+	}
+	return strconv.Itoa(version), nil
+}
+
+func (h *LibClient) RollbackRelease(releaseName string, revision string) error {
+	h.LogEntry.Infof("helm release '%s': execute helm rollback to revision %s", releaseName, revision)
+
+	version, err := strconv.Atoi(revision)
+	if err != nil {
+		return fmt.Errorf("bad revision '%s': %v", revision, err)
+	}
+
+	rb := action.NewRollback(actionConfig)
+	rb.Version = version
+	rb.Timeout = options.Timeout
+	rb.CleanupOnFail = true
+	err = rb.Run(releaseName)
+	if err != nil {
+		return fmt.Errorf("helm rollback %s %s invocation error: %v", releaseName, revision, err)
+	}
+	return nil
+}
+
 func (h *LibClient) rollbackLatestRelease(releases []*release.Release) {
 	latestRelease := releases[0]
 	nsReleaseName := fmt.Sprintf("%s/%s", latestRelease.Namespace, latestRelease.Name)
@@ -240,6 +284,15 @@ func (h *LibClient) GetReleaseValues(releaseName string) (utils.Values, error) {
 	return gv.Run(releaseName)
 }
 
+func (h *LibClient) GetReleaseManifest(releaseName string) (string, error) {
+	gm := action.NewGet(actionConfig)
+	rel, err := gm.Run(releaseName)
+	if err != nil {
+		return "", fmt.Errorf("cannot get manifest of helm release %s: %s", releaseName, err)
+	}
+	return rel.Manifest, nil
+}
+
 func (h *LibClient) DeleteRelease(releaseName string) error {
 	h.LogEntry.Debugf("helm release '%s': execute helm uninstall", releaseName)
 
@@ -313,26 +366,9 @@ func (h *LibClient) Render(releaseName string, chartName string, valuesPaths []s
 		return "", err
 	}
 
-	var resultValues chartutil.Values
-
-	for _, vp := range valuesPaths {
-		values, err := chartutil.ReadValuesFile(vp)
-		if err != nil {
-			return "", err
-		}
-
-		resultValues = chartutil.CoalesceTables(resultValues, values)
-	}
-
-	if len(setValues) > 0 {
-		m := make(map[string]interface{})
-		for _, sv := range setValues {
-			arr := strings.Split(sv, "=")
-			if len(arr) == 2 {
-				m[arr[0]] = arr[1]
-			}
-		}
-		resultValues = chartutil.CoalesceTables(resultValues, m)
+	resultValues, err := mergeValues(valuesPaths, setValues)
+	if err != nil {
+		return "", err
 	}
 
 	h.LogEntry.Debugf("Render helm templates for chart '%s' in namespace '%s' ...", chartName, namespace)
@@ -358,3 +394,61 @@ func (h *LibClient) Render(releaseName string, chartName string, valuesPaths []s
 
 	return rs.Manifest, nil
 }
+
+// RenderClientOnly renders chart like 'helm template' without a cluster and without Init.
+// Capabilities of the cluster are defaults of the helm library.
+func RenderClientOnly(releaseName string, chartName string, valuesPaths []string, namespace string) (string, error) {
+	chart, err := loader.Load(chartName)
+	if err != nil {
+		return "", err
+	}
+
+	resultValues, err := mergeValues(valuesPaths, nil)
+	if err != nil {
+		return "", err
+	}
+
+	logEntry := log.WithField("operator.component", "helm3lib")
+	inst := action.NewInstall(&action.Configuration{Log: logEntry.Debugf})
+	inst.DryRun = true
+	inst.ClientOnly = true
+	inst.Namespace = namespace
+	inst.ReleaseName = releaseName
+	inst.UseReleaseName = true
+	inst.Replace = true // Skip the name check
+	inst.IsUpgrade = true
+
+	rs, err := inst.Run(chart, resultValues)
+	if err != nil {
+		return "", err
+	}
+
+	return rs.Manifest, nil
+}
+
+// mergeValues reads values files and merges them with values in 'key=value' format.
+func mergeValues(valuesPaths []string, setValues []string) (chartutil.Values, error) {
+	var resultValues chartutil.Values
+
+	for _, vp := range valuesPaths {
+		values, err := chartutil.ReadValuesFile(vp)
+		if err != nil {
+			return nil, err
+		}
+
+		resultValues = chartutil.CoalesceTables(resultValues, values)
+	}
+
+	if len(setValues) > 0 {
+		m := make(map[string]interface{})
+		for _, sv := range setValues {
+			arr := strings.Split(sv, "=")
+			if len(arr) == 2 {
+				m[arr[0]] = arr[1]
+			}
+		}
+		resultValues = chartutil.CoalesceTables(resultValues, m)
+	}
+
+	return resultValues, nil
+}
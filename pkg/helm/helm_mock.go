@@ -13,6 +13,10 @@ type MockHelmClient struct {
 	UpgradeReleaseExecuted             bool
 	DeleteReleaseExecuted              bool
 	ReleaseNames                       []string
+	ReleaseManifest                    string
+	DeployedRevision                   string
+	ReleaseStatus                      string
+	RollbackReleaseExecuted            bool
 }
 
 func (h *MockHelmClient) DeleteOldFailedRevisions(releaseName string) error {
@@ -43,7 +47,7 @@ func (h *MockHelmClient) DeleteSingleFailedRevision(_ string) error {
 }
 
 func (h *MockHelmClient) LastReleaseStatus(_ string) (string, string, error) {
-	return "", "", nil
+	return "", h.ReleaseStatus, nil
 }
 
 func (h *MockHelmClient) IsReleaseExists(_ string) (bool, error) {
@@ -54,6 +58,19 @@ func (h *MockHelmClient) GetReleaseValues(_ string) (utils.Values, error) {
 	return make(utils.Values), nil
 }
 
+func (h *MockHelmClient) GetReleaseManifest(_ string) (string, error) {
+	return h.ReleaseManifest, nil
+}
+
+func (h *MockHelmClient) LastDeployedRevision(_ string) (string, error) {
+	return h.DeployedRevision, nil
+}
+
+func (h *MockHelmClient) RollbackRelease(_ string, _ string) error {
+	h.RollbackReleaseExecuted = true
+	return nil
+}
+
 func (h *MockHelmClient) UpgradeRelease(_, _ string, _ []string, _ []string, _ string) error {
 	h.UpgradeReleaseExecuted = true
 	return nil
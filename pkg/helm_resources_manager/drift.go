@@ -0,0 +1,215 @@
+package helm_resources_manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/flant/kube-client/manifest"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	. "github.com/flant/addon-operator/pkg/helm_resources_manager/types"
+)
+
+// ManifestDrift compares the live object with its manifest. Only fields set in the manifest
+// are compared: fields defaulted by the API server or set by controllers are not a drift.
+// It returns nil if the live object matches the manifest.
+func ManifestDrift(m manifest.Manifest, live *unstructured.Unstructured, defaultNamespace string) *ResourceDrift {
+	fields := make([]string, 0)
+	managers := make(map[string]struct{})
+
+	for key, expected := range m {
+		switch key {
+		case "apiVersion", "kind", "status":
+			continue
+		case "stringData":
+			// Secret.stringData is write-only.
+			if m.Kind() == "Secret" {
+				continue
+			}
+		case "metadata":
+			expectedMeta, _ := expected.(map[string]interface{})
+			liveMeta, _ := live.Object["metadata"].(map[string]interface{})
+			for _, metaKey := range []string{"labels", "annotations"} {
+				if _, has := expectedMeta[metaKey]; !has {
+					continue
+				}
+				path := []string{"metadata", metaKey}
+				fields = append(fields, diffFields(path, expectedMeta[metaKey], liveMeta[metaKey])...)
+			}
+			continue
+		}
+		fields = append(fields, diffFields([]string{key}, expected, live.Object[key])...)
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		for _, manager := range fieldManagers(live, field) {
+			managers[manager] = struct{}{}
+		}
+	}
+
+	drift := &ResourceDrift{
+		Namespace: m.Namespace(defaultNamespace),
+		Kind:      m.Kind(),
+		Name:      m.Name(),
+		Fields:    fields,
+	}
+	for manager := range managers {
+		drift.Managers = append(drift.Managers, manager)
+	}
+	sort.Strings(drift.Managers)
+	return drift
+}
+
+// diffFields returns paths of fields in expected with different values in live.
+func diffFields(path []string, expected, live interface{}) []string {
+	// The API server drops zero values of omitempty fields, e.g. 'hostNetwork: false',
+	// 'replicas: 0' or 'annotations: {}', so a missing live field is equal to a zero value.
+	if live == nil && isZeroValue(expected) {
+		return nil
+	}
+	switch expectedV := expected.(type) {
+	case nil:
+		// Nulls are dropped from manifests on apply.
+		return nil
+	case map[string]interface{}:
+		liveV, ok := live.(map[string]interface{})
+		if !ok {
+			return []string{fieldPath(path)}
+		}
+		res := make([]string, 0)
+		for key, value := range expectedV {
+			res = append(res, diffFields(append(path, key), value, liveV[key])...)
+		}
+		return res
+	case []interface{}:
+		liveV, ok := live.([]interface{})
+		if !ok {
+			return []string{fieldPath(path)}
+		}
+		if len(expectedV) != len(liveV) {
+			return []string{fieldPath(path)}
+		}
+		res := make([]string, 0)
+		for i := range expectedV {
+			res = append(res, diffFields(append(path, fmt.Sprintf("[%d]", i)), expectedV[i], liveV[i])...)
+		}
+		return res
+	default:
+		if scalarsEqual(expected, live) {
+			return nil
+		}
+		return []string{fieldPath(path)}
+	}
+}
+
+// isZeroValue returns true for nil, false, 0, "", empty lists and objects
+// with zero values only.
+func isZeroValue(v interface{}) bool {
+	switch value := v.(type) {
+	case nil:
+		return true
+	case bool:
+		return !value
+	case string:
+		return value == ""
+	case []interface{}:
+		return len(value) == 0
+	case map[string]interface{}:
+		for _, item := range value {
+			if !isZeroValue(item) {
+				return false
+			}
+		}
+		return true
+	}
+	if num, ok := toFloat(v); ok {
+		return num == 0
+	}
+	return false
+}
+
+// scalarsEqual compares numbers regardless of type and quantities regardless of format, e.g. "1" and "1000m".
+func scalarsEqual(a, b interface{}) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	aNum, aOk := toFloat(a)
+	bNum, bOk := toFloat(b)
+	if aOk && bOk {
+		return aNum == bNum
+	}
+	aStr, aOk := a.(string)
+	bStr, bOk := b.(string)
+	if aOk && bOk {
+		aQ, aErr := resource.ParseQuantity(aStr)
+		bQ, bErr := resource.ParseQuantity(bStr)
+		return aErr == nil && bErr == nil && aQ.Cmp(bQ) == 0
+	}
+	return false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func fieldPath(path []string) string {
+	return strings.Replace(strings.Join(path, "."), ".[", "[", -1)
+}
+
+// fieldManagers returns managers from metadata.managedFields that own the field.
+// Items of lists are not matched: a manager of any item is returned.
+func fieldManagers(live *unstructured.Unstructured, field string) []string {
+	segments := make([]string, 0)
+	for _, segment := range strings.Split(strings.Replace(field, "[", ".[", -1), ".") {
+		if strings.HasPrefix(segment, "[") {
+			break
+		}
+		segments = append(segments, segment)
+	}
+
+	res := make([]string, 0)
+	for _, entry := range live.GetManagedFields() {
+		if entry.FieldsV1 == nil {
+			continue
+		}
+		var fieldSet map[string]interface{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fieldSet); err != nil {
+			continue
+		}
+		owned := true
+		for _, segment := range segments {
+			next, has := fieldSet["f:"+segment]
+			if !has {
+				owned = false
+				break
+			}
+			fieldSet, _ = next.(map[string]interface{})
+		}
+		if owned {
+			res = append(res, entry.Manager)
+		}
+	}
+	return res
+}
@@ -0,0 +1,261 @@
+package helm_resources_manager
+
+import (
+	"context"
+	"testing"
+
+	"github.com/flant/kube-client/manifest"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+
+	. "github.com/flant/addon-operator/pkg/helm_resources_manager/types"
+)
+
+func Test_ManifestDrift(t *testing.T) {
+	m := manifest.MustFromYAML(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: backend
+  labels:
+    app: backend
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: backend
+        image: backend:v1
+        resources:
+          requests:
+            cpu: "1"
+`)
+
+	tests := []struct {
+		name         string
+		live         string
+		expectFields []string
+		expectMgrs   []string
+	}{
+		{
+			name: "defaults and status are not a drift",
+			live: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: backend
+  namespace: default
+  uid: 1234
+  labels:
+    app: backend
+spec:
+  replicas: 2
+  strategy:
+    type: RollingUpdate
+  template:
+    spec:
+      containers:
+      - name: backend
+        image: backend:v1
+        imagePullPolicy: IfNotPresent
+        resources:
+          requests:
+            cpu: 1000m
+status:
+  replicas: 2
+`,
+		},
+		{
+			name: "changed fields",
+			live: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: backend
+  labels:
+    app: frontend
+  managedFields:
+  - manager: helm
+    operation: Update
+    fieldsType: FieldsV1
+    fieldsV1:
+      f:metadata:
+        f:labels:
+          f:app: {}
+  - manager: kubectl-edit
+    operation: Update
+    fieldsType: FieldsV1
+    fieldsV1:
+      f:spec:
+        f:replicas: {}
+        f:template:
+          f:spec:
+            f:containers: {}
+spec:
+  replicas: 5
+  template:
+    spec:
+      containers:
+      - name: backend
+        image: backend:v2
+        resources:
+          requests:
+            cpu: "1"
+`,
+			expectFields: []string{"metadata.labels.app", "spec.replicas", "spec.template.spec.containers[0].image"},
+			expectMgrs:   []string{"helm", "kubectl-edit"},
+		},
+		{
+			name: "list with different length",
+			live: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: backend
+  labels:
+    app: backend
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers: []
+`,
+			expectFields: []string{"spec.template.spec.containers"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			live := &unstructured.Unstructured{}
+			g.Expect(yaml.Unmarshal([]byte(tt.live), &live.Object)).Should(Succeed())
+
+			drift := ManifestDrift(m, live, "default")
+			if tt.expectFields == nil {
+				g.Expect(drift).To(BeNil())
+				return
+			}
+			g.Expect(drift).ToNot(BeNil())
+			g.Expect(drift.Id()).To(Equal("default/Deployment/backend"))
+			g.Expect(drift.Fields).To(Equal(tt.expectFields))
+			g.Expect(drift.Managers).To(Equal(tt.expectMgrs))
+		})
+	}
+}
+
+func Test_ManifestDrift_ZeroValues(t *testing.T) {
+	g := NewWithT(t)
+
+	m := manifest.MustFromYAML(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: backend
+  annotations: {}
+spec:
+  replicas: 0
+  template:
+    spec:
+      hostNetwork: false
+      securityContext:
+        runAsNonRoot: false
+      containers:
+      - name: backend
+        image: backend:v1
+        args: []
+        workingDir: ""
+`)
+
+	// Zero values are dropped by the API server.
+	live := &unstructured.Unstructured{}
+	g.Expect(yaml.Unmarshal([]byte(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: backend
+spec:
+  template:
+    spec:
+      containers:
+      - name: backend
+        image: backend:v1
+`), &live.Object)).Should(Succeed())
+	g.Expect(ManifestDrift(m, live, "default")).To(BeNil())
+
+	// Non-zero live values are a drift.
+	live = &unstructured.Unstructured{}
+	g.Expect(yaml.Unmarshal([]byte(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: backend
+  annotations:
+    owner: someone
+spec:
+  replicas: 3
+  template:
+    spec:
+      hostNetwork: true
+      containers:
+      - name: backend
+        image: backend:v1
+`), &live.Object)).Should(Succeed())
+	drift := ManifestDrift(m, live, "default")
+	g.Expect(drift).ToNot(BeNil())
+	g.Expect(drift.Fields).To(Equal([]string{"spec.replicas", "spec.template.spec.hostNetwork"}))
+}
+
+// Monitor is restarted after each helm upgrade. The same drift should not be reported by the new monitor.
+func Test_ResourcesMonitor_KeepsDriftAfterRestart(t *testing.T) {
+	g := NewWithT(t)
+
+	m := manifest.MustFromYAML(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: backend
+spec:
+  replicas: 2
+`)
+	live := &unstructured.Unstructured{}
+	g.Expect(yaml.Unmarshal([]byte(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: backend
+  namespace: default
+spec:
+  replicas: 3
+`), &live.Object)).Should(Succeed())
+
+	nsgvr := namespacedGVR{Namespace: "default", GVR: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}}
+	notified := 0
+	newMonitor := func() *ResourcesMonitor {
+		rm := NewResourcesMonitor()
+		rm.WithContext(context.Background())
+		rm.WithModuleName("backend")
+		rm.WithDefaultNamespace("default")
+		rm.WithDriftCb(func(string, []ResourceDrift) { notified++ })
+		rm.gvrMap = map[namespacedGVR][]manifest.Manifest{nsgvr: {m}}
+		return rm
+	}
+
+	first := newMonitor()
+	first.diffLive(nsgvr, live)
+	g.Expect(notified).To(Equal(1))
+	g.Expect(first.DriftedResources()).To(HaveLen(1))
+
+	second := newMonitor()
+	second.WithDrifted(first.DriftedResources())
+	second.diffLive(nsgvr, live)
+	g.Expect(notified).To(Equal(1), "the same drift should not be reported again")
+
+	// Repaired resource is reported.
+	g.Expect(unstructured.SetNestedField(live.Object, int64(2), "spec", "replicas")).Should(Succeed())
+	second.diffLive(nsgvr, live)
+	g.Expect(notified).To(Equal(2))
+	g.Expect(second.DriftedResources()).To(HaveLen(0))
+}
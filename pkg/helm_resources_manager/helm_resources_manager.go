@@ -2,10 +2,12 @@ package helm_resources_manager
 
 import (
 	"context"
+	"sync"
 
 	klient "github.com/flant/kube-client/client"
 	"github.com/flant/kube-client/manifest"
 	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/metadata"
 
 	. "github.com/flant/addon-operator/pkg/helm_resources_manager/types"
 )
@@ -13,6 +15,7 @@ import (
 type HelmResourcesManager interface {
 	WithContext(ctx context.Context)
 	WithKubeClient(client klient.Client)
+	WithMetadataClient(client metadata.Interface)
 	WithDefaultNamespace(namespace string)
 	Stop()
 	StopMonitors()
@@ -26,7 +29,9 @@ type HelmResourcesManager interface {
 	AbsentResources(moduleName string) ([]manifest.Manifest, error)
 	GetMonitor(moduleName string) *ResourcesMonitor
 	GetAbsentResources(templates []manifest.Manifest, defaultNamespace string) ([]manifest.Manifest, error)
+	DriftedResources(moduleName string) []ResourceDrift
 	Ch() chan AbsentResourcesEvent
+	DriftCh() chan DriftedResourcesEvent
 }
 
 type helmResourcesManager struct {
@@ -35,11 +40,17 @@ type helmResourcesManager struct {
 
 	Namespace string
 
-	kubeClient klient.Client
+	kubeClient     klient.Client
+	metadataClient metadata.Interface
 
-	monitors map[string]*ResourcesMonitor
+	// monitorsLock protects monitors: helm phases of modules can run in parallel.
+	monitorsLock sync.RWMutex
+	monitors     map[string]*ResourcesMonitor
+	// informers are shared between monitors of all modules.
+	informers *resourceInformers
 
 	eventCh chan AbsentResourcesEvent
+	driftCh chan DriftedResourcesEvent
 }
 
 var _ HelmResourcesManager = &helmResourcesManager{}
@@ -47,6 +58,7 @@ var _ HelmResourcesManager = &helmResourcesManager{}
 func NewHelmResourcesManager() HelmResourcesManager {
 	return &helmResourcesManager{
 		eventCh:  make(chan AbsentResourcesEvent),
+		driftCh:  make(chan DriftedResourcesEvent),
 		monitors: make(map[string]*ResourcesMonitor),
 	}
 }
@@ -55,6 +67,11 @@ func (hm *helmResourcesManager) WithKubeClient(client klient.Client) {
 	hm.kubeClient = client
 }
 
+// WithMetadataClient sets a client for informers of monitors. Informers request only metadata of objects.
+func (hm *helmResourcesManager) WithMetadataClient(client metadata.Interface) {
+	hm.metadataClient = client
+}
+
 func (hm *helmResourcesManager) WithDefaultNamespace(namespace string) {
 	hm.Namespace = namespace
 }
@@ -73,20 +90,37 @@ func (hm *helmResourcesManager) Ch() chan AbsentResourcesEvent {
 	return hm.eventCh
 }
 
+func (hm *helmResourcesManager) DriftCh() chan DriftedResourcesEvent {
+	return hm.driftCh
+}
+
 func (hm *helmResourcesManager) StartMonitor(moduleName string, manifests []manifest.Manifest, defaultNamespace string) {
 	log.Debugf("Start helm resources monitor for '%s'", moduleName)
-	hm.StopMonitor(moduleName)
+	hm.monitorsLock.Lock()
+	defer hm.monitorsLock.Unlock()
+
+	if hm.informers == nil {
+		hm.informers = newResourceInformers(hm.ctx, hm.metadataClient)
+	}
 
 	rm := NewResourcesMonitor()
 	rm.WithKubeClient(hm.kubeClient)
+	rm.WithMetadataClient(hm.metadataClient)
+	rm.WithInformers(hm.informers)
 	rm.WithContext(hm.ctx)
 	rm.WithModuleName(moduleName)
 	rm.WithManifests(manifests)
 	rm.WithDefaultNamespace(defaultNamespace)
 	rm.WithAbsentCb(hm.absentResourcesCallback)
+	rm.WithDriftCb(hm.driftedResourcesCallback)
+	if prev, has := hm.monitors[moduleName]; has {
+		rm.WithDrifted(prev.DriftedResources())
+	}
 
-	hm.monitors[moduleName] = rm
+	// Start a new monitor before stopping the old one to keep shared informers running.
 	rm.Start()
+	hm.stopMonitor(moduleName)
+	hm.monitors[moduleName] = rm
 }
 
 func (hm *helmResourcesManager) absentResourcesCallback(moduleName string, absent []manifest.Manifest, defaultNs string) {
@@ -94,31 +128,57 @@ func (hm *helmResourcesManager) absentResourcesCallback(moduleName string, absen
 	for _, m := range absent {
 		log.Debugf("%s/%s/%s", m.Namespace(defaultNs), m.Kind(), m.Name())
 	}
-	hm.eventCh <- AbsentResourcesEvent{
+	select {
+	case hm.eventCh <- AbsentResourcesEvent{
 		ModuleName: moduleName,
 		Absent:     absent,
+	}:
+	case <-hm.ctx.Done():
+	}
+}
+
+func (hm *helmResourcesManager) driftedResourcesCallback(moduleName string, drifted []ResourceDrift) {
+	log.Debugf("Detect %d drifted resources for %s", len(drifted), moduleName)
+	select {
+	case hm.driftCh <- DriftedResourcesEvent{
+		ModuleName: moduleName,
+		Drifted:    drifted,
+	}:
+	case <-hm.ctx.Done():
 	}
 }
 
 func (hm *helmResourcesManager) StopMonitors() {
+	hm.monitorsLock.Lock()
+	defer hm.monitorsLock.Unlock()
 	for moduleName := range hm.monitors {
-		hm.StopMonitor(moduleName)
+		hm.stopMonitor(moduleName)
 	}
 }
 
 func (hm *helmResourcesManager) PauseMonitors() {
+	hm.monitorsLock.RLock()
+	defer hm.monitorsLock.RUnlock()
 	for _, monitor := range hm.monitors {
 		monitor.Pause()
 	}
 }
 
 func (hm *helmResourcesManager) ResumeMonitors() {
+	hm.monitorsLock.RLock()
+	defer hm.monitorsLock.RUnlock()
 	for _, monitor := range hm.monitors {
 		monitor.Resume()
 	}
 }
 
 func (hm *helmResourcesManager) StopMonitor(moduleName string) {
+	hm.monitorsLock.Lock()
+	defer hm.monitorsLock.Unlock()
+	hm.stopMonitor(moduleName)
+}
+
+func (hm *helmResourcesManager) stopMonitor(moduleName string) {
 	if monitor, ok := hm.monitors[moduleName]; ok {
 		monitor.Stop()
 		delete(hm.monitors, moduleName)
@@ -126,30 +186,45 @@ func (hm *helmResourcesManager) StopMonitor(moduleName string) {
 }
 
 func (hm *helmResourcesManager) PauseMonitor(moduleName string) {
+	hm.monitorsLock.RLock()
+	defer hm.monitorsLock.RUnlock()
 	if monitor, ok := hm.monitors[moduleName]; ok {
 		monitor.Pause()
 	}
 }
 
 func (hm *helmResourcesManager) ResumeMonitor(moduleName string) {
+	hm.monitorsLock.RLock()
+	defer hm.monitorsLock.RUnlock()
 	if monitor, ok := hm.monitors[moduleName]; ok {
 		monitor.Resume()
 	}
 }
 
 func (hm *helmResourcesManager) HasMonitor(moduleName string) bool {
+	hm.monitorsLock.RLock()
+	defer hm.monitorsLock.RUnlock()
 	_, ok := hm.monitors[moduleName]
 	return ok
 }
 
 func (hm *helmResourcesManager) AbsentResources(moduleName string) ([]manifest.Manifest, error) {
-	if monitor, ok := hm.monitors[moduleName]; ok {
+	if monitor := hm.GetMonitor(moduleName); monitor != nil {
 		return monitor.AbsentResources()
 	}
 	return nil, nil
 }
 
+func (hm *helmResourcesManager) DriftedResources(moduleName string) []ResourceDrift {
+	if monitor := hm.GetMonitor(moduleName); monitor != nil {
+		return monitor.DriftedResources()
+	}
+	return nil
+}
+
 func (hm *helmResourcesManager) GetMonitor(moduleName string) *ResourcesMonitor {
+	hm.monitorsLock.RLock()
+	defer hm.monitorsLock.RUnlock()
 	return hm.monitors[moduleName]
 }
 
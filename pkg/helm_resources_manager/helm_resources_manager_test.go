@@ -1,6 +1,7 @@
 package helm_resources_manager
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -8,6 +9,16 @@ import (
 	"github.com/flant/kube-client/manifest"
 	. "github.com/onsi/gomega"
 	"go.uber.org/goleak"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/metadata"
+	"sigs.k8s.io/yaml"
+
+	. "github.com/flant/addon-operator/pkg/helm_resources_manager/types"
 )
 
 // Problem: fake client do not support metadata.name filtering
@@ -73,6 +84,142 @@ metadata:
 	g.Expect(absent).To(HaveLen(1), "Absent resources should be detected after deletion")
 }
 
+func Test_Monitor_DetectsDeletedResource(t *testing.T) {
+	g := NewWithT(t)
+
+	fc := fake.NewFakeCluster("")
+
+	defaultNs := "default"
+
+	chartResources := []manifest.Manifest{
+		createResource(fc, defaultNs, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: backend
+`),
+		createResource(fc, defaultNs, `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: pod-0
+  namespace: ns1
+`),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mgr := NewHelmResourcesManager()
+	mgr.WithContext(ctx)
+	mgr.WithKubeClient(fc.Client)
+	mgr.WithMetadataClient(newFakeMetadataClient(fc))
+	mgr.StartMonitor("backend", chartResources, defaultNs)
+
+	// Wait for informers cache.
+	g.Eventually(func() bool {
+		_, synced := mgr.GetMonitor("backend").absentInCache()
+		return synced
+	}, "5s", "50ms").Should(BeTrue())
+
+	absent, err := mgr.AbsentResources("backend")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(absent).To(HaveLen(0), "Should be no absent resources after start")
+
+	fc.DeleteSimpleNamespaced("ns1", "Pod", "pod-0")
+
+	var event AbsentResourcesEvent
+	g.Eventually(mgr.Ch(), "5s").Should(Receive(&event))
+	g.Expect(event.ModuleName).To(Equal("backend"))
+	g.Expect(event.Absent).To(HaveLen(1))
+	g.Expect(event.Absent[0].Name()).To(Equal("pod-0"))
+
+	absent, err = mgr.AbsentResources("backend")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(absent).To(HaveLen(1), "Absent resources should be detected in cache after deletion")
+
+	// Paused monitor should not send events.
+	mgr.PauseMonitor("backend")
+	fc.DeleteSimpleNamespaced(defaultNs, "Deployment", "backend")
+	g.Consistently(mgr.Ch(), "500ms").ShouldNot(Receive())
+
+	// Informers are stopped with the last monitor.
+	mgr.StopMonitor("backend")
+	g.Expect(mgr.(*helmResourcesManager).informers.Keys()).To(HaveLen(0))
+}
+
+// Informers cache only metadata, full objects are fetched to compare changed resources with manifests.
+func Test_Monitor_CachesMetadataOnly(t *testing.T) {
+	g := NewWithT(t)
+
+	fc := fake.NewFakeCluster("")
+	gvr := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	deployments := fc.Client.Dynamic().Resource(gvr).Namespace("default")
+
+	live := &unstructured.Unstructured{}
+	g.Expect(yaml.Unmarshal([]byte(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: backend
+  namespace: default
+  generation: 1
+  managedFields:
+  - manager: helm
+    operation: Update
+spec:
+  replicas: 2
+`), &live.Object)).Should(Succeed())
+	_, err := deployments.Create(context.TODO(), live, metav1.CreateOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mgr := NewHelmResourcesManager()
+	mgr.WithContext(ctx)
+	mgr.WithKubeClient(fc.Client)
+	mgr.WithMetadataClient(newFakeMetadataClient(fc))
+	mgr.StartMonitor("backend", []manifest.Manifest{manifest.MustFromYAML(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: backend
+spec:
+  replicas: 2
+`)}, "default")
+
+	monitor := mgr.GetMonitor("backend")
+	g.Eventually(func() bool {
+		_, synced := monitor.absentInCache()
+		return synced
+	}, "5s", "50ms").Should(BeTrue())
+
+	monitor.m.RLock()
+	informers := monitor.subscribed
+	monitor.m.RUnlock()
+	g.Expect(informers).To(HaveLen(1))
+	for _, informer := range informers {
+		g.Expect(informer.GetStore().List()).To(HaveLen(1))
+		for _, obj := range informer.GetStore().List() {
+			cached, ok := obj.(*metav1.PartialObjectMetadata)
+			g.Expect(ok).To(BeTrue(), "informer should cache PartialObjectMetadata, got %T", obj)
+			g.Expect(cached.GetName()).To(Equal("backend"))
+			g.Expect(cached.GetGeneration()).To(Equal(int64(1)))
+		}
+	}
+
+	g.Expect(unstructured.SetNestedField(live.Object, int64(5), "spec", "replicas")).Should(Succeed())
+	live.SetGeneration(2)
+	_, err = deployments.Update(context.TODO(), live, metav1.UpdateOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	var event DriftedResourcesEvent
+	g.Eventually(mgr.DriftCh(), "5s").Should(Receive(&event))
+	g.Expect(event.Drifted).To(HaveLen(1))
+	g.Expect(event.Drifted[0].Fields).To(Equal([]string{"spec.replicas"}))
+}
+
 func createResource(fc *fake.Cluster, ns, manifestYaml string) manifest.Manifest {
 	manifests, err := manifest.ListFromYamlDocs(manifestYaml)
 	if err != nil {
@@ -90,3 +237,69 @@ func createResource(fc *fake.Cluster, ns, manifestYaml string) manifest.Manifest
 
 	return m
 }
+
+// fakeMetadataClient serves metadata of objects from the fake cluster as API server does for metadata informers.
+type fakeMetadataClient struct {
+	dynamic dynamic.Interface
+}
+
+func newFakeMetadataClient(fc *fake.Cluster) metadata.Interface {
+	return &fakeMetadataClient{dynamic: fc.Client.Dynamic()}
+}
+
+func (c *fakeMetadataClient) Resource(gvr schema.GroupVersionResource) metadata.Getter {
+	resource := c.dynamic.Resource(gvr)
+	return &fakeMetadataResource{resource: resource, namespaceable: resource}
+}
+
+// fakeMetadataResource implements List and Watch used by informers, other methods are not implemented.
+type fakeMetadataResource struct {
+	metadata.ResourceInterface
+
+	resource      dynamic.ResourceInterface
+	namespaceable dynamic.NamespaceableResourceInterface
+}
+
+func (r *fakeMetadataResource) Namespace(ns string) metadata.ResourceInterface {
+	return &fakeMetadataResource{resource: r.namespaceable.Namespace(ns)}
+}
+
+func (r *fakeMetadataResource) List(ctx context.Context, opts metav1.ListOptions) (*metav1.PartialObjectMetadataList, error) {
+	list, err := r.resource.List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	res := &metav1.PartialObjectMetadataList{}
+	res.SetResourceVersion(list.GetResourceVersion())
+	for i := range list.Items {
+		obj, err := toPartialObjectMetadata(&list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		res.Items = append(res.Items, *obj)
+	}
+	return res, nil
+}
+
+func (r *fakeMetadataResource) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	w, err := r.resource.Watch(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+		if obj, ok := event.Object.(*unstructured.Unstructured); ok {
+			partial, err := toPartialObjectMetadata(obj)
+			if err != nil {
+				return event, false
+			}
+			event.Object = partial
+		}
+		return event, true
+	}), nil
+}
+
+func toPartialObjectMetadata(obj *unstructured.Unstructured) (*metav1.PartialObjectMetadata, error) {
+	res := &metav1.PartialObjectMetadata{}
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), res)
+	return res, err
+}
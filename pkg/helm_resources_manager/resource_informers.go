@@ -0,0 +1,155 @@
+package helm_resources_manager
+
+import (
+	"context"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// resourceInformer is an informer for one kind of resources in one namespace.
+// It is shared between monitors of all modules with resources of this kind in this namespace.
+// Informer caches only metadata of objects: PartialObjectMetadata is requested from API server.
+type resourceInformer struct {
+	key      namespacedGVR
+	informer cache.SharedIndexInformer
+	cancel   context.CancelFunc
+
+	m        sync.RWMutex
+	monitors map[*ResourcesMonitor]struct{}
+}
+
+func (ri *resourceInformer) subscribers() []*ResourcesMonitor {
+	ri.m.RLock()
+	defer ri.m.RUnlock()
+	res := make([]*ResourcesMonitor, 0, len(ri.monitors))
+	for monitor := range ri.monitors {
+		res = append(res, monitor)
+	}
+	return res
+}
+
+func (ri *resourceInformer) handleUpdate(obj interface{}) {
+	live, ok := obj.(*metav1.PartialObjectMetadata)
+	if !ok {
+		return
+	}
+	for _, monitor := range ri.subscribers() {
+		monitor.handleUpdate(ri.key, live)
+	}
+}
+
+func (ri *resourceInformer) handleDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		log.Errorf("Helm resources monitor: informer %s: bad object: %v", ri.key, err)
+		return
+	}
+	for _, monitor := range ri.subscribers() {
+		monitor.handleDelete(ri.key, accessor.GetName())
+	}
+}
+
+// resourceInformers starts informers on demand and stops them when the last monitor unsubscribes.
+type resourceInformers struct {
+	ctx            context.Context
+	metadataClient metadata.Interface
+
+	m         sync.Mutex
+	informers map[namespacedGVR]*resourceInformer
+}
+
+func newResourceInformers(ctx context.Context, metadataClient metadata.Interface) *resourceInformers {
+	return &resourceInformers{
+		ctx:            ctx,
+		metadataClient: metadataClient,
+		informers:      make(map[namespacedGVR]*resourceInformer),
+	}
+}
+
+// Subscribe adds monitor to the informer for key. The informer is started if needed.
+func (ris *resourceInformers) Subscribe(key namespacedGVR, monitor *ResourcesMonitor) cache.SharedIndexInformer {
+	ris.m.Lock()
+	defer ris.m.Unlock()
+
+	ri, has := ris.informers[key]
+	if !has {
+		ri = ris.startInformer(key)
+		ris.informers[key] = ri
+	}
+
+	ri.m.Lock()
+	ri.monitors[monitor] = struct{}{}
+	ri.m.Unlock()
+
+	return ri.informer
+}
+
+// Unsubscribe removes monitor from the informer for key. The informer is stopped if there are no monitors.
+func (ris *resourceInformers) Unsubscribe(key namespacedGVR, monitor *ResourcesMonitor) {
+	ris.m.Lock()
+	defer ris.m.Unlock()
+
+	ri, has := ris.informers[key]
+	if !has {
+		return
+	}
+
+	ri.m.Lock()
+	delete(ri.monitors, monitor)
+	empty := len(ri.monitors) == 0
+	ri.m.Unlock()
+
+	if empty {
+		log.Debugf("Helm resources monitor: stop informer for %s", key)
+		ri.cancel()
+		delete(ris.informers, key)
+	}
+}
+
+// Keys returns keys of running informers.
+func (ris *resourceInformers) Keys() []namespacedGVR {
+	ris.m.Lock()
+	defer ris.m.Unlock()
+	res := make([]namespacedGVR, 0, len(ris.informers))
+	for key := range ris.informers {
+		res = append(res, key)
+	}
+	return res
+}
+
+func (ris *resourceInformers) startInformer(key namespacedGVR) *resourceInformer {
+	log.Debugf("Helm resources monitor: start informer for %s", key)
+
+	ctx, cancel := context.WithCancel(ris.ctx)
+	// Only metadata is requested from API server: monitors need names to check absent resources and
+	// fetch full objects to compare changed resources with manifests.
+	// No resync: monitors are only interested in changes.
+	informer := metadatainformer.NewFilteredMetadataInformer(ris.metadataClient, key.GVR, key.Namespace, 0, cache.Indexers{}, nil).Informer()
+
+	ri := &resourceInformer{
+		key:      key,
+		informer: informer,
+		cancel:   cancel,
+		monitors: make(map[*ResourcesMonitor]struct{}),
+	}
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(_, newObj interface{}) {
+			ri.handleUpdate(newObj)
+		},
+		DeleteFunc: ri.handleDelete,
+	})
+
+	go informer.Run(ctx.Done())
+
+	return ri
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"reflect"
 	"sort"
 	"sync"
 	"time"
@@ -13,33 +14,53 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/tools/cache"
 
+	. "github.com/flant/addon-operator/pkg/helm_resources_manager/types"
 	"github.com/flant/addon-operator/pkg/utils"
 )
 
+// monitorDelayBase is a period of absent resources checks. Checks use informers cache,
+// they are a safety net for deletions that happen while monitor is paused.
 const monitorDelayBase = time.Minute*4 + time.Second*30
 
 type ResourcesMonitor struct {
 	ctx    context.Context
 	cancel context.CancelFunc
-	paused bool
 
 	moduleName       string
 	manifests        []manifest.Manifest
 	defaultNamespace string
 
-	kubeClient klient.Client
-	logLabels  map[string]string
+	kubeClient     klient.Client
+	metadataClient metadata.Interface
+	informers      *resourceInformers
+	logLabels      map[string]string
+
+	// m protects paused flag, informers subscriptions and drifted resources.
+	m          sync.RWMutex
+	paused     bool
+	gvrMap     map[namespacedGVR][]manifest.Manifest
+	subscribed map[namespacedGVR]cache.SharedIndexInformer
+	drifted    map[string]ResourceDrift
+	// diffed holds fingerprints of objects compared with manifests, see driftFingerprint.
+	diffed map[string]string
 
 	absentCb func(moduleName string, absent []manifest.Manifest, defaultNs string)
+	driftCb  func(moduleName string, drifted []ResourceDrift)
 }
 
 func NewResourcesMonitor() *ResourcesMonitor {
 	return &ResourcesMonitor{
-		paused:    false,
-		logLabels: make(map[string]string),
-		manifests: make([]manifest.Manifest, 0),
+		paused:     false,
+		logLabels:  make(map[string]string),
+		manifests:  make([]manifest.Manifest, 0),
+		subscribed: make(map[namespacedGVR]cache.SharedIndexInformer),
+		drifted:    make(map[string]ResourceDrift),
+		diffed:     make(map[string]string),
 	}
 }
 
@@ -51,12 +72,23 @@ func (r *ResourcesMonitor) Stop() {
 	if r.cancel != nil {
 		r.cancel()
 	}
+	r.unsubscribe()
 }
 
 func (r *ResourcesMonitor) WithKubeClient(client klient.Client) {
 	r.kubeClient = client
 }
 
+// WithMetadataClient sets a client for informers. Informers request only metadata of objects.
+func (r *ResourcesMonitor) WithMetadataClient(client metadata.Interface) {
+	r.metadataClient = client
+}
+
+// WithInformers sets shared informers. Monitor starts its own informers if not set.
+func (r *ResourcesMonitor) WithInformers(informers *resourceInformers) {
+	r.informers = informers
+}
+
 func (r *ResourcesMonitor) WithLogLabels(logLabels map[string]string) {
 	r.logLabels = logLabels
 }
@@ -78,55 +110,395 @@ func (r *ResourcesMonitor) WithAbsentCb(cb func(string, []manifest.Manifest, str
 	r.absentCb = cb
 }
 
-// Start creates a timer and check if all manifests are present in cluster.
+// WithDrifted sets drifted resources found by the previous monitor of the module.
+// Monitor is restarted after each helm upgrade, the callback is called only if
+// drifted resources are changed since the previous monitor.
+func (r *ResourcesMonitor) WithDrifted(drifted []ResourceDrift) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	for _, drift := range drifted {
+		r.drifted[drift.Id()] = drift
+	}
+}
+
+// WithDriftCb sets a callback for changes of drifted resources.
+func (r *ResourcesMonitor) WithDriftCb(cb func(string, []ResourceDrift)) {
+	r.driftCb = cb
+}
+
+// Start subscribes to informers for all kinds of resources in manifests
+// and checks if all manifests are present in cluster. Then absent callback
+// is called on deletion of every resource from manifests and drift callback
+// is called when live objects start or stop to differ from manifests.
 func (r *ResourcesMonitor) Start() {
 	logEntry := log.WithFields(utils.LabelsToLogFields(r.logLabels)).
 		WithField("operator.component", "HelmResourceMonitor")
+
+	if r.informers == nil {
+		r.informers = newResourceInformers(r.ctx, r.metadataClient)
+	}
+
+	// Subscribe synchronously to not stop informers shared with the previous monitor of the module.
+	subscribeErr := r.subscribe()
+
 	go func() {
+		defer r.unsubscribe()
+
 		rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
 		randSecondsDelay := time.Second * time.Duration(rnd.Int31n(60))
 		timer := time.NewTicker(monitorDelayBase + randSecondsDelay)
+		defer timer.Stop()
 
-		for {
+		// Retry subscription: GVR discovery fails if CRD is not created yet.
+		for subscribeErr != nil {
+			logEntry.Errorf("Cannot start informers for helm resources: %s", subscribeErr)
 			select {
 			case <-timer.C:
-				if r.paused {
-					continue
-				}
-				// Check resources
-				absent, err := r.AbsentResources()
-				if err != nil {
-					logEntry.Errorf("Cannot list helm resources: %s", err)
-				}
-
-				if len(absent) > 0 {
-					logEntry.Debug("Absent resources detected")
-					if r.absentCb != nil {
-						r.absentCb(r.moduleName, absent, r.defaultNamespace)
-					}
-				} else {
-					logEntry.Debug("No absent resources detected")
-				}
+				subscribeErr = r.subscribe()
+			case <-r.ctx.Done():
+				return
+			}
+		}
+
+		if !cache.WaitForCacheSync(r.ctx.Done(), r.informersSynced()...) {
+			return
+		}
 
+		for {
+			r.checkAbsent(logEntry)
+
+			select {
+			case <-timer.C:
 			case <-r.ctx.Done():
-				timer.Stop()
 				return
 			}
 		}
 	}()
 }
 
+func (r *ResourcesMonitor) checkAbsent(logEntry *log.Entry) {
+	if r.isPaused() {
+		return
+	}
+
+	absent, err := r.AbsentResources()
+	if err != nil {
+		logEntry.Errorf("Cannot list helm resources: %s", err)
+	}
+
+	if len(absent) > 0 {
+		logEntry.Debug("Absent resources detected")
+		r.notifyAbsent(absent)
+	} else {
+		logEntry.Debug("No absent resources detected")
+	}
+
+	r.checkDrift()
+}
+
+// checkDrift compares objects changed since the last check with manifests. Informers cache
+// only metadata, so full objects are fetched from API server for changed resources.
+func (r *ResourcesMonitor) checkDrift() {
+	type cachedResource struct {
+		nsgvr namespacedGVR
+		m     manifest.Manifest
+		obj   *v1.PartialObjectMetadata
+	}
+	cached := make([]cachedResource, 0)
+
+	r.m.RLock()
+	for nsgvr, manifests := range r.gvrMap {
+		informer, has := r.subscribed[nsgvr]
+		if !has {
+			continue
+		}
+		for _, m := range manifests {
+			obj, exists, _ := informer.GetStore().GetByKey(storeKey(nsgvr, m.Name()))
+			live, ok := obj.(*v1.PartialObjectMetadata)
+			if !exists || !ok {
+				continue
+			}
+			cached = append(cached, cachedResource{nsgvr: nsgvr, m: m, obj: live})
+		}
+	}
+	r.m.RUnlock()
+
+	changed := false
+	present := make(map[string]bool)
+	for _, res := range cached {
+		id := r.resourceId(res.m)
+		present[id] = true
+		if !r.shouldDiff(id, res.obj) {
+			continue
+		}
+		live, err := r.fetchLive(res.nsgvr, res.m.Name())
+		if err != nil {
+			log.WithFields(utils.LabelsToLogFields(r.logLabels)).
+				WithField("operator.component", "HelmResourceMonitor").
+				Debugf("Cannot get resource %s to check drift: %v", id, err)
+			continue
+		}
+		if r.updateDrift(res.m, live) {
+			changed = true
+		}
+	}
+
+	// Forget drift of absent resources and resources removed from manifests.
+	r.m.Lock()
+	for id := range r.drifted {
+		if !present[id] {
+			delete(r.drifted, id)
+			changed = true
+		}
+	}
+	r.m.Unlock()
+
+	if changed {
+		r.notifyDrift()
+	}
+}
+
+// handleUpdate is called by informer when resource is changed. The object has only metadata.
+func (r *ResourcesMonitor) handleUpdate(nsgvr namespacedGVR, obj *v1.PartialObjectMetadata) {
+	if r.isPaused() || r.ctx.Err() != nil {
+		return
+	}
+
+	m, has := r.manifestFor(nsgvr, obj.GetName())
+	if !has || !r.shouldDiff(r.resourceId(m), obj) {
+		return
+	}
+
+	live, err := r.fetchLive(nsgvr, obj.GetName())
+	if err != nil {
+		// Deleted resource is handled by handleDelete.
+		log.WithFields(utils.LabelsToLogFields(r.logLabels)).
+			WithField("operator.component", "HelmResourceMonitor").
+			Debugf("Cannot get resource %s to check drift: %v", r.resourceId(m), err)
+		return
+	}
+	r.diffLive(nsgvr, live)
+}
+
+// diffLive compares the full object with its manifest and notifies about drift changes.
+func (r *ResourcesMonitor) diffLive(nsgvr namespacedGVR, live *unstructured.Unstructured) {
+	m, has := r.manifestFor(nsgvr, live.GetName())
+	if !has {
+		return
+	}
+	if r.updateDrift(m, live) {
+		r.notifyDrift()
+	}
+}
+
+// updateDrift saves the drift of the live object. It returns true if the drift is changed.
+func (r *ResourcesMonitor) updateDrift(m manifest.Manifest, live *unstructured.Unstructured) bool {
+	id := r.resourceId(m)
+	drift := ManifestDrift(m, live, r.defaultNamespace)
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.diffed[id] = driftFingerprint(live)
+	old, hadDrift := r.drifted[id]
+	switch {
+	case drift != nil && (!hadDrift || !reflect.DeepEqual(old, *drift)):
+		r.drifted[id] = *drift
+		return true
+	case drift == nil && hadDrift:
+		delete(r.drifted, id)
+		return true
+	}
+	return false
+}
+
+// shouldDiff returns true if the object is changed since the last comparison with the manifest.
+func (r *ResourcesMonitor) shouldDiff(id string, obj v1.Object) bool {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	fingerprint, has := r.diffed[id]
+	return !has || fingerprint != driftFingerprint(obj)
+}
+
+func (r *ResourcesMonitor) manifestFor(nsgvr namespacedGVR, name string) (manifest.Manifest, bool) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	for _, m := range r.gvrMap[nsgvr] {
+		if m.Name() == name {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+func (r *ResourcesMonitor) fetchLive(nsgvr namespacedGVR, name string) (*unstructured.Unstructured, error) {
+	return r.kubeClient.Dynamic().Resource(nsgvr.GVR).Namespace(nsgvr.Namespace).Get(r.ctx, name, v1.GetOptions{})
+}
+
+func (r *ResourcesMonitor) resourceId(m manifest.Manifest) string {
+	return fmt.Sprintf("%s/%s/%s", m.Namespace(r.defaultNamespace), m.Kind(), m.Name())
+}
+
+// driftFingerprint changes when fields compared with manifests can change. Generation is not
+// changed on status updates, so frequent status updates do not lead to requests for full objects.
+// Objects without generation are compared on every change.
+func driftFingerprint(obj v1.Object) string {
+	if obj.GetGeneration() == 0 {
+		return obj.GetResourceVersion()
+	}
+	return fmt.Sprintf("%d/%v/%v", obj.GetGeneration(), obj.GetLabels(), obj.GetAnnotations())
+}
+
+// handleDelete is called by informer when resource is deleted.
+func (r *ResourcesMonitor) handleDelete(nsgvr namespacedGVR, name string) {
+	if r.isPaused() || r.ctx.Err() != nil {
+		return
+	}
+
+	r.m.RLock()
+	manifests := r.gvrMap[nsgvr]
+	r.m.RUnlock()
+
+	for _, m := range manifests {
+		if m.Name() == name {
+			log.WithFields(utils.LabelsToLogFields(r.logLabels)).
+				WithField("operator.component", "HelmResourceMonitor").
+				Debugf("Resource %s/%s/%s is deleted", m.Namespace(r.defaultNamespace), m.Kind(), m.Name())
+			r.notifyAbsent([]manifest.Manifest{m})
+
+			id := r.resourceId(m)
+			r.m.Lock()
+			_, hadDrift := r.drifted[id]
+			delete(r.drifted, id)
+			delete(r.diffed, id)
+			r.m.Unlock()
+			if hadDrift {
+				r.notifyDrift()
+			}
+			return
+		}
+	}
+}
+
+func (r *ResourcesMonitor) notifyDrift() {
+	if r.driftCb != nil {
+		r.driftCb(r.moduleName, r.DriftedResources())
+	}
+}
+
+// DriftedResources returns resources with live objects different from manifests.
+func (r *ResourcesMonitor) DriftedResources() []ResourceDrift {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	res := make([]ResourceDrift, 0, len(r.drifted))
+	for _, drift := range r.drifted {
+		res = append(res, drift)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Id() < res[j].Id()
+	})
+	return res
+}
+
+func (r *ResourcesMonitor) notifyAbsent(absent []manifest.Manifest) {
+	if r.absentCb != nil {
+		r.absentCb(r.moduleName, absent, r.defaultNamespace)
+	}
+}
+
+func (r *ResourcesMonitor) subscribe() error {
+	gvrMap, err := r.buildGVRMap()
+	if err != nil {
+		return err
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	// Monitor is stopped, do not subscribe.
+	if r.ctx.Err() != nil {
+		return nil
+	}
+	r.gvrMap = gvrMap
+	for nsgvr := range gvrMap {
+		r.subscribed[nsgvr] = r.informers.Subscribe(nsgvr, r)
+	}
+	return nil
+}
+
+func (r *ResourcesMonitor) unsubscribe() {
+	r.m.Lock()
+	defer r.m.Unlock()
+	for nsgvr := range r.subscribed {
+		r.informers.Unsubscribe(nsgvr, r)
+		delete(r.subscribed, nsgvr)
+	}
+}
+
+func (r *ResourcesMonitor) informersSynced() []cache.InformerSynced {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	res := make([]cache.InformerSynced, 0, len(r.subscribed))
+	for _, informer := range r.subscribed {
+		res = append(res, informer.HasSynced)
+	}
+	return res
+}
+
 // Pause prevent execution of absent callback
 func (r *ResourcesMonitor) Pause() {
+	r.m.Lock()
 	r.paused = true
+	r.m.Unlock()
 }
 
 // Resume allows execution of absent callback
 func (r *ResourcesMonitor) Resume() {
+	r.m.Lock()
 	r.paused = false
+	r.m.Unlock()
+}
+
+func (r *ResourcesMonitor) isPaused() bool {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	return r.paused
 }
 
+// AbsentResources returns manifests of resources that are not present in cluster.
+// Informers cache is used if monitor is started, otherwise resources are listed from API server.
 func (r *ResourcesMonitor) AbsentResources() ([]manifest.Manifest, error) {
+	if absent, ok := r.absentInCache(); ok {
+		return absent, nil
+	}
+	return r.listAbsentResources()
+}
+
+// absentInCache checks manifests against informers cache. It returns false if informers are not synced.
+func (r *ResourcesMonitor) absentInCache() ([]manifest.Manifest, bool) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	if len(r.subscribed) == 0 || len(r.subscribed) != len(r.gvrMap) {
+		return nil, false
+	}
+	for _, informer := range r.subscribed {
+		if !informer.HasSynced() {
+			return nil, false
+		}
+	}
+
+	absent := make([]manifest.Manifest, 0)
+	for nsgvr, manifests := range r.gvrMap {
+		store := r.subscribed[nsgvr].GetStore()
+		for _, m := range manifests {
+			if _, exists, _ := store.GetByKey(storeKey(nsgvr, m.Name())); !exists {
+				absent = append(absent, m)
+			}
+		}
+	}
+	return absent, true
+}
+
+func (r *ResourcesMonitor) listAbsentResources() ([]manifest.Manifest, error) {
 	gvrMap, err := r.buildGVRMap()
 	if err != nil {
 		return nil, err
@@ -167,6 +539,14 @@ func (r *ResourcesMonitor) AbsentResources() ([]manifest.Manifest, error) {
 	return nil, nil
 }
 
+// storeKey returns a key of the object in informer store.
+func storeKey(nsgvr namespacedGVR, name string) string {
+	if nsgvr.Namespace == "" {
+		return name
+	}
+	return nsgvr.Namespace + "/" + name
+}
+
 type namespacedGVR struct {
 	Namespace string
 	GVR       schema.GroupVersionResource
@@ -1,8 +1,34 @@
 package types
 
-import "github.com/flant/kube-client/manifest"
+import (
+	"fmt"
+
+	"github.com/flant/kube-client/manifest"
+)
 
 type AbsentResourcesEvent struct {
 	ModuleName string
 	Absent     []manifest.Manifest
 }
+
+// ResourceDrift is a difference between a live object and its manifest.
+type ResourceDrift struct {
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	// Fields are paths of fields in the manifest with different values in the live object.
+	Fields []string `json:"fields"`
+	// Managers are field managers of drifted fields in the live object.
+	Managers []string `json:"managers,omitempty"`
+}
+
+func (d ResourceDrift) Id() string {
+	return fmt.Sprintf("%s/%s/%s", d.Namespace, d.Kind, d.Name)
+}
+
+// DriftedResourcesEvent contains all drifted resources of the module.
+// Event is sent when the set of drifted resources or fields is changed.
+type DriftedResourcesEvent struct {
+	ModuleName string
+	Drifted    []ResourceDrift
+}
@@ -4,12 +4,14 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	klient "github.com/flant/kube-client/client"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	corev1 "k8s.io/client-go/informers/core/v1"
@@ -31,6 +33,10 @@ type KubeConfigManager interface {
 	Stop()
 	InitialConfig() *Config
 	CurrentConfig() *Config
+	// ConfigAnnotation returns an annotation of the config object: the ConfigMap or GlobalConfig/global.
+	ConfigAnnotation(name string) (string, error)
+	// SetConfigAnnotation changes an annotation of the config object. Empty value removes the annotation.
+	SetConfigAnnotation(name string, value string) error
 }
 
 type kubeConfigManager struct {
@@ -44,6 +50,8 @@ type kubeConfigManager struct {
 	initialConfig *Config
 	currentConfig *Config
 
+	// checksumsLock protects checksums: config values can be saved by hooks from parallel ModuleRuns.
+	checksumsLock         sync.Mutex
 	GlobalValuesChecksum  string
 	ModulesValuesChecksum map[string]string
 }
@@ -103,6 +111,8 @@ func (kcm *kubeConfigManager) WithKubeClient(client klient.Client) {
 }
 
 func (kcm *kubeConfigManager) saveGlobalKubeConfig(globalKubeConfig GlobalKubeConfig) error {
+	kcm.checksumsLock.Lock()
+	defer kcm.checksumsLock.Unlock()
 	err := kcm.changeOrCreateKubeConfig(func(obj *v1.ConfigMap) error {
 		obj.Data = simpleMergeConfigMapData(obj.Data, globalKubeConfig.ConfigData)
 		return nil
@@ -116,6 +126,8 @@ func (kcm *kubeConfigManager) saveGlobalKubeConfig(globalKubeConfig GlobalKubeCo
 }
 
 func (kcm *kubeConfigManager) saveModuleKubeConfig(moduleKubeConfig ModuleKubeConfig) error {
+	kcm.checksumsLock.Lock()
+	defer kcm.checksumsLock.Unlock()
 	err := kcm.changeOrCreateKubeConfig(func(obj *v1.ConfigMap) error {
 		obj.Data = simpleMergeConfigMapData(obj.Data, moduleKubeConfig.ConfigData)
 		return nil
@@ -123,7 +135,6 @@ func (kcm *kubeConfigManager) saveModuleKubeConfig(moduleKubeConfig ModuleKubeCo
 	if err != nil {
 		return err
 	}
-	// TODO add a mutex for this map? Config patch from hook can run in parallel with ConfigMap editing...
 	kcm.ModulesValuesChecksum[moduleKubeConfig.ModuleName] = moduleKubeConfig.Checksum
 	return nil
 }
@@ -249,6 +260,50 @@ func (kcm *kubeConfigManager) getConfigMap() (*v1.ConfigMap, error) {
 	}
 }
 
+func (kcm *kubeConfigManager) ConfigAnnotation(name string) (string, error) {
+	obj, err := kcm.KubeClient.CoreV1().ConfigMaps(kcm.Namespace).Get(context.TODO(), kcm.ConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return obj.Annotations[name], nil
+}
+
+func (kcm *kubeConfigManager) SetConfigAnnotation(name string, value string) error {
+	obj, err := kcm.KubeClient.CoreV1().ConfigMaps(kcm.Namespace).Get(context.TODO(), kcm.ConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) && value == "" {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !setAnnotation(obj, name, value) {
+		return nil
+	}
+	_, err = kcm.KubeClient.CoreV1().ConfigMaps(kcm.Namespace).Update(context.TODO(), obj, metav1.UpdateOptions{})
+	return err
+}
+
+// setAnnotation returns false if the annotation is not changed.
+func setAnnotation(obj metav1.Object, name string, value string) bool {
+	annotations := obj.GetAnnotations()
+	if annotations[name] == value {
+		return false
+	}
+	if value == "" {
+		delete(annotations, name)
+	} else {
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[name] = value
+	}
+	obj.SetAnnotations(annotations)
+	return true
+}
+
 func (kcm *kubeConfigManager) InitialConfig() *Config {
 	return kcm.initialConfig
 }
@@ -276,11 +331,16 @@ func (kcm *kubeConfigManager) initConfig() error {
 		return nil
 	}
 
+	return kcm.initConfigFromData(obj.Data)
+}
+
+// initConfigFromData fills initial config and checksums from ConfigMap-like data.
+func (kcm *kubeConfigManager) initConfigFromData(configData map[string]string) error {
 	initialConfig := NewConfig()
 	globalValuesChecksum := ""
 	modulesValuesChecksum := make(map[string]string)
 
-	globalKubeConfig, err := GetGlobalKubeConfigFromConfigData(obj.Data)
+	globalKubeConfig, err := GetGlobalKubeConfigFromConfigData(configData)
 	if err != nil {
 		return err
 	}
@@ -289,9 +349,9 @@ func (kcm *kubeConfigManager) initConfig() error {
 		globalValuesChecksum = globalKubeConfig.Checksum
 	}
 
-	for moduleName := range GetModulesNamesFromConfigData(obj.Data) {
+	for moduleName := range GetModulesNamesFromConfigData(configData) {
 		// all GetModulesNamesFromConfigData must exist
-		moduleKubeConfig, err := ExtractModuleKubeConfig(moduleName, obj.Data)
+		moduleKubeConfig, err := ExtractModuleKubeConfig(moduleName, configData)
 		if err != nil {
 			return err
 		}
@@ -334,7 +394,16 @@ func (kcm *kubeConfigManager) Init() error {
 // Array of actual ModuleConfig is send over ModuleConfigsUpdated channel
 // if module sections are changed or deleted.
 func (kcm *kubeConfigManager) handleNewCm(obj *v1.ConfigMap) error {
-	globalKubeConfig, err := GetGlobalKubeConfigFromConfigData(obj.Data)
+	return kcm.handleNewConfigData(obj.Data)
+}
+
+// handleNewConfigData is a handleNewCm for ConfigMap-like data. It is used
+// by config managers that assemble the data from other sources.
+func (kcm *kubeConfigManager) handleNewConfigData(configData map[string]string) error {
+	kcm.checksumsLock.Lock()
+	defer kcm.checksumsLock.Unlock()
+
+	globalKubeConfig, err := GetGlobalKubeConfigFromConfigData(configData)
 	if err != nil {
 		return err
 	}
@@ -358,9 +427,9 @@ func (kcm *kubeConfigManager) handleNewCm(obj *v1.ConfigMap) error {
 
 		// calculate new checksums of a module sections
 		newModulesValuesChecksum := make(map[string]string)
-		for moduleName := range GetModulesNamesFromConfigData(obj.Data) {
+		for moduleName := range GetModulesNamesFromConfigData(configData) {
 			// all GetModulesNamesFromConfigData must exist
-			moduleKubeConfig, err := ExtractModuleKubeConfig(moduleName, obj.Data)
+			moduleKubeConfig, err := ExtractModuleKubeConfig(moduleName, configData)
 			if err != nil {
 				return err
 			}
@@ -380,7 +449,7 @@ func (kcm *kubeConfigManager) handleNewCm(obj *v1.ConfigMap) error {
 
 		kcm.currentConfig = newConfig
 	} else {
-		actualModulesNames := GetModulesNamesFromConfigData(obj.Data)
+		actualModulesNames := GetModulesNamesFromConfigData(configData)
 
 		moduleConfigsActual := make(ModuleConfigs)
 		updatedCount := 0
@@ -390,7 +459,7 @@ func (kcm *kubeConfigManager) handleNewCm(obj *v1.ConfigMap) error {
 		// IsUpdated flag set for updated configs
 		for moduleName := range actualModulesNames {
 			// all GetModulesNamesFromConfigData must exist
-			moduleKubeConfig, err := ExtractModuleKubeConfig(moduleName, obj.Data)
+			moduleKubeConfig, err := ExtractModuleKubeConfig(moduleName, configData)
 			if err != nil {
 				return err
 			}
@@ -460,6 +529,9 @@ func (kcm *kubeConfigManager) handleCmDelete(obj *v1.ConfigMap) error {
 		log.Debugf("Kube config manager: handle ConfigMap '%s' delete:\n%s", obj.Name, objYaml)
 	}
 
+	kcm.checksumsLock.Lock()
+	defer kcm.checksumsLock.Unlock()
+
 	if kcm.GlobalValuesChecksum != "" {
 		kcm.GlobalValuesChecksum = ""
 		kcm.ModulesValuesChecksum = make(map[string]string)
@@ -0,0 +1,384 @@
+package kube_config_manager
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/yaml"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// Custom resources to store configuration instead of a single ConfigMap.
+//
+// ModuleConfig is a cluster-scoped resource named after the module (kebab-case):
+//
+//   apiVersion: addon-operator.flant.com/v1alpha1
+//   kind: ModuleConfig
+//   metadata:
+//     name: simple-module
+//   spec:
+//     enabled: true
+//     settings:
+//       modParam1: value1
+//
+// GlobalConfig is a cluster-scoped resource named 'global' with global values:
+//
+//   apiVersion: addon-operator.flant.com/v1alpha1
+//   kind: GlobalConfig
+//   metadata:
+//     name: global
+//   spec:
+//     settings:
+//       param1: value1
+const (
+	ConfigGroup      = "addon-operator.flant.com"
+	ConfigVersion    = "v1alpha1"
+	ModuleConfigKind = "ModuleConfig"
+	GlobalConfigKind = "GlobalConfig"
+	GlobalConfigName = "global"
+)
+
+var ModuleConfigGVR = schema.GroupVersionResource{Group: ConfigGroup, Version: ConfigVersion, Resource: "moduleconfigs"}
+var GlobalConfigGVR = schema.GroupVersionResource{Group: ConfigGroup, Version: ConfigVersion, Resource: "globalconfigs"}
+
+// crdKubeConfigManager reads config from ModuleConfig and GlobalConfig custom resources.
+// Resources are converted to ConfigMap-like data, so detection of changes and
+// notifications are the same as for the ConfigMap.
+type crdKubeConfigManager struct {
+	kubeConfigManager
+
+	// handleMu serializes events from ModuleConfig and GlobalConfig informers.
+	handleMu sync.Mutex
+
+	moduleConfigStore cache.Store
+	globalConfigStore cache.Store
+}
+
+// crdKubeConfigManager should implement KubeConfigManager
+var _ KubeConfigManager = &crdKubeConfigManager{}
+
+func NewCrdKubeConfigManager() KubeConfigManager {
+	return &crdKubeConfigManager{
+		kubeConfigManager: kubeConfigManager{
+			initialConfig:         NewConfig(),
+			currentConfig:         NewConfig(),
+			ModulesValuesChecksum: map[string]string{},
+		},
+	}
+}
+
+// WithConfigMapName is not used: resources have fixed names.
+func (kcm *crdKubeConfigManager) WithConfigMapName(_ string) {
+}
+
+func (kcm *crdKubeConfigManager) Init() error {
+	log.Debug("INIT: KUBE_CONFIG from custom resources")
+
+	ConfigUpdated = make(chan Config, 1)
+	ModuleConfigsUpdated = make(chan ModuleConfigs, 1)
+
+	moduleConfigs, err := kcm.KubeClient.Dynamic().Resource(ModuleConfigGVR).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list %s: %v", ModuleConfigKind, err)
+	}
+	objs := make([]*unstructured.Unstructured, 0, len(moduleConfigs.Items))
+	for i := range moduleConfigs.Items {
+		objs = append(objs, &moduleConfigs.Items[i])
+	}
+
+	globalConfig, err := kcm.getGlobalConfig()
+	if err != nil {
+		return err
+	}
+
+	configData, err := ConfigDataFromCustomResources(globalConfig, objs)
+	if err != nil {
+		return err
+	}
+
+	return kcm.initConfigFromData(configData)
+}
+
+func (kcm *crdKubeConfigManager) getGlobalConfig() (*unstructured.Unstructured, error) {
+	obj, err := kcm.KubeClient.Dynamic().Resource(GlobalConfigGVR).Get(context.TODO(), GlobalConfigName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		log.Debugf("KUBE_CONFIG_MANAGER: %s/%s is not created", GlobalConfigKind, GlobalConfigName)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get %s/%s: %v", GlobalConfigKind, GlobalConfigName, err)
+	}
+	return obj, nil
+}
+
+func (kcm *crdKubeConfigManager) SetKubeGlobalValues(values utils.Values) error {
+	globalKubeConfig, err := GetGlobalKubeConfigFromValues(values)
+	if err != nil {
+		return err
+	}
+	if globalKubeConfig == nil {
+		return nil
+	}
+
+	log.Debugf("Kube config manager: set kube global values:\n%s", values.DebugString())
+
+	settings, ok := globalKubeConfig.Values[utils.GlobalValuesKey].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("global config values should be a map")
+	}
+	kcm.checksumsLock.Lock()
+	defer kcm.checksumsLock.Unlock()
+	err = kcm.saveSettings(GlobalConfigGVR, GlobalConfigKind, GlobalConfigName, settings)
+	if err != nil {
+		return err
+	}
+	kcm.GlobalValuesChecksum = globalKubeConfig.Checksum
+	return nil
+}
+
+func (kcm *crdKubeConfigManager) SetKubeModuleValues(moduleName string, values utils.Values) error {
+	moduleKubeConfig, err := GetModuleKubeConfigFromValues(moduleName, values)
+	if err != nil {
+		return err
+	}
+	if moduleKubeConfig == nil {
+		return nil
+	}
+
+	log.Debugf("Kube config manager: set kube module values:\n%s", moduleKubeConfig.ModuleConfig.String())
+
+	settings, ok := moduleKubeConfig.Values[utils.ModuleNameToValuesKey(moduleName)].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("module '%s' config values should be a map", moduleName)
+	}
+	kcm.checksumsLock.Lock()
+	defer kcm.checksumsLock.Unlock()
+	err = kcm.saveSettings(ModuleConfigGVR, ModuleConfigKind, moduleName, settings)
+	if err != nil {
+		return err
+	}
+	kcm.ModulesValuesChecksum[moduleName] = moduleKubeConfig.Checksum
+	return nil
+}
+
+// saveSettings updates spec.settings field in the resource or creates a new resource.
+func (kcm *crdKubeConfigManager) saveSettings(gvr schema.GroupVersionResource, kind string, name string, settings map[string]interface{}) error {
+	client := kcm.KubeClient.Dynamic().Resource(gvr)
+
+	obj, err := client.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("get %s/%s: %v", kind, name, err)
+	}
+
+	if errors.IsNotFound(err) {
+		obj = &unstructured.Unstructured{}
+		obj.SetAPIVersion(ConfigGroup + "/" + ConfigVersion)
+		obj.SetKind(kind)
+		obj.SetName(name)
+		err = unstructured.SetNestedField(obj.Object, settings, "spec", "settings")
+		if err != nil {
+			return err
+		}
+		_, err = client.Create(context.TODO(), obj, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("create %s/%s: %v", kind, name, err)
+		}
+		return nil
+	}
+
+	err = unstructured.SetNestedField(obj.Object, settings, "spec", "settings")
+	if err != nil {
+		return err
+	}
+	_, err = client.Update(context.TODO(), obj, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("update %s/%s: %v", kind, name, err)
+	}
+	return nil
+}
+
+func (kcm *crdKubeConfigManager) ConfigAnnotation(name string) (string, error) {
+	obj, err := kcm.getGlobalConfig()
+	if err != nil || obj == nil {
+		return "", err
+	}
+	return obj.GetAnnotations()[name], nil
+}
+
+func (kcm *crdKubeConfigManager) SetConfigAnnotation(name string, value string) error {
+	obj, err := kcm.getGlobalConfig()
+	if err != nil {
+		return err
+	}
+	if obj == nil {
+		if value == "" {
+			return nil
+		}
+		return fmt.Errorf("%s/%s is not created", GlobalConfigKind, GlobalConfigName)
+	}
+	if !setAnnotation(obj, name, value) {
+		return nil
+	}
+	_, err = kcm.KubeClient.Dynamic().Resource(GlobalConfigGVR).Update(context.TODO(), obj, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("update %s/%s: %v", GlobalConfigKind, GlobalConfigName, err)
+	}
+	return nil
+}
+
+// handleStoresChange converts all cached resources into ConfigMap-like data
+// and detects changes in global and module sections.
+func (kcm *crdKubeConfigManager) handleStoresChange() error {
+	kcm.handleMu.Lock()
+	defer kcm.handleMu.Unlock()
+
+	var globalConfig *unstructured.Unstructured
+	for _, item := range kcm.globalConfigStore.List() {
+		obj := item.(*unstructured.Unstructured)
+		if obj.GetName() == GlobalConfigName {
+			globalConfig = obj
+			break
+		}
+	}
+
+	moduleConfigs := make([]*unstructured.Unstructured, 0)
+	for _, item := range kcm.moduleConfigStore.List() {
+		moduleConfigs = append(moduleConfigs, item.(*unstructured.Unstructured))
+	}
+
+	configData, err := ConfigDataFromCustomResources(globalConfig, moduleConfigs)
+	if err != nil {
+		return err
+	}
+
+	return kcm.handleNewConfigData(configData)
+}
+
+func (kcm *crdKubeConfigManager) Start() {
+	log.Debugf("Run kube config manager for custom resources")
+
+	// define resyncPeriod for informer
+	resyncPeriod := time.Duration(5) * time.Minute
+
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(kcm.KubeClient.Dynamic(), resyncPeriod)
+	moduleConfigInformer := factory.ForResource(ModuleConfigGVR).Informer()
+	globalConfigInformer := factory.ForResource(GlobalConfigGVR).Informer()
+	kcm.moduleConfigStore = moduleConfigInformer.GetStore()
+	kcm.globalConfigStore = globalConfigInformer.GetStore()
+
+	// Events are ignored until both informers are synced: initial config is already loaded in Init.
+	synced := func() bool {
+		return moduleConfigInformer.HasSynced() && globalConfigInformer.HasSynced()
+	}
+	handleEvent := func(kind string, event string) {
+		if !synced() {
+			return
+		}
+		err := kcm.handleStoresChange()
+		if err != nil {
+			log.Errorf("Kube config manager: cannot handle %s %s: %s", kind, event, err)
+		}
+	}
+
+	for kind, informer := range map[string]cache.SharedIndexInformer{
+		ModuleConfigKind: moduleConfigInformer,
+		GlobalConfigKind: globalConfigInformer,
+	} {
+		kind := kind
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(_ interface{}) {
+				handleEvent(kind, "add")
+			},
+			UpdateFunc: func(_ interface{}, _ interface{}) {
+				handleEvent(kind, "update")
+			},
+			DeleteFunc: func(_ interface{}) {
+				handleEvent(kind, "delete")
+			},
+		})
+	}
+
+	factory.Start(kcm.ctx.Done())
+	if !cache.WaitForCacheSync(kcm.ctx.Done(), synced) {
+		log.Errorf("Kube config manager: custom resources informers are not synced")
+		return
+	}
+	// Catch changes made between Init and informers sync.
+	handleEvent("", "sync")
+
+	<-kcm.ctx.Done()
+}
+
+// ConfigDataFromCustomResources returns ConfigMap-like data for GlobalConfig and ModuleConfig resources.
+func ConfigDataFromCustomResources(globalConfig *unstructured.Unstructured, moduleConfigs []*unstructured.Unstructured) (map[string]string, error) {
+	configData := make(map[string]string)
+
+	if globalConfig != nil {
+		settings, err := settingsYaml(globalConfig)
+		if err != nil {
+			return nil, err
+		}
+		if settings != "" {
+			configData[utils.GlobalValuesKey] = settings
+		}
+	}
+
+	// Sort resources to get stable error messages.
+	sort.Slice(moduleConfigs, func(i, j int) bool {
+		return moduleConfigs[i].GetName() < moduleConfigs[j].GetName()
+	})
+
+	for _, obj := range moduleConfigs {
+		valuesKey := utils.ModuleNameToValuesKey(obj.GetName())
+		if utils.ModuleNameFromValuesKey(valuesKey) != obj.GetName() {
+			log.Errorf("Bad %s name '%s': should be kebab-cased module name: ignoring resource", ModuleConfigKind, obj.GetName())
+			continue
+		}
+
+		settings, err := settingsYaml(obj)
+		if err != nil {
+			return nil, err
+		}
+		if settings != "" {
+			configData[valuesKey] = settings
+		}
+
+		enabled, found, err := unstructured.NestedBool(obj.Object, "spec", "enabled")
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s: bad spec.enabled: %v", ModuleConfigKind, obj.GetName(), err)
+		}
+		if found {
+			configData[valuesKey+"Enabled"] = fmt.Sprintf("%t", enabled)
+		}
+	}
+
+	return configData, nil
+}
+
+// settingsYaml returns spec.settings as a yaml string or an empty string if there are no settings.
+func settingsYaml(obj *unstructured.Unstructured) (string, error) {
+	settings, found, err := unstructured.NestedFieldNoCopy(obj.Object, "spec", "settings")
+	if err != nil {
+		return "", fmt.Errorf("%s/%s: bad spec.settings: %v", obj.GetKind(), obj.GetName(), err)
+	}
+	if !found || settings == nil {
+		return "", nil
+	}
+
+	data, err := yaml.Marshal(settings)
+	if err != nil {
+		return "", fmt.Errorf("%s/%s: marshal spec.settings: %v", obj.GetKind(), obj.GetName(), err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,97 @@
+package kube_config_manager
+
+import (
+	"context"
+	"testing"
+
+	klient "github.com/flant/kube-client/client"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+func newConfigResource(kind string, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	obj.SetAPIVersion(ConfigGroup + "/" + ConfigVersion)
+	obj.SetKind(kind)
+	obj.SetName(name)
+	return obj
+}
+
+func Test_ConfigDataFromCustomResources(t *testing.T) {
+	g := NewWithT(t)
+
+	globalConfig := newConfigResource(GlobalConfigKind, GlobalConfigName, map[string]interface{}{
+		"settings": map[string]interface{}{"project": "tfprod"},
+	})
+	moduleConfigs := []*unstructured.Unstructured{
+		newConfigResource(ModuleConfigKind, "nginx-ingress", map[string]interface{}{
+			"enabled":  true,
+			"settings": map[string]interface{}{"hsts": true},
+		}),
+		newConfigResource(ModuleConfigKind, "kube-lego", map[string]interface{}{
+			"enabled": false,
+		}),
+		// Bad name should be ignored.
+		newConfigResource(ModuleConfigKind, "badName", map[string]interface{}{
+			"enabled": false,
+		}),
+	}
+
+	configData, err := ConfigDataFromCustomResources(globalConfig, moduleConfigs)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(configData).To(Equal(map[string]string{
+		"global":              "project: tfprod\n",
+		"nginxIngress":        "hsts: true\n",
+		"nginxIngressEnabled": "true",
+		"kubeLegoEnabled":     "false",
+	}))
+}
+
+func Test_CrdKubeConfigManager_Init(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeClient := klient.NewFake(nil)
+	_, err := kubeClient.Dynamic().Resource(GlobalConfigGVR).Create(context.TODO(),
+		newConfigResource(GlobalConfigKind, GlobalConfigName, map[string]interface{}{
+			"settings": map[string]interface{}{"clusterName": "main"},
+		}), metav1.CreateOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	_, err = kubeClient.Dynamic().Resource(ModuleConfigGVR).Create(context.TODO(),
+		newConfigResource(ModuleConfigKind, "prometheus", map[string]interface{}{
+			"enabled":  true,
+			"settings": map[string]interface{}{"retentionDays": 20.0},
+		}), metav1.CreateOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	kcm := NewCrdKubeConfigManager()
+	kcm.WithKubeClient(kubeClient)
+	kcm.WithContext(context.Background())
+
+	err = kcm.Init()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	config := kcm.InitialConfig()
+	g.Expect(config.Values).To(Equal(utils.Values{
+		"global": map[string]interface{}{"clusterName": "main"},
+	}))
+	g.Expect(config.ModuleConfigs).To(HaveKey("prometheus"))
+	prometheusConfig := config.ModuleConfigs["prometheus"]
+	g.Expect(prometheusConfig.GetEnabled()).To(Equal("true"))
+	g.Expect(prometheusConfig.Values).To(Equal(utils.Values{
+		"prometheus": map[string]interface{}{"retentionDays": 20.0},
+	}))
+
+	// Config patch from a hook should create a new ModuleConfig.
+	err = kcm.SetKubeModuleValues("kube-lego", utils.Values{
+		"kubeLego": map[string]interface{}{"email": "admin@example.com"},
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	obj, err := kubeClient.Dynamic().Resource(ModuleConfigGVR).Get(context.TODO(), "kube-lego", metav1.GetOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	email, _, _ := unstructured.NestedString(obj.Object, "spec", "settings", "email")
+	g.Expect(email).To(Equal("admin@example.com"))
+}
@@ -0,0 +1,119 @@
+package module_events
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/flant/addon-operator/pkg/module_status_manager"
+)
+
+// Reasons of events.
+const (
+	ModuleEnabled        = "ModuleEnabled"
+	ModuleDisabled       = "ModuleDisabled"
+	ModuleDeleteFailed   = "ModuleDeleteFailed"
+	ModuleConflict       = "ModuleConflict"
+	HelmUpgraded         = "HelmUpgraded"
+	HelmUpgradeFailed    = "HelmUpgradeFailed"
+	HookFailed           = "HookFailed"
+	HelmResourcesAbsent  = "HelmResourcesAbsent"
+	HelmResourcesDrifted = "HelmResourcesDrifted"
+)
+
+// MaxMessageLength limits a message of the event, hook errors can contain a long output.
+const MaxMessageLength = 1024
+
+// Recorder emits core/v1 Events about modules and global hooks. Events for modules are
+// attached to Module custom resources if module statuses are enabled, otherwise to the
+// operator Pod. Events for global hooks are always attached to the operator Pod.
+//
+// Events are aggregated and rate limited by the client-go event correlator: similar events
+// are counted in one Event and a burst of events for one object is throttled.
+//
+// A nil Recorder does nothing, so callers do not check if events are enabled.
+type Recorder struct {
+	broadcaster   record.EventBroadcaster
+	eventRecorder record.EventRecorder
+	operatorRef   *v1.ObjectReference
+	moduleObjects bool
+}
+
+func NewRecorder(kubeClient kubernetes.Interface, component string, operatorRef *v1.ObjectReference, moduleObjects bool) *Recorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+	return &Recorder{
+		broadcaster:   broadcaster,
+		eventRecorder: broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: component}),
+		operatorRef:   operatorRef,
+		moduleObjects: moduleObjects,
+	}
+}
+
+// OperatorPodReference returns a reference to the operator Pod. The Pod is requested
+// to get its uid for 'kubectl describe', the reference without uid is returned on error.
+func OperatorPodReference(kubeClient kubernetes.Interface, namespace string, podName string) *v1.ObjectReference {
+	ref := &v1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Namespace:  namespace,
+		Name:       podName,
+	}
+	pod, err := kubeClient.CoreV1().Pods(namespace).Get(context.TODO(), podName, metav1.GetOptions{})
+	if err != nil {
+		log.Warnf("Get Pod '%s/%s' for events: %v", namespace, podName, err)
+		return ref
+	}
+	ref.UID = pod.UID
+	ref.ResourceVersion = pod.ResourceVersion
+	return ref
+}
+
+// ModuleEvent emits an event about the module.
+func (r *Recorder) ModuleEvent(moduleName string, eventType string, reason string, messageFmt string, args ...interface{}) {
+	if r == nil {
+		return
+	}
+	message := fmt.Sprintf(messageFmt, args...)
+	if !r.moduleObjects {
+		r.emit(r.operatorRef, eventType, reason, fmt.Sprintf("Module '%s': %s", moduleName, message))
+		return
+	}
+	// Module is cluster-scoped, so the event is created in the 'default' namespace.
+	ref := &v1.ObjectReference{
+		APIVersion: module_status_manager.ModuleGroup + "/" + module_status_manager.ModuleVersion,
+		Kind:       module_status_manager.ModuleKind,
+		Name:       moduleName,
+	}
+	r.emit(ref, eventType, reason, message)
+}
+
+// OperatorEvent emits an event about the operator, e.g. a global hook failure.
+func (r *Recorder) OperatorEvent(eventType string, reason string, messageFmt string, args ...interface{}) {
+	if r == nil {
+		return
+	}
+	r.emit(r.operatorRef, eventType, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *Recorder) emit(ref *v1.ObjectReference, eventType string, reason string, message string) {
+	if len(message) > MaxMessageLength {
+		message = message[:MaxMessageLength-3] + "..."
+	}
+	r.eventRecorder.Event(ref, eventType, reason, message)
+}
+
+// Stop stops sending of events.
+func (r *Recorder) Stop() {
+	if r == nil || r.broadcaster == nil {
+		return
+	}
+	r.broadcaster.Shutdown()
+}
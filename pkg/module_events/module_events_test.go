@@ -0,0 +1,77 @@
+package module_events
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	klient "github.com/flant/kube-client/client"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+type recordedEvent struct {
+	ref       *v1.ObjectReference
+	eventType string
+	reason    string
+	message   string
+}
+
+// testEventRecorder saves events instead of sending them to the broadcaster.
+type testEventRecorder struct {
+	events []recordedEvent
+}
+
+func (r *testEventRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	r.events = append(r.events, recordedEvent{ref: object.(*v1.ObjectReference), eventType: eventtype, reason: reason, message: message})
+}
+
+func (r *testEventRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+}
+
+func (r *testEventRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+}
+
+func Test_Recorder_InvolvedObjects(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeClient := klient.NewFake(nil)
+	_, err := kubeClient.CoreV1().Pods("d8-system").Create(context.TODO(), &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "addon-operator-0", Namespace: "d8-system", UID: "pod-uid"},
+	}, metav1.CreateOptions{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	podRef := OperatorPodReference(kubeClient, "d8-system", "addon-operator-0")
+	g.Expect(string(podRef.UID)).To(Equal("pod-uid"))
+
+	// Module events are attached to the operator Pod if module statuses are disabled.
+	rec := &testEventRecorder{}
+	r := &Recorder{eventRecorder: rec, operatorRef: podRef}
+	r.ModuleEvent("module-a", v1.EventTypeNormal, ModuleEnabled, "Module is enabled")
+	r.OperatorEvent(v1.EventTypeWarning, HookFailed, "Global hook '%s' failed", "hook.sh")
+
+	g.Expect(rec.events).To(HaveLen(2))
+	g.Expect(rec.events[0].ref.Kind).To(Equal("Pod"))
+	g.Expect(rec.events[0].message).To(Equal("Module 'module-a': Module is enabled"))
+	g.Expect(rec.events[1].ref.Kind).To(Equal("Pod"))
+	g.Expect(rec.events[1].reason).To(Equal(HookFailed))
+	g.Expect(rec.events[1].message).To(Equal("Global hook 'hook.sh' failed"))
+
+	// Module events are attached to Module resources and long messages are truncated.
+	rec = &testEventRecorder{}
+	r = &Recorder{eventRecorder: rec, operatorRef: podRef, moduleObjects: true}
+	r.ModuleEvent("module-a", v1.EventTypeWarning, HelmUpgradeFailed, "Helm upgrade failed: %s", strings.Repeat("x", 2000))
+
+	g.Expect(rec.events).To(HaveLen(1))
+	g.Expect(rec.events[0].ref.Kind).To(Equal("Module"))
+	g.Expect(rec.events[0].ref.Name).To(Equal("module-a"))
+	g.Expect(rec.events[0].ref.Namespace).To(BeEmpty())
+	g.Expect(rec.events[0].message).To(HaveLen(MaxMessageLength))
+
+	// Nil recorder does nothing.
+	var nilRecorder *Recorder
+	nilRecorder.ModuleEvent("module-a", v1.EventTypeNormal, ModuleEnabled, "Module is enabled")
+	nilRecorder.Stop()
+}
@@ -8,14 +8,17 @@ import (
 	"github.com/hashicorp/go-multierror"
 	log "github.com/sirupsen/logrus"
 	uuid "gopkg.in/satori/go.uuid.v1"
+	v1 "k8s.io/api/core/v1"
 
 	"github.com/flant/shell-operator/pkg/hook"
 	. "github.com/flant/shell-operator/pkg/hook/binding_context"
 	. "github.com/flant/shell-operator/pkg/hook/types"
 
 	. "github.com/flant/addon-operator/pkg/hook/types"
+	"github.com/flant/addon-operator/pkg/module_events"
 	"github.com/flant/addon-operator/pkg/module_manager/go_hook"
 
+	"github.com/flant/addon-operator/pkg/tracing"
 	"github.com/flant/addon-operator/pkg/utils"
 )
 
@@ -157,23 +160,35 @@ func (h *GlobalHook) Run(bindingType BindingType, bindingContext []BindingContex
 			Infof("snapshot info: %s", info)
 	}
 
+	metricLabels := map[string]string{
+		"hook":       h.Name,
+		"binding":    string(bindingType),
+		"queue":      logLabels["queue"],
+		"activation": logLabels["event.type"],
+	}
+
 	globalHookExecutor := NewHookExecutor(h, bindingContext, h.Config.Version, h.moduleManager.KubeObjectPatcher)
 	globalHookExecutor.WithLogLabels(logLabels)
+	globalHookExecutor.WithTimeout(h.Config.Timeout)
+	span := tracing.StartSpan(logLabels, "GlobalHookExecute", hookSpanAttributes(h.Name, bindingContext)...)
 	hookResult, err := globalHookExecutor.Run()
+	tracing.EndSpan(span, err)
 	if hookResult != nil && hookResult.Usage != nil {
-		metricLabels := map[string]string{
-			"hook":       h.Name,
-			"binding":    string(bindingType),
-			"queue":      logLabels["queue"],
-			"activation": logLabels["event.type"],
-		}
 		// usage metrics
 		h.moduleManager.metricStorage.HistogramObserve("{PREFIX}global_hook_run_sys_cpu_seconds", hookResult.Usage.Sys.Seconds(), metricLabels, nil)
 		h.moduleManager.metricStorage.HistogramObserve("{PREFIX}global_hook_run_user_cpu_seconds", hookResult.Usage.User.Seconds(), metricLabels, nil)
 		h.moduleManager.metricStorage.GaugeSet("{PREFIX}global_hook_run_max_rss_bytes", float64(hookResult.Usage.MaxRss)*1024, metricLabels)
 	}
+	if IsHookTimeout(err) {
+		h.moduleManager.metricStorage.CounterAdd("{PREFIX}global_hook_timeouts_total", 1.0, metricLabels)
+	}
+	if IsHookAbandoned(err) {
+		h.moduleManager.metricStorage.CounterAdd("{PREFIX}global_hook_abandoned_total", 1.0, metricLabels)
+	}
 	if err != nil {
-		return fmt.Errorf("global hook '%s' failed: %s", h.Name, err)
+		h.moduleManager.eventRecorder.OperatorEvent(v1.EventTypeWarning, module_events.HookFailed,
+			"Global hook '%s' failed on %s: %v", h.Name, bindingType, err)
+		return fmt.Errorf("global hook '%s' failed: %w", h.Name, err)
 	}
 
 	// Apply metric operations
@@ -259,7 +274,7 @@ func (h *GlobalHook) Run(bindingType BindingType, bindingContext []BindingContex
 				)
 			}
 
-			h.moduleManager.UpdateGlobalDynamicValuesPatches(valuesPatchResult.ValuesPatch)
+			h.moduleManager.UpdateGlobalDynamicValuesPatches(valuesPatchResult.ValuesPatch, newValuesPatchSource(h.Name, bindingType, bindingContext))
 			newGlobalValues, err := h.moduleManager.GlobalValues()
 			if err != nil {
 				return fmt.Errorf("global hook '%s': global values after patch apply: %s", h.Name, err)
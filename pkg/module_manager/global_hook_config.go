@@ -3,6 +3,7 @@ package module_manager
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	types2 "github.com/flant/shell-operator/pkg/kube_events_manager/types"
@@ -12,6 +13,7 @@ import (
 
 	. "github.com/flant/addon-operator/pkg/hook/types"
 	"github.com/flant/addon-operator/pkg/module_manager/go_hook"
+	"github.com/flant/addon-operator/pkg/utils"
 
 	. "github.com/flant/shell-operator/pkg/hook/types"
 
@@ -34,8 +36,10 @@ type GlobalHookConfig struct {
 	GlobalV1 *GlobalHookConfigV0
 
 	// effective config values
-	BeforeAll *BeforeAllConfig
-	AfterAll  *AfterAllConfig
+	BeforeAll   *BeforeAllConfig
+	AfterAll    *AfterAllConfig
+	Timeout     time.Duration
+	RetryPolicy *utils.RetryPolicy
 }
 
 type BeforeAllConfig struct {
@@ -49,8 +53,10 @@ type AfterAllConfig struct {
 }
 
 type GlobalHookConfigV0 struct {
-	BeforeAll interface{} `json:"beforeAll"`
-	AfterAll  interface{} `json:"afterAll"`
+	BeforeAll   interface{}              `json:"beforeAll"`
+	AfterAll    interface{}              `json:"afterAll"`
+	Timeout     string                   `json:"timeout"`
+	RetryPolicy *utils.RetryPolicyConfig `json:"retryPolicy"`
 }
 
 func GetGlobalHookConfigSchema(version string) *spec.Schema {
@@ -59,7 +65,7 @@ func GetGlobalHookConfigSchema(version string) *spec.Schema {
 		schema := config.Schemas[version]
 		switch version {
 		case "v1":
-			// add beforeAll and afterAll properties
+			// add beforeAll, afterAll, timeout and retryPolicy properties
 			schema += `
   beforeAll:
     type: integer
@@ -67,6 +73,23 @@ func GetGlobalHookConfigSchema(version string) *spec.Schema {
   afterAll:
     type: integer
     example: 10    
+  timeout:
+    type: string
+    example: 30s
+  retryPolicy:
+    type: object
+    additionalProperties: false
+    properties:
+      initialDelay:
+        type: string
+      maxDelay:
+        type: string
+      maxAttempts:
+        type: integer
+        minimum: 0
+      onExhausted:
+        type: string
+        enum: ["KeepFailing", "Skip"]
 `
 		case "v0":
 			// add beforeAll and afterAll properties
@@ -170,6 +193,16 @@ func (c *GlobalHookConfig) ConvertAndCheckV1() (err error) {
 		return err
 	}
 
+	c.Timeout, err = ConvertHookTimeout(c.GlobalV1.Timeout)
+	if err != nil {
+		return err
+	}
+
+	c.RetryPolicy, err = c.GlobalV1.RetryPolicy.Convert()
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -262,9 +295,37 @@ func NewGlobalHookConfigFromGoConfig(input *go_hook.HookConfig) (*GlobalHookConf
 		cfg.AfterAll.Order = input.OnAfterAll.Order
 	}
 
+	if input.Settings != nil {
+		cfg.Timeout = input.Settings.Timeout
+		cfg.RetryPolicy = input.Settings.RetryPolicy
+		if cfg.RetryPolicy != nil {
+			if cfg.RetryPolicy.OnExhausted == utils.RetryDisableModule {
+				return nil, fmt.Errorf("retryPolicy: '%s' is not supported for global hooks", utils.RetryDisableModule)
+			}
+			if err := cfg.RetryPolicy.Validate(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	return cfg, nil
 }
 
+// ConvertHookTimeout parses a 'timeout' field of the hook config. Empty value means no timeout.
+func ConvertHookTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("timeout is invalid: %v", err)
+	}
+	if timeout < 0 {
+		return 0, fmt.Errorf("timeout is invalid: should be positive, got '%s'", value)
+	}
+	return timeout, nil
+}
+
 func NewHookConfigFromGoConfig(input *go_hook.HookConfig) (config.HookConfig, error) {
 	c := config.HookConfig{
 		Version:            "v1",
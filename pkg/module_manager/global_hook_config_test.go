@@ -56,6 +56,24 @@ afterAll: 10
 				g.Expect(config.AfterAll.Order).To(Equal(10.0))
 			},
 		},
+		{
+			"load v1 config with retryPolicy",
+			"hook_v1",
+			`{"configVersion": "v1", "afterAll":10, "retryPolicy": {"maxAttempts": 2, "onExhausted": "Skip"}}`,
+			func() {
+				g.Expect(err).ShouldNot(HaveOccurred())
+				g.Expect(config.RetryPolicy.MaxAttempts).To(Equal(2))
+				g.Expect(config.RetryPolicy.ExhaustedAction()).To(Equal("Skip"))
+			},
+		},
+		{
+			"load v1 config with DisableModule retryPolicy",
+			"hook_v1",
+			`{"configVersion": "v1", "afterAll":10, "retryPolicy": {"onExhausted": "DisableModule"}}`,
+			func() {
+				g.Expect(err).Should(HaveOccurred())
+			},
+		},
 	}
 
 	for _, test := range tests {
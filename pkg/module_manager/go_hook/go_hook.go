@@ -1,6 +1,7 @@
 package go_hook
 
 import (
+	"context"
 	"time"
 
 	"github.com/flant/shell-operator/pkg/kube/object_patch"
@@ -10,6 +11,7 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	"github.com/flant/addon-operator/pkg/module_manager/go_hook/metrics"
+	"github.com/flant/addon-operator/pkg/utils"
 )
 
 type GoHook interface {
@@ -131,6 +133,8 @@ type HookInput struct {
 	PatchCollector   *object_patch.PatchCollector
 	LogEntry         *logrus.Entry
 	BindingActions   *[]BindingAction
+	// Context is cancelled when the hook timeout is exceeded.
+	Context context.Context
 }
 
 // Deprecated. Use methods from PatchCollector property.
@@ -165,6 +169,12 @@ type HookConfigSettings struct {
 	// EnableSchedulesOnStartup
 	// set to true, if you need to run 'Schedule' hooks without waiting addon-operator readiness
 	EnableSchedulesOnStartup bool
+	// Timeout is a maximum duration of the hook run. HookInput.Context is cancelled
+	// after timeout and the run is failed. Zero means no timeout.
+	Timeout time.Duration
+	// RetryPolicy defines delays between retries of the failed hook and an action after
+	// the last attempt. Nil means infinite retries with the default delay.
+	RetryPolicy *utils.RetryPolicy
 }
 
 type ScheduleConfig struct {
@@ -348,6 +348,11 @@ func (mm *moduleManager) RegisterGlobalHooks() error {
 	}
 
 	// Load validation schemas
+	return mm.loadGlobalValuesSchemas()
+}
+
+// loadGlobalValuesSchemas loads OpenAPI schemas for global values from the 'openapi' directory in global hooks dir.
+func (mm *moduleManager) loadGlobalValuesSchemas() error {
 	openApiDir := filepath.Join(mm.GlobalHooksDir, "openapi")
 	configBytes, valuesBytes, err := ReadOpenAPIFiles(openApiDir)
 	if err != nil {
@@ -1,10 +1,17 @@
 package module_manager
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/flant/shell-operator/pkg/kube/object_patch"
 	log "github.com/sirupsen/logrus"
@@ -33,6 +40,7 @@ type HookExecutor struct {
 	ObjectPatcher         *object_patch.ObjectPatcher
 	KubernetesPatchPath   string
 	LogLabels             map[string]string
+	Timeout               time.Duration
 }
 
 func NewHookExecutor(h Hook, context []BindingContext, configVersion string, objectPatcher *object_patch.ObjectPatcher) *HookExecutor {
@@ -49,12 +57,56 @@ func (e *HookExecutor) WithLogLabels(logLabels map[string]string) {
 	e.LogLabels = logLabels
 }
 
+// WithTimeout sets a maximum duration of the hook run. Zero means no timeout.
+func (e *HookExecutor) WithTimeout(timeout time.Duration) {
+	e.Timeout = timeout
+}
+
+// goHookStopGracePeriod is a time for a Go hook to return after its context is cancelled.
+var goHookStopGracePeriod = 5 * time.Second
+
+// HookTimeoutError is returned when the hook run exceeds the timeout from the hook config.
+type HookTimeoutError struct {
+	Timeout time.Duration
+	// Abandoned is true if a Go hook ignores HookInput.Context and is still running.
+	Abandoned bool
+}
+
+func (e *HookTimeoutError) Error() string {
+	if e.Abandoned {
+		return fmt.Sprintf("hook run exceeded timeout %s, hook ignores context and is still running", e.Timeout)
+	}
+	return fmt.Sprintf("hook run exceeded timeout %s", e.Timeout)
+}
+
+// IsHookTimeout returns true if the error or one of wrapped errors is a HookTimeoutError.
+func IsHookTimeout(err error) bool {
+	var timeoutErr *HookTimeoutError
+	return errors.As(err, &timeoutErr)
+}
+
+// IsHookAbandoned returns true if the error is a timeout of a Go hook that is still running.
+func IsHookAbandoned(err error) bool {
+	var timeoutErr *HookTimeoutError
+	return errors.As(err, &timeoutErr) && timeoutErr.Abandoned
+}
+
+// runContext returns a context that is cancelled after the hook timeout.
+func (e *HookExecutor) runContext() (context.Context, context.CancelFunc) {
+	if e.Timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), e.Timeout)
+}
+
 type HookResult struct {
 	Usage                   *executor.CmdUsage
 	Patches                 map[utils.ValuesPatchType]*utils.ValuesPatch
 	Metrics                 []metric_operation.MetricOperation
 	ObjectPatcherOperations []object_patch.Operation
 	BindingActions          []go_hook.BindingAction
+	// KubernetesPatchBytes is a content of KUBERNETES_PATCH_PATH file of a shell hook.
+	KubernetesPatchBytes []byte
 }
 
 func (e *HookExecutor) Run() (result *HookResult, err error) {
@@ -99,12 +151,19 @@ func (e *HookExecutor) Run() (result *HookResult, err error) {
 	for envName, filePath := range tmpFiles {
 		envs = append(envs, fmt.Sprintf("%s=%s", envName, filePath))
 	}
-	envs = append(envs, helm.NewClient().CommandEnv()...)
+	envs = append(envs, helmCommandEnv()...)
 
 	cmd := executor.MakeCommand("", e.Hook.GetPath(), []string{}, envs)
 
-	usage, err := executor.RunAndLogLines(cmd, e.LogLabels)
+	ctx, cancel := e.runContext()
+	defer cancel()
+
+	usage, err := e.runAndLogLines(cmd)
 	result.Usage = usage
+	// Hook that is finished successfully just before the deadline is not a timeout.
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return result, &HookTimeoutError{Timeout: e.Timeout}
+	}
 	if err != nil {
 		return result, err
 	}
@@ -129,6 +188,7 @@ func (e *HookExecutor) Run() (result *HookResult, err error) {
 		return result, fmt.Errorf("can't read kubernetes patch file: %s", err)
 	}
 
+	result.KubernetesPatchBytes = kubernetesPatchBytes
 	result.ObjectPatcherOperations, err = object_patch.ParseOperations(kubernetesPatchBytes)
 	if err != nil {
 		return nil, err
@@ -177,15 +237,40 @@ func (e *HookExecutor) RunGoHook() (result *HookResult, err error) {
 	metricsCollector := metrics.NewCollector(e.Hook.GetName())
 	patchCollector := object_patch.NewPatchCollector()
 
-	err = goHook.Run(&go_hook.HookInput{
-		Snapshots:        formattedSnapshots,
-		Values:           patchableValues,
-		ConfigValues:     patchableConfigValues,
-		PatchCollector:   patchCollector,
-		LogEntry:         logEntry,
-		MetricsCollector: metricsCollector,
-		BindingActions:   bindingActions,
-	})
+	ctx, cancel := e.runContext()
+	defer cancel()
+
+	// Go hook can't be killed. Hook should stop its work when the context is cancelled,
+	// otherwise the run is abandoned after the grace period.
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- goHook.Run(&go_hook.HookInput{
+			Snapshots:        formattedSnapshots,
+			Values:           patchableValues,
+			ConfigValues:     patchableConfigValues,
+			PatchCollector:   patchCollector,
+			LogEntry:         logEntry,
+			MetricsCollector: metricsCollector,
+			BindingActions:   bindingActions,
+			Context:          ctx,
+		})
+	}()
+
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		// Wait for the hook to return to not run it concurrently with the retry.
+		select {
+		case err = <-errCh:
+		case <-time.After(goHookStopGracePeriod):
+			logEntry.Errorf("Hook ignores HookInput.Context: still running %s after timeout %s, abandon the run", goHookStopGracePeriod, e.Timeout)
+			return nil, &HookTimeoutError{Timeout: e.Timeout, Abandoned: true}
+		}
+	}
+	// Hook that is finished successfully just before the deadline is not a timeout.
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return nil, &HookTimeoutError{Timeout: e.Timeout}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -211,7 +296,7 @@ func (e *HookExecutor) Config() (configOutput []byte, err error) {
 
 	envs := make([]string, 0)
 	envs = append(envs, os.Environ()...)
-	envs = append(envs, helm.NewClient().CommandEnv()...)
+	envs = append(envs, helmCommandEnv()...)
 
 	cmd := executor.MakeCommand("", e.Hook.GetPath(), []string{"--config"}, envs)
 
@@ -228,3 +313,56 @@ func (e *HookExecutor) Config() (configOutput []byte, err error) {
 
 	return output, nil
 }
+
+// helmCommandEnv returns environment variables for helm. Helm client is not
+// initialized when hooks are executed without a cluster, e.g. in lint mode.
+func helmCommandEnv() []string {
+	helmClient := helm.NewClient()
+	if helmClient == nil {
+		return nil
+	}
+	return helmClient.CommandEnv()
+}
+
+// runAndLogLines runs the command with executor.RunAndLogLines. With a timeout, the hook is
+// started in its own process group and the group is killed when the timeout is exceeded:
+// hook can start child processes that hold stdout and stderr, so killing only the hook
+// process is not enough to stop reading the output.
+func (e *HookExecutor) runAndLogLines(cmd *exec.Cmd) (*executor.CmdUsage, error) {
+	if e.Timeout <= 0 {
+		return executor.RunAndLogLines(cmd, e.LogLabels)
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	pidCh := make(chan int, 1)
+	cmd.Stdin = &startNotifier{cmd: cmd, pidCh: pidCh}
+	timer := time.AfterFunc(e.Timeout, func() {
+		select {
+		case pid := <-pidCh:
+			log.WithFields(utils.LabelsToLogFields(e.LogLabels)).
+				Warnf("Kill hook process group: hook run exceeded timeout %s", e.Timeout)
+			// Negative pid means the process group.
+			_ = syscall.Kill(-pid, syscall.SIGKILL)
+		default:
+		}
+	})
+	defer timer.Stop()
+
+	return executor.RunAndLogLines(cmd, e.LogLabels)
+}
+
+// startNotifier is an empty stdin of the hook that sends the pid of the started hook.
+// exec.Cmd reads stdin in a goroutine that is started after the process, so the pid
+// is passed to the timer without a data race.
+type startNotifier struct {
+	cmd   *exec.Cmd
+	pidCh chan int
+	once  sync.Once
+}
+
+func (n *startNotifier) Read(_ []byte) (int, error) {
+	n.once.Do(func() {
+		n.pidCh <- n.cmd.Process.Pid
+	})
+	return 0, io.EOF
+}
@@ -1,7 +1,11 @@
 package module_manager
 
 import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/flant/addon-operator/pkg/module_manager/go_hook"
 	"github.com/flant/addon-operator/sdk"
@@ -44,3 +48,133 @@ func Test_Config_GoHook(t *testing.T) {
 	g.Expect(res.Patches).ShouldNot(BeEmpty())
 	g.Expect(res.Metrics).ShouldNot(BeEmpty())
 }
+
+func Test_HookExecutor_Timeout_ShellHook(t *testing.T) {
+	g := NewWithT(t)
+
+	// Child process holds stdout and should be killed with the hook.
+	hookPath := filepath.Join(t.TempDir(), "hook.sh")
+	err := ioutil.WriteFile(hookPath, []byte("#!/bin/bash\nsleep 30 &\nsleep 30\n"), 0755)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	mm := NewMainModuleManager()
+	mm.WithDirectories("", "", t.TempDir())
+	gh := NewGlobalHook("hook.sh", hookPath)
+	gh.WithModuleManager(mm)
+	gh.WithTmpDir(mm.TempDir)
+
+	e := NewHookExecutor(gh, []BindingContext{}, "v1", nil)
+	e.WithTimeout(200 * time.Millisecond)
+
+	start := time.Now()
+	_, err = e.Run()
+	g.Expect(err).Should(HaveOccurred())
+	g.Expect(IsHookTimeout(err)).To(BeTrue())
+	g.Expect(IsHookTimeout(fmt.Errorf("wrapped: %w", err))).To(BeTrue())
+	g.Expect(time.Since(start)).To(BeNumerically("<", 10*time.Second))
+}
+
+func Test_HookExecutor_Timeout_ShellHookSucceeded(t *testing.T) {
+	g := NewWithT(t)
+
+	hookPath := filepath.Join(t.TempDir(), "hook.sh")
+	err := ioutil.WriteFile(hookPath, []byte("#!/bin/bash\necho done\n"), 0755)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	mm := NewMainModuleManager()
+	mm.WithDirectories("", "", t.TempDir())
+	gh := NewGlobalHook("hook.sh", hookPath)
+	gh.WithModuleManager(mm)
+	gh.WithTmpDir(mm.TempDir)
+
+	e := NewHookExecutor(gh, []BindingContext{}, "v1", nil)
+	e.WithTimeout(10 * time.Second)
+
+	res, err := e.Run()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(res.Usage).ToNot(BeNil())
+}
+
+type blockingGoHook struct{}
+
+func (h *blockingGoHook) Config() *go_hook.HookConfig {
+	return &go_hook.HookConfig{Settings: &go_hook.HookConfigSettings{Timeout: 100 * time.Millisecond}}
+}
+
+func (h *blockingGoHook) Run(input *go_hook.HookInput) error {
+	<-input.Context.Done()
+	return input.Context.Err()
+}
+
+func Test_HookExecutor_Timeout_GoHook(t *testing.T) {
+	g := NewWithT(t)
+
+	goHook := &blockingGoHook{}
+	gh := NewGlobalHook("blocking.go", "/global-hooks/blocking.go")
+	gh.WithGoHook(goHook)
+	g.Expect(gh.WithGoConfig(goHook.Config())).Should(Succeed())
+	gh.WithModuleManager(NewMainModuleManager())
+	g.Expect(gh.Config.Timeout).To(Equal(100 * time.Millisecond))
+
+	e := NewHookExecutor(gh, []BindingContext{}, "v1", nil)
+	e.WithTimeout(gh.Config.Timeout)
+	_, err := e.Run()
+	g.Expect(IsHookTimeout(err)).To(BeTrue())
+	g.Expect(IsHookAbandoned(err)).To(BeFalse())
+}
+
+// ignoringGoHook does not watch HookInput.Context and returns when released.
+type ignoringGoHook struct {
+	release chan struct{}
+}
+
+func (h *ignoringGoHook) Config() *go_hook.HookConfig {
+	return &go_hook.HookConfig{Settings: &go_hook.HookConfigSettings{Timeout: 100 * time.Millisecond}}
+}
+
+func (h *ignoringGoHook) Run(_ *go_hook.HookInput) error {
+	<-h.release
+	return nil
+}
+
+func Test_HookExecutor_Timeout_GoHookIgnoresContext(t *testing.T) {
+	g := NewWithT(t)
+
+	defer func(period time.Duration) { goHookStopGracePeriod = period }(goHookStopGracePeriod)
+	goHookStopGracePeriod = 200 * time.Millisecond
+
+	goHook := &ignoringGoHook{release: make(chan struct{})}
+	defer close(goHook.release)
+	gh := NewGlobalHook("ignoring.go", "/global-hooks/ignoring.go")
+	gh.WithGoHook(goHook)
+	g.Expect(gh.WithGoConfig(goHook.Config())).Should(Succeed())
+	gh.WithModuleManager(NewMainModuleManager())
+
+	e := NewHookExecutor(gh, []BindingContext{}, "v1", nil)
+	e.WithTimeout(gh.Config.Timeout)
+
+	start := time.Now()
+	_, err := e.Run()
+	g.Expect(IsHookTimeout(err)).To(BeTrue())
+	g.Expect(IsHookAbandoned(err)).To(BeTrue())
+	g.Expect(time.Since(start)).To(BeNumerically(">=", gh.Config.Timeout+goHookStopGracePeriod))
+}
+
+// Hook that returns after the deadline with a result is not a timeout.
+func Test_HookExecutor_Timeout_GoHookReturnsInGracePeriod(t *testing.T) {
+	g := NewWithT(t)
+
+	goHook := &ignoringGoHook{release: make(chan struct{})}
+	time.AfterFunc(200*time.Millisecond, func() { close(goHook.release) })
+	gh := NewGlobalHook("ignoring.go", "/global-hooks/ignoring.go")
+	gh.WithGoHook(goHook)
+	g.Expect(gh.WithGoConfig(goHook.Config())).Should(Succeed())
+	gh.WithModuleManager(NewMainModuleManager())
+
+	e := NewHookExecutor(gh, []BindingContext{}, "v1", nil)
+	e.WithTimeout(gh.Config.Timeout)
+
+	res, err := e.Run()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(res).ToNot(BeNil())
+}
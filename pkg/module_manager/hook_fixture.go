@@ -0,0 +1,129 @@
+package module_manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	uuid "gopkg.in/satori/go.uuid.v1"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// HookFixture is an input for a shell hook: a binding context as it is written
+// into BINDING_CONTEXT_PATH, values and config values.
+type HookFixture struct {
+	BindingContext []byte
+	Values         utils.Values
+	ConfigValues   utils.Values
+}
+
+// fixtureHook is a shell hook that gets values, config values and binding context from a fixture.
+// Other files and environment variables are prepared the same way as for the hook run by addon-operator.
+type fixtureHook struct {
+	Hook
+	fixture HookFixture
+	tmpDir  string
+}
+
+var _ Hook = &fixtureHook{}
+
+func (h *fixtureHook) GetValues() (utils.Values, error) {
+	return h.fixture.Values, nil
+}
+
+func (h *fixtureHook) GetConfigValues() utils.Values {
+	return h.fixture.ConfigValues
+}
+
+// PrepareTmpFilesForHookRun ignores the binding context from HookExecutor and writes the fixture instead.
+func (h *fixtureHook) PrepareTmpFilesForHookRun(_ []byte) (tmpFiles map[string]string, err error) {
+	tmpFiles = make(map[string]string)
+
+	configValuesBytes, err := h.fixture.ConfigValues.JsonBytes()
+	if err != nil {
+		return nil, err
+	}
+	valuesBytes, err := h.fixture.Values.JsonBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{
+		"CONFIG_VALUES_PATH":            configValuesBytes,
+		"VALUES_PATH":                   valuesBytes,
+		"BINDING_CONTEXT_PATH":          h.fixture.BindingContext,
+		"CONFIG_VALUES_JSON_PATCH_PATH": nil,
+		"VALUES_JSON_PATCH_PATH":        nil,
+		"METRICS_PATH":                  nil,
+		"KUBERNETES_PATCH_PATH":         nil,
+	}
+	for envName, data := range files {
+		path := filepath.Join(h.tmpDir, fmt.Sprintf("hook-test-%s-%s", strings.ToLower(envName), uuid.NewV4().String()))
+		if err := ioutil.WriteFile(path, data, 0666); err != nil {
+			return tmpFiles, err
+		}
+		tmpFiles[envName] = path
+	}
+	return tmpFiles, nil
+}
+
+// RunHookWithFixture finds a shell hook by name and runs it with inputs from the fixture.
+// Hook name is a path relative to the global hooks directory for global hooks
+// or a path relative to the modules directory for module hooks, e.g. '001-module/hooks/hook.sh'.
+func (mm *moduleManager) RunHookWithFixture(hookName string, fixture HookFixture) (*HookResult, error) {
+	h, err := mm.findShellHook(hookName)
+	if err != nil {
+		return nil, err
+	}
+
+	if fixture.Values == nil {
+		fixture.Values = utils.Values{}
+	}
+	if fixture.ConfigValues == nil {
+		fixture.ConfigValues = utils.Values{}
+	}
+	if len(fixture.BindingContext) == 0 {
+		fixture.BindingContext = []byte("[]")
+	}
+
+	executor := NewHookExecutor(&fixtureHook{Hook: h, fixture: fixture, tmpDir: mm.TempDir}, nil, "", nil)
+	executor.WithLogLabels(map[string]string{"hook": hookName})
+	return executor.Run()
+}
+
+// findShellHook searches a global hook and then a module hook with the name. Go hooks are not
+// searched: they can be tested with the sdk/testing package.
+func (mm *moduleManager) findShellHook(hookName string) (Hook, error) {
+	globalHooks, err := SearchGlobalShellHooks(mm.GlobalHooksDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, globalHook := range globalHooks {
+		if globalHook.Name == hookName {
+			return globalHook, nil
+		}
+	}
+
+	modules, _, err := searchModules(mm.ModulesDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, module := range modules {
+		if !strings.HasPrefix(hookName, filepath.Base(module.Path)+"/") {
+			continue
+		}
+		moduleHooks, err := SearchModuleShellHooks(module)
+		if err != nil {
+			return nil, err
+		}
+		for _, moduleHook := range moduleHooks {
+			if moduleHook.Name == hookName {
+				return moduleHook, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("shell hook '%s' is not found", hookName)
+}
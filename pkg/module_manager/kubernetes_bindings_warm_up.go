@@ -0,0 +1,134 @@
+package module_manager
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/flant/shell-operator/pkg/hook/controller"
+
+	"github.com/flant/addon-operator/pkg/utils"
+
+	. "github.com/flant/shell-operator/pkg/hook/types"
+	. "github.com/flant/shell-operator/pkg/kube_events_manager/types"
+)
+
+// WarmUpKubernetesBindings starts monitors for kubernetes bindings of global hooks and
+// of modules enabled by config and enabled scripts. It is used by standby replicas to fill
+// informer caches before the Lease is acquired. Hooks are not run and tasks are not created:
+// events are locked until the leader runs Synchronization for warm monitors.
+//
+// Enabled scripts are run with config values only, so the leader can discover another
+// set of modules. Warm monitors of modules disabled by the leader are stopped in DiscoverModulesState.
+func (mm *moduleManager) WarmUpKubernetesBindings(logLabels map[string]string) error {
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
+
+	for _, hookName := range mm.GetGlobalHooksInOrder(OnKubernetesEvent) {
+		gh := mm.GetGlobalHook(hookName)
+		if err := gh.HookController.HandleEnableKubernetesBindings(nil); err != nil {
+			return fmt.Errorf("start monitors for global hook '%s': %v", hookName, err)
+		}
+		mm.setWarm(&mm.warmGlobalHooks, hookName, gh.HookController)
+	}
+
+	enabledModules, err := mm.RunModulesEnabledScript(mm.enabledModulesByConfig, logLabels)
+	if err != nil {
+		return fmt.Errorf("discover modules: %v", err)
+	}
+	for _, moduleName := range enabledModules {
+		if err := mm.RegisterModuleHooks(mm.allModulesByName[moduleName], logLabels); err != nil {
+			return err
+		}
+		hookControllers := make([]controller.HookController, 0)
+		for _, hookName := range mm.GetModuleHooksInOrder(moduleName, OnKubernetesEvent) {
+			mh := mm.GetModuleHook(hookName)
+			if err := mh.HookController.HandleEnableKubernetesBindings(nil); err != nil {
+				return fmt.Errorf("start monitors for module hook '%s': %v", hookName, err)
+			}
+			hookControllers = append(hookControllers, mh.HookController)
+		}
+		mm.setWarm(&mm.warmModules, moduleName, hookControllers...)
+	}
+
+	logEntry.Infof("Kubernetes bindings are warmed up for global hooks and modules %v", enabledModules)
+	return nil
+}
+
+// DropWarmKubernetesEvents drops events saved by locked monitors of warm bindings.
+// The leader reads Synchronization objects from informer caches, so these events are
+// not needed and should not pile up while the replica is waiting for the Lease.
+func (mm *moduleManager) DropWarmKubernetesEvents() {
+	mm.warmLock.Lock()
+	defer mm.warmLock.Unlock()
+
+	for _, index := range []map[string][]controller.HookController{mm.warmGlobalHooks, mm.warmModules} {
+		for _, hookControllers := range index {
+			for _, hookController := range hookControllers {
+				// Snapshots reset the events buffer of locked monitors.
+				hookController.KubernetesSnapshots()
+			}
+		}
+	}
+}
+
+// setWarm saves hook controllers with started monitors. Controllers are saved instead of names:
+// DropWarmKubernetesEvents is called in background and should not read hooks indexes.
+func (mm *moduleManager) setWarm(index *map[string][]controller.HookController, name string, hookControllers ...controller.HookController) {
+	mm.warmLock.Lock()
+	defer mm.warmLock.Unlock()
+	if *index == nil {
+		*index = make(map[string][]controller.HookController)
+	}
+	(*index)[name] = hookControllers
+}
+
+// takeWarm returns true if monitors were started by WarmUpKubernetesBindings. Monitors are
+// handed over to the caller, DropWarmKubernetesEvents does not touch them anymore.
+func (mm *moduleManager) takeWarm(index map[string][]controller.HookController, name string) bool {
+	mm.warmLock.Lock()
+	defer mm.warmLock.Unlock()
+	if _, has := index[name]; !has {
+		return false
+	}
+	delete(index, name)
+	return true
+}
+
+// stopWarmModules stops monitors started for modules that are not enabled.
+func (mm *moduleManager) stopWarmModules(enabledModules []string) {
+	enabled := make(map[string]bool)
+	for _, moduleName := range enabledModules {
+		enabled[moduleName] = true
+	}
+
+	mm.warmLock.Lock()
+	defer mm.warmLock.Unlock()
+	for moduleName, hookControllers := range mm.warmModules {
+		if enabled[moduleName] {
+			continue
+		}
+		for _, hookController := range hookControllers {
+			hookController.StopMonitors()
+		}
+		delete(mm.warmModules, moduleName)
+	}
+}
+
+// handleWarmKubernetesBindings returns Synchronization infos for already started monitors.
+// It is the same as HandleEnableKubernetesBindings without restarting the informers.
+func handleWarmKubernetesBindings(hookController controller.HookController, monitorIDs []string, createTaskFn func(controller.BindingExecutionInfo)) {
+	for _, monitorID := range monitorIDs {
+		hookController.HandleKubeEvent(KubeEvent{
+			MonitorId: monitorID,
+			Type:      TypeSynchronization,
+		}, createTaskFn)
+	}
+}
+
+func kubernetesMonitorIDs(configs []OnKubernetesEventConfig) []string {
+	res := make([]string, 0, len(configs))
+	for _, cfg := range configs {
+		res = append(res, cfg.Monitor.Metadata.MonitorId)
+	}
+	return res
+}
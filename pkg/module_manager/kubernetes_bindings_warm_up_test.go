@@ -0,0 +1,106 @@
+package module_manager
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/flant/shell-operator/pkg/hook/controller"
+	"github.com/flant/shell-operator/pkg/kube_events_manager"
+
+	. "github.com/flant/shell-operator/pkg/hook/types"
+	. "github.com/flant/shell-operator/pkg/kube_events_manager/types"
+)
+
+type warmUpHookController struct {
+	controller.HookController
+
+	enabled   int
+	snapshots int
+	stopped   int
+	events    []KubeEvent
+}
+
+func (c *warmUpHookController) HandleEnableKubernetesBindings(createTasksFn func(controller.BindingExecutionInfo)) error {
+	c.enabled++
+	if createTasksFn != nil {
+		createTasksFn(controller.BindingExecutionInfo{Binding: "enable"})
+	}
+	return nil
+}
+
+func (c *warmUpHookController) HandleKubeEvent(event KubeEvent, createTasksFn func(controller.BindingExecutionInfo)) {
+	c.events = append(c.events, event)
+	if createTasksFn != nil {
+		createTasksFn(controller.BindingExecutionInfo{Binding: "warm"})
+	}
+}
+
+func (c *warmUpHookController) KubernetesSnapshots() map[string][]ObjectAndFilterResult {
+	c.snapshots++
+	return nil
+}
+
+func (c *warmUpHookController) StopMonitors() {
+	c.stopped++
+}
+
+// The leader reuses monitors started on a standby replica and does not list objects again.
+func Test_ModuleManager_WarmUpKubernetesBindings(t *testing.T) {
+	g := NewWithT(t)
+
+	monitor := &kube_events_manager.MonitorConfig{}
+	monitor.Metadata.MonitorId = "monitor-1"
+
+	hookController := &warmUpHookController{}
+	gh := NewGlobalHook("global-hook", "/global-hooks/global-hook")
+	gh.Config.OnKubernetesEvents = []OnKubernetesEventConfig{{Monitor: monitor}}
+	gh.WithHookController(hookController)
+
+	mm := NewMainModuleManager()
+	mm.globalHooksByName[gh.Name] = gh
+	mm.globalHooksOrder[OnKubernetesEvent] = []*GlobalHook{gh}
+
+	g.Expect(mm.WarmUpKubernetesBindings(map[string]string{})).To(Succeed())
+	g.Expect(hookController.enabled).To(Equal(1))
+
+	mm.DropWarmKubernetesEvents()
+	g.Expect(hookController.snapshots).To(Equal(1))
+
+	bindings := make([]string, 0)
+	createTaskFn := func(_ *GlobalHook, info controller.BindingExecutionInfo) {
+		bindings = append(bindings, info.Binding)
+	}
+
+	// Synchronization for warm monitors.
+	g.Expect(mm.HandleGlobalEnableKubernetesBindings(gh.Name, createTaskFn)).To(Succeed())
+	g.Expect(hookController.enabled).To(Equal(1))
+	g.Expect(hookController.events).To(Equal([]KubeEvent{{MonitorId: "monitor-1", Type: TypeSynchronization}}))
+	g.Expect(bindings).To(Equal([]string{"warm"}))
+
+	// Monitors are handed over to the leader.
+	mm.DropWarmKubernetesEvents()
+	g.Expect(hookController.snapshots).To(Equal(1))
+
+	g.Expect(mm.HandleGlobalEnableKubernetesBindings(gh.Name, createTaskFn)).To(Succeed())
+	g.Expect(hookController.enabled).To(Equal(2))
+	g.Expect(bindings).To(Equal([]string{"warm", "enable"}))
+}
+
+// Warm monitors of modules disabled by the leader are stopped.
+func Test_ModuleManager_StopWarmModules(t *testing.T) {
+	g := NewWithT(t)
+
+	enabled := &warmUpHookController{}
+	disabled := &warmUpHookController{}
+
+	mm := NewMainModuleManager()
+	mm.setWarm(&mm.warmModules, "enabled-module", enabled)
+	mm.setWarm(&mm.warmModules, "disabled-module", disabled)
+
+	mm.stopWarmModules([]string{"enabled-module"})
+	g.Expect(enabled.stopped).To(Equal(0))
+	g.Expect(disabled.stopped).To(Equal(1))
+	g.Expect(mm.warmModules).To(HaveLen(1))
+	g.Expect(mm.warmModules).To(HaveKey("enabled-module"))
+}
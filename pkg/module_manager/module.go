@@ -14,7 +14,9 @@ import (
 	"github.com/flant/kube-client/manifest"
 	"github.com/kennygrant/sanitize"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 	uuid "gopkg.in/satori/go.uuid.v1"
+	v1 "k8s.io/api/core/v1"
 
 	. "github.com/flant/addon-operator/pkg/hook/types"
 	. "github.com/flant/shell-operator/pkg/hook/binding_context"
@@ -29,6 +31,8 @@ import (
 	"github.com/flant/addon-operator/pkg/app"
 	"github.com/flant/addon-operator/pkg/helm"
 	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/module_events"
+	"github.com/flant/addon-operator/pkg/tracing"
 	"github.com/flant/addon-operator/pkg/utils"
 	"github.com/flant/addon-operator/pkg/values/validation"
 )
@@ -40,6 +44,8 @@ type Module struct {
 	CommonStaticConfig *utils.ModuleConfig
 	// module values from modules/<module name>/values.yaml
 	StaticConfig *utils.ModuleConfig
+	// module dependencies from modules/<module name>/module.yaml
+	Definition ModuleDefinition
 
 	State *ModuleState
 
@@ -61,6 +67,19 @@ type ModuleState struct {
 
 	// flag to prevent excess monitor starts
 	MonitorsStarted bool
+
+	// The last automatic rollback of the helm release. It is reset after a successful upgrade.
+	HelmRollback *HelmRollbackState
+
+	// Checksum of module files and values of the last successful helm phase and time of the last
+	// successful ModuleRun. It is read by the state checkpoint saver, so access is guarded.
+	Checkpoint ModuleCheckpointState
+
+	// Phase and result of the last ModuleRun for the status endpoint.
+	RunStatus ModuleRunStatus
+
+	// The last known revision of the helm release for the module status.
+	HelmRevision ModuleHelmRevision
 }
 
 func NewModule(name, path string) *Module {
@@ -128,6 +147,7 @@ func (m *Module) RunOnStartup(logLabels map[string]string) error {
 	})
 
 	m.State.Enabled = true
+	m.State.RunStatus.Start(ModuleRunHooks)
 
 	if err := m.cleanup(); err != nil {
 		return err
@@ -163,6 +183,7 @@ func (m *Module) Run(logLabels map[string]string) (bool, error) {
 
 	var err error
 
+	m.State.RunStatus.Start(ModuleRunHooks)
 	treg := trace.StartRegion(context.Background(), "ModuleRun-HelmPhase-beforeHelm")
 	err = m.runHooksByBinding(BeforeHelm, logLabels)
 	treg.End()
@@ -170,6 +191,7 @@ func (m *Module) Run(logLabels map[string]string) (bool, error) {
 		return false, err
 	}
 
+	m.State.RunStatus.Start(ModuleRunHelm)
 	treg = trace.StartRegion(context.Background(), "ModuleRun-HelmPhase-helm")
 	err = m.runHelmInstall(logLabels)
 	treg.End()
@@ -177,12 +199,14 @@ func (m *Module) Run(logLabels map[string]string) (bool, error) {
 		return false, err
 	}
 
+	m.State.RunStatus.Start(ModuleRunHooks)
 	treg = trace.StartRegion(context.Background(), "ModuleRun-HelmPhase-afterHelm")
 	valuesChanged, err := m.runHooksByBindingAndCheckValues(AfterHelm, logLabels)
 	treg.End()
 	if err != nil {
 		return false, err
 	}
+	m.State.Checkpoint.SetLastRunTime(time.Now())
 	// Do not send to mm.moduleValuesChanged, changed values are handled by TaskHandler.
 	return valuesChanged, nil
 }
@@ -202,6 +226,13 @@ func (m *Module) Delete(logLabels map[string]string) error {
 	// Stop resources monitor before deleting release
 	m.moduleManager.HelmResourcesManager.StopMonitor(m.Name)
 
+	// Orphaned release is left as is, afterDeleteHelm hooks are not executed as they may clean up release resources.
+	if m.Definition.ModuleDeletionProtection() == DeletionProtectionOrphan {
+		logEntry.Warnf("Module '%s' has deletionProtection '%s', helm release '%s' is orphaned", m.Name, DeletionProtectionOrphan, m.generateHelmReleaseName())
+		m.State = &ModuleState{}
+		return nil
+	}
+
 	// Module has chart, but there is no release -> log a warning.
 	// Module has chart and release -> execute helm delete.
 	chartExists, _ := m.checkHelmChart()
@@ -213,6 +244,8 @@ func (m *Module) Delete(logLabels map[string]string) error {
 			} else {
 				logEntry.Warnf("Cannot find helm release '%s' for module '%s'.", m.generateHelmReleaseName(), m.Name)
 			}
+		} else if app.HelmDryRun {
+			logEntry.Infof("helm release '%s': dry-run mode, skip helm delete", m.generateHelmReleaseName())
 		} else {
 			// Chart and release are existed, so run helm delete command
 			err := helm.NewClient(deleteLogLabels).DeleteRelease(m.generateHelmReleaseName())
@@ -241,6 +274,11 @@ func (m *Module) cleanup() error {
 		}
 	}
 
+	// Failed revisions are not deleted in dry-run mode.
+	if app.HelmDryRun {
+		return nil
+	}
+
 	helmLogLabels := map[string]string{
 		"module": m.Name,
 	}
@@ -282,35 +320,46 @@ func (m *Module) runHelmInstall(logLabels map[string]string) error {
 
 	helmReleaseName := m.generateHelmReleaseName()
 
+	helmClient := helm.NewClient(logLabels)
+
+	// Skip render and upgrade on the first run after restart if module files and values are not changed.
+	var helmChecksum string
+	if m.moduleManager.checkpointsEnabled() && !app.HelmDryRun {
+		m.State.Checkpoint.SetHelmChecksum("")
+		helmChecksum, err = m.helmChecksum()
+		if err != nil {
+			logEntry.Warnf("cannot calculate checksum of module files and values: %v", err)
+		}
+		deployedManifests, err := m.deployedManifests(helmClient, helmReleaseName, helmChecksum)
+		if err != nil {
+			logEntry.Warnf("cannot get deployed manifests, run helm phase: %v", err)
+		}
+		if deployedManifests != nil {
+			// Release resources may be deleted or changed while addon-operator was not running.
+			shouldRepair, err := m.shouldRepairRelease(helmReleaseName, deployedManifests, logEntry)
+			if err != nil {
+				logEntry.Warnf("cannot check resources of helm release '%s', run helm phase: %v", helmReleaseName, err)
+			}
+			if err != nil || shouldRepair {
+				deployedManifests = nil
+			}
+		}
+		if deployedManifests != nil {
+			logEntry.Infof("helm release '%s': module is not changed since the last run before restart, skip helm upgrade", helmReleaseName)
+			m.moduleManager.HelmResourcesManager.StartMonitor(m.Name, deployedManifests, app.Namespace)
+			m.State.Checkpoint.SetHelmChecksum(helmChecksum)
+			return nil
+		}
+	}
+
 	valuesPath, err := m.PrepareValuesYamlFile()
 	if err != nil {
 		return err
 	}
 	defer os.Remove(valuesPath)
 
-	helmClient := helm.NewClient(logLabels)
-
 	// Render templates to prevent excess helm runs.
-	var renderedManifests string
-	func() {
-		defer trace.StartRegion(context.Background(), "ModuleRun-HelmPhase-helm-render").End()
-
-		metricLabels := map[string]string{
-			"module":     m.Name,
-			"activation": logLabels["event.type"],
-			"operation":  "template",
-		}
-		defer measure.Duration(func(d time.Duration) {
-			m.metricStorage.HistogramObserve("{PREFIX}helm_operation_seconds", d.Seconds(), metricLabels, nil)
-		})()
-
-		renderedManifests, err = helmClient.Render(
-			helmReleaseName,
-			m.Path,
-			[]string{valuesPath},
-			[]string{},
-			app.Namespace)
-	}()
+	renderedManifests, err := m.renderHelmChart(helmClient, helmReleaseName, valuesPath, logLabels)
 	if err != nil {
 		return err
 	}
@@ -322,6 +371,12 @@ func (m *Module) runHelmInstall(logLabels map[string]string) error {
 	}
 	logEntry.Debugf("chart has %d resources", len(manifests))
 
+	// Do not repeat the failed upgrade and the rollback until values or chart change.
+	if m.State.HelmRollback.Skips(checksum) {
+		logEntry.Warnf("helm release '%s': manifests are not changed since the failed upgrade, skip helm upgrade: %s", helmReleaseName, m.State.HelmRollback)
+		return nil
+	}
+
 	// Skip upgrades if nothing is changes
 	var runUpgradeRelease bool
 	func() {
@@ -336,7 +391,10 @@ func (m *Module) runHelmInstall(logLabels map[string]string) error {
 			m.metricStorage.HistogramObserve("{PREFIX}helm_operation_seconds", d.Seconds(), metricLabels, nil)
 		})()
 
+		span := tracing.StartSpan(logLabels, "helm-check-upgrade", attribute.String("helm.release", helmReleaseName))
 		runUpgradeRelease, err = m.ShouldRunHelmUpgrade(helmClient, helmReleaseName, checksum, manifests, logLabels)
+		span.SetAttributes(attribute.Bool("helm.upgrade", runUpgradeRelease))
+		tracing.EndSpan(span, err)
 	}()
 	if err != nil {
 		return err
@@ -347,6 +405,21 @@ func (m *Module) runHelmInstall(logLabels map[string]string) error {
 		if !m.moduleManager.HelmResourcesManager.HasMonitor(m.Name) {
 			m.moduleManager.HelmResourcesManager.StartMonitor(m.Name, manifests, app.Namespace)
 		}
+		m.State.Checkpoint.SetHelmChecksum(helmChecksum)
+		return nil
+	}
+
+	// Log changes before upgrade. Diff is informational, so errors are not fatal.
+	diff, err := m.releaseDiff(helmClient, helmReleaseName, renderedManifests)
+	if err != nil {
+		logEntry.Warnf("cannot get diff for helm release '%s': %v", helmReleaseName, err)
+	} else {
+		logEntry.Infof("%s", diff.ChangesString())
+		logEntry.Debugf("%s", diff.String())
+	}
+
+	if app.HelmDryRun {
+		logEntry.Infof("helm release '%s': dry-run mode, skip helm upgrade", helmReleaseName)
 		return nil
 	}
 
@@ -363,6 +436,7 @@ func (m *Module) runHelmInstall(logLabels map[string]string) error {
 			m.metricStorage.HistogramObserve("{PREFIX}helm_operation_seconds", d.Seconds(), metricLabels, nil)
 		})()
 
+		span := tracing.StartSpan(logLabels, "helm-upgrade", attribute.String("helm.release", helmReleaseName))
 		err = helmClient.UpgradeRelease(
 			helmReleaseName,
 			m.Path,
@@ -370,28 +444,107 @@ func (m *Module) runHelmInstall(logLabels map[string]string) error {
 			[]string{fmt.Sprintf("_addonOperatorModuleChecksum=%s", checksum)},
 			app.Namespace,
 		)
+		tracing.EndSpan(span, err)
 	}()
 
 	if err != nil {
-		return err
+		m.moduleManager.eventRecorder.ModuleEvent(m.Name, v1.EventTypeWarning, module_events.HelmUpgradeFailed,
+			"Helm upgrade of release '%s' failed: %v", helmReleaseName, err)
+		return m.rollbackFailedRelease(helmClient, helmReleaseName, checksum, err, logLabels)
 	}
+	m.State.HelmRollback = nil
+	m.State.HelmRevision.Upgraded()
+	m.moduleManager.eventRecorder.ModuleEvent(m.Name, v1.EventTypeNormal, module_events.HelmUpgraded,
+		"Helm release '%s' is upgraded", helmReleaseName)
 
 	// Start monitor resources if release was successful
 	m.moduleManager.HelmResourcesManager.StartMonitor(m.Name, manifests, app.Namespace)
+	m.State.Checkpoint.SetHelmChecksum(helmChecksum)
 
 	return nil
 }
 
+// renderHelmChart runs helm template for the module chart. Trace and measure its time.
+func (m *Module) renderHelmChart(helmClient client.HelmClient, releaseName string, valuesPath string, logLabels map[string]string) (string, error) {
+	defer trace.StartRegion(context.Background(), "ModuleRun-HelmPhase-helm-render").End()
+
+	metricLabels := map[string]string{
+		"module":     m.Name,
+		"activation": logLabels["event.type"],
+		"operation":  "template",
+	}
+	defer measure.Duration(func(d time.Duration) {
+		m.metricStorage.HistogramObserve("{PREFIX}helm_operation_seconds", d.Seconds(), metricLabels, nil)
+	})()
+
+	span := tracing.StartSpan(logLabels, "helm-template", attribute.String("helm.release", releaseName))
+	manifests, err := helmClient.Render(
+		releaseName,
+		m.Path,
+		[]string{valuesPath},
+		[]string{},
+		app.Namespace)
+	tracing.EndSpan(span, err)
+	return manifests, err
+}
+
+// releaseDiff compares the deployed release manifest with rendered manifests.
+// All resources are added if there is no release yet.
+func (m *Module) releaseDiff(helmClient client.HelmClient, releaseName string, renderedManifests string) (helm.ReleaseDiff, error) {
+	deployedManifests := ""
+	releaseExists, err := helmClient.IsReleaseExists(releaseName)
+	if err != nil {
+		return helm.ReleaseDiff{}, err
+	}
+	if releaseExists {
+		deployedManifests, err = helmClient.GetReleaseManifest(releaseName)
+		if err != nil {
+			return helm.ReleaseDiff{}, err
+		}
+	}
+	return helm.DiffManifests(releaseName, deployedManifests, renderedManifests, app.Namespace)
+}
+
+// HelmDiff renders the module chart with current values and returns changes
+// against the deployed release. Diff is empty if module has no chart.
+func (m *Module) HelmDiff(logLabels map[string]string) (helm.ReleaseDiff, error) {
+	helmReleaseName := m.generateHelmReleaseName()
+
+	chartExists, _ := m.checkHelmChart()
+	if !chartExists {
+		return helm.ReleaseDiff{Release: helmReleaseName, Changes: []helm.ResourceChange{}}, nil
+	}
+
+	valuesPath, err := m.PrepareValuesYamlFile()
+	if err != nil {
+		return helm.ReleaseDiff{}, err
+	}
+	defer os.Remove(valuesPath)
+
+	helmClient := helm.NewClient(logLabels)
+
+	renderedManifests, err := m.renderHelmChart(helmClient, helmReleaseName, valuesPath, logLabels)
+	if err != nil {
+		return helm.ReleaseDiff{}, err
+	}
+
+	return m.releaseDiff(helmClient, helmReleaseName, renderedManifests)
+}
+
 // ShouldRunHelmUpgrade tells if there is a case to run `helm upgrade`:
 //  - Helm chart in not installed yet.
 //  - Last release has FAILED status.
 //  - Checksum in release values not equals to checksum argument.
 //  - Some resources installed previously are missing.
+//  - Some resources are changed in cluster and the module has the "repair" drift policy.
 // If all these conditions aren't met, helm upgrade can be skipped.
 func (m *Module) ShouldRunHelmUpgrade(helmClient client.HelmClient, releaseName string, checksum string, manifests []manifest.Manifest, logLabels map[string]string) (bool, error) {
 	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
 
 	revision, status, err := helmClient.LastReleaseStatus(releaseName)
+	if err == nil || revision == "0" {
+		m.State.HelmRevision.Set(revision)
+	}
 
 	if revision == "0" {
 		logEntry.Debugf("helm release '%s' not exists: should run upgrade", releaseName)
@@ -431,6 +584,18 @@ func (m *Module) ShouldRunHelmUpgrade(helmClient client.HelmClient, releaseName
 		}
 	}
 
+	shouldRepair, err := m.shouldRepairRelease(releaseName, manifests, logEntry)
+	if err != nil || shouldRepair {
+		return shouldRepair, err
+	}
+
+	logEntry.Debugf("helm release '%s' is unchanged: skip release upgrade", releaseName)
+	return false, nil
+}
+
+// shouldRepairRelease returns true if resources of the release are deleted or changed in cluster
+// and the module has the "repair" drift policy.
+func (m *Module) shouldRepairRelease(releaseName string, manifests []manifest.Manifest, logEntry *log.Entry) (bool, error) {
 	// Check if there are absent resources
 	absent, err := m.moduleManager.HelmResourcesManager.GetAbsentResources(manifests, app.Namespace)
 	if err != nil {
@@ -443,7 +608,15 @@ func (m *Module) ShouldRunHelmUpgrade(helmClient client.HelmClient, releaseName
 		return true, nil
 	}
 
-	logEntry.Debugf("helm release '%s' is unchanged: skip release upgrade", releaseName)
+	// Run helm upgrade to repair resources changed in cluster.
+	if m.Definition.HelmDriftPolicy() == HelmDriftRepair {
+		drifted := m.moduleManager.HelmResourcesManager.DriftedResources(m.Name)
+		if len(drifted) > 0 {
+			logEntry.Debugf("helm release '%s' has %d drifted resources: should run upgrade", releaseName, len(drifted))
+			return true, nil
+		}
+	}
+
 	return false, nil
 }
 
@@ -669,6 +842,11 @@ func (m *Module) generateHelmReleaseName() string {
 	return m.Name
 }
 
+// HelmReleaseName returns a name of the helm release for the module.
+func (m *Module) HelmReleaseName() string {
+	return m.generateHelmReleaseName()
+}
+
 // ConfigValues returns raw values from ConfigMap:
 // - global section
 // - module section
@@ -679,7 +857,7 @@ func (m *Module) ConfigValues() utils.Values {
 		// Init module section.
 		utils.Values{m.ValuesKey(): map[string]interface{}{}},
 		// Merge overrides from ConfigMap.
-		m.moduleManager.kubeModulesConfigValues[m.Name],
+		m.moduleManager.moduleConfigValues(m.Name),
 	)
 }
 
@@ -702,7 +880,7 @@ func (m *Module) StaticAndConfigValues() utils.Values {
 			m.moduleManager.ValuesValidator,
 		},
 		// Merge overrides from ConfigMap.
-		m.moduleManager.kubeModulesConfigValues[m.Name],
+		m.moduleManager.moduleConfigValues(m.Name),
 	)
 }
 
@@ -729,6 +907,31 @@ func (m *Module) StaticAndNewValues(newValues utils.Values) utils.Values {
 	)
 }
 
+// valuesLayers returns layers of module values merged over global values before patches.
+func (m *Module) valuesLayers() []valuesLayer {
+	return []valuesLayer{
+		// Init module section.
+		{ValuesSourceInit, utils.Values{m.ValuesKey(): map[string]interface{}{}}},
+		// Merge static values from various values.yaml files.
+		{ValuesSourceCommonStatic, m.CommonStaticConfig.Values},
+		{ValuesSourceStatic, m.StaticConfig.Values},
+		// Apply config values defaults before ConfigMap overrides.
+		{ValuesSourceConfigDefaults, &ApplyDefaultsForModule{
+			m.ValuesKey(),
+			validation.ConfigValuesSchema,
+			m.moduleManager.ValuesValidator,
+		}},
+		// Merge overrides from ConfigMap.
+		{ValuesSourceConfig, m.moduleManager.moduleConfigValues(m.Name)},
+		// Apply dynamic values defaults before patches.
+		{ValuesSourceValuesDefaults, &ApplyDefaultsForModule{
+			m.ValuesKey(),
+			validation.ValuesSchema,
+			m.moduleManager.ValuesValidator,
+		}},
+	}
+}
+
 // Values returns effective values for module hook or helm chart:
 //
 // global section: static + config + defaults + patches from hooks
@@ -743,31 +946,10 @@ func (m *Module) Values() (utils.Values, error) {
 	}
 
 	// Apply global and module values defaults before applying patches.
-	res := MergeLayers(
-		// Global values with patches and defaults.
-		globalValues,
-		// Init module section.
-		utils.Values{m.ValuesKey(): map[string]interface{}{}},
-		// Merge static values from various values.yaml files.
-		m.CommonStaticConfig.Values,
-		m.StaticConfig.Values,
-		// Apply config values defaults before ConfigMap overrides.
-		&ApplyDefaultsForModule{
-			m.ValuesKey(),
-			validation.ConfigValuesSchema,
-			m.moduleManager.ValuesValidator,
-		},
-		// Merge overrides from ConfigMap.
-		m.moduleManager.kubeModulesConfigValues[m.Name],
-		// Apply dynamic values defaults before patches.
-		&ApplyDefaultsForModule{
-			m.ValuesKey(),
-			validation.ValuesSchema,
-			m.moduleManager.ValuesValidator,
-		},
-	)
+	res := mergeValuesLayers(globalValues, m.valuesLayers())
 
-	for _, patch := range m.moduleManager.modulesDynamicValuesPatches[m.Name] {
+	patches, _ := m.moduleManager.moduleValuesPatchesSnapshot(m.Name)
+	for _, patch := range patches {
 		// Invariant: do not store patches that does not apply
 		// Give user error for patches early, after patch receive
 		res, _, err = utils.ApplyValuesPatch(res, patch, utils.IgnoreNonExistentPaths)
@@ -810,7 +992,7 @@ func (m *Module) ValuesKey() string {
 }
 
 func (m *Module) ValuesPatches() []utils.ValuesPatch {
-	return m.moduleManager.modulesDynamicValuesPatches[m.Name]
+	return m.moduleManager.moduleDynamicValuesPatches(m.Name)
 }
 
 func (m *Module) prepareModuleEnabledResultFile() (string, error) {
@@ -914,7 +1096,9 @@ func (m *Module) checkIsEnabledByScript(precedingEnabledModules []string, logLab
 
 	cmd := executor.MakeCommand("", enabledScriptPath, []string{}, envs)
 
+	span := tracing.StartSpan(logLabels, "EnabledScript", attribute.String("module", m.Name))
 	usage, err := executor.RunAndLogLines(cmd, logLabels)
+	tracing.EndSpan(span, err)
 	if usage != nil {
 		// usage metrics
 		metricLabels := map[string]string{
@@ -950,12 +1134,26 @@ func (m *Module) checkIsEnabledByScript(precedingEnabledModules []string, logLab
 var ValidModuleNameRe = regexp.MustCompile(`^[0-9][0-9][0-9]-(.*)$`)
 
 func SearchModules(modulesDir string) (modules []*Module, err error) {
+	modules, badModulesDirs, err := searchModules(modulesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(badModulesDirs) > 0 {
+		return nil, fmt.Errorf("modules directory contains directories not matched ValidModuleRegex '%s': %s", ValidModuleNameRe, strings.Join(badModulesDirs, ", "))
+	}
+
+	return
+}
+
+// searchModules returns modules and paths of directories with names not matched ValidModuleNameRe.
+func searchModules(modulesDir string) (modules []*Module, badModulesDirs []string, err error) {
 	files, err := ioutil.ReadDir(modulesDir) // returns a list of modules sorted by filename
 	if err != nil {
-		return nil, fmt.Errorf("list modules directory '%s': %s", modulesDir, err)
+		return nil, nil, fmt.Errorf("list modules directory '%s': %s", modulesDir, err)
 	}
 
-	badModulesDirs := make([]string, 0)
+	badModulesDirs = make([]string, 0)
 	modules = make([]*Module, 0)
 
 	for _, file := range files {
@@ -973,10 +1171,6 @@ func SearchModules(modulesDir string) (modules []*Module, err error) {
 		}
 	}
 
-	if len(badModulesDirs) > 0 {
-		return nil, fmt.Errorf("modules directory contains directories not matched ValidModuleRegex '%s': %s", ValidModuleNameRe, strings.Join(badModulesDirs, ", "))
-	}
-
 	return
 }
 
@@ -1009,6 +1203,12 @@ func (mm *moduleManager) RegisterModules() error {
 			return fmt.Errorf("bad module values")
 		}
 
+		// load dependencies from module.yaml
+		err = module.loadDefinition()
+		if err != nil {
+			return fmt.Errorf("module '%s': %v", module.Name, err)
+		}
+
 		mm.allModulesByName[module.Name] = module
 		mm.allModulesNamesInOrder = append(mm.allModulesNamesInOrder, module.Name)
 
@@ -1031,6 +1231,15 @@ func (mm *moduleManager) RegisterModules() error {
 		logEntry.Infof("Module '%s' is registered", module.Name)
 	}
 
+	// Required modules should run before modules that require them.
+	if err := mm.validateModuleDependencies(); err != nil {
+		return err
+	}
+	mm.allModulesNamesInOrder, err = SortModulesByDependencies(mm.allModulesNamesInOrder, mm.allModulesByName)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
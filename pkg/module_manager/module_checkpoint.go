@@ -0,0 +1,144 @@
+package module_manager
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flant/kube-client/manifest"
+
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// ModuleCheckpoint is a module state that is saved to skip the helm phase
+// for the unchanged module after restart.
+type ModuleCheckpoint struct {
+	// HelmChecksum is a checksum of module files and values of the last successful helm phase.
+	HelmChecksum string `json:"helmChecksum"`
+	// LastRunTime is a time of the last successful ModuleRun.
+	LastRunTime time.Time `json:"lastRunTime"`
+}
+
+// ModuleCheckpointState is a checkpoint of the module changed by ModuleRun.
+type ModuleCheckpointState struct {
+	m          sync.Mutex
+	checkpoint ModuleCheckpoint
+}
+
+// SetHelmChecksum saves a checksum of the successful helm phase. It is set only if checkpoints are enabled.
+func (s *ModuleCheckpointState) SetHelmChecksum(checksum string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.checkpoint.HelmChecksum = checksum
+}
+
+// SetLastRunTime saves a time of the successful run of beforeHelm hooks, helm and afterHelm hooks.
+func (s *ModuleCheckpointState) SetLastRunTime(t time.Time) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.checkpoint.LastRunTime = t
+}
+
+func (s *ModuleCheckpointState) Get() ModuleCheckpoint {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.checkpoint
+}
+
+// ModuleCheckpoints returns states of modules with successful helm phase. Restored checkpoints
+// of modules that are not run yet are returned as is.
+func (mm *moduleManager) ModuleCheckpoints() map[string]ModuleCheckpoint {
+	checkpoints := make(map[string]ModuleCheckpoint)
+
+	mm.checkpointsLock.Lock()
+	for moduleName, checkpoint := range mm.restoredCheckpoints {
+		checkpoints[moduleName] = checkpoint
+	}
+	mm.checkpointsLock.Unlock()
+
+	for _, moduleName := range mm.allModulesNamesInOrder {
+		module := mm.GetModule(moduleName)
+		if module == nil {
+			continue
+		}
+		if checkpoint := module.State.Checkpoint.Get(); checkpoint.HelmChecksum != "" {
+			checkpoints[moduleName] = checkpoint
+		}
+	}
+	return checkpoints
+}
+
+// RestoreModuleCheckpoints enables checksums for the helm phase and saves checkpoints
+// for the first run of each module.
+func (mm *moduleManager) RestoreModuleCheckpoints(checkpoints map[string]ModuleCheckpoint) {
+	mm.checkpointsLock.Lock()
+	defer mm.checkpointsLock.Unlock()
+	mm.restoredCheckpoints = make(map[string]ModuleCheckpoint)
+	for moduleName, checkpoint := range checkpoints {
+		mm.restoredCheckpoints[moduleName] = checkpoint
+	}
+}
+
+func (mm *moduleManager) checkpointsEnabled() bool {
+	mm.checkpointsLock.Lock()
+	defer mm.checkpointsLock.Unlock()
+	return mm.restoredCheckpoints != nil
+}
+
+// popRestoredChecksum returns the restored checksum of the module only once, so only
+// the first run after restart can skip the helm phase.
+func (mm *moduleManager) popRestoredChecksum(moduleName string) string {
+	mm.checkpointsLock.Lock()
+	defer mm.checkpointsLock.Unlock()
+	checkpoint, has := mm.restoredCheckpoints[moduleName]
+	if !has {
+		return ""
+	}
+	delete(mm.restoredCheckpoints, moduleName)
+	return checkpoint.HelmChecksum
+}
+
+// helmChecksum returns a checksum of module files and values passed to helm.
+func (m *Module) helmChecksum() (string, error) {
+	filesChecksum, err := utils.CalculateChecksumOfDirectory(m.Path)
+	if err != nil {
+		return "", err
+	}
+	values, err := m.Values()
+	if err != nil {
+		return "", err
+	}
+	valuesChecksum, err := values.Checksum()
+	if err != nil {
+		return "", err
+	}
+	return utils.CalculateStringsChecksum(filesChecksum, valuesChecksum), nil
+}
+
+// deployedManifests returns manifests of the deployed release if the restored checksum equals
+// the current checksum and the last release is not failed. Nil means that the helm phase
+// should run as usual.
+func (m *Module) deployedManifests(helmClient client.HelmClient, releaseName string, helmChecksum string) ([]manifest.Manifest, error) {
+	if helmChecksum == "" || m.moduleManager.popRestoredChecksum(m.Name) != helmChecksum {
+		return nil, nil
+	}
+
+	revision, status, err := helmClient.LastReleaseStatus(releaseName)
+	if revision == "0" {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.State.HelmRevision.Set(revision)
+	if strings.ToLower(status) == "failed" {
+		return nil, nil
+	}
+	deployedManifests, err := helmClient.GetReleaseManifest(releaseName)
+	if err != nil {
+		return nil, fmt.Errorf("get manifest of release '%s': %v", releaseName, err)
+	}
+	return manifest.ListFromYamlDocs(deployedManifests)
+}
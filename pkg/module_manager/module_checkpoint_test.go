@@ -0,0 +1,111 @@
+package module_manager
+
+import (
+	"testing"
+
+	"github.com/flant/kube-client/fake"
+	"github.com/flant/kube-client/manifest"
+	. "github.com/onsi/gomega"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/flant/addon-operator/pkg/helm"
+	"github.com/flant/addon-operator/pkg/helm_resources_manager"
+)
+
+func Test_Module_DeployedManifests_RestoredChecksum(t *testing.T) {
+	g := NewWithT(t)
+
+	mm := &moduleManager{
+		allModulesByName:       make(map[string]*Module),
+		allModulesNamesInOrder: []string{"test-module", "other-module"},
+	}
+	g.Expect(mm.checkpointsEnabled()).To(BeFalse())
+
+	m := NewModule("test-module", "/modules/test-module")
+	m.WithModuleManager(mm)
+	mm.allModulesByName[m.Name] = m
+
+	mm.RestoreModuleCheckpoints(map[string]ModuleCheckpoint{
+		"test-module":  {HelmChecksum: "abc"},
+		"other-module": {HelmChecksum: "def"},
+	})
+	g.Expect(mm.checkpointsEnabled()).To(BeTrue())
+
+	hc := &helm.MockHelmClient{ReleaseManifest: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+`}
+
+	// Checksum is changed: helm phase should run.
+	manifests, err := m.deployedManifests(hc, "test-module", "changed")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(manifests).To(BeNil())
+
+	// Restored checksum is used only by the first run.
+	manifests, err = m.deployedManifests(hc, "test-module", "abc")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(manifests).To(BeNil())
+
+	mm.RestoreModuleCheckpoints(map[string]ModuleCheckpoint{
+		"test-module":  {HelmChecksum: "abc"},
+		"other-module": {HelmChecksum: "def"},
+	})
+	manifests, err = m.deployedManifests(hc, "test-module", "abc")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(manifests).To(HaveLen(1))
+	g.Expect(manifests[0].Kind()).To(Equal("ConfigMap"))
+
+	// Failed release should be upgraded.
+	mm.RestoreModuleCheckpoints(map[string]ModuleCheckpoint{
+		"test-module":  {HelmChecksum: "abc"},
+		"other-module": {HelmChecksum: "def"},
+	})
+	hc.ReleaseStatus = "FAILED"
+	manifests, err = m.deployedManifests(hc, "test-module", "abc")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(manifests).To(BeNil())
+
+	// Checkpoints contain the actual state of run modules and restored state of other modules.
+	m.State.Checkpoint.SetHelmChecksum("abc")
+	g.Expect(mm.ModuleCheckpoints()).To(Equal(map[string]ModuleCheckpoint{
+		"test-module":  {HelmChecksum: "abc"},
+		"other-module": {HelmChecksum: "def"},
+	}))
+}
+
+// Checkpoint shortcut is not taken if resources of the deployed release are deleted.
+func Test_Module_ShouldRepairRelease(t *testing.T) {
+	g := NewWithT(t)
+
+	fc := fake.NewFakeCluster("")
+	fc.CreateSimpleNamespaced("default", "ConfigMap", "test")
+
+	hrm := helm_resources_manager.NewHelmResourcesManager()
+	hrm.WithKubeClient(fc.Client)
+	mm := NewMainModuleManager()
+	mm.WithHelmResourcesManager(hrm)
+
+	m := NewModule("test-module", "/modules/test-module")
+	m.WithModuleManager(mm)
+
+	manifests, err := manifest.ListFromYamlDocs(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+  namespace: default
+`)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	logEntry := log.WithField("test", t.Name())
+
+	shouldRepair, err := m.shouldRepairRelease("test-module", manifests, logEntry)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(shouldRepair).To(BeFalse())
+
+	fc.DeleteSimpleNamespaced("default", "ConfigMap", "test")
+	shouldRepair, err = m.shouldRepairRelease("test-module", manifests, logEntry)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(shouldRepair).To(BeTrue())
+}
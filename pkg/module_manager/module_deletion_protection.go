@@ -0,0 +1,21 @@
+package module_manager
+
+// Protection policies for the release of the disabled module. Policy is set by the deletionProtection field in module.yaml.
+const (
+	// DeletionProtectionNone deletes the release when the module is disabled.
+	DeletionProtectionNone = "none"
+	// DeletionProtectionConfirm deletes the release only after the explicit confirmation.
+	DeletionProtectionConfirm = "confirm"
+	// DeletionProtectionOrphan keeps the release when the module is disabled.
+	DeletionProtectionOrphan = "orphan"
+)
+
+var DeletionProtectionPolicies = []string{DeletionProtectionNone, DeletionProtectionConfirm, DeletionProtectionOrphan}
+
+// ModuleDeletionProtection returns a deletion protection policy for the module. Default is DeletionProtectionNone.
+func (d ModuleDefinition) ModuleDeletionProtection() string {
+	if d.DeletionProtection == "" {
+		return DeletionProtectionNone
+	}
+	return d.DeletionProtection
+}
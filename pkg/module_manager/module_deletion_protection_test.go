@@ -0,0 +1,38 @@
+package module_manager
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/flant/addon-operator/pkg/helm"
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/helm_resources_manager"
+)
+
+func Test_Module_Delete_OrphanRelease(t *testing.T) {
+	g := NewWithT(t)
+
+	hc := &helm.MockHelmClient{}
+	defer func(newClient func(logLabels ...map[string]string) client.HelmClient) {
+		helm.NewClient = newClient
+	}(helm.NewClient)
+	helm.NewClient = func(_ ...map[string]string) client.HelmClient {
+		return hc
+	}
+
+	mm := NewMainModuleManager()
+	mm.WithHelmResourcesManager(helm_resources_manager.NewHelmResourcesManager())
+
+	m := NewModule("test-module", "/modules/test-module")
+	m.WithModuleManager(mm)
+	m.Definition.DeletionProtection = DeletionProtectionOrphan
+	m.State.Enabled = true
+
+	g.Expect(m.Definition.ModuleDeletionProtection()).To(Equal(DeletionProtectionOrphan))
+	g.Expect(m.Delete(map[string]string{})).Should(Succeed())
+	g.Expect(hc.DeleteReleaseExecuted).To(BeFalse())
+	g.Expect(m.State.Enabled).To(BeFalse())
+
+	g.Expect(ModuleDefinition{}.ModuleDeletionProtection()).To(Equal(DeletionProtectionNone))
+}
@@ -0,0 +1,201 @@
+package module_manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// ModuleDefinition is a content of the module.yaml file in the module directory.
+//
+// Example:
+//
+// requires:
+// - cert-manager
+// conflicts:
+// - legacy-ingress
+// rollbackPolicy: rollback-to-last-deployed
+// driftPolicy: repair
+// retryPolicy: {maxAttempts: 5, onExhausted: DisableModule}
+// deletionProtection: confirm
+type ModuleDefinition struct {
+	// Requires is a list of modules that should be enabled for this module.
+	// Module is disabled if one of the required modules is disabled.
+	Requires []string `json:"requires,omitempty"`
+	// Conflicts is a list of modules that cannot be enabled together with this module.
+	Conflicts []string `json:"conflicts,omitempty"`
+	// RollbackPolicy is an action for a failed helm upgrade, see HelmRollbackPolicies.
+	RollbackPolicy string `json:"rollbackPolicy,omitempty"`
+	// DriftPolicy is an action for resources changed in cluster, see HelmDriftPolicies.
+	DriftPolicy string `json:"driftPolicy,omitempty"`
+	// RetryPolicy is a retry policy for failed ModuleRun tasks and for module hooks without own policy.
+	RetryPolicy *utils.RetryPolicyConfig `json:"retryPolicy,omitempty"`
+	// DeletionProtection is an action for the release of the disabled module, see DeletionProtectionPolicies.
+	DeletionProtection string `json:"deletionProtection,omitempty"`
+}
+
+// TaskRetryPolicy returns a retry policy of the module or nil if the policy is not set.
+// Policy is validated when module.yaml is loaded.
+func (d ModuleDefinition) TaskRetryPolicy() *utils.RetryPolicy {
+	policy, _ := d.RetryPolicy.Convert()
+	return policy
+}
+
+// loadDefinition loads module.yaml file. The file is optional.
+func (m *Module) loadDefinition() error {
+	definitionPath := filepath.Join(m.Path, "module.yaml")
+	if _, err := os.Stat(definitionPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(definitionPath)
+	if err != nil {
+		return fmt.Errorf("cannot read '%s': %s", definitionPath, err)
+	}
+
+	err = yaml.UnmarshalStrict(data, &m.Definition)
+	if err != nil {
+		return fmt.Errorf("bad module.yaml: %s", err)
+	}
+	if m.Definition.RollbackPolicy != "" && !containsString(HelmRollbackPolicies, m.Definition.RollbackPolicy) {
+		return fmt.Errorf("bad module.yaml: unknown rollbackPolicy '%s', expect one of: %s", m.Definition.RollbackPolicy, strings.Join(HelmRollbackPolicies, ", "))
+	}
+	if m.Definition.DriftPolicy != "" && !containsString(HelmDriftPolicies, m.Definition.DriftPolicy) {
+		return fmt.Errorf("bad module.yaml: unknown driftPolicy '%s', expect one of: %s", m.Definition.DriftPolicy, strings.Join(HelmDriftPolicies, ", "))
+	}
+	if m.Definition.DeletionProtection != "" && !containsString(DeletionProtectionPolicies, m.Definition.DeletionProtection) {
+		return fmt.Errorf("bad module.yaml: unknown deletionProtection '%s', expect one of: %s", m.Definition.DeletionProtection, strings.Join(DeletionProtectionPolicies, ", "))
+	}
+	if _, err := m.Definition.RetryPolicy.Convert(); err != nil {
+		return fmt.Errorf("bad module.yaml: %v", err)
+	}
+	return nil
+}
+
+// DisabledRequirements returns required modules that are not in the enabledModules list.
+func (m *Module) DisabledRequirements(enabledModules []string) []string {
+	return utils.ListSubtract(m.Definition.Requires, enabledModules)
+}
+
+// conflictingModules returns modules from the enabledModules list that conflict with the module.
+// Conflicts are symmetric: it is enough to declare a conflict in one of the modules.
+func (mm *moduleManager) conflictingModules(moduleName string, enabledModules []string) []string {
+	module := mm.allModulesByName[moduleName]
+
+	res := make([]string, 0)
+	for _, enabledName := range enabledModules {
+		enabledModule := mm.allModulesByName[enabledName]
+		if containsString(module.Definition.Conflicts, enabledName) ||
+			(enabledModule != nil && containsString(enabledModule.Definition.Conflicts, moduleName)) {
+			res = append(res, enabledName)
+		}
+	}
+	return res
+}
+
+// validateModuleDependencies checks that all required and conflicting modules exist.
+func (mm *moduleManager) validateModuleDependencies() error {
+	for _, moduleName := range mm.allModulesNamesInOrder {
+		module := mm.allModulesByName[moduleName]
+		for _, required := range module.Definition.Requires {
+			if _, has := mm.allModulesByName[required]; !has {
+				return fmt.Errorf("module '%s' requires unknown module '%s'", moduleName, required)
+			}
+			if required == moduleName {
+				return fmt.Errorf("module '%s' requires itself", moduleName)
+			}
+		}
+		for _, conflicting := range module.Definition.Conflicts {
+			if _, has := mm.allModulesByName[conflicting]; !has {
+				return fmt.Errorf("module '%s' conflicts with unknown module '%s'", moduleName, conflicting)
+			}
+			if conflicting == moduleName {
+				return fmt.Errorf("module '%s' conflicts with itself", moduleName)
+			}
+		}
+	}
+	return nil
+}
+
+// SortModulesByDependencies returns module names sorted topologically: required
+// modules are placed before modules that require them. Independent modules
+// keep the order from the input list, i.e. the order of NNN- prefixes.
+//
+// An error is returned if there is a dependency cycle.
+func SortModulesByDependencies(names []string, modules map[string]*Module) ([]string, error) {
+	sorted := make([]string, 0, len(names))
+	placed := make(map[string]bool, len(names))
+
+	for len(sorted) < len(names) {
+		found := false
+		for _, name := range names {
+			if placed[name] {
+				continue
+			}
+			ready := true
+			for _, required := range modules[name].Definition.Requires {
+				if _, known := modules[required]; known && !placed[required] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				sorted = append(sorted, name)
+				placed[name] = true
+				found = true
+				// Start from the beginning to preserve the input order.
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("modules dependency cycle: %s", findDependencyCycle(names, modules, placed))
+		}
+	}
+
+	return sorted, nil
+}
+
+// findDependencyCycle returns a description of a cycle among not placed modules.
+func findDependencyCycle(names []string, modules map[string]*Module, placed map[string]bool) string {
+	// Each not placed module has at least one not placed requirement, so
+	// walking by requirements always returns to an already visited module.
+	var start string
+	for _, name := range names {
+		if !placed[name] {
+			start = name
+			break
+		}
+	}
+
+	path := make([]string, 0)
+	visited := make(map[string]int)
+	current := start
+	for {
+		if idx, has := visited[current]; has {
+			return strings.Join(append(path[idx:], current), " -> ")
+		}
+		visited[current] = len(path)
+		path = append(path, current)
+		for _, required := range modules[current].Definition.Requires {
+			if _, known := modules[required]; known && !placed[required] {
+				current = required
+				break
+			}
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
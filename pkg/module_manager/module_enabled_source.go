@@ -0,0 +1,71 @@
+package module_manager
+
+import (
+	"github.com/flant/addon-operator/pkg/kube_config_manager"
+)
+
+// Sources of the module enabled state.
+const (
+	// EnabledByDefault — no layer has an enabled flag, module is disabled.
+	EnabledByDefault = "default"
+	// EnabledByStatic — enabled flag is from modules/values.yaml or from module's values.yaml.
+	EnabledByStatic = "static"
+	// EnabledByConfig — enabled flag is from the ConfigMap.
+	EnabledByConfig = "config"
+	// EnabledByDynamic — enabled flag is set by a global hook.
+	EnabledByDynamic = "dynamic"
+	// EnabledByScript — module is enabled by flags, but disabled by the enabled script.
+	EnabledByScript = "enabled-script"
+	// EnabledByRequirements — module is enabled by flags, but its required modules are disabled.
+	EnabledByRequirements = "requirements"
+)
+
+// calculateEnabledSources returns a layer that determines the enabled state of each module.
+// Layers are merged in the same order as in calculateEnabledModulesByConfig: the last
+// defined flag wins.
+func (mm *moduleManager) calculateEnabledSources(moduleConfigs kube_config_manager.ModuleConfigs, enabledByConfig []string, enabledModules []string) map[string]string {
+	sources := make(map[string]string)
+	enabledByConfigIndex := make(map[string]bool)
+	for _, name := range enabledByConfig {
+		enabledByConfigIndex[name] = true
+	}
+	enabledIndex := make(map[string]bool)
+	for _, name := range enabledModules {
+		enabledIndex[name] = true
+	}
+
+	for moduleName, module := range mm.allModulesByName {
+		source := EnabledByDefault
+		if module.CommonStaticConfig.IsEnabled != nil || module.StaticConfig.IsEnabled != nil {
+			source = EnabledByStatic
+		}
+		if kubeConfig, has := moduleConfigs[moduleName]; has && kubeConfig.IsEnabled != nil {
+			source = EnabledByConfig
+		}
+		if mm.dynamicEnabled[moduleName] != nil {
+			source = EnabledByDynamic
+		}
+
+		if enabledByConfigIndex[moduleName] && !enabledIndex[moduleName] {
+			source = EnabledByScript
+			if len(module.DisabledRequirements(enabledModules)) > 0 {
+				source = EnabledByRequirements
+			}
+		}
+		sources[moduleName] = source
+	}
+
+	return sources
+}
+
+// ModuleEnabledSources returns sources of the enabled state of all known modules
+// calculated by the last discovery. It is empty if modules were not discovered yet.
+func (mm *moduleManager) ModuleEnabledSources() map[string]string {
+	mm.enabledSourcesLock.RLock()
+	defer mm.enabledSourcesLock.RUnlock()
+	sources := make(map[string]string, len(mm.enabledSources))
+	for name, source := range mm.enabledSources {
+		sources[name] = source
+	}
+	return sources
+}
@@ -0,0 +1,80 @@
+package module_manager
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/flant/addon-operator/pkg/kube_config_manager"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+func Test_CalculateEnabledSources(t *testing.T) {
+	g := NewWithT(t)
+
+	newModule := func(name string, staticEnabled *bool, requires ...string) *Module {
+		m := NewModule(name, "")
+		m.CommonStaticConfig = utils.NewModuleConfig(name)
+		m.StaticConfig = utils.NewModuleConfig(name)
+		m.StaticConfig.IsEnabled = staticEnabled
+		m.Definition.Requires = requires
+		return m
+	}
+
+	mm := NewMainModuleManager()
+	for _, m := range []*Module{
+		newModule("by-default", nil),
+		newModule("by-static", &utils.ModuleEnabled),
+		newModule("by-config", &utils.ModuleEnabled),
+		newModule("by-dynamic", &utils.ModuleDisabled),
+		newModule("by-script", &utils.ModuleEnabled),
+		newModule("by-requirements", &utils.ModuleEnabled, "by-default"),
+	} {
+		mm.allModulesByName[m.Name] = m
+	}
+	mm.dynamicEnabled["by-dynamic"] = &utils.ModuleEnabled
+
+	moduleConfigs := kube_config_manager.ModuleConfigs{
+		"by-config": *utils.NewModuleConfig("by-config").WithEnabled(false),
+	}
+	enabledByConfig := []string{"by-static", "by-dynamic", "by-script", "by-requirements"}
+	enabledModules := []string{"by-static", "by-dynamic"}
+
+	sources := mm.calculateEnabledSources(moduleConfigs, enabledByConfig, enabledModules)
+	g.Expect(sources).To(Equal(map[string]string{
+		"by-default":      EnabledByDefault,
+		"by-static":       EnabledByStatic,
+		"by-config":       EnabledByConfig,
+		"by-dynamic":      EnabledByDynamic,
+		"by-script":       EnabledByScript,
+		"by-requirements": EnabledByRequirements,
+	}))
+}
+
+func Test_ModuleRunStatus(t *testing.T) {
+	g := NewWithT(t)
+
+	s := &ModuleRunStatus{}
+	g.Expect(s.Get().Phase).To(BeEmpty())
+
+	s.Start(ModuleRunHooks)
+	started := s.Get().Started
+	g.Expect(started.IsZero()).To(BeFalse())
+	// Start time is kept when the phase changes during the run.
+	s.Start(ModuleRunHelm)
+	g.Expect(s.Get().Phase).To(Equal(ModuleRunHelm))
+	g.Expect(s.Get().Started).To(Equal(started))
+
+	s.Finish(fmt.Errorf("helm upgrade failed"))
+	info := s.Get()
+	g.Expect(info.Phase).To(Equal(ModuleRunFailed))
+	g.Expect(info.LastError).To(Equal("helm upgrade failed"))
+	g.Expect(info.Started.IsZero()).To(BeTrue())
+	g.Expect(info.LastRunTime.IsZero()).To(BeFalse())
+
+	s.Start(ModuleRunHooks)
+	s.Finish(nil)
+	g.Expect(s.Get().Phase).To(Equal(ModuleRunDone))
+	g.Expect(s.Get().LastError).To(BeEmpty())
+}
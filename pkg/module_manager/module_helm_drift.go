@@ -0,0 +1,21 @@
+package module_manager
+
+// Policies for resources of the module release changed in cluster. Policy is set by the driftPolicy field in module.yaml.
+const (
+	// HelmDriftIgnore ignores changes, e.g. for resources that are changed by controllers.
+	HelmDriftIgnore = "ignore"
+	// HelmDriftAlert reports drifted resources in log and metrics.
+	HelmDriftAlert = "alert"
+	// HelmDriftRepair is like HelmDriftAlert, but also runs the module to upgrade the release.
+	HelmDriftRepair = "repair"
+)
+
+var HelmDriftPolicies = []string{HelmDriftIgnore, HelmDriftAlert, HelmDriftRepair}
+
+// HelmDriftPolicy returns a drift policy for the module. Default is HelmDriftAlert.
+func (d ModuleDefinition) HelmDriftPolicy() string {
+	if d.DriftPolicy == "" {
+		return HelmDriftAlert
+	}
+	return d.DriftPolicy
+}
@@ -0,0 +1,39 @@
+package module_manager
+
+import (
+	"strconv"
+	"sync"
+)
+
+// ModuleHelmRevision is the last known revision of the module helm release. It is saved
+// when the release status is checked in the helm phase, so the status of the module can be
+// reported without an additional helm call. It is read after parallel ModuleRuns, so access is guarded.
+type ModuleHelmRevision struct {
+	m        sync.Mutex
+	revision string
+}
+
+// Set saves the revision returned by LastReleaseStatus. Revision "0" means that release is not exists.
+func (s *ModuleHelmRevision) Set(revision string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if revision == "0" {
+		revision = ""
+	}
+	s.revision = revision
+}
+
+// Upgraded increments the revision after a successful helm upgrade.
+func (s *ModuleHelmRevision) Upgraded() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	revision, _ := strconv.Atoi(s.revision)
+	s.revision = strconv.Itoa(revision + 1)
+}
+
+// Get returns the last known revision or an empty string if there is no release.
+func (s *ModuleHelmRevision) Get() string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.revision
+}
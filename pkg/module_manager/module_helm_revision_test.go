@@ -0,0 +1,29 @@
+package module_manager
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+// The revision is saved when the release status is checked and incremented after upgrade.
+func Test_Module_HelmRevision(t *testing.T) {
+	g := NewWithT(t)
+
+	m := NewModule("module-a", "")
+	g.Expect(m.State.HelmRevision.Get()).To(Equal(""))
+
+	shouldUpgrade, err := m.ShouldRunHelmUpgrade(&failedReleaseHelmClient{}, "module-a", "checksum", nil, map[string]string{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(shouldUpgrade).To(BeTrue())
+	g.Expect(m.State.HelmRevision.Get()).To(Equal("3"))
+
+	m.State.HelmRevision.Upgraded()
+	g.Expect(m.State.HelmRevision.Get()).To(Equal("4"))
+
+	// Release is not exists.
+	m.State.HelmRevision.Set("0")
+	g.Expect(m.State.HelmRevision.Get()).To(Equal(""))
+	m.State.HelmRevision.Upgraded()
+	g.Expect(m.State.HelmRevision.Get()).To(Equal("1"))
+}
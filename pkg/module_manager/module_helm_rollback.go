@@ -0,0 +1,119 @@
+package module_manager
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// Rollback policies for a failed helm upgrade. Policy is set by the rollbackPolicy field in module.yaml.
+const (
+	// HelmRollbackNone keeps a failed release as is, upgrade is retried.
+	HelmRollbackNone = "none"
+	// HelmRollbackToLastDeployed rolls a failed release back to the last deployed revision.
+	HelmRollbackToLastDeployed = "rollback-to-last-deployed"
+	// HelmRollbackAtomic is like HelmRollbackToLastDeployed, but also deletes a failed release
+	// if there is no deployed revision, e.g. if the first installation is failed.
+	HelmRollbackAtomic = "atomic"
+)
+
+var HelmRollbackPolicies = []string{HelmRollbackNone, HelmRollbackToLastDeployed, HelmRollbackAtomic}
+
+// HelmRollbackState describes the last automatic rollback of the module release.
+type HelmRollbackState struct {
+	Policy         string `json:"policy"`
+	FailedRevision string `json:"failedRevision"`
+	// RolledBackTo is a revision the release is rolled back to. It is empty if the release is deleted.
+	RolledBackTo string    `json:"rolledBackTo,omitempty"`
+	Deleted      bool      `json:"deleted,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	Time         time.Time `json:"time"`
+	// Checksum is a checksum of rendered manifests of the failed upgrade.
+	Checksum string `json:"checksum"`
+}
+
+// Skips returns true if the upgrade with rendered manifests should be skipped: the same manifests
+// are failed and the release is rolled back. The upgrade is retried when values or chart change.
+func (s *HelmRollbackState) Skips(checksum string) bool {
+	return s != nil && s.Error == "" && s.Checksum == checksum
+}
+
+// String returns a result of the rollback for the module status.
+func (s *HelmRollbackState) String() string {
+	if s.Deleted {
+		return fmt.Sprintf("helm upgrade failed, failed revision %s is deleted", s.FailedRevision)
+	}
+	return fmt.Sprintf("helm upgrade failed, release is rolled back from revision %s to revision %s", s.FailedRevision, s.RolledBackTo)
+}
+
+// HelmRollbackPolicy returns a rollback policy for the module. Default is HelmRollbackNone.
+func (d ModuleDefinition) HelmRollbackPolicy() string {
+	if d.RollbackPolicy == "" {
+		return HelmRollbackNone
+	}
+	return d.RollbackPolicy
+}
+
+// rollbackFailedRelease applies the module rollback policy after a failed upgrade.
+// upgradeErr is returned as is if there is nothing to roll back, otherwise
+// the error is extended with the result of the rollback. checksum is a checksum
+// of the failed manifests, upgrade with the same manifests is not retried after rollback.
+func (m *Module) rollbackFailedRelease(helmClient client.HelmClient, releaseName string, checksum string, upgradeErr error, logLabels map[string]string) error {
+	logEntry := log.WithFields(utils.LabelsToLogFields(logLabels))
+
+	policy := m.Definition.HelmRollbackPolicy()
+	if policy == HelmRollbackNone {
+		return upgradeErr
+	}
+
+	failedRevision, _, err := helmClient.LastReleaseStatus(releaseName)
+	if failedRevision == "0" {
+		// Release is not created, nothing to roll back.
+		return upgradeErr
+	}
+	if err != nil {
+		logEntry.Warnf("helm release '%s': cannot get failed revision: %v", releaseName, err)
+	}
+
+	state := &HelmRollbackState{
+		Policy:         policy,
+		FailedRevision: failedRevision,
+		Time:           time.Now(),
+		Checksum:       checksum,
+	}
+
+	lastDeployed, err := helmClient.LastDeployedRevision(releaseName)
+	switch {
+	case err != nil:
+	case lastDeployed != "":
+		logEntry.Infof("helm release '%s': roll back failed revision %s to revision %s", releaseName, failedRevision, lastDeployed)
+		state.RolledBackTo = lastDeployed
+		err = helmClient.RollbackRelease(releaseName, lastDeployed)
+	case policy == HelmRollbackAtomic:
+		logEntry.Infof("helm release '%s': no deployed revisions, delete failed revision %s", releaseName, failedRevision)
+		state.Deleted = true
+		err = helmClient.DeleteRelease(releaseName)
+	default:
+		logEntry.Warnf("helm release '%s': no deployed revisions to roll back to", releaseName)
+		return upgradeErr
+	}
+
+	m.metricStorage.CounterAdd("{PREFIX}module_helm_rollbacks_total", 1.0, map[string]string{"module": m.Name, "policy": policy})
+
+	if err != nil {
+		m.metricStorage.CounterAdd("{PREFIX}module_helm_rollback_errors_total", 1.0, map[string]string{"module": m.Name})
+		state.Error = err.Error()
+		m.State.HelmRollback = state
+		return fmt.Errorf("%v; rollback failed: %v", upgradeErr, err)
+	}
+
+	m.State.HelmRollback = state
+	if state.Deleted {
+		return fmt.Errorf("%v; failed release is deleted", upgradeErr)
+	}
+	return fmt.Errorf("%v; release is rolled back to revision %s", upgradeErr, state.RolledBackTo)
+}
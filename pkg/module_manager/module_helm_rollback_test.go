@@ -0,0 +1,170 @@
+package module_manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/flant/shell-operator/pkg/metric_storage"
+	. "github.com/onsi/gomega"
+
+	"github.com/flant/addon-operator/pkg/helm"
+	"github.com/flant/addon-operator/pkg/helm/client"
+	"github.com/flant/addon-operator/pkg/helm_resources_manager"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// failedReleaseHelmClient is a helm client with a failed last revision.
+type failedReleaseHelmClient struct {
+	helm.MockHelmClient
+}
+
+func (h *failedReleaseHelmClient) LastReleaseStatus(_ string) (string, string, error) {
+	return "3", "failed", nil
+}
+
+// failingUpgradeHelmClient is a helm client that fails to upgrade the release.
+type failingUpgradeHelmClient struct {
+	failedReleaseHelmClient
+	manifests string
+	upgrades  int
+	rollbacks int
+}
+
+func (h *failingUpgradeHelmClient) Render(_ string, _ string, _ []string, _ []string, _ string) (string, error) {
+	return h.manifests, nil
+}
+
+func (h *failingUpgradeHelmClient) UpgradeRelease(_, _ string, _ []string, _ []string, _ string) error {
+	h.upgrades++
+	return fmt.Errorf("helm upgrade failed")
+}
+
+func (h *failingUpgradeHelmClient) RollbackRelease(_ string, _ string) error {
+	h.rollbacks++
+	return nil
+}
+
+func Test_Module_RollbackFailedRelease(t *testing.T) {
+	upgradeErr := fmt.Errorf("helm upgrade failed")
+
+	tests := []struct {
+		name             string
+		policy           string
+		deployedRevision string
+
+		expectErr      string
+		expectRollback bool
+		expectDelete   bool
+		expectState    *HelmRollbackState
+	}{
+		{
+			name:             "no policy",
+			policy:           "",
+			deployedRevision: "2",
+			expectErr:        "helm upgrade failed",
+		},
+		{
+			name:             "rollback to last deployed",
+			policy:           HelmRollbackToLastDeployed,
+			deployedRevision: "2",
+			expectErr:        "helm upgrade failed; release is rolled back to revision 2",
+			expectRollback:   true,
+			expectState:      &HelmRollbackState{Policy: HelmRollbackToLastDeployed, FailedRevision: "3", RolledBackTo: "2"},
+		},
+		{
+			name:             "rollback without deployed revision",
+			policy:           HelmRollbackToLastDeployed,
+			deployedRevision: "",
+			expectErr:        "helm upgrade failed",
+		},
+		{
+			name:             "atomic without deployed revision",
+			policy:           HelmRollbackAtomic,
+			deployedRevision: "",
+			expectErr:        "helm upgrade failed; failed release is deleted",
+			expectDelete:     true,
+			expectState:      &HelmRollbackState{Policy: HelmRollbackAtomic, FailedRevision: "3", Deleted: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			hc := &failedReleaseHelmClient{}
+			hc.DeployedRevision = tt.deployedRevision
+
+			metricStorage := metric_storage.NewMetricStorage()
+			metricStorage.WithNewRegistry()
+
+			m := NewModule("test-module", "/modules/test-module")
+			m.WithMetricStorage(metricStorage)
+			m.Definition.RollbackPolicy = tt.policy
+
+			err := m.rollbackFailedRelease(hc, "test-module", "checksum", upgradeErr, map[string]string{})
+			g.Expect(err).To(MatchError(tt.expectErr))
+			g.Expect(hc.RollbackReleaseExecuted).To(Equal(tt.expectRollback))
+			g.Expect(hc.DeleteReleaseExecuted).To(Equal(tt.expectDelete))
+
+			if tt.expectState == nil {
+				g.Expect(m.State.HelmRollback).To(BeNil())
+				return
+			}
+			g.Expect(m.State.HelmRollback).ToNot(BeNil())
+			// Time is not checked.
+			m.State.HelmRollback.Time = tt.expectState.Time
+			tt.expectState.Checksum = "checksum"
+			g.Expect(m.State.HelmRollback).To(Equal(tt.expectState))
+		})
+	}
+}
+
+// Retry of ModuleRun does not upgrade and roll back the release again until manifests change.
+func Test_Module_Run_RollbackOnce(t *testing.T) {
+	g := NewWithT(t)
+
+	hc := &failingUpgradeHelmClient{manifests: "kind: ConfigMap\nmetadata:\n  name: cm\n"}
+	hc.DeployedRevision = "2"
+	defer func(newClient func(logLabels ...map[string]string) client.HelmClient) {
+		helm.NewClient = newClient
+	}(helm.NewClient)
+	helm.NewClient = func(_ ...map[string]string) client.HelmClient {
+		return hc
+	}
+
+	modulePath := t.TempDir()
+	g.Expect(ioutil.WriteFile(filepath.Join(modulePath, "Chart.yaml"), []byte("name: test-module\n"), 0644)).Should(Succeed())
+
+	metricStorage := metric_storage.NewMetricStorage()
+	metricStorage.WithNewRegistry()
+
+	mm := NewMainModuleManager()
+	mm.WithHelmResourcesManager(helm_resources_manager.NewHelmResourcesManager())
+	mm.TempDir = t.TempDir()
+
+	m := NewModule("test-module", modulePath)
+	m.WithModuleManager(mm)
+	m.WithMetricStorage(metricStorage)
+	m.CommonStaticConfig = utils.NewModuleConfig(m.Name)
+	m.StaticConfig = utils.NewModuleConfig(m.Name)
+	m.Definition.RollbackPolicy = HelmRollbackToLastDeployed
+
+	_, err := m.Run(map[string]string{})
+	g.Expect(err).To(MatchError("helm upgrade failed; release is rolled back to revision 2"))
+
+	// The retry skips the upgrade with the same manifests.
+	_, err = m.Run(map[string]string{})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(hc.upgrades).To(Equal(1))
+	g.Expect(hc.rollbacks).To(Equal(1))
+	g.Expect(m.State.HelmRollback.RolledBackTo).To(Equal("2"))
+
+	// Changed manifests are upgraded again.
+	hc.manifests = "kind: ConfigMap\nmetadata:\n  name: cm-fixed\n"
+	_, err = m.Run(map[string]string{})
+	g.Expect(err).Should(HaveOccurred())
+	g.Expect(hc.upgrades).To(Equal(2))
+	g.Expect(hc.rollbacks).To(Equal(2))
+}
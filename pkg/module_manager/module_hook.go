@@ -8,6 +8,7 @@ import (
 	"github.com/hashicorp/go-multierror"
 	log "github.com/sirupsen/logrus"
 	uuid "gopkg.in/satori/go.uuid.v1"
+	v1 "k8s.io/api/core/v1"
 
 	"github.com/flant/shell-operator/pkg/hook"
 	. "github.com/flant/shell-operator/pkg/hook/binding_context"
@@ -16,6 +17,8 @@ import (
 	"github.com/flant/addon-operator/pkg/module_manager/go_hook"
 
 	. "github.com/flant/addon-operator/pkg/hook/types"
+	"github.com/flant/addon-operator/pkg/module_events"
+	"github.com/flant/addon-operator/pkg/tracing"
 	"github.com/flant/addon-operator/pkg/utils"
 )
 
@@ -157,15 +160,26 @@ func (h *ModuleHook) Run(bindingType BindingType, context []BindingContext, logL
 
 	moduleHookExecutor := NewHookExecutor(h, context, h.Config.Version, h.moduleManager.KubeObjectPatcher)
 	moduleHookExecutor.WithLogLabels(logLabels)
+	moduleHookExecutor.WithTimeout(h.Config.Timeout)
+	span := tracing.StartSpan(logLabels, "ModuleHookExecute", hookSpanAttributes(h.Name, context)...)
 	hookResult, err := moduleHookExecutor.Run()
+	tracing.EndSpan(span, err)
 	if hookResult != nil && hookResult.Usage != nil {
 		// usage metrics
 		h.moduleManager.metricStorage.HistogramObserve("{PREFIX}module_hook_run_sys_cpu_seconds", hookResult.Usage.Sys.Seconds(), metricLabels, nil)
 		h.moduleManager.metricStorage.HistogramObserve("{PREFIX}module_hook_run_user_cpu_seconds", hookResult.Usage.User.Seconds(), metricLabels, nil)
 		h.moduleManager.metricStorage.GaugeSet("{PREFIX}module_hook_run_max_rss_bytes", float64(hookResult.Usage.MaxRss)*1024, metricLabels)
 	}
+	if IsHookTimeout(err) {
+		h.moduleManager.metricStorage.CounterAdd("{PREFIX}module_hook_timeouts_total", 1.0, metricLabels)
+	}
+	if IsHookAbandoned(err) {
+		h.moduleManager.metricStorage.CounterAdd("{PREFIX}module_hook_abandoned_total", 1.0, metricLabels)
+	}
 	if err != nil {
-		return fmt.Errorf("module hook '%s' failed: %s", h.Name, err)
+		h.moduleManager.eventRecorder.ModuleEvent(h.Module.Name, v1.EventTypeWarning, module_events.HookFailed,
+			"Hook '%s' failed on %s: %v", h.Name, bindingType, err)
+		return fmt.Errorf("module hook '%s' failed: %w", h.Name, err)
 	}
 
 	moduleName := h.Module.Name
@@ -218,12 +232,12 @@ func (h *ModuleHook) Run(bindingType BindingType, context []BindingContext, logL
 
 			err := h.moduleManager.kubeConfigManager.SetKubeModuleValues(moduleName, configValuesPatchResult.Values)
 			if err != nil {
-				log.Debugf("Module hook '%s' kube module config values stay unchanged:\n%s", h.Name, h.moduleManager.kubeModulesConfigValues[moduleName].DebugString())
+				log.Debugf("Module hook '%s' kube module config values stay unchanged:\n%s", h.Name, h.moduleManager.moduleConfigValues(moduleName).DebugString())
 				return fmt.Errorf("module hook '%s': set kube module config failed: %s", h.Name, err)
 			}
 
 			h.moduleManager.UpdateModuleConfigValues(moduleName, configValuesPatchResult.Values)
-			log.Debugf("Module hook '%s': kube module '%s' config values updated:\n%s", h.Name, moduleName, h.moduleManager.kubeModulesConfigValues[moduleName].DebugString())
+			log.Debugf("Module hook '%s': kube module '%s' config values updated:\n%s", h.Name, moduleName, h.moduleManager.moduleConfigValues(moduleName).DebugString())
 		}
 	}
 
@@ -251,7 +265,7 @@ func (h *ModuleHook) Run(bindingType BindingType, context []BindingContext, logL
 			}
 
 			// Save patch set if everything is ok.
-			h.moduleManager.UpdateModuleDynamicValuesPatches(moduleName, valuesPatchResult.ValuesPatch)
+			h.moduleManager.UpdateModuleDynamicValuesPatches(moduleName, valuesPatchResult.ValuesPatch, newValuesPatchSource(h.Name, bindingType, context))
 			newValues, err := h.Module.Values()
 			if err != nil {
 				return fmt.Errorf("get module values after values patch: %s", err)
@@ -2,6 +2,7 @@ package module_manager
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/go-openapi/spec"
 	"sigs.k8s.io/yaml"
@@ -10,6 +11,7 @@ import (
 
 	. "github.com/flant/addon-operator/pkg/hook/types"
 	"github.com/flant/addon-operator/pkg/module_manager/go_hook"
+	"github.com/flant/addon-operator/pkg/utils"
 
 	"github.com/flant/shell-operator/pkg/hook/config"
 )
@@ -26,6 +28,8 @@ type ModuleHookConfig struct {
 	BeforeHelm      *BeforeHelmConfig
 	AfterHelm       *AfterHelmConfig
 	AfterDeleteHelm *AfterDeleteHelmConfig
+	Timeout         time.Duration
+	RetryPolicy     *utils.RetryPolicy
 }
 
 type BeforeHelmConfig struct {
@@ -44,9 +48,11 @@ type AfterDeleteHelmConfig struct {
 }
 
 type ModuleHookConfigV0 struct {
-	BeforeHelm      interface{} `json:"beforeHelm"`
-	AfterHelm       interface{} `json:"afterHelm"`
-	AfterDeleteHelm interface{} `json:"afterDeleteHelm"`
+	BeforeHelm      interface{}              `json:"beforeHelm"`
+	AfterHelm       interface{}              `json:"afterHelm"`
+	AfterDeleteHelm interface{}              `json:"afterDeleteHelm"`
+	Timeout         string                   `json:"timeout"`
+	RetryPolicy     *utils.RetryPolicyConfig `json:"retryPolicy"`
 }
 
 func GetModuleHookConfigSchema(version string) *spec.Schema {
@@ -55,7 +61,7 @@ func GetModuleHookConfigSchema(version string) *spec.Schema {
 		schema := config.Schemas[version]
 		switch version {
 		case "v1":
-			// add beforeHelm, afterHelm and afterDeleteHelm properties
+			// add beforeHelm, afterHelm, afterDeleteHelm, timeout and retryPolicy properties
 			schema += `
   beforeHelm:
     type: integer
@@ -66,6 +72,23 @@ func GetModuleHookConfigSchema(version string) *spec.Schema {
   afterDeleteHelm:
     type: integer
     example: 10   
+  timeout:
+    type: string
+    example: 30s
+  retryPolicy:
+    type: object
+    additionalProperties: false
+    properties:
+      initialDelay:
+        type: string
+      maxDelay:
+        type: string
+      maxAttempts:
+        type: integer
+        minimum: 0
+      onExhausted:
+        type: string
+        enum: ["KeepFailing", "Skip", "DisableModule"]
 `
 		case "v0":
 			// add beforeHelm, afterHelm and afterDeleteHelm properties
@@ -177,6 +200,14 @@ func (c *ModuleHookConfig) ConvertAndCheckV1() (err error) {
 	if err != nil {
 		return err
 	}
+	c.Timeout, err = ConvertHookTimeout(c.ModuleV1.Timeout)
+	if err != nil {
+		return err
+	}
+	c.RetryPolicy, err = c.ModuleV1.RetryPolicy.Convert()
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -290,5 +321,15 @@ func NewModuleHookConfigFromGoConfig(input *go_hook.HookConfig) (*ModuleHookConf
 		cfg.AfterDeleteHelm.Order = input.OnAfterDeleteHelm.Order
 	}
 
+	if input.Settings != nil {
+		cfg.Timeout = input.Settings.Timeout
+		cfg.RetryPolicy = input.Settings.RetryPolicy
+		if cfg.RetryPolicy != nil {
+			if err := cfg.RetryPolicy.Validate(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	return cfg, nil
 }
@@ -2,6 +2,7 @@ package module_manager
 
 import (
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 
@@ -105,6 +106,51 @@ afterDeleteHelm: 18
 				g.Expect(config.AfterDeleteHelm.Order).To(Equal(18.0))
 			},
 		},
+		{
+			"load v1 module config with timeout",
+			"hook_v1",
+			`{"configVersion": "v1", "beforeHelm": 10, "timeout": "1m30s"}`,
+			func() {
+				g.Expect(err).ShouldNot(HaveOccurred())
+				g.Expect(config.Timeout).To(Equal(90 * time.Second))
+			},
+		},
+		{
+			"load v1 module config with bad timeout",
+			"hook_v1",
+			`{"configVersion": "v1", "beforeHelm": 10, "timeout": "10"}`,
+			func() {
+				g.Expect(err).Should(HaveOccurred())
+				g.Expect(err.Error()).Should(ContainSubstring("timeout is invalid"))
+			},
+		},
+		{
+			"load v1 module config with retryPolicy",
+			"hook_v1",
+			`
+configVersion: v1
+afterHelm: 10
+retryPolicy:
+  initialDelay: 10s
+  maxAttempts: 3
+  onExhausted: DisableModule
+`,
+			func() {
+				g.Expect(err).ShouldNot(HaveOccurred())
+				g.Expect(config.RetryPolicy).ToNot(BeNil())
+				g.Expect(config.RetryPolicy.InitialDelay).To(Equal(10 * time.Second))
+				g.Expect(config.RetryPolicy.MaxAttempts).To(Equal(3))
+				g.Expect(config.RetryPolicy.OnExhausted).To(Equal("DisableModule"))
+			},
+		},
+		{
+			"load v1 module config with bad retryPolicy",
+			"hook_v1",
+			`{"configVersion": "v1", "afterHelm": 10, "retryPolicy": {"onExhausted": "Ignore"}}`,
+			func() {
+				g.Expect(err).Should(HaveOccurred())
+			},
+		},
 		{
 			"load v1 bad module config",
 			"hook_v1",
@@ -0,0 +1,239 @@
+package module_manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/flant/addon-operator/pkg/values/validation"
+)
+
+// Lint rules.
+const (
+	LintRuleModuleDirName      = "module-dir-name"
+	LintRuleModuleDefinition   = "module-definition"
+	LintRuleModuleDependencies = "module-dependencies"
+	LintRuleStaticValues       = "static-values"
+	LintRuleOpenAPISchema      = "openapi-schema"
+	LintRuleHookConfig         = "hook-config"
+	LintRuleEnabledScript      = "enabled-script"
+)
+
+// LintRules is a list of all lint rules with descriptions.
+var LintRules = map[string]string{
+	LintRuleModuleDirName:      "Module directory name should match " + ValidModuleNameRe.String(),
+	LintRuleModuleDefinition:   "module.yaml should be a valid module definition",
+	LintRuleModuleDependencies: "Modules should require known modules without cycles",
+	LintRuleStaticValues:       "Static values from values.yaml files should be valid against OpenAPI schemas",
+	LintRuleOpenAPISchema:      "OpenAPI schemas in openapi directory should be valid",
+	LintRuleHookConfig:         "Hook configuration should be valid",
+	LintRuleEnabledScript:      "enabled script should be executable",
+}
+
+const (
+	LintLevelError   = "error"
+	LintLevelWarning = "warning"
+)
+
+// LintIssue is a problem found in the modules tree.
+type LintIssue struct {
+	Rule    string `json:"rule"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+	Path    string `json:"path,omitempty"`
+	Module  string `json:"module,omitempty"`
+	Hook    string `json:"hook,omitempty"`
+}
+
+// Lint loads modules, hooks and schemas the same way as Init does, but does not start anything
+// and does not stop on the first error. Hooks are executed only with --config flag.
+func (mm *moduleManager) Lint() []LintIssue {
+	issues := make([]LintIssue, 0)
+	addIssue := func(issue LintIssue) {
+		if issue.Level == "" {
+			issue.Level = LintLevelError
+		}
+		issues = append(issues, issue)
+	}
+
+	// Global hooks and schemas.
+	if err := mm.loadGlobalValuesSchemas(); err != nil {
+		addIssue(LintIssue{Rule: LintRuleOpenAPISchema, Message: err.Error(), Path: filepath.Join(mm.GlobalHooksDir, "openapi")})
+	}
+	for _, issue := range lintGlobalHooks(mm.GlobalHooksDir) {
+		addIssue(issue)
+	}
+
+	if err := mm.loadCommonStaticValues(); err != nil {
+		addIssue(LintIssue{Rule: LintRuleStaticValues, Message: err.Error(), Path: filepath.Join(mm.ModulesDir, "values.yaml")})
+	}
+	if err := mm.lintGlobalStaticValues(); err != nil {
+		addIssue(LintIssue{Rule: LintRuleStaticValues, Message: fmt.Sprintf("global values are not valid: %v", err), Path: filepath.Join(mm.ModulesDir, "values.yaml")})
+	}
+
+	modules, badModulesDirs, err := searchModules(mm.ModulesDir)
+	if err != nil {
+		addIssue(LintIssue{Rule: LintRuleModuleDirName, Message: err.Error(), Path: mm.ModulesDir})
+		return issues
+	}
+	for _, dir := range badModulesDirs {
+		addIssue(LintIssue{
+			Rule:    LintRuleModuleDirName,
+			Message: fmt.Sprintf("directory name does not match '%s'", ValidModuleNameRe),
+			Path:    dir,
+		})
+	}
+
+	definitionsValid := true
+	for _, module := range modules {
+		module.WithModuleManager(mm)
+		module.WithMetricStorage(mm.metricStorage)
+		mm.allModulesByName[module.Name] = module
+		mm.allModulesNamesInOrder = append(mm.allModulesNamesInOrder, module.Name)
+
+		moduleIssue := func(issue LintIssue) {
+			issue.Module = module.Name
+			addIssue(issue)
+		}
+
+		if err := module.loadDefinition(); err != nil {
+			definitionsValid = false
+			moduleIssue(LintIssue{Rule: LintRuleModuleDefinition, Message: err.Error(), Path: filepath.Join(module.Path, "module.yaml")})
+		}
+
+		schemasValid := true
+		openAPIPath := filepath.Join(module.Path, "openapi")
+		configBytes, valuesBytes, err := ReadOpenAPIFiles(openAPIPath)
+		if err == nil {
+			err = mm.ValuesValidator.SchemaStorage.AddModuleValuesSchemas(module.ValuesKey(), configBytes, valuesBytes)
+		}
+		if err != nil {
+			schemasValid = false
+			moduleIssue(LintIssue{Rule: LintRuleOpenAPISchema, Message: err.Error(), Path: openAPIPath})
+		}
+
+		valuesPath := filepath.Join(module.Path, "values.yaml")
+		if err := module.loadStaticValues(); err != nil {
+			moduleIssue(LintIssue{Rule: LintRuleStaticValues, Message: err.Error(), Path: valuesPath})
+		} else if schemasValid {
+			if err := mm.lintModuleStaticValues(module); err != nil {
+				moduleIssue(LintIssue{Rule: LintRuleStaticValues, Message: fmt.Sprintf("values are not valid: %v", err), Path: valuesPath})
+			}
+		}
+
+		enabledPath := filepath.Join(module.Path, "enabled")
+		if stat, err := os.Stat(enabledPath); err == nil && !stat.IsDir() && stat.Mode()&0111 == 0 {
+			moduleIssue(LintIssue{Rule: LintRuleEnabledScript, Message: "enabled script is not executable", Path: enabledPath})
+		}
+
+		for _, issue := range lintModuleHooks(module) {
+			moduleIssue(issue)
+		}
+	}
+
+	if definitionsValid {
+		err := mm.validateModuleDependencies()
+		if err == nil {
+			_, err = SortModulesByDependencies(mm.allModulesNamesInOrder, mm.allModulesByName)
+		}
+		if err != nil {
+			addIssue(LintIssue{Rule: LintRuleModuleDependencies, Message: err.Error(), Path: mm.ModulesDir})
+		}
+	}
+
+	return issues
+}
+
+// lintGlobalStaticValues validates static values against the values schema, which extends
+// the config values schema. The config values schema is used if there is no values schema.
+func (mm *moduleManager) lintGlobalStaticValues() error {
+	values := mm.GlobalStaticAndNewValues(nil)
+	if mm.ValuesValidator.SchemaStorage.GlobalValuesSchema(validation.ValuesSchema) == nil {
+		return mm.ValuesValidator.ValidateGlobalConfigValues(values)
+	}
+	return mm.ValuesValidator.ValidateGlobalValues(values)
+}
+
+func (mm *moduleManager) lintModuleStaticValues(module *Module) error {
+	values := module.StaticAndNewValues(nil)
+	if mm.ValuesValidator.SchemaStorage.ModuleValuesSchema(module.ValuesKey(), validation.ValuesSchema) == nil {
+		return mm.ValuesValidator.ValidateModuleConfigValues(module.ValuesKey(), values)
+	}
+	return mm.ValuesValidator.ValidateModuleValues(module.ValuesKey(), values)
+}
+
+// LintHasErrors returns true if there is an issue with error level.
+func LintHasErrors(issues []LintIssue) bool {
+	return LintErrorsCount(issues) > 0
+}
+
+// LintErrorsCount returns a number of issues with error level.
+func LintErrorsCount(issues []LintIssue) int {
+	count := 0
+	for _, issue := range issues {
+		if issue.Level == LintLevelError {
+			count++
+		}
+	}
+	return count
+}
+
+func lintGlobalHooks(hooksDir string) []LintIssue {
+	hooks, err := SearchGlobalHooks(hooksDir)
+	if err != nil {
+		return []LintIssue{{Rule: LintRuleHookConfig, Message: fmt.Sprintf("search global hooks: %v", err), Path: hooksDir}}
+	}
+
+	issues := make([]LintIssue, 0)
+	for _, globalHook := range hooks {
+		if issue := lintHookConfig(globalHook); issue != nil {
+			issues = append(issues, *issue)
+		}
+	}
+	return issues
+}
+
+func lintModuleHooks(module *Module) []LintIssue {
+	hooks, err := SearchModuleHooks(module)
+	if err != nil {
+		return []LintIssue{{Rule: LintRuleHookConfig, Message: fmt.Sprintf("search module hooks: %v", err), Path: filepath.Join(module.Path, "hooks")}}
+	}
+
+	issues := make([]LintIssue, 0)
+	for _, moduleHook := range hooks {
+		if issue := lintHookConfig(moduleHook); issue != nil {
+			issues = append(issues, *issue)
+		}
+	}
+	return issues
+}
+
+// lintHookConfig loads config of a Go hook or runs a shell hook with --config and loads its output.
+func lintHookConfig(h Hook) *LintIssue {
+	issue := &LintIssue{Rule: LintRuleHookConfig, Level: LintLevelError, Path: h.GetPath(), Hook: h.GetName()}
+
+	if h.GetGoHook() != nil {
+		if err := h.WithGoConfig(h.GetGoHook().Config()); err != nil {
+			issue.Message = err.Error()
+			return issue
+		}
+		return nil
+	}
+
+	configOutput, err := NewHookExecutor(h, nil, "", nil).Config()
+	if err != nil {
+		issue.Message = fmt.Sprintf("run --config: %v", err)
+		return issue
+	}
+	if len(configOutput) == 0 {
+		// Hook without bindings is registered at startup, but it is never executed.
+		issue.Level = LintLevelWarning
+		issue.Message = "--config output is empty, hook has no bindings"
+		return issue
+	}
+	if err := h.WithConfig(configOutput); err != nil {
+		issue.Message = err.Error()
+		return issue
+	}
+	return nil
+}
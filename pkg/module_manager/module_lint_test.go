@@ -0,0 +1,43 @@
+package module_manager
+
+import (
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_ModuleManager_Lint(t *testing.T) {
+	g := NewWithT(t)
+
+	rootDir := filepath.Join("testdata", "lint")
+	mm := NewMainModuleManager()
+	mm.WithDirectories(filepath.Join(rootDir, "modules"), filepath.Join(rootDir, "global-hooks"), t.TempDir())
+
+	issues := mm.Lint()
+
+	type issueKey struct {
+		Rule   string
+		Level  string
+		Module string
+	}
+	keys := make([]issueKey, 0, len(issues))
+	for _, issue := range issues {
+		g.Expect(issue.Message).ToNot(BeEmpty())
+		g.Expect(issue.Path).ToNot(BeEmpty())
+		keys = append(keys, issueKey{issue.Rule, issue.Level, issue.Module})
+	}
+
+	g.Expect(keys).To(ConsistOf(
+		issueKey{LintRuleModuleDirName, LintLevelError, ""},
+		issueKey{LintRuleStaticValues, LintLevelError, "bad-values"},
+		issueKey{LintRuleModuleDefinition, LintLevelError, "bad-hook"},
+		issueKey{LintRuleEnabledScript, LintLevelError, "bad-hook"},
+		issueKey{LintRuleHookConfig, LintLevelError, "bad-hook"},
+	))
+	g.Expect(LintHasErrors(issues)).To(BeTrue())
+
+	// Warnings are not counted as errors.
+	issues = append(issues, LintIssue{Rule: LintRuleModuleDependencies, Level: LintLevelWarning})
+	g.Expect(LintErrorsCount(issues)).To(Equal(5))
+}
@@ -32,6 +32,7 @@ import (
 	"github.com/flant/addon-operator/pkg/helm"
 	"github.com/flant/addon-operator/pkg/helm_resources_manager"
 	"github.com/flant/addon-operator/pkg/kube_config_manager"
+	"github.com/flant/addon-operator/pkg/module_events"
 	"github.com/flant/addon-operator/pkg/module_manager/go_hook"
 	"github.com/flant/addon-operator/pkg/utils"
 	"github.com/flant/addon-operator/pkg/values/validation"
@@ -54,6 +55,7 @@ type ModuleManager interface {
 	WithHelmResourcesManager(manager helm_resources_manager.HelmResourcesManager)
 	WithMetricStorage(storage *metric_storage.MetricStorage)
 	WithHookMetricStorage(storage *metric_storage.MetricStorage)
+	WithEventRecorder(recorder *module_events.Recorder)
 
 	GetGlobalHooksInOrder(bindingType BindingType) []string
 	GetGlobalHooksNames() []string
@@ -61,6 +63,7 @@ type ModuleManager interface {
 
 	GetModuleNamesInOrder() []string
 	GetModule(name string) *Module
+	ModuleEnabledSources() map[string]string
 	GetModuleHookNames(moduleName string) []string
 	GetModuleHook(name string) *ModuleHook
 	GetModuleHooksInOrder(moduleName string, bindingType BindingType) []string
@@ -70,10 +73,12 @@ type ModuleManager interface {
 	GlobalConfigValues() utils.Values
 	GlobalValues() (utils.Values, error)
 	GlobalValuesPatches() []utils.ValuesPatch
+	GlobalValuesProvenance() ([]ValueProvenance, error)
+	GlobalValuesPatchHistory() []ValuesPatchRecord
 	UpdateGlobalConfigValues(configValues utils.Values)
-	UpdateGlobalDynamicValuesPatches(valuesPatch utils.ValuesPatch)
+	UpdateGlobalDynamicValuesPatches(valuesPatch utils.ValuesPatch, source ValuesPatchSource)
 	UpdateModuleConfigValues(moduleName string, configValues utils.Values)
-	UpdateModuleDynamicValuesPatches(moduleName string, valuesPatch utils.ValuesPatch)
+	UpdateModuleDynamicValuesPatches(moduleName string, valuesPatch utils.ValuesPatch, source ValuesPatchSource)
 
 	// Actions for tasks
 	DiscoverModulesState(logLabels map[string]string) (*ModulesState, error)
@@ -88,6 +93,8 @@ type ModuleManager interface {
 	HandleKubeEvent(kubeEvent KubeEvent, createGlobalTaskFn func(*GlobalHook, controller.BindingExecutionInfo), createModuleTaskFn func(*Module, *ModuleHook, controller.BindingExecutionInfo))
 	HandleGlobalEnableKubernetesBindings(hookName string, createTaskFn func(*GlobalHook, controller.BindingExecutionInfo)) error
 	HandleModuleEnableKubernetesBindings(hookName string, createTaskFn func(*ModuleHook, controller.BindingExecutionInfo)) error
+	WarmUpKubernetesBindings(logLabels map[string]string) error
+	DropWarmKubernetesEvents()
 	StartModuleHooks(moduleName string)
 	//EnableScheduleBindings()
 	DisableModuleHooks(moduleName string)
@@ -102,6 +109,9 @@ type ModuleManager interface {
 	SynchronizationDone(id string)
 
 	DumpState()
+
+	ModuleCheckpoints() map[string]ModuleCheckpoint
+	RestoreModuleCheckpoints(checkpoints map[string]ModuleCheckpoint)
 }
 
 // ModulesState is a result of Discovery process, that determines which
@@ -115,6 +125,8 @@ type ModulesState struct {
 	ReleasedUnknownModules []string
 	// modules that was disabled and now are enabled
 	NewlyEnabledModules []string
+	// conflicting modules that keep their current state, indexed by module name
+	ConflictingModules map[string][]string
 }
 
 type moduleManager struct {
@@ -135,6 +147,7 @@ type moduleManager struct {
 	HelmResourcesManager helm_resources_manager.HelmResourcesManager
 	metricStorage        *metric_storage.MetricStorage
 	hookMetricStorage    *metric_storage.MetricStorage
+	eventRecorder        *module_events.Recorder
 	ValuesValidator      *validation.ValuesValidator
 
 	// Index of all modules in modules directory. Key is module name.
@@ -163,6 +176,10 @@ type moduleManager struct {
 	// This list is changed on ConfigMap changes.
 	enabledModulesInOrder []string
 
+	// Sources of the enabled state of all modules, see ModuleEnabledSources.
+	enabledSources     map[string]string
+	enabledSourcesLock sync.RWMutex
+
 	// Index of all global hooks. Key is global hook name
 	globalHooksByName map[string]*GlobalHook
 	// Index for searching global hooks by their bindings.
@@ -174,13 +191,22 @@ type moduleManager struct {
 
 	kubernetesBindingSynchronizationState map[string]*KubernetesBindingSynchronizationState
 
+	// Global hooks and modules with monitors started by WarmUpKubernetesBindings.
+	warmGlobalHooks map[string][]controller.HookController
+	warmModules     map[string][]controller.HookController
+	warmLock        sync.Mutex
+
+	// Module states restored from the checkpoint. It is nil if checkpoints are disabled.
+	restoredCheckpoints map[string]ModuleCheckpoint
+	checkpointsLock     sync.Mutex
+
 	// VALUE STORAGES
 
 	// Values from modules/values.yaml file
 	commonStaticValues utils.Values
 
 	// A lock to synchronize access to *ConfigValues and *DynamicValuesPatches fields.
-	valuesLayersLock sync.Mutex
+	valuesLayersLock sync.RWMutex
 
 	// global values from ConfigMap
 	kubeGlobalConfigValues utils.Values
@@ -196,6 +222,12 @@ type moduleManager struct {
 	globalDynamicValuesPatches []utils.ValuesPatch
 	// Pathces for dynamic module values
 	modulesDynamicValuesPatches map[string][]utils.ValuesPatch
+	// Hooks that set patch operations, indexed by the operation path.
+	globalValuesPatchSources  map[string]ValuesPatchSource
+	modulesValuesPatchSources map[string]map[string]ValuesPatchSource
+	// The last applied patches with hooks that sent them.
+	globalValuesPatchHistory  *valuesPatchHistory
+	modulesValuesPatchHistory map[string]*valuesPatchHistory
 
 	// Internal event: module values are changed.
 	// This event leads to module run action.
@@ -251,7 +283,7 @@ type Event struct {
 func NewMainModuleManager() *moduleManager {
 	return &moduleManager{
 		EventCh:          make(chan Event),
-		valuesLayersLock: sync.Mutex{},
+		valuesLayersLock: sync.RWMutex{},
 
 		ValuesValidator: validation.NewValuesValidator(),
 
@@ -268,6 +300,8 @@ func NewMainModuleManager() *moduleManager {
 		kubeModulesConfigValues:     make(map[string]utils.Values),
 		globalDynamicValuesPatches:  make([]utils.ValuesPatch, 0),
 		modulesDynamicValuesPatches: make(map[string][]utils.ValuesPatch),
+		modulesValuesPatchSources:   make(map[string]map[string]ValuesPatchSource),
+		modulesValuesPatchHistory:   make(map[string]*valuesPatchHistory),
 
 		moduleValuesChanged: make(chan string, 1),
 		globalValuesChanged: make(chan bool, 1),
@@ -317,6 +351,10 @@ func (mm *moduleManager) WithHookMetricStorage(storage *metric_storage.MetricSto
 	mm.hookMetricStorage = storage
 }
 
+func (mm *moduleManager) WithEventRecorder(recorder *module_events.Recorder) {
+	mm.eventRecorder = recorder
+}
+
 func (mm *moduleManager) WithContext(ctx context.Context) {
 	mm.ctx, mm.cancel = context.WithCancel(ctx)
 }
@@ -329,24 +367,100 @@ func (mm *moduleManager) Stop() {
 
 // RunModulesEnabledScript runs enable script for each module that is enabled by config.
 // Enable script receives a list of previously enabled modules.
+// Module is disabled without running the script if one of its required modules
+// is disabled. Conflicting modules keep their current state, see runModulesEnabledScript.
 func (mm *moduleManager) RunModulesEnabledScript(enabledByConfig []string, logLabels map[string]string) ([]string, error) {
+	enabledModules, _, err := mm.runModulesEnabledScript(enabledByConfig, logLabels)
+	return enabledModules, err
+}
+
+// runModulesEnabledScript returns enabled modules and conflicts between modules enabled by
+// scripts. Addon-operator does not choose which of conflicting modules to disable: it can
+// delete a working release. A module from a conflicting pair stays enabled only if it is
+// currently enabled, so a typo in the config does not change running modules.
+func (mm *moduleManager) runModulesEnabledScript(enabledByConfig []string, logLabels map[string]string) ([]string, map[string][]string, error) {
+	return mm.resolveEnabledModules(enabledByConfig, (*Module).checkIsEnabledByScript, logLabels)
+}
+
+// isEnabledFn decides if the module is enabled after its required modules are checked.
+type isEnabledFn func(module *Module, precedingEnabledModules []string, logLabels map[string]string) (bool, error)
+
+// resolveEnabledModules applies requires and conflicts of modules to enabledByConfig
+// modules checked with isEnabled. See runModulesEnabledScript.
+func (mm *moduleManager) resolveEnabledModules(enabledByConfig []string, isEnabled isEnabledFn, logLabels map[string]string) ([]string, map[string][]string, error) {
+	conflicts := make(map[string][]string)
+	keepDisabled := make(map[string]bool)
+
+	for {
+		enabledModules, conflict, err := mm.enableModules(enabledByConfig, keepDisabled, isEnabled, logLabels)
+		if err != nil {
+			return nil, nil, err
+		}
+		if conflict == nil {
+			return enabledModules, conflicts, nil
+		}
+
+		// The second module of the pair is checked later, so enabled scripts are run again
+		// to recalculate modules checked after the first one.
+		first, second := conflict[0], conflict[1]
+		log.WithFields(utils.LabelsToLogFields(logLabels)).
+			Warnf("Modules '%s' and '%s' conflict with each other, keep their current state", first, second)
+		conflicts[first] = append(conflicts[first], second)
+		conflicts[second] = append(conflicts[second], first)
+
+		kept := false
+		for _, name := range conflict {
+			if !containsString(mm.enabledModulesInOrder, name) {
+				keepDisabled[name] = true
+				kept = true
+			}
+		}
+		// Both modules are enabled: the conflict is declared after they were enabled.
+		if !kept {
+			keepDisabled[second] = true
+		}
+	}
+}
+
+// enableModules checks modules with isEnabled and returns the first found pair of conflicting modules.
+func (mm *moduleManager) enableModules(enabledByConfig []string, keepDisabled map[string]bool, isEnabled isEnabledFn, logLabels map[string]string) ([]string, []string, error) {
 	enabledModules := make([]string, 0)
 
 	for _, name := range utils.SortByReference(enabledByConfig, mm.allModulesNamesInOrder) {
 		moduleLogLabels := utils.MergeLabels(logLabels)
 		moduleLogLabels["module"] = name
 		module := mm.allModulesByName[name]
-		moduleIsEnabled, err := module.checkIsEnabledByScript(enabledModules, moduleLogLabels)
+
+		if keepDisabled[name] {
+			log.WithFields(utils.LabelsToLogFields(moduleLogLabels)).
+				Infof("Module is disabled: conflicting module is enabled")
+			continue
+		}
+
+		// Required modules are checked before the enabled script,
+		// because modules are sorted so requirements go first.
+		disabledRequirements := module.DisabledRequirements(enabledModules)
+		if len(disabledRequirements) > 0 {
+			log.WithFields(utils.LabelsToLogFields(moduleLogLabels)).
+				Infof("Module is disabled: required modules are disabled: %v", disabledRequirements)
+			continue
+		}
+
+		moduleIsEnabled, err := isEnabled(module, enabledModules, moduleLogLabels)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		if moduleIsEnabled {
+			conflicts := mm.conflictingModules(name, enabledModules)
+			if len(conflicts) > 0 {
+				return nil, []string{conflicts[0], name}, nil
+			}
 			enabledModules = append(enabledModules, name)
 		}
 	}
 
-	return enabledModules, nil
+	return enabledModules, nil, nil
 }
 
 // kubeUpdate
@@ -740,7 +854,8 @@ func (mm *moduleManager) DiscoverModulesState(logLabels map[string]string) (stat
 
 	currentEnabledModules := mm.enabledModulesInOrder
 
-	updateEnabledModules, updateModuleValues, _ := mm.calculateEnabledModulesByConfig(mm.kubeConfigManager.CurrentConfig().ModuleConfigs)
+	moduleConfigs := mm.kubeConfigManager.CurrentConfig().ModuleConfigs
+	updateEnabledModules, updateModuleValues, _ := mm.calculateEnabledModulesByConfig(moduleConfigs)
 	updateEnabledModules = utils.SortByReference(updateEnabledModules, mm.allModulesNamesInOrder)
 
 	mm.enabledModulesByConfig = updateEnabledModules
@@ -779,12 +894,13 @@ func (mm *moduleManager) DiscoverModulesState(logLabels map[string]string) (stat
 	// no need to refresh mm.enabledModulesByConfig because
 	// it is updated before in Init or in applyKubeUpdate
 	logEntry.Debugf("Run enabled script for %+v", mm.enabledModulesByConfig)
-	enabledModules, err := mm.RunModulesEnabledScript(mm.enabledModulesByConfig, logLabels)
+	enabledModules, conflicts, err := mm.runModulesEnabledScript(mm.enabledModulesByConfig, logLabels)
 	logEntry.Infof("Modules enabled by script: %+v", enabledModules)
 
 	if err != nil {
 		return nil, err
 	}
+	state.ConflictingModules = conflicts
 
 	for _, moduleName := range enabledModules {
 		if err = mm.RegisterModuleHooks(mm.allModulesByName[moduleName], logLabels); err != nil {
@@ -797,12 +913,22 @@ func (mm *moduleManager) DiscoverModulesState(logLabels map[string]string) (stat
 	state.NewlyEnabledModules = utils.ListSubtract(enabledModules, mm.enabledModulesInOrder)
 	// save enabled modules for future usages
 	mm.enabledModulesInOrder = enabledModules
+	mm.stopWarmModules(enabledModules)
+
+	enabledSources := mm.calculateEnabledSources(moduleConfigs, mm.enabledModulesByConfig, enabledModules)
+	mm.enabledSourcesLock.Lock()
+	mm.enabledSources = enabledSources
+	mm.enabledSourcesLock.Unlock()
 
 	// Calculate disabled known modules that has helm release and/or was enabled.
 	// Sort them in reverse order for proper deletion.
 	state.ModulesToDisable = utils.ListSubtract(mm.allModulesNamesInOrder, enabledModules)
 	enabledAndReleased := utils.ListUnion(currentEnabledModules, releasedModules)
 	state.ModulesToDisable = utils.ListIntersection(state.ModulesToDisable, enabledAndReleased)
+	// Releases of conflicting modules are kept as is.
+	for moduleName := range conflicts {
+		state.ModulesToDisable = utils.ListSubtract(state.ModulesToDisable, []string{moduleName})
+	}
 	// disable modules in reverse order
 	state.ModulesToDisable = utils.SortReverseByReference(state.ModulesToDisable, mm.allModulesNamesInOrder)
 
@@ -1096,26 +1222,32 @@ func (mm *moduleManager) GlobalStaticAndNewValues(newValues utils.Values) utils.
 	)
 }
 
-// GlobalValues return current global values with applied patches
-func (mm *moduleManager) GlobalValues() (utils.Values, error) {
-	var err error
-
-	res := MergeLayers(
+// globalValuesLayers returns layers of global values before patches.
+func (mm *moduleManager) globalValuesLayers() []valuesLayer {
+	return []valuesLayer{
 		// Init global section.
-		utils.Values{"global": map[string]interface{}{}},
+		{ValuesSourceInit, utils.Values{"global": map[string]interface{}{}}},
 		// Merge static values from modules/values.yaml.
-		mm.commonStaticValues.Global(),
+		{ValuesSourceCommonStatic, mm.commonStaticValues.Global()},
 		// Apply config values defaults before ConfigMap overrides.
-		&ApplyDefaultsForGlobal{validation.ConfigValuesSchema, mm.ValuesValidator},
+		{ValuesSourceConfigDefaults, &ApplyDefaultsForGlobal{validation.ConfigValuesSchema, mm.ValuesValidator}},
 		// Merge overrides from ConfigMap.
-		mm.kubeGlobalConfigValues,
+		{ValuesSourceConfig, mm.kubeGlobalConfigValues},
 		// Apply dynamic values defaults before patches.
-		&ApplyDefaultsForGlobal{validation.ValuesSchema, mm.ValuesValidator},
-	)
+		{ValuesSourceValuesDefaults, &ApplyDefaultsForGlobal{validation.ValuesSchema, mm.ValuesValidator}},
+	}
+}
+
+// GlobalValues return current global values with applied patches
+func (mm *moduleManager) GlobalValues() (utils.Values, error) {
+	var err error
+
+	res := mergeValuesLayers(utils.Values{}, mm.globalValuesLayers())
 
 	// Invariant: do not store patches that does not apply
 	// Give user error for patches early, after patch receive
-	for _, patch := range mm.globalDynamicValuesPatches {
+	patches, _ := mm.globalValuesPatchesSnapshot()
+	for _, patch := range patches {
 		res, _, err = utils.ApplyValuesPatch(res, patch, utils.IgnoreNonExistentPaths)
 		if err != nil {
 			return nil, fmt.Errorf("apply global patch error: %s", err)
@@ -1139,13 +1271,15 @@ func (mm *moduleManager) UpdateGlobalConfigValues(configValues utils.Values) {
 }
 
 // UpdateGlobalDynamicValuesPatches appends patches for global dynamic values.
-func (mm *moduleManager) UpdateGlobalDynamicValuesPatches(valuesPatch utils.ValuesPatch) {
+func (mm *moduleManager) UpdateGlobalDynamicValuesPatches(valuesPatch utils.ValuesPatch, source ValuesPatchSource) {
 	mm.valuesLayersLock.Lock()
 	defer mm.valuesLayersLock.Unlock()
 
 	mm.globalDynamicValuesPatches = utils.AppendValuesPatch(
 		mm.globalDynamicValuesPatches,
 		valuesPatch)
+	mm.globalValuesPatchSources = updateValuesPatchSources(mm.globalValuesPatchSources, mm.globalDynamicValuesPatches, valuesPatch, source)
+	mm.addGlobalValuesPatchRecord(valuesPatch, source)
 }
 
 // UpdateModuleConfigValues sets updated config values for module.
@@ -1156,13 +1290,30 @@ func (mm *moduleManager) UpdateModuleConfigValues(moduleName string, configValue
 }
 
 // UpdateModuleDynamicValuesPatches appends patches for dynamic values for module.
-func (mm *moduleManager) UpdateModuleDynamicValuesPatches(moduleName string, valuesPatch utils.ValuesPatch) {
+func (mm *moduleManager) UpdateModuleDynamicValuesPatches(moduleName string, valuesPatch utils.ValuesPatch, source ValuesPatchSource) {
 	mm.valuesLayersLock.Lock()
 	defer mm.valuesLayersLock.Unlock()
 
 	mm.modulesDynamicValuesPatches[moduleName] = utils.AppendValuesPatch(
 		mm.modulesDynamicValuesPatches[moduleName],
 		valuesPatch)
+	mm.modulesValuesPatchSources[moduleName] = updateValuesPatchSources(mm.modulesValuesPatchSources[moduleName], mm.modulesDynamicValuesPatches[moduleName], valuesPatch, source)
+	mm.addModuleValuesPatchRecord(moduleName, valuesPatch, source)
+}
+
+// moduleConfigValues returns config values for module. Values can be updated by hooks
+// from parallel ModuleRuns, so access is guarded by valuesLayersLock.
+func (mm *moduleManager) moduleConfigValues(moduleName string) utils.Values {
+	mm.valuesLayersLock.RLock()
+	defer mm.valuesLayersLock.RUnlock()
+	return mm.kubeModulesConfigValues[moduleName]
+}
+
+// moduleDynamicValuesPatches returns patches for dynamic values for module.
+func (mm *moduleManager) moduleDynamicValuesPatches(moduleName string) []utils.ValuesPatch {
+	mm.valuesLayersLock.RLock()
+	defer mm.valuesLayersLock.RUnlock()
+	return mm.modulesDynamicValuesPatches[moduleName]
 }
 
 func (mm *moduleManager) HandleKubeEvent(kubeEvent KubeEvent, createGlobalTaskFn func(*GlobalHook, controller.BindingExecutionInfo), createModuleTaskFn func(*Module, *ModuleHook, controller.BindingExecutionInfo)) {
@@ -1190,11 +1341,19 @@ func (mm *moduleManager) HandleKubeEvent(kubeEvent KubeEvent, createGlobalTaskFn
 func (mm *moduleManager) HandleGlobalEnableKubernetesBindings(hookName string, createTaskFn func(*GlobalHook, controller.BindingExecutionInfo)) error {
 	gh := mm.GetGlobalHook(hookName)
 
-	err := gh.HookController.HandleEnableKubernetesBindings(func(info controller.BindingExecutionInfo) {
+	createTasks := func(info controller.BindingExecutionInfo) {
 		if createTaskFn != nil {
 			createTaskFn(gh, info)
 		}
-	})
+	}
+
+	// Monitors are started on a standby replica.
+	if mm.takeWarm(mm.warmGlobalHooks, hookName) {
+		handleWarmKubernetesBindings(gh.HookController, kubernetesMonitorIDs(gh.Config.OnKubernetesEvents), createTasks)
+		return nil
+	}
+
+	err := gh.HookController.HandleEnableKubernetesBindings(createTasks)
 	if err != nil {
 		return err
 	}
@@ -1211,13 +1370,21 @@ mm.GetModule(moduleName).HandleEnableKubernetesBindings(createTaskFn)
 func (mm *moduleManager) HandleModuleEnableKubernetesBindings(moduleName string, createTaskFn func(*ModuleHook, controller.BindingExecutionInfo)) error {
 	kubeHooks := mm.GetModuleHooksInOrder(moduleName, OnKubernetesEvent)
 
+	// Monitors are started on a standby replica.
+	isWarm := mm.takeWarm(mm.warmModules, moduleName)
+
 	for _, hookName := range kubeHooks {
 		mh := mm.GetModuleHook(hookName)
-		err := mh.HookController.HandleEnableKubernetesBindings(func(info controller.BindingExecutionInfo) {
+		createTasks := func(info controller.BindingExecutionInfo) {
 			if createTaskFn != nil {
 				createTaskFn(mh, info)
 			}
-		})
+		}
+		if isWarm {
+			handleWarmKubernetesBindings(mh.HookController, kubernetesMonitorIDs(mh.Config.OnKubernetesEvents), createTasks)
+			continue
+		}
+		err := mh.HookController.HandleEnableKubernetesBindings(createTasks)
 		if err != nil {
 			return err
 		}
@@ -1224,6 +1224,35 @@ func Test_MainModuleManager_DiscoverModulesState(t *testing.T) {
 
 			},
 		},
+		{
+			"module_dependencies",
+			"discover_modules_state__dependencies",
+			[]string{},
+			func() {
+				// Required modules go first.
+				assert.Equal(t, []string{"cert-manager", "ingress", "logging", "monitoring", "alerting"}, mm.allModulesNamesInOrder)
+				// logging is disabled, so monitoring and alerting should be disabled too.
+				if assert.NoError(t, err) {
+					assert.Equal(t, []string{"cert-manager", "ingress"}, modulesState.EnabledModules)
+				}
+
+				// Conflicting modules keep their current state: ingress is enabled, logging is not.
+				mm.allModulesByName["logging"].Definition.Conflicts = []string{"ingress"}
+				mm.dynamicEnabled["logging"] = &utils.ModuleEnabled
+				modulesState, err = mm.DiscoverModulesState(map[string]string{})
+				if assert.NoError(t, err) {
+					assert.Equal(t, []string{"cert-manager", "ingress"}, modulesState.EnabledModules)
+					assert.Equal(t, map[string][]string{"ingress": {"logging"}, "logging": {"ingress"}}, modulesState.ConflictingModules)
+				}
+
+				mm.allModulesByName["logging"].Definition.Conflicts = nil
+				modulesState, err = mm.DiscoverModulesState(map[string]string{})
+				if assert.NoError(t, err) {
+					assert.Equal(t, []string{"cert-manager", "ingress", "logging", "monitoring", "alerting"}, modulesState.EnabledModules)
+					assert.Empty(t, modulesState.ConflictingModules)
+				}
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -1246,3 +1275,49 @@ func Test_MainModuleManager_DiscoverModulesState(t *testing.T) {
 	}
 
 }
+
+func Test_SortModulesByDependencies(t *testing.T) {
+	newModule := func(name string, requires ...string) *Module {
+		m := NewModule(name, "")
+		m.Definition.Requires = requires
+		return m
+	}
+
+	modules := map[string]*Module{
+		"a": newModule("a", "c"),
+		"b": newModule("b"),
+		"c": newModule("c", "b"),
+		"d": newModule("d"),
+	}
+	sorted, err := SortModulesByDependencies([]string{"a", "b", "c", "d"}, modules)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"b", "c", "a", "d"}, sorted)
+	}
+
+	modules["b"] = newModule("b", "a")
+	_, err = SortModulesByDependencies([]string{"a", "b", "c", "d"}, modules)
+	if assert.Error(t, err) {
+		assert.Equal(t, "modules dependency cycle: a -> c -> b -> a", err.Error())
+	}
+}
+
+func Test_ModuleManager_ConflictingModules(t *testing.T) {
+	mm := NewMainModuleManager()
+	mm.allModulesByName["ingress"] = NewModule("ingress", "")
+	mm.allModulesByName["legacy-ingress"] = NewModule("legacy-ingress", "")
+	mm.allModulesByName["legacy-ingress"].Definition.Conflicts = []string{"ingress"}
+
+	// Conflict is declared only in legacy-ingress, but it works in both directions.
+	assert.Equal(t, []string{"legacy-ingress"}, mm.conflictingModules("ingress", []string{"legacy-ingress"}))
+	assert.Equal(t, []string{"ingress"}, mm.conflictingModules("legacy-ingress", []string{"ingress"}))
+	assert.Empty(t, mm.conflictingModules("ingress", []string{"cert-manager"}))
+
+	mm.allModulesNamesInOrder = []string{"ingress", "legacy-ingress"}
+	assert.NoError(t, mm.validateModuleDependencies())
+
+	mm.allModulesByName["legacy-ingress"].Definition.Conflicts = []string{"ingress", "nginx"}
+	assert.EqualError(t, mm.validateModuleDependencies(), "module 'legacy-ingress' conflicts with unknown module 'nginx'")
+
+	mm.allModulesByName["legacy-ingress"].Definition.Conflicts = []string{"legacy-ingress"}
+	assert.EqualError(t, mm.validateModuleDependencies(), "module 'legacy-ingress' conflicts with itself")
+}
@@ -0,0 +1,131 @@
+package module_manager
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/flant/addon-operator/pkg/kube_config_manager"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// ModuleRender is a result of offline rendering of the module chart.
+type ModuleRender struct {
+	Module    string `json:"module"`
+	Manifests string `json:"manifests,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// RenderFn renders the module chart with values from valuesPath.
+type RenderFn func(releaseName string, chartPath string, valuesPath string) (string, error)
+
+// InitOffline initializes module manager without a cluster: it loads modules, static values and
+// OpenAPI schemas, but does not run hooks. Config values are taken from configValues instead of ConfigMap.
+// configValues has the same structure as ConfigMap data: 'global' section, module sections and
+// '<moduleName>Enabled' flags.
+func (mm *moduleManager) InitOffline(configValues utils.Values) error {
+	if err := mm.loadGlobalValuesSchemas(); err != nil {
+		return err
+	}
+
+	if err := mm.RegisterModules(); err != nil {
+		return err
+	}
+
+	config, err := offlineKubeConfig(configValues, mm.allModulesNamesInOrder)
+	if err != nil {
+		return err
+	}
+
+	mm.kubeGlobalConfigValues = config.Values
+	mm.enabledModulesByConfig, mm.kubeModulesConfigValues, _ = mm.calculateEnabledModulesByConfig(config.ModuleConfigs)
+	// Enabled scripts are not executed, but requires and conflicts are applied as in a cluster.
+	// There are no running modules, so both modules of a conflicting pair are disabled.
+	mm.enabledModulesInOrder, _, err = mm.resolveEnabledModules(mm.enabledModulesByConfig, enabledWithoutScript, map[string]string{})
+	if err != nil {
+		return err
+	}
+
+	return mm.validateKubeConfig(config)
+}
+
+func enabledWithoutScript(_ *Module, _ []string, _ map[string]string) (bool, error) {
+	return true, nil
+}
+
+// offlineKubeConfig converts values into a Config as if they were loaded from ConfigMap.
+func offlineKubeConfig(configValues utils.Values, moduleNames []string) (*kube_config_manager.Config, error) {
+	config := kube_config_manager.NewConfig()
+	if configValues.HasGlobal() {
+		config.Values = configValues.Global()
+	}
+
+	known := map[string]bool{utils.GlobalValuesKey: true}
+	for _, moduleName := range moduleNames {
+		moduleConfig, err := utils.NewModuleConfig(moduleName).LoadFromValues(configValues)
+		if err != nil {
+			return nil, err
+		}
+		known[moduleConfig.ModuleConfigKey] = true
+		known[moduleConfig.ModuleEnabledKey] = true
+		if len(moduleConfig.Values) == 0 && moduleConfig.IsEnabled == nil {
+			continue
+		}
+		config.ModuleConfigs[moduleName] = *moduleConfig
+	}
+
+	for key := range configValues {
+		if !known[key] {
+			log.Warnf("Ignore config values section '%s' for absent module", key)
+		}
+	}
+
+	return config, nil
+}
+
+// RenderModules renders charts of modules with values prepared the same way as for ModuleRun.
+// Modules enabled by config are rendered if moduleNames is empty. Modules without chart are skipped.
+func (mm *moduleManager) RenderModules(moduleNames []string, render RenderFn) ([]ModuleRender, error) {
+	if len(moduleNames) == 0 {
+		moduleNames = mm.enabledModulesInOrder
+	}
+
+	res := make([]ModuleRender, 0, len(moduleNames))
+	for _, moduleName := range moduleNames {
+		m := mm.GetModule(moduleName)
+		if m == nil {
+			return nil, fmt.Errorf("module '%s' is not found", moduleName)
+		}
+		if exists, _ := m.checkHelmChart(); !exists {
+			log.Debugf("module '%s' has no chart, skip rendering", moduleName)
+			continue
+		}
+
+		manifests, err := m.renderOffline(render)
+		if err != nil {
+			res = append(res, ModuleRender{Module: moduleName, Error: err.Error()})
+			continue
+		}
+		res = append(res, ModuleRender{Module: moduleName, Manifests: manifests})
+	}
+
+	return res, nil
+}
+
+func (m *Module) renderOffline(render RenderFn) (string, error) {
+	values, err := m.Values()
+	if err != nil {
+		return "", err
+	}
+	// Values from hooks are absent, so required fields are not checked.
+	if err := m.moduleManager.ValuesValidator.ValidateModuleOfflineValues(m.ValuesKey(), values); err != nil {
+		return "", fmt.Errorf("values are not valid: %v", err)
+	}
+
+	valuesPath, err := m.PrepareValuesYamlFile()
+	if err != nil {
+		return "", err
+	}
+
+	return render(m.generateHelmReleaseName(), m.Path, valuesPath)
+}
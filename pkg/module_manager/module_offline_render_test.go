@@ -0,0 +1,108 @@
+package module_manager
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+func Test_ModuleManager_RenderModules_Offline(t *testing.T) {
+	rootDir := filepath.Join("testdata", "render_offline")
+
+	// Render returns values file to check the values pipeline.
+	renderValues := func(releaseName string, chartPath string, valuesPath string) (string, error) {
+		data, err := ioutil.ReadFile(valuesPath)
+		return releaseName + "\n" + string(data), err
+	}
+
+	tests := []struct {
+		name          string
+		configValues  string
+		moduleNames   []string
+		expectInitErr bool
+		expectRenders []string
+		expectValues  []string
+	}{
+		{
+			name:          "static values",
+			configValues:  ``,
+			expectRenders: []string{"module-one"},
+			expectValues:  []string{"logLevel: Info", "replicas: 1", "clusterName: test", "- module-one"},
+		},
+		{
+			name: "config values override static values",
+			configValues: `
+moduleOne:
+  logLevel: Debug
+moduleTwoEnabled: true
+`,
+			// module-three requires module-two, so it is enabled and sorted after module-two.
+			expectRenders: []string{"module-one", "module-two", "module-three"},
+			expectValues:  []string{"logLevel: Debug", "replicas: 1", "- module-two"},
+		},
+		{
+			name: "conflicting modules",
+			configValues: `
+moduleFourEnabled: true
+`,
+			expectRenders: []string{},
+		},
+		{
+			// internal.certificate is required in values schema and is set by a hook.
+			name:          "required values from hooks",
+			configValues:  ``,
+			moduleNames:   []string{"module-one"},
+			expectRenders: []string{"module-one"},
+			expectValues:  []string{"logLevel: Info"},
+		},
+		{
+			name:          "selected module",
+			configValues:  ``,
+			moduleNames:   []string{"module-two"},
+			expectRenders: []string{"module-two"},
+		},
+		{
+			name: "invalid config values",
+			configValues: `
+moduleOne:
+  replicas: many
+`,
+			expectInitErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			configValues, err := utils.NewValuesFromBytes([]byte(tt.configValues))
+			g.Expect(err).ShouldNot(HaveOccurred())
+
+			mm := NewMainModuleManager()
+			mm.WithDirectories(filepath.Join(rootDir, "modules"), filepath.Join(rootDir, "global-hooks"), t.TempDir())
+
+			err = mm.InitOffline(configValues)
+			if tt.expectInitErr {
+				g.Expect(err).Should(HaveOccurred())
+				return
+			}
+			g.Expect(err).ShouldNot(HaveOccurred())
+
+			renders, err := mm.RenderModules(tt.moduleNames, renderValues)
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(renders).To(HaveLen(len(tt.expectRenders)))
+			for i, render := range renders {
+				g.Expect(render.Error).To(BeEmpty())
+				g.Expect(render.Module).To(Equal(tt.expectRenders[i]))
+				g.Expect(render.Manifests).To(HavePrefix(tt.expectRenders[i]))
+			}
+			for _, value := range tt.expectValues {
+				g.Expect(renders[0].Manifests + renders[len(renders)-1].Manifests).To(ContainSubstring(value))
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package module_manager
+
+import (
+	"sync"
+	"time"
+)
+
+type ModuleRunPhase string
+
+const (
+	// ModuleRunPending — module is enabled, ModuleRun is queued or not started yet.
+	ModuleRunPending ModuleRunPhase = "Pending"
+	// ModuleRunHooks — onStartup, Synchronization, beforeHelm or afterHelm hooks are running.
+	ModuleRunHooks ModuleRunPhase = "RunningHooks"
+	// ModuleRunHelm — helm chart is rendered and upgraded.
+	ModuleRunHelm ModuleRunPhase = "Helm"
+	// ModuleRunDone — last ModuleRun is succeeded.
+	ModuleRunDone ModuleRunPhase = "Done"
+	// ModuleRunFailed — last ModuleRun or ModuleDelete is failed.
+	ModuleRunFailed ModuleRunPhase = "Failed"
+	// ModuleRunDisabled — module is disabled.
+	ModuleRunDisabled ModuleRunPhase = "Disabled"
+)
+
+// ModuleRunStatus is a phase and a result of the last ModuleRun. It is changed
+// by the task handler and read by HTTP handlers, so access is guarded.
+type ModuleRunStatus struct {
+	m               sync.Mutex
+	phase           ModuleRunPhase
+	started         time.Time
+	lastRunTime     time.Time
+	lastRunDuration time.Duration
+	lastError       string
+}
+
+// ModuleRunInfo is a copy of ModuleRunStatus.
+type ModuleRunInfo struct {
+	// Phase is empty if module was not run yet.
+	Phase           ModuleRunPhase
+	Started         time.Time
+	LastRunTime     time.Time
+	LastRunDuration time.Duration
+	LastError       string
+}
+
+func (p ModuleRunPhase) IsRunning() bool {
+	return p == ModuleRunHooks || p == ModuleRunHelm
+}
+
+// Start sets the running phase. The start time is kept when the phase changes during the run.
+func (s *ModuleRunStatus) Start(phase ModuleRunPhase) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if !s.phase.IsRunning() {
+		s.started = time.Now()
+	}
+	s.phase = phase
+}
+
+// Finish saves a result of the run.
+func (s *ModuleRunStatus) Finish(err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	now := time.Now()
+	if !s.started.IsZero() {
+		s.lastRunDuration = now.Sub(s.started)
+	}
+	s.lastRunTime = now
+	s.started = time.Time{}
+	if err != nil {
+		s.phase = ModuleRunFailed
+		s.lastError = err.Error()
+		return
+	}
+	s.phase = ModuleRunDone
+	s.lastError = ""
+}
+
+func (s *ModuleRunStatus) Get() ModuleRunInfo {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return ModuleRunInfo{
+		Phase:           s.phase,
+		Started:         s.started,
+		LastRunTime:     s.lastRunTime,
+		LastRunDuration: s.lastRunDuration,
+		LastError:       s.lastError,
+	}
+}
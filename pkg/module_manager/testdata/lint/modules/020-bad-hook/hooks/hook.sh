@@ -0,0 +1,5 @@
+#!/bin/bash -e
+
+if [[ "$1" == "--config" ]]; then
+    echo '{"configVersion": "v1", "beforeHelm": "first"}'
+fi
@@ -0,0 +1,21 @@
+package module_manager
+
+import (
+	"strings"
+
+	. "github.com/flant/shell-operator/pkg/hook/binding_context"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// hookSpanAttributes returns attributes of the hook execution span.
+func hookSpanAttributes(hookName string, bindingContext []BindingContext) []attribute.KeyValue {
+	names := make([]string, 0, len(bindingContext))
+	for _, bc := range bindingContext {
+		names = append(names, bc.Binding)
+	}
+	return []attribute.KeyValue{
+		attribute.String("hook", hookName),
+		attribute.String("binding.names", strings.Join(names, ",")),
+		attribute.Int("binding_context.length", len(bindingContext)),
+	}
+}
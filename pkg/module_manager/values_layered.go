@@ -30,3 +30,19 @@ func MergeLayers(initial utils.Values, layers ...interface{}) utils.Values {
 
 	return res
 }
+
+// valuesLayer is a layer for MergeLayers with the source of its values.
+// Values and their provenance are built from the same list of layers.
+type valuesLayer struct {
+	source string
+	layer  interface{}
+}
+
+// mergeValuesLayers merges layers as MergeLayers does.
+func mergeValuesLayers(initial utils.Values, layers []valuesLayer) utils.Values {
+	res := make([]interface{}, 0, len(layers))
+	for _, l := range layers {
+		res = append(res, l.layer)
+	}
+	return MergeLayers(initial, res...)
+}
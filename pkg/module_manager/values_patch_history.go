@@ -0,0 +1,103 @@
+package module_manager
+
+import (
+	"time"
+
+	"github.com/flant/addon-operator/pkg/app"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// ValuesPatchRecord is a values patch applied by a hook run. Patches are compacted
+// when saved, so the history is the only way to see which hook changed values and when.
+type ValuesPatchRecord struct {
+	Time        time.Time                     `json:"time"`
+	Hook        string                        `json:"hook"`
+	Binding     string                        `json:"binding,omitempty"`
+	BindingType string                        `json:"bindingType,omitempty"`
+	Operations  []*utils.ValuesPatchOperation `json:"operations"`
+}
+
+// valuesPatchHistory is a ring buffer with the last applied patches.
+type valuesPatchHistory struct {
+	records []ValuesPatchRecord
+	// next is an index for the next record when the buffer is full.
+	next int
+	size int
+}
+
+func newValuesPatchHistory(size int) *valuesPatchHistory {
+	return &valuesPatchHistory{
+		records: make([]ValuesPatchRecord, 0),
+		size:    size,
+	}
+}
+
+func (h *valuesPatchHistory) add(record ValuesPatchRecord) {
+	if h.size <= 0 {
+		return
+	}
+	if len(h.records) < h.size {
+		h.records = append(h.records, record)
+		return
+	}
+	h.records[h.next] = record
+	h.next = (h.next + 1) % h.size
+}
+
+// list returns records from the oldest to the newest.
+func (h *valuesPatchHistory) list() []ValuesPatchRecord {
+	res := make([]ValuesPatchRecord, 0, len(h.records))
+	res = append(res, h.records[h.next:]...)
+	res = append(res, h.records[:h.next]...)
+	return res
+}
+
+func newValuesPatchRecord(valuesPatch utils.ValuesPatch, source ValuesPatchSource) ValuesPatchRecord {
+	return ValuesPatchRecord{
+		Time:        time.Now(),
+		Hook:        source.Hook,
+		Binding:     source.Binding,
+		BindingType: source.BindingType,
+		Operations:  valuesPatch.Operations,
+	}
+}
+
+// addGlobalValuesPatchRecord saves the patch into the history. It should be called with valuesLayersLock.
+func (mm *moduleManager) addGlobalValuesPatchRecord(valuesPatch utils.ValuesPatch, source ValuesPatchSource) {
+	if mm.globalValuesPatchHistory == nil {
+		mm.globalValuesPatchHistory = newValuesPatchHistory(app.ValuesPatchHistorySize)
+	}
+	mm.globalValuesPatchHistory.add(newValuesPatchRecord(valuesPatch, source))
+}
+
+// addModuleValuesPatchRecord saves the patch into the module history. It should be called with valuesLayersLock.
+func (mm *moduleManager) addModuleValuesPatchRecord(moduleName string, valuesPatch utils.ValuesPatch, source ValuesPatchSource) {
+	history, has := mm.modulesValuesPatchHistory[moduleName]
+	if !has {
+		history = newValuesPatchHistory(app.ValuesPatchHistorySize)
+		mm.modulesValuesPatchHistory[moduleName] = history
+	}
+	history.add(newValuesPatchRecord(valuesPatch, source))
+}
+
+// GlobalValuesPatchHistory returns the last applied patches for global values.
+func (mm *moduleManager) GlobalValuesPatchHistory() []ValuesPatchRecord {
+	mm.valuesLayersLock.RLock()
+	defer mm.valuesLayersLock.RUnlock()
+	if mm.globalValuesPatchHistory == nil {
+		return []ValuesPatchRecord{}
+	}
+	return mm.globalValuesPatchHistory.list()
+}
+
+// ValuesPatchHistory returns the last applied patches for module values.
+func (m *Module) ValuesPatchHistory() []ValuesPatchRecord {
+	mm := m.moduleManager
+	mm.valuesLayersLock.RLock()
+	defer mm.valuesLayersLock.RUnlock()
+	history, has := mm.modulesValuesPatchHistory[m.Name]
+	if !has {
+		return []ValuesPatchRecord{}
+	}
+	return history.list()
+}
@@ -0,0 +1,63 @@
+package module_manager
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/flant/addon-operator/pkg/app"
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+func Test_ValuesPatchHistory_Ring(t *testing.T) {
+	g := NewWithT(t)
+
+	h := newValuesPatchHistory(3)
+	g.Expect(h.list()).To(BeEmpty())
+
+	for i := 0; i < 5; i++ {
+		h.add(ValuesPatchRecord{Hook: fmt.Sprintf("hook-%d", i)})
+	}
+	hooks := []string{}
+	for _, r := range h.list() {
+		hooks = append(hooks, r.Hook)
+	}
+	g.Expect(hooks).To(Equal([]string{"hook-2", "hook-3", "hook-4"}))
+
+	// Zero size disables the history.
+	h = newValuesPatchHistory(0)
+	h.add(ValuesPatchRecord{Hook: "hook"})
+	g.Expect(h.list()).To(BeEmpty())
+}
+
+func Test_ValuesPatchHistory_Module(t *testing.T) {
+	g := NewWithT(t)
+
+	defer func(size int) { app.ValuesPatchHistorySize = size }(app.ValuesPatchHistorySize)
+	app.ValuesPatchHistorySize = 2
+
+	mm := NewMainModuleManager()
+	m := NewModule("module-a", "")
+	m.WithModuleManager(mm)
+
+	// A hook flaps the value.
+	for _, v := range []string{"1", "2", "1"} {
+		patch, err := utils.ValuesPatchFromBytes([]byte(fmt.Sprintf(`[{"op":"add", "path":"/moduleA/replicas", "value":%s}]`, v)))
+		g.Expect(err).ShouldNot(HaveOccurred())
+		mm.UpdateModuleDynamicValuesPatches("module-a", *patch, ValuesPatchSource{Hook: "module-a/hooks/replicas", Binding: "every-minute", BindingType: "schedule"})
+	}
+
+	// Patches are compacted, the history keeps each of the last patches.
+	g.Expect(m.ValuesPatches()).To(HaveLen(1))
+	history := m.ValuesPatchHistory()
+	g.Expect(history).To(HaveLen(2))
+	g.Expect(history[0].Operations[0].Value).To(Equal(2.0))
+	g.Expect(history[1].Operations[0].Value).To(Equal(1.0))
+	g.Expect(history[1].Hook).To(Equal("module-a/hooks/replicas"))
+	g.Expect(history[1].Binding).To(Equal("every-minute"))
+	g.Expect(history[1].BindingType).To(Equal("schedule"))
+	g.Expect(history[1].Time.Before(history[0].Time)).To(BeFalse())
+
+	g.Expect(mm.GlobalValuesPatchHistory()).To(BeEmpty())
+}
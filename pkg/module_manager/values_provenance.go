@@ -0,0 +1,284 @@
+package module_manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	. "github.com/flant/shell-operator/pkg/hook/binding_context"
+	. "github.com/flant/shell-operator/pkg/hook/types"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+// Sources of values.
+const (
+	// ValuesSourceInit — an empty section created before layers are merged.
+	ValuesSourceInit = "init"
+	// ValuesSourceCommonStatic — modules/values.yaml.
+	ValuesSourceCommonStatic = "common-static"
+	// ValuesSourceStatic — modules/<module>/values.yaml.
+	ValuesSourceStatic = "static"
+	// ValuesSourceConfigDefaults — defaults from the config-values.yaml schema.
+	ValuesSourceConfigDefaults = "config-defaults"
+	// ValuesSourceConfig — the ConfigMap.
+	ValuesSourceConfig = "config"
+	// ValuesSourceValuesDefaults — defaults from the values.yaml schema.
+	ValuesSourceValuesDefaults = "values-defaults"
+	// ValuesSourcePatch — a values patch from a hook.
+	ValuesSourcePatch = "patch"
+	// ValuesSourceEnabledModules — the list of enabled modules.
+	ValuesSourceEnabledModules = "enabled-modules"
+)
+
+// ValuesPatchSource is a hook that sets values with a patch.
+type ValuesPatchSource struct {
+	Hook string `json:"hook"`
+	// Binding is a binding name from the hook configuration.
+	Binding     string `json:"binding,omitempty"`
+	BindingType string `json:"bindingType,omitempty"`
+}
+
+// newValuesPatchSource returns a source for the patch from the hook run. Binding contexts
+// of a run have the same binding, so the name is taken from the first one.
+func newValuesPatchSource(hookName string, bindingType BindingType, bindingContext []BindingContext) ValuesPatchSource {
+	source := ValuesPatchSource{
+		Hook:        hookName,
+		BindingType: string(bindingType),
+	}
+	if len(bindingContext) > 0 {
+		source.Binding = bindingContext[0].Binding
+	}
+	return source
+}
+
+// ValueProvenance is a leaf of effective values with its source layer.
+// Arrays and empty objects are leaves.
+type ValueProvenance struct {
+	// Path is a JSON pointer, e.g. /global/discovery/clusterDomain.
+	Path        string      `json:"path"`
+	Value       interface{} `json:"value"`
+	Source      string      `json:"source"`
+	Hook        string      `json:"hook,omitempty"`
+	Binding     string      `json:"binding,omitempty"`
+	BindingType string      `json:"bindingType,omitempty"`
+}
+
+// valuesProvenance merges values layers as MergeLayers does and remembers the last layer
+// that set each leaf.
+type valuesProvenance struct {
+	values  utils.Values
+	sources map[string]ValueProvenance
+}
+
+func newValuesProvenance() *valuesProvenance {
+	return &valuesProvenance{
+		values:  utils.Values{},
+		sources: make(map[string]ValueProvenance),
+	}
+}
+
+// merge adds a layer. Leaves defined in a plain values layer belong to it even if
+// values are not changed. Leaves added or changed by transformers belong to it too.
+func (p *valuesProvenance) merge(source string, layer interface{}) {
+	before := flattenValues(p.values)
+	p.values = MergeLayers(p.values, layer)
+	defined := map[string]interface{}{}
+	switch layer := layer.(type) {
+	case utils.Values:
+		defined = flattenValues(layer)
+	case map[string]interface{}:
+		defined = flattenValues(layer)
+	}
+	p.update(before, defined, ValueProvenance{Source: source})
+}
+
+// mergeLayers adds layers in order.
+func (p *valuesProvenance) mergeLayers(layers []valuesLayer) {
+	for _, l := range layers {
+		p.merge(l.source, l.layer)
+	}
+}
+
+// applyPatch applies patch operations one by one to attribute leaves to hooks.
+func (p *valuesProvenance) applyPatch(patch utils.ValuesPatch, patchSources map[string]ValuesPatchSource) error {
+	for _, op := range patch.Operations {
+		before := flattenValues(p.values)
+		res, _, err := utils.ApplyValuesPatch(p.values, utils.ValuesPatch{Operations: []*utils.ValuesPatchOperation{op}}, utils.IgnoreNonExistentPaths)
+		if err != nil {
+			return err
+		}
+		p.values = res
+
+		// Leaves under the path of 'add' or 'replace' are set by the operation.
+		defined := map[string]interface{}{}
+		if op.Op != "remove" {
+			for path, value := range flattenValues(p.values) {
+				if path == op.Path || strings.HasPrefix(path, op.Path+"/") {
+					defined[path] = value
+				}
+			}
+		}
+		src := patchSources[op.Path]
+		p.update(before, defined, ValueProvenance{Source: ValuesSourcePatch, Hook: src.Hook, Binding: src.Binding, BindingType: src.BindingType})
+	}
+	return nil
+}
+
+func (p *valuesProvenance) update(before map[string]interface{}, defined map[string]interface{}, source ValueProvenance) {
+	after := flattenValues(p.values)
+	for path, value := range after {
+		_, isDefined := defined[path]
+		prev, existed := before[path]
+		if isDefined || !existed || !reflect.DeepEqual(prev, value) {
+			p.sources[path] = source
+		}
+	}
+	for path := range p.sources {
+		if _, has := after[path]; !has {
+			delete(p.sources, path)
+		}
+	}
+}
+
+// list returns leaves sorted by path.
+func (p *valuesProvenance) list() []ValueProvenance {
+	after := flattenValues(p.values)
+	res := make([]ValueProvenance, 0, len(after))
+	for path, value := range after {
+		item := p.sources[path]
+		item.Path = path
+		item.Value = value
+		res = append(res, item)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Path < res[j].Path
+	})
+	return res
+}
+
+// flattenValues returns leaves of values indexed by JSON pointers. Values are
+// copied through JSON to compare them with values after transformations.
+func flattenValues(values map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{})
+	data, err := json.Marshal(values)
+	if err != nil {
+		return res
+	}
+	var copied map[string]interface{}
+	if err := json.Unmarshal(data, &copied); err != nil {
+		return res
+	}
+	flattenInto(res, "", copied)
+	return res
+}
+
+func flattenInto(res map[string]interface{}, prefix string, obj map[string]interface{}) {
+	for key, value := range obj {
+		path := prefix + "/" + escapeJSONPointer(key)
+		if child, ok := value.(map[string]interface{}); ok && len(child) > 0 {
+			flattenInto(res, path, child)
+			continue
+		}
+		res[path] = value
+	}
+}
+
+func escapeJSONPointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// globalValuesProvenance merges global layers as GlobalValues does.
+func (mm *moduleManager) globalValuesProvenance() (*valuesProvenance, error) {
+	p := newValuesProvenance()
+	p.mergeLayers(mm.globalValuesLayers())
+
+	patches, patchSources := mm.globalValuesPatchesSnapshot()
+	for _, patch := range patches {
+		if err := p.applyPatch(patch, patchSources); err != nil {
+			return nil, fmt.Errorf("apply global patch error: %s", err)
+		}
+	}
+	return p, nil
+}
+
+// GlobalValuesProvenance returns leaves of global values with their sources.
+func (mm *moduleManager) GlobalValuesProvenance() ([]ValueProvenance, error) {
+	p, err := mm.globalValuesProvenance()
+	if err != nil {
+		return nil, err
+	}
+	return p.list(), nil
+}
+
+// ValuesProvenance returns leaves of module values with their sources.
+// Layers are the same as in Values.
+func (m *Module) ValuesProvenance() ([]ValueProvenance, error) {
+	p, err := m.moduleManager.globalValuesProvenance()
+	if err != nil {
+		return nil, fmt.Errorf("construct module values: %s", err)
+	}
+
+	p.mergeLayers(m.valuesLayers())
+
+	patches, patchSources := m.moduleManager.moduleValuesPatchesSnapshot(m.Name)
+	for _, patch := range patches {
+		if err := p.applyPatch(patch, patchSources); err != nil {
+			return nil, fmt.Errorf("construct module values: apply module patch error: %s", err)
+		}
+	}
+
+	p.merge(ValuesSourceEnabledModules, utils.Values{"global": map[string]interface{}{
+		"enabledModules": m.moduleManager.enabledModulesInOrder,
+	}})
+
+	return p.list(), nil
+}
+
+// updateValuesPatchSources saves the source for operations of the new patch and
+// forgets sources of operations removed by the compaction.
+func updateValuesPatchSources(sources map[string]ValuesPatchSource, compacted []utils.ValuesPatch, newPatch utils.ValuesPatch, source ValuesPatchSource) map[string]ValuesPatchSource {
+	if sources == nil {
+		sources = make(map[string]ValuesPatchSource)
+	}
+	for _, op := range newPatch.Operations {
+		sources[op.Path] = source
+	}
+	paths := make(map[string]bool)
+	for _, patch := range compacted {
+		for _, op := range patch.Operations {
+			paths[op.Path] = true
+		}
+	}
+	for path := range sources {
+		if !paths[path] {
+			delete(sources, path)
+		}
+	}
+	return sources
+}
+
+// globalValuesPatchesSnapshot returns patches for global values and sources of their
+// operations. They are updated together, so they are read under the same lock.
+func (mm *moduleManager) globalValuesPatchesSnapshot() ([]utils.ValuesPatch, map[string]ValuesPatchSource) {
+	mm.valuesLayersLock.RLock()
+	defer mm.valuesLayersLock.RUnlock()
+	return mm.globalDynamicValuesPatches, copyValuesPatchSources(mm.globalValuesPatchSources)
+}
+
+// moduleValuesPatchesSnapshot returns patches for module values and sources of their operations.
+func (mm *moduleManager) moduleValuesPatchesSnapshot(moduleName string) ([]utils.ValuesPatch, map[string]ValuesPatchSource) {
+	mm.valuesLayersLock.RLock()
+	defer mm.valuesLayersLock.RUnlock()
+	return mm.modulesDynamicValuesPatches[moduleName], copyValuesPatchSources(mm.modulesValuesPatchSources[moduleName])
+}
+
+func copyValuesPatchSources(sources map[string]ValuesPatchSource) map[string]ValuesPatchSource {
+	res := make(map[string]ValuesPatchSource, len(sources))
+	for path, src := range sources {
+		res[path] = src
+	}
+	return res
+}
@@ -0,0 +1,71 @@
+package module_manager
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	. "github.com/flant/shell-operator/pkg/hook/binding_context"
+	. "github.com/flant/shell-operator/pkg/hook/types"
+
+	"github.com/flant/addon-operator/pkg/utils"
+)
+
+func Test_ValuesProvenance(t *testing.T) {
+	g := NewWithT(t)
+
+	mm := NewMainModuleManager()
+	mm.commonStaticValues = utils.Values{"global": map[string]interface{}{"domain": "example.com", "replicas": 1.0}}
+	mm.kubeGlobalConfigValues = utils.Values{"global": map[string]interface{}{"replicas": 2.0}}
+
+	m := NewModule("module-a", "")
+	m.WithModuleManager(mm)
+	m.CommonStaticConfig = utils.NewModuleConfig("module-a")
+	m.CommonStaticConfig.Values = utils.Values{"moduleA": map[string]interface{}{"image": "nginx"}}
+	m.StaticConfig = utils.NewModuleConfig("module-a")
+	m.StaticConfig.Values = utils.Values{"moduleA": map[string]interface{}{"port": 80.0, "internal": map[string]interface{}{}}}
+	mm.allModulesByName[m.Name] = m
+	mm.enabledModulesInOrder = []string{"module-a"}
+	// The same value in the ConfigMap overrides static values.
+	mm.kubeModulesConfigValues["module-a"] = utils.Values{"moduleA": map[string]interface{}{"image": "nginx"}}
+
+	patch, err := utils.ValuesPatchFromBytes([]byte(`[
+{"op":"add", "path":"/moduleA/internal/cert", "value":{"crt":"a", "key":"b"}},
+{"op":"add", "path":"/moduleA/port", "value":8080}
+]`))
+	g.Expect(err).ShouldNot(HaveOccurred())
+	mm.UpdateModuleDynamicValuesPatches("module-a", *patch, ValuesPatchSource{Hook: "module-a/hooks/gen-cert", Binding: "beforeHelm", BindingType: "beforeHelm"})
+	// The last patch for the path wins.
+	patch, err = utils.ValuesPatchFromBytes([]byte(`[{"op":"add", "path":"/moduleA/port", "value":9090}]`))
+	g.Expect(err).ShouldNot(HaveOccurred())
+	mm.UpdateModuleDynamicValuesPatches("module-a", *patch, newValuesPatchSource("module-a/hooks/port", Schedule, []BindingContext{{Binding: "every-minute"}}))
+
+	provenance, err := m.ValuesProvenance()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	byPath := map[string]ValueProvenance{}
+	for _, p := range provenance {
+		byPath[p.Path] = p
+	}
+	g.Expect(byPath).To(HaveLen(7))
+	g.Expect(byPath["/global/domain"].Source).To(Equal(ValuesSourceCommonStatic))
+	g.Expect(byPath["/global/replicas"].Source).To(Equal(ValuesSourceConfig))
+	g.Expect(byPath["/global/replicas"].Value).To(Equal(2.0))
+	g.Expect(byPath["/global/enabledModules"].Source).To(Equal(ValuesSourceEnabledModules))
+	g.Expect(byPath["/moduleA/image"].Source).To(Equal(ValuesSourceConfig))
+	g.Expect(byPath["/moduleA/port"]).To(Equal(ValueProvenance{
+		Path:        "/moduleA/port",
+		Value:       9090.0,
+		Source:      ValuesSourcePatch,
+		Hook:        "module-a/hooks/port",
+		Binding:     "every-minute",
+		BindingType: "schedule",
+	}))
+	g.Expect(byPath["/moduleA/internal/cert/crt"].Hook).To(Equal("module-a/hooks/gen-cert"))
+	g.Expect(byPath["/moduleA/internal/cert/key"].Source).To(Equal(ValuesSourcePatch))
+
+	globalProvenance, err := mm.GlobalValuesProvenance()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(globalProvenance).To(HaveLen(2))
+	g.Expect(globalProvenance[0].Path).To(Equal("/global/domain"))
+}
@@ -0,0 +1,231 @@
+package module_status_manager
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	klient "github.com/flant/kube-client/client"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Module is a cluster-scoped custom resource with a module status:
+//
+//   apiVersion: addon-operator.flant.com/v1alpha1
+//   kind: Module
+//   metadata:
+//     name: simple-module
+//   status:
+//     phase: Failed
+//     enabled: true
+//     message: 'helm upgrade failed: ...'
+//     helmRevision: "3"
+//     lastConvergeTime: "2021-06-01T10:00:00Z"
+const (
+	ModuleGroup   = "addon-operator.flant.com"
+	ModuleVersion = "v1alpha1"
+	ModuleKind    = "Module"
+)
+
+var ModuleGVR = schema.GroupVersionResource{Group: ModuleGroup, Version: ModuleVersion, Resource: "modules"}
+
+type ModulePhase string
+
+const (
+	// ModuleEnabled — module is enabled, ModuleRun is not finished yet.
+	ModuleEnabled ModulePhase = "Enabled"
+	// ModuleReady — last ModuleRun is succeeded.
+	ModuleReady ModulePhase = "Ready"
+	// ModuleFailed — last ModuleRun or ModuleDelete is failed.
+	ModuleFailed ModulePhase = "Failed"
+	// ModuleRolledBack — helm upgrade is failed and the release is rolled back. Upgrade
+	// is not retried until values or chart change.
+	ModuleRolledBack ModulePhase = "RolledBack"
+	// ModuleDisabled — module is disabled and its helm release is deleted.
+	ModuleDisabled ModulePhase = "Disabled"
+)
+
+// retryDelay is a delay before next write if Kubernetes API returns an error.
+var retryDelay = 5 * time.Second
+
+type ModuleStatus struct {
+	Phase   ModulePhase
+	Enabled bool
+	// Message is a reason of the phase, e.g. an error of the last ModuleRun.
+	Message      string
+	HelmRevision string
+	// LastConvergeTime is a time of the last successful ModuleRun.
+	LastConvergeTime time.Time
+}
+
+type ModuleStatusManager interface {
+	WithContext(ctx context.Context)
+	WithKubeClient(client klient.Client)
+	Start()
+	Stop()
+	UpdateStatus(moduleName string, updateFn func(status *ModuleStatus))
+	GetStatus(moduleName string) ModuleStatus
+}
+
+// moduleStatusManager stores statuses in memory and writes them in background,
+// so a slow Kubernetes API does not block the main queue. Only the latest
+// status of each module is written.
+type moduleStatusManager struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	kubeClient klient.Client
+
+	m        sync.Mutex
+	statuses map[string]ModuleStatus
+	// modules with statuses not written to Kubernetes yet
+	dirty map[string]struct{}
+
+	updateCh chan struct{}
+}
+
+var _ ModuleStatusManager = &moduleStatusManager{}
+
+func NewModuleStatusManager() ModuleStatusManager {
+	return &moduleStatusManager{
+		statuses: make(map[string]ModuleStatus),
+		dirty:    make(map[string]struct{}),
+		updateCh: make(chan struct{}, 1),
+	}
+}
+
+func (sm *moduleStatusManager) WithContext(ctx context.Context) {
+	sm.ctx, sm.cancel = context.WithCancel(ctx)
+}
+
+func (sm *moduleStatusManager) WithKubeClient(client klient.Client) {
+	sm.kubeClient = client
+}
+
+func (sm *moduleStatusManager) Stop() {
+	if sm.cancel != nil {
+		sm.cancel()
+	}
+}
+
+// UpdateStatus changes module status with updateFn and schedules a write if status is changed.
+func (sm *moduleStatusManager) UpdateStatus(moduleName string, updateFn func(status *ModuleStatus)) {
+	sm.m.Lock()
+	status := sm.statuses[moduleName]
+	newStatus := status
+	updateFn(&newStatus)
+	if reflect.DeepEqual(status, newStatus) {
+		sm.m.Unlock()
+		return
+	}
+	sm.statuses[moduleName] = newStatus
+	sm.dirty[moduleName] = struct{}{}
+	sm.m.Unlock()
+
+	// Non-blocking notification: one pending signal is enough to write all dirty statuses.
+	select {
+	case sm.updateCh <- struct{}{}:
+	default:
+	}
+}
+
+func (sm *moduleStatusManager) GetStatus(moduleName string) ModuleStatus {
+	sm.m.Lock()
+	defer sm.m.Unlock()
+	return sm.statuses[moduleName]
+}
+
+func (sm *moduleStatusManager) Start() {
+	go func() {
+		for {
+			select {
+			case <-sm.updateCh:
+				if !sm.writeDirtyStatuses() {
+					// Retry later, dirty statuses are preserved.
+					time.AfterFunc(retryDelay, func() {
+						select {
+						case sm.updateCh <- struct{}{}:
+						default:
+						}
+					})
+				}
+			case <-sm.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// writeDirtyStatuses writes changed statuses. It returns false if some writes are failed.
+func (sm *moduleStatusManager) writeDirtyStatuses() bool {
+	sm.m.Lock()
+	statuses := make(map[string]ModuleStatus, len(sm.dirty))
+	for moduleName := range sm.dirty {
+		statuses[moduleName] = sm.statuses[moduleName]
+	}
+	sm.dirty = make(map[string]struct{})
+	sm.m.Unlock()
+
+	success := true
+	for moduleName, status := range statuses {
+		err := sm.writeStatus(moduleName, status)
+		if err != nil {
+			log.Errorf("Module status manager: cannot write status for module '%s': %v", moduleName, err)
+			success = false
+			sm.m.Lock()
+			// Do not override a status set after this write attempt.
+			sm.dirty[moduleName] = struct{}{}
+			sm.m.Unlock()
+		}
+	}
+	return success
+}
+
+// writeStatus creates Module resource if needed and updates its status subresource.
+func (sm *moduleStatusManager) writeStatus(moduleName string, status ModuleStatus) error {
+	client := sm.kubeClient.Dynamic().Resource(ModuleGVR)
+
+	obj, err := client.Get(context.TODO(), moduleName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		obj = &unstructured.Unstructured{}
+		obj.SetAPIVersion(ModuleGroup + "/" + ModuleVersion)
+		obj.SetKind(ModuleKind)
+		obj.SetName(moduleName)
+		obj.Object["spec"] = map[string]interface{}{}
+		obj, err = client.Create(context.TODO(), obj, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("create %s/%s: %v", ModuleKind, moduleName, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("get %s/%s: %v", ModuleKind, moduleName, err)
+	}
+
+	obj.Object["status"] = StatusToObject(status)
+
+	_, err = client.UpdateStatus(context.TODO(), obj, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("update %s/%s status: %v", ModuleKind, moduleName, err)
+	}
+	log.Debugf("Module status manager: module '%s' status is updated: %s", moduleName, status.Phase)
+	return nil
+}
+
+// StatusToObject returns a content of the status field of the Module resource.
+func StatusToObject(status ModuleStatus) map[string]interface{} {
+	obj := map[string]interface{}{
+		"phase":        string(status.Phase),
+		"enabled":      status.Enabled,
+		"message":      status.Message,
+		"helmRevision": status.HelmRevision,
+	}
+	if !status.LastConvergeTime.IsZero() {
+		obj["lastConvergeTime"] = status.LastConvergeTime.UTC().Format(time.RFC3339)
+	}
+	return obj
+}
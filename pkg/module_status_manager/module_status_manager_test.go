@@ -0,0 +1,60 @@
+package module_status_manager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	klient "github.com/flant/kube-client/client"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func Test_ModuleStatusManager_WriteStatus(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeClient := klient.NewFake(nil)
+
+	sm := NewModuleStatusManager()
+	sm.WithContext(context.Background())
+	sm.WithKubeClient(kubeClient)
+	sm.Start()
+	defer sm.Stop()
+
+	moduleStatus := func() map[string]interface{} {
+		obj, err := kubeClient.Dynamic().Resource(ModuleGVR).Get(context.TODO(), "simple-module", metav1.GetOptions{})
+		if err != nil {
+			return nil
+		}
+		status, _, _ := unstructured.NestedMap(obj.Object, "status")
+		return status
+	}
+
+	sm.UpdateStatus("simple-module", func(status *ModuleStatus) {
+		status.Enabled = true
+		status.Phase = ModuleFailed
+		status.Message = "helm upgrade failed"
+	})
+	g.Eventually(moduleStatus, "5s", "10ms").Should(And(
+		HaveKeyWithValue("phase", "Failed"),
+		HaveKeyWithValue("message", "helm upgrade failed"),
+	))
+
+	convergeTime := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	sm.UpdateStatus("simple-module", func(status *ModuleStatus) {
+		status.Phase = ModuleReady
+		status.Message = ""
+		status.HelmRevision = "2"
+		status.LastConvergeTime = convergeTime
+	})
+	g.Eventually(moduleStatus, "5s", "10ms").Should(Equal(map[string]interface{}{
+		"phase":            "Ready",
+		"enabled":          true,
+		"message":          "",
+		"helmRevision":     "2",
+		"lastConvergeTime": "2021-06-01T10:00:00Z",
+	}))
+
+	g.Expect(sm.GetStatus("simple-module").Phase).To(Equal(ModuleReady))
+}
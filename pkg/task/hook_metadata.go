@@ -10,6 +10,8 @@ import (
 	"github.com/flant/shell-operator/pkg/hook/task_metadata"
 	. "github.com/flant/shell-operator/pkg/hook/types"
 	"github.com/flant/shell-operator/pkg/task"
+
+	"github.com/flant/addon-operator/pkg/utils"
 )
 
 // HookMetadata is a metadata for addon-operator tasks
@@ -22,7 +24,8 @@ type HookMetadata struct {
 	BindingContext   []BindingContext
 	AllowFailure     bool //Task considered as 'ok' if hook failed. False by default. Can be true for some schedule hooks.
 
-	OnStartupHooks bool // Execute onStartup and kubernetes@Synchronization hooks for module
+	OnStartupHooks    bool // Execute onStartup and kubernetes@Synchronization hooks for module
+	ParallelHelmPhase bool // Run beforeHelm, helm and afterHelm for module in background, see ParallelModuleRunsWait
 
 	ValuesChecksum           string // checksum of global values before first afterAll hook execution
 	DynamicEnabledChecksum   string // checksum of dynamicEnabled before first afterAll hook execution
@@ -33,6 +36,8 @@ type HookMetadata struct {
 	WaitForSynchronization   bool     // kubernetes.Synchronization task should be waited
 	MonitorIDs               []string // an array of monitor IDs to unlock Kubernetes events after Synchronization.
 	ExecuteOnSynchronization bool     // A flag to skip hook execution in Synchronization tasks.
+
+	RetryPolicy *utils.RetryPolicy // a retry policy of the failed task for informative queue dump
 }
 
 var _ task_metadata.HookNameAccessor = HookMetadata{}
@@ -55,6 +60,14 @@ func HookMetadataAccessor(t task.Task) (meta HookMetadata) {
 }
 
 func (hm HookMetadata) GetDescription() string {
+	description := hm.description()
+	if hm.RetryPolicy != nil {
+		description = fmt.Sprintf("%s:retry(%s)", description, hm.RetryPolicy)
+	}
+	return description
+}
+
+func (hm HookMetadata) description() string {
 	bindingsMap := make(map[string]struct{})
 	bindings := make([]string, 0)
 
@@ -20,6 +20,8 @@ const (
 
 	// Delete unknown helm release when no module in ModulesDir
 	ModulePurge task.TaskType = "ModulePurge"
+	// Wait for helm phases of modules started in parallel by ModuleRun tasks
+	ParallelModuleRunsWait task.TaskType = "ParallelModuleRunsWait"
 	// Task to call ModuleManager.Retry
 	ModuleManagerRetry task.TaskType = "ModuleManagerRetry"
 )
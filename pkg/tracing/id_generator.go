@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/binary"
+	"math/rand"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+	uuid "gopkg.in/satori/go.uuid.v1"
+)
+
+type eventIDKey struct{}
+
+// eventIDGenerator generates random ids for spans. Ids of the event span are derived
+// from the event id, so tasks can link to the event span without passing the span context.
+type eventIDGenerator struct {
+	m          sync.Mutex
+	randSource *rand.Rand
+}
+
+func newEventIDGenerator() *eventIDGenerator {
+	var seed int64
+	_ = binary.Read(crand.Reader, binary.LittleEndian, &seed)
+	return &eventIDGenerator{
+		randSource: rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (g *eventIDGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	if eventID, ok := ctx.Value(eventIDKey{}).(string); ok {
+		if sc := eventSpanContext(eventID); sc.IsValid() {
+			return sc.TraceID(), sc.SpanID()
+		}
+	}
+	g.m.Lock()
+	defer g.m.Unlock()
+	tid := trace.TraceID{}
+	_, _ = g.randSource.Read(tid[:])
+	sid := trace.SpanID{}
+	_, _ = g.randSource.Read(sid[:])
+	return tid, sid
+}
+
+func (g *eventIDGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
+	g.m.Lock()
+	defer g.m.Unlock()
+	sid := trace.SpanID{}
+	_, _ = g.randSource.Read(sid[:])
+	return sid
+}
+
+// eventSpanContext returns a span context of the event span: the trace id is the
+// event id and the span id is the second half of the event id.
+func eventSpanContext(eventID string) trace.SpanContext {
+	id, err := uuid.FromString(eventID)
+	if err != nil {
+		return trace.SpanContext{}
+	}
+	var tid trace.TraceID
+	copy(tid[:], id[:])
+	var sid trace.SpanID
+	copy(sid[:], id[8:])
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    tid,
+		SpanID:     sid,
+		TraceFlags: trace.FlagsSampled,
+	})
+}
@@ -0,0 +1,260 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/flant/addon-operator/pkg/app"
+)
+
+const (
+	ExporterNone     = "none"
+	ExporterOTLPGRPC = "otlp-grpc"
+	ExporterOTLPHTTP = "otlp-http"
+	ExporterStdout   = "stdout"
+)
+
+var Exporters = []string{ExporterNone, ExporterOTLPGRPC, ExporterOTLPHTTP, ExporterStdout}
+
+const instrumentationName = "github.com/flant/addon-operator"
+
+// Labels that are copied into span attributes.
+var attributeLabels = []string{
+	"module",
+	"hook",
+	"hook.type",
+	"binding",
+	"binding.name",
+	"queue",
+	"task.id",
+	"event.id",
+	"event.type",
+}
+
+var (
+	m        sync.RWMutex
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer = trace.NewNoopTracerProvider().Tracer(instrumentationName)
+	// taskSpans are contexts of running tasks, spans started with the task log labels are children of the task span.
+	taskSpans = make(map[string]trace.SpanContext)
+)
+
+// Init configures the span exporter. Tracing is disabled with the 'none' exporter.
+// An empty endpoint means the default endpoint of the exporter or OTEL_EXPORTER_OTLP_ENDPOINT.
+func Init(exporterName string, endpoint string, insecure bool) error {
+	var exporter sdktrace.SpanExporter
+	var err error
+	ctx := context.Background()
+
+	switch exporterName {
+	case "", ExporterNone:
+		return nil
+	case ExporterOTLPGRPC:
+		opts := make([]otlptracegrpc.Option, 0)
+		if endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(endpoint))
+		}
+		if insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	case ExporterOTLPHTTP:
+		opts := make([]otlptracehttp.Option, 0)
+		if endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(endpoint))
+		}
+		if insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return fmt.Errorf("unknown tracing exporter '%s'", exporterName)
+	}
+	if err != nil {
+		return fmt.Errorf("create tracing exporter '%s': %v", exporterName, err)
+	}
+
+	InitWithSpanProcessor(sdktrace.NewBatchSpanProcessor(exporter))
+	return nil
+}
+
+// InitWithSpanProcessor enables tracing with the span processor.
+func InitWithSpanProcessor(sp sdktrace.SpanProcessor) {
+	res := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceNameKey.String(app.AppName),
+		semconv.ServiceVersionKey.String(app.Version),
+	)
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(sp),
+		sdktrace.WithResource(res),
+		sdktrace.WithIDGenerator(newEventIDGenerator()),
+	)
+	otel.SetTracerProvider(tp)
+
+	m.Lock()
+	defer m.Unlock()
+	provider = tp
+	tracer = tp.Tracer(instrumentationName)
+}
+
+// Shutdown sends ended spans to the exporter.
+func Shutdown(timeout time.Duration) error {
+	m.RLock()
+	tp := provider
+	m.RUnlock()
+	if tp == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return tp.Shutdown(ctx)
+}
+
+func Enabled() bool {
+	m.RLock()
+	defer m.RUnlock()
+	return provider != nil
+}
+
+func getTracer() trace.Tracer {
+	m.RLock()
+	defer m.RUnlock()
+	return tracer
+}
+
+// RecordEvent records a span for the event that creates tasks. The span context
+// is derived from the 'event.id' label, so task spans can link to the event.
+func RecordEvent(logLabels map[string]string, name string, attrs ...attribute.KeyValue) {
+	if !Enabled() {
+		return
+	}
+	eventID := logLabels["event.id"]
+	if eventID == "" {
+		return
+	}
+	ctx := context.WithValue(context.Background(), eventIDKey{}, eventID)
+	_, span := getTracer().Start(ctx, name,
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(labelsAttributes(logLabels)...),
+		trace.WithAttributes(attrs...),
+	)
+	span.End()
+}
+
+// StartTaskSpan starts a root span for the task handling linked to the event span.
+// Spans started with the task log labels are children of this span until EndTaskSpan.
+func StartTaskSpan(taskID string, logLabels map[string]string, name string, attrs ...attribute.KeyValue) trace.Span {
+	if !Enabled() {
+		return trace.SpanFromContext(context.Background())
+	}
+	opts := []trace.SpanStartOption{
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(labelsAttributes(logLabels)...),
+		trace.WithAttributes(attrs...),
+	}
+	if eventSpan := eventSpanContext(logLabels["event.id"]); eventSpan.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: eventSpan}))
+	}
+	_, span := getTracer().Start(context.Background(), name, opts...)
+
+	m.Lock()
+	taskSpans[taskID] = span.SpanContext()
+	m.Unlock()
+	return span
+}
+
+// EndTaskSpan ends the task span.
+func EndTaskSpan(taskID string, span trace.Span, status string, failureMessage string) {
+	m.Lock()
+	delete(taskSpans, taskID)
+	m.Unlock()
+
+	span.SetAttributes(attribute.String("task.status", status))
+	if status == "Fail" {
+		span.SetStatus(codes.Error, failureMessage)
+	}
+	span.End()
+}
+
+// StartSpan starts a span for the operation. The span is a child of the span
+// from 'trace.id' and 'span.id' labels or a child of the running task span.
+func StartSpan(logLabels map[string]string, name string, attrs ...attribute.KeyValue) trace.Span {
+	if !Enabled() {
+		return trace.SpanFromContext(context.Background())
+	}
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), parentSpanContext(logLabels))
+	_, span := getTracer().Start(ctx, name,
+		trace.WithAttributes(labelsAttributes(logLabels)...),
+		trace.WithAttributes(attrs...),
+	)
+	return span
+}
+
+// EndSpan ends the span and records the error.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// WithTaskSpanLabels returns a copy of labels with 'trace.id' and 'span.id' of the running
+// task span. It is used to start child spans after the task handler returns.
+func WithTaskSpanLabels(logLabels map[string]string) map[string]string {
+	newLabels := make(map[string]string, len(logLabels)+2)
+	for k, v := range logLabels {
+		newLabels[k] = v
+	}
+	m.RLock()
+	sc, has := taskSpans[logLabels["task.id"]]
+	m.RUnlock()
+	if has {
+		newLabels["trace.id"] = sc.TraceID().String()
+		newLabels["span.id"] = sc.SpanID().String()
+	}
+	return newLabels
+}
+
+func parentSpanContext(logLabels map[string]string) trace.SpanContext {
+	traceID, traceErr := trace.TraceIDFromHex(logLabels["trace.id"])
+	spanID, spanErr := trace.SpanIDFromHex(logLabels["span.id"])
+	if traceErr == nil && spanErr == nil {
+		return trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceID,
+			SpanID:     spanID,
+			TraceFlags: trace.FlagsSampled,
+		})
+	}
+	m.RLock()
+	defer m.RUnlock()
+	return taskSpans[logLabels["task.id"]]
+}
+
+func labelsAttributes(logLabels map[string]string) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0)
+	for _, label := range attributeLabels {
+		if value, has := logLabels[label]; has && value != "" {
+			attrs = append(attrs, attribute.String(label, value))
+		}
+	}
+	return attrs
+}
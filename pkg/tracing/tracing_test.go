@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	uuid "gopkg.in/satori/go.uuid.v1"
+)
+
+func Test_TaskSpans(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(Enabled()).To(BeFalse())
+	g.Expect(StartSpan(map[string]string{}, "noop").SpanContext().IsValid()).To(BeFalse())
+
+	sr := tracetest.NewSpanRecorder()
+	InitWithSpanProcessor(sr)
+	g.Expect(Enabled()).To(BeTrue())
+
+	logLabels := map[string]string{
+		"event.id": uuid.NewV4().String(),
+		"task.id":  "task-1",
+		"module":   "module-a",
+		"queue":    "main",
+	}
+
+	RecordEvent(logLabels, "KubernetesEvent")
+	taskSpan := StartTaskSpan("task-1", logLabels, "ModuleRun")
+	helmSpan := StartSpan(logLabels, "helm-upgrade")
+	EndSpan(helmSpan, fmt.Errorf("upgrade failed"))
+	// Helm phase in background is started with labels of the running task.
+	runLabels := WithTaskSpanLabels(logLabels)
+	EndTaskSpan("task-1", taskSpan, "Fail", "upgrade failed")
+	renderSpan := StartSpan(runLabels, "helm-template")
+	EndSpan(renderSpan, nil)
+
+	spans := sr.Ended()
+	g.Expect(spans).To(HaveLen(4))
+	eventSpan, helmUpgrade, task, helmTemplate := spans[0], spans[1], spans[2], spans[3]
+
+	// Event span ids are derived from the event id.
+	g.Expect(eventSpan.SpanContext().TraceID().String()).To(Equal(eventSpanContext(logLabels["event.id"]).TraceID().String()))
+
+	// Task span is a root span linked to the event span.
+	g.Expect(task.Parent().IsValid()).To(BeFalse())
+	g.Expect(task.Links()).To(HaveLen(1))
+	g.Expect(task.Links()[0].SpanContext.SpanID()).To(Equal(eventSpan.SpanContext().SpanID()))
+	g.Expect(task.Status().Code).To(Equal(codes.Error))
+	g.Expect(task.Attributes()).To(ContainElement(HaveField("Key", BeEquivalentTo("module"))))
+
+	// Operation spans are children of the task span.
+	g.Expect(helmUpgrade.Parent().SpanID()).To(Equal(task.SpanContext().SpanID()))
+	g.Expect(helmUpgrade.Status().Code).To(Equal(codes.Error))
+	g.Expect(helmTemplate.Parent().SpanID()).To(Equal(task.SpanContext().SpanID()))
+	g.Expect(helmTemplate.SpanContext().TraceID()).To(Equal(task.SpanContext().TraceID()))
+}
@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Actions for a task that is failed MaxAttempts times.
+const (
+	// RetryKeepFailing retries the task forever with the maximum delay.
+	RetryKeepFailing = "KeepFailing"
+	// RetrySkip drops the task from the queue, so next tasks can run.
+	RetrySkip = "Skip"
+	// RetryDisableModule disables the module of the task and reloads all modules.
+	RetryDisableModule = "DisableModule"
+)
+
+var RetryExhaustedActions = []string{RetryKeepFailing, RetrySkip, RetryDisableModule}
+
+const (
+	DefaultRetryInitialDelay = 5 * time.Second
+	DefaultRetryMaxDelay     = 5 * time.Minute
+)
+
+// RetryPolicy defines delays between retries of a failed task and an action
+// when the task is failed MaxAttempts times.
+type RetryPolicy struct {
+	// InitialDelay is a delay after the first failure. Delay is doubled after each next failure.
+	InitialDelay time.Duration
+	// MaxDelay is an upper bound of the delay.
+	MaxDelay time.Duration
+	// MaxAttempts is a number of failed runs before OnExhausted action. Zero means no limit.
+	MaxAttempts int
+	// OnExhausted is one of RetryExhaustedActions. Default is RetryKeepFailing.
+	OnExhausted string
+}
+
+// RetryPolicyConfig is a retryPolicy section in the hook config or in module.yaml.
+//
+// Example:
+//
+//	retryPolicy:
+//	  initialDelay: 10s
+//	  maxDelay: 10m
+//	  maxAttempts: 5
+//	  onExhausted: DisableModule
+type RetryPolicyConfig struct {
+	InitialDelay string `json:"initialDelay,omitempty"`
+	MaxDelay     string `json:"maxDelay,omitempty"`
+	MaxAttempts  int    `json:"maxAttempts,omitempty"`
+	OnExhausted  string `json:"onExhausted,omitempty"`
+}
+
+// Convert parses durations and returns a validated RetryPolicy. Nil config means no policy.
+func (c *RetryPolicyConfig) Convert() (*RetryPolicy, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	policy := &RetryPolicy{
+		MaxAttempts: c.MaxAttempts,
+		OnExhausted: c.OnExhausted,
+	}
+
+	var err error
+	if c.InitialDelay != "" {
+		policy.InitialDelay, err = time.ParseDuration(c.InitialDelay)
+		if err != nil {
+			return nil, fmt.Errorf("retryPolicy.initialDelay is invalid: %v", err)
+		}
+	}
+	if c.MaxDelay != "" {
+		policy.MaxDelay, err = time.ParseDuration(c.MaxDelay)
+		if err != nil {
+			return nil, fmt.Errorf("retryPolicy.maxDelay is invalid: %v", err)
+		}
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// Validate checks values of the policy.
+func (p *RetryPolicy) Validate() error {
+	if p.InitialDelay < 0 || p.MaxDelay < 0 {
+		return fmt.Errorf("retryPolicy: delays should be positive")
+	}
+	if p.MaxDelay != 0 && p.MaxDelay < p.InitialDelay {
+		return fmt.Errorf("retryPolicy: maxDelay %s is less than initialDelay %s", p.MaxDelay, p.InitialDelay)
+	}
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("retryPolicy: maxAttempts should be positive, got %d", p.MaxAttempts)
+	}
+	if p.OnExhausted != "" {
+		valid := false
+		for _, action := range RetryExhaustedActions {
+			if p.OnExhausted == action {
+				valid = true
+			}
+		}
+		if !valid {
+			return fmt.Errorf("retryPolicy: unknown onExhausted '%s', expect one of: %s", p.OnExhausted, strings.Join(RetryExhaustedActions, ", "))
+		}
+	}
+	return nil
+}
+
+// ExhaustedAction returns an action for the task that is failed MaxAttempts times.
+func (p *RetryPolicy) ExhaustedAction() string {
+	if p.OnExhausted == "" {
+		return RetryKeepFailing
+	}
+	return p.OnExhausted
+}
+
+// IsExhausted returns true if the task is failed MaxAttempts times.
+func (p *RetryPolicy) IsExhausted(failedAttempts int) bool {
+	return p.MaxAttempts > 0 && failedAttempts >= p.MaxAttempts
+}
+
+// Delay returns a delay before the next attempt after failedAttempts failures.
+func (p *RetryPolicy) Delay(failedAttempts int) time.Duration {
+	initialDelay, maxDelay := p.delays()
+	delay := initialDelay
+	for i := 1; i < failedAttempts; i++ {
+		delay *= 2
+		if delay >= maxDelay {
+			return maxDelay
+		}
+	}
+	if delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
+
+func (p *RetryPolicy) delays() (time.Duration, time.Duration) {
+	initialDelay := p.InitialDelay
+	if initialDelay == 0 {
+		initialDelay = DefaultRetryInitialDelay
+	}
+	maxDelay := p.MaxDelay
+	if maxDelay == 0 {
+		maxDelay = DefaultRetryMaxDelay
+		if maxDelay < initialDelay {
+			maxDelay = initialDelay
+		}
+	}
+	return initialDelay, maxDelay
+}
+
+// String returns a short description of the policy for the queue dump.
+func (p *RetryPolicy) String() string {
+	initialDelay, maxDelay := p.delays()
+	if p.MaxAttempts == 0 {
+		return fmt.Sprintf("backoff %s..%s, unlimited attempts", initialDelay, maxDelay)
+	}
+	return fmt.Sprintf("backoff %s..%s, %d attempts, then %s", initialDelay, maxDelay, p.MaxAttempts, p.ExhaustedAction())
+}
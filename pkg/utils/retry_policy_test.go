@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_RetryPolicy_Delay(t *testing.T) {
+	g := NewWithT(t)
+
+	policy := &RetryPolicy{InitialDelay: time.Second, MaxDelay: 10 * time.Second, MaxAttempts: 3, OnExhausted: RetrySkip}
+	g.Expect(policy.Delay(1)).To(Equal(time.Second))
+	g.Expect(policy.Delay(2)).To(Equal(2 * time.Second))
+	g.Expect(policy.Delay(4)).To(Equal(8 * time.Second))
+	g.Expect(policy.Delay(5)).To(Equal(10 * time.Second))
+	g.Expect(policy.Delay(1000)).To(Equal(10 * time.Second))
+
+	g.Expect(policy.IsExhausted(2)).To(BeFalse())
+	g.Expect(policy.IsExhausted(3)).To(BeTrue())
+	g.Expect(policy.String()).To(Equal("backoff 1s..10s, 3 attempts, then Skip"))
+
+	// Defaults.
+	policy = &RetryPolicy{}
+	g.Expect(policy.Delay(1)).To(Equal(DefaultRetryInitialDelay))
+	g.Expect(policy.Delay(1000)).To(Equal(DefaultRetryMaxDelay))
+	g.Expect(policy.IsExhausted(1000)).To(BeFalse())
+	g.Expect(policy.ExhaustedAction()).To(Equal(RetryKeepFailing))
+}
+
+func Test_RetryPolicyConfig_Convert(t *testing.T) {
+	g := NewWithT(t)
+
+	var cfg *RetryPolicyConfig
+	policy, err := cfg.Convert()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(policy).To(BeNil())
+
+	cfg = &RetryPolicyConfig{InitialDelay: "10s", MaxDelay: "5m", MaxAttempts: 5, OnExhausted: RetryDisableModule}
+	policy, err = cfg.Convert()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(*policy).To(Equal(RetryPolicy{InitialDelay: 10 * time.Second, MaxDelay: 5 * time.Minute, MaxAttempts: 5, OnExhausted: RetryDisableModule}))
+
+	for _, bad := range []RetryPolicyConfig{
+		{InitialDelay: "10"},
+		{InitialDelay: "1m", MaxDelay: "10s"},
+		{MaxAttempts: -1},
+		{OnExhausted: "Ignore"},
+	} {
+		bad := bad
+		_, err = bad.Convert()
+		g.Expect(err).Should(HaveOccurred(), "%+v", bad)
+	}
+}
@@ -108,3 +108,65 @@ moduleName:
 	mErr = v.ValidateModuleHelmValues("moduleName", moduleValues)
 	g.Expect(mErr).ShouldNot(HaveOccurred())
 }
+
+func Test_Transform_Required_Offline(t *testing.T) {
+	g := NewWithT(t)
+	var err error
+	v := NewValuesValidator()
+
+	var configValuesYaml = `
+type: object
+properties:
+  param1:
+    type: string
+`
+	var valuesYaml = `
+x-extend:
+  schema: "config-values.yaml"
+type: object
+required:
+- internal
+properties:
+  internal:
+    type: object
+    required:
+    - param2
+    properties:
+      param2:
+        type: string
+      param3:
+        type: integer
+`
+
+	err = v.SchemaStorage.AddModuleValuesSchemas("moduleName", []byte(configValuesYaml), []byte(valuesYaml))
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// Values without fields set by hooks.
+	moduleValues, err := utils.NewValuesFromBytes([]byte(`
+moduleName:
+  param1: val1
+`))
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// Values contract is not satisfied — no internal field.
+	mErr := v.ValidateModuleValues("moduleName", moduleValues)
+	g.Expect(mErr).Should(HaveOccurred())
+
+	// Required fields are not checked without hooks.
+	mErr = v.ValidateModuleOfflineValues("moduleName", moduleValues)
+	g.Expect(mErr).ShouldNot(HaveOccurred())
+
+	// Nested required fields are not checked too, but types are checked.
+	moduleValues, err = utils.NewValuesFromBytes([]byte(`
+moduleName:
+  param1: val1
+  internal:
+    param3: val3
+`))
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	mErr = v.ValidateModuleOfflineValues("moduleName", moduleValues)
+	g.Expect(mErr).Should(HaveOccurred())
+	g.Expect(mErr.Error()).To(ContainSubstring("param3"))
+	g.Expect(mErr.Error()).ToNot(ContainSubstring("param2"))
+}
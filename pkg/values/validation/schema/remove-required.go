@@ -0,0 +1,31 @@
+package schema
+
+import (
+	"github.com/go-openapi/spec"
+)
+
+// RemoveRequiredTransformer drops required fields from the schema and its properties.
+// Values set by hooks are absent when a module is rendered without a cluster, so only
+// types and formats are checked for such values.
+type RemoveRequiredTransformer struct {
+}
+
+func (t *RemoveRequiredTransformer) Transform(s *spec.Schema) *spec.Schema {
+	if s == nil {
+		return s
+	}
+
+	s.Required = nil
+
+	// Deep transform.
+	removeRequired(s.Properties)
+	return s
+}
+
+func removeRequired(props map[string]spec.Schema) {
+	for k, prop := range props {
+		prop.Required = nil
+		props[k] = prop
+		removeRequired(props[k].Properties)
+	}
+}
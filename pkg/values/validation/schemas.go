@@ -30,6 +30,8 @@ const (
 	ConfigValuesSchema SchemaType = "config"
 	ValuesSchema       SchemaType = "values"
 	HelmValuesSchema   SchemaType = "helm"
+	// OfflineValuesSchema is a values schema without required fields to validate values without hooks.
+	OfflineValuesSchema SchemaType = "offline"
 )
 
 type SchemaStorage struct {
@@ -59,7 +61,8 @@ func (st *SchemaStorage) ModuleValuesSchema(moduleName string, schemaType Schema
 	return st.ModuleSchemas[moduleName][schemaType]
 }
 
-// AddGlobalValuesSchemas prepares and stores three schemas: config, config+values, config+values+required.
+// AddGlobalValuesSchemas prepares and stores schemas: config, config+values, config+values+required
+// and config+values without required fields.
 func (st *SchemaStorage) AddGlobalValuesSchemas(configBytes, valuesBytes []byte) error {
 	schemas, err := PrepareSchemas(configBytes, valuesBytes)
 	if err != nil {
@@ -139,6 +142,13 @@ func PrepareSchemas(configBytes, valuesBytes []byte) (schemas map[SchemaType]*sp
 			// Transform x-required-for-helm
 			&schema.RequiredForHelmTransformer{},
 		)
+
+		res[OfflineValuesSchema] = schema.TransformSchema(
+			res[ValuesSchema],
+			// Copy schema object.
+			&schema.CopyTransformer{},
+			&schema.RemoveRequiredTransformer{},
+		)
 	}
 
 	return res, nil
@@ -42,6 +42,12 @@ func (v *ValuesValidator) ValidateModuleHelmValues(moduleName string, values uti
 	return v.ValidateValues(ModuleSchema, HelmValuesSchema, moduleName, values)
 }
 
+// ValidateModuleOfflineValues checks module values without required fields. It is used to
+// render modules without a cluster, when values from hooks are absent.
+func (v *ValuesValidator) ValidateModuleOfflineValues(moduleName string, values utils.Values) (multiErr error) {
+	return v.ValidateValues(ModuleSchema, OfflineValuesSchema, moduleName, values)
+}
+
 func (v *ValuesValidator) ValidateValues(schemaType SchemaType, valuesType SchemaType, moduleName string, values utils.Values) error {
 	var s *spec.Schema
 	var obj interface{}
@@ -0,0 +1,265 @@
+// Package testing runs Go hooks in unit tests without addon-operator and a cluster.
+//
+// A cluster state is defined with YAML manifests, snapshots are built with FilterFunc
+// of kubernetes bindings, and the result of the run contains values patches, metrics
+// and Kubernetes object patches. Object patches are applied to the cluster state, so
+// the next run sees them.
+//
+//	ht := testing.NewHookTest(config, handler).
+//		WithValues(utils.Values{"moduleOne": map[string]interface{}{}})
+//	err := ht.SetKubeState(`
+//	apiVersion: v1
+//	kind: ConfigMap
+//	metadata:
+//	  name: cm
+//	`)
+//	res, err := ht.RunSynchronization()
+//	// Check res.Values, res.Metrics, res.ObjectPatches or ht.KubeObject(...)
+package testing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/flant/kube-client/fake"
+	"github.com/flant/kube-client/manifest"
+	"github.com/flant/shell-operator/pkg/kube/object_patch"
+	kube_types "github.com/flant/shell-operator/pkg/kube_events_manager/types"
+	"github.com/flant/shell-operator/pkg/metric_storage/operation"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/flant/addon-operator/pkg/module_manager/go_hook"
+	"github.com/flant/addon-operator/pkg/module_manager/go_hook/metrics"
+	"github.com/flant/addon-operator/pkg/utils"
+	"github.com/flant/addon-operator/sdk"
+)
+
+// Binding context types.
+const (
+	Synchronization = "Synchronization"
+	Event           = "Event"
+	Schedule        = "Schedule"
+)
+
+// BindingContext describes why the hook is executed.
+type BindingContext struct {
+	Type       string
+	Binding    string
+	WatchEvent kube_types.WatchEventType
+	Object     *unstructured.Unstructured
+}
+
+// HookResult is a result of the hook execution.
+type HookResult struct {
+	BindingContext BindingContext
+	Snapshots      go_hook.Snapshots
+
+	// Patches returned by the hook.
+	ValuesPatches       []*utils.ValuesPatchOperation
+	ConfigValuesPatches []*utils.ValuesPatchOperation
+	Metrics             []operation.MetricOperation
+	ObjectPatches       []object_patch.Operation
+	BindingActions      []go_hook.BindingAction
+
+	// Values and config values with applied patches.
+	Values       utils.Values
+	ConfigValues utils.Values
+}
+
+// HookTest runs a Go hook with a fake cluster state.
+type HookTest struct {
+	name         string
+	hook         go_hook.GoHook
+	values       utils.Values
+	configValues utils.Values
+	cluster      *fake.Cluster
+	logEntry     *log.Entry
+}
+
+type goHook struct {
+	config        *go_hook.HookConfig
+	reconcileFunc func(input *go_hook.HookInput) error
+}
+
+func (h *goHook) Config() *go_hook.HookConfig {
+	return h.config
+}
+
+func (h *goHook) Run(input *go_hook.HookInput) error {
+	return h.reconcileFunc(input)
+}
+
+// NewHookTest returns a HookTest for the hook defined with the same arguments as for sdk.RegisterFunc.
+func NewHookTest(config *go_hook.HookConfig, reconcileFunc func(input *go_hook.HookInput) error) *HookTest {
+	return NewHookTestForGoHook(&goHook{config: config, reconcileFunc: reconcileFunc})
+}
+
+// NewHookTestForGoHook returns a HookTest for the hook.
+func NewHookTestForGoHook(hook go_hook.GoHook) *HookTest {
+	return &HookTest{
+		name:         "go-hook",
+		hook:         hook,
+		values:       utils.Values{},
+		configValues: utils.Values{},
+		cluster:      fake.NewFakeCluster(""),
+		logEntry:     log.WithField("output", "gohook"),
+	}
+}
+
+// NewHookTestFromRegistry returns a HookTest for the hook registered in the sdk registry,
+// e.g. "global-hook.go" or "001-module-one/hooks/module-hook.go".
+func NewHookTestFromRegistry(hookName string) (*HookTest, error) {
+	for _, h := range sdk.Registry().Hooks() {
+		if h.Metadata.Name == hookName {
+			t := NewHookTestForGoHook(h.Hook)
+			t.name = hookName
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("hook '%s' is not registered", hookName)
+}
+
+// WithValues sets values for the hook. Values should contain 'global' and module sections.
+func (t *HookTest) WithValues(values utils.Values) *HookTest {
+	t.values = values
+	return t
+}
+
+// WithConfigValues sets config values for the hook.
+func (t *HookTest) WithConfigValues(values utils.Values) *HookTest {
+	t.configValues = values
+	return t
+}
+
+// Values returns current values. Values are updated with patches after each run.
+func (t *HookTest) Values() utils.Values {
+	return t.values
+}
+
+// ConfigValues returns current config values. Config values are updated with patches after each run.
+func (t *HookTest) ConfigValues() utils.Values {
+	return t.configValues
+}
+
+// RunSynchronization executes the hook as on Synchronization of kubernetes bindings.
+func (t *HookTest) RunSynchronization() (*HookResult, error) {
+	return t.run(BindingContext{Type: Synchronization})
+}
+
+// RunEvent applies the event to the cluster state and executes the hook as on Event of the binding.
+// objectYAML is an object for Added and Modified events. Deleted event requires apiVersion, kind and metadata only.
+func (t *HookTest) RunEvent(bindingName string, watchEvent kube_types.WatchEventType, objectYAML string) (*HookResult, error) {
+	kubeCfg := t.kubernetesBinding(bindingName)
+	if kubeCfg == nil {
+		return nil, fmt.Errorf("hook has no kubernetes binding '%s'", bindingName)
+	}
+
+	m, err := manifest.NewFromYAML(objectYAML)
+	if err != nil {
+		return nil, err
+	}
+	switch watchEvent {
+	case kube_types.WatchEventAdded, kube_types.WatchEventModified:
+		err = t.applyObject(m)
+	case kube_types.WatchEventDeleted:
+		err = t.deleteObject(m)
+	default:
+		err = fmt.Errorf("unknown watch event '%s'", watchEvent)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !go_hook.BoolDeref(kubeCfg.ExecuteHookOnEvents, true) {
+		return nil, fmt.Errorf("kubernetes binding '%s' does not execute hook on events", bindingName)
+	}
+
+	return t.run(BindingContext{Type: Event, Binding: bindingName, WatchEvent: watchEvent, Object: m.Unstructured()})
+}
+
+// RunSchedule executes the hook as on the schedule binding.
+func (t *HookTest) RunSchedule(bindingName string) (*HookResult, error) {
+	found := false
+	for _, sch := range t.hook.Config().Schedule {
+		if sch.Name == bindingName {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("hook has no schedule binding '%s'", bindingName)
+	}
+	return t.run(BindingContext{Type: Schedule, Binding: bindingName})
+}
+
+// run executes the hook the same way as HookExecutor does and applies returned patches.
+func (t *HookTest) run(bindingContext BindingContext) (*HookResult, error) {
+	snapshots, err := t.Snapshots()
+	if err != nil {
+		return nil, err
+	}
+
+	patchableValues, err := go_hook.NewPatchableValues(t.values)
+	if err != nil {
+		return nil, err
+	}
+	patchableConfigValues, err := go_hook.NewPatchableValues(t.configValues)
+	if err != nil {
+		return nil, err
+	}
+	bindingActions := new([]go_hook.BindingAction)
+	metricsCollector := metrics.NewCollector(t.name)
+	patchCollector := object_patch.NewPatchCollector()
+
+	err = t.hook.Run(&go_hook.HookInput{
+		Snapshots:        snapshots,
+		Values:           patchableValues,
+		ConfigValues:     patchableConfigValues,
+		MetricsCollector: metricsCollector,
+		PatchCollector:   patchCollector,
+		LogEntry:         t.logEntry.WithField("hook", t.name).WithField("binding", bindingContext.Binding),
+		BindingActions:   bindingActions,
+		Context:          context.Background(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &HookResult{
+		BindingContext:      bindingContext,
+		Snapshots:           snapshots,
+		ValuesPatches:       patchableValues.GetPatches(),
+		ConfigValuesPatches: patchableConfigValues.GetPatches(),
+		Metrics:             metricsCollector.CollectedMetrics(),
+		ObjectPatches:       patchCollector.Operations(),
+		BindingActions:      *bindingActions,
+	}
+
+	res.Values, _, err = utils.ApplyValuesPatch(t.values, utils.ValuesPatch{Operations: res.ValuesPatches}, utils.Strict)
+	if err != nil {
+		return nil, fmt.Errorf("apply values patch: %v", err)
+	}
+	res.ConfigValues, _, err = utils.ApplyValuesPatch(t.configValues, utils.ValuesPatch{Operations: res.ConfigValuesPatches}, utils.Strict)
+	if err != nil {
+		return nil, fmt.Errorf("apply config values patch: %v", err)
+	}
+
+	err = object_patch.NewObjectPatcher(t.cluster.Client).ExecuteOperations(res.ObjectPatches)
+	if err != nil {
+		return nil, fmt.Errorf("apply object patches: %v", err)
+	}
+
+	t.values = res.Values
+	t.configValues = res.ConfigValues
+	return res, nil
+}
+
+func (t *HookTest) kubernetesBinding(bindingName string) *go_hook.KubernetesConfig {
+	for i, kubeCfg := range t.hook.Config().Kubernetes {
+		if kubeCfg.Name == bindingName {
+			return &t.hook.Config().Kubernetes[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package testing_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/flant/shell-operator/pkg/kube/object_patch"
+	kube_types "github.com/flant/shell-operator/pkg/kube_events_manager/types"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/flant/addon-operator/pkg/module_manager/go_hook"
+	"github.com/flant/addon-operator/pkg/utils"
+	hooktesting "github.com/flant/addon-operator/sdk/testing"
+)
+
+// A hook that stores names of labeled ConfigMaps in values and creates a Secret with their count.
+var hookConfig = &go_hook.HookConfig{
+	Kubernetes: []go_hook.KubernetesConfig{
+		{
+			Name:       "configmaps",
+			ApiVersion: "v1",
+			Kind:       "ConfigMap",
+			LabelSelector: &v1.LabelSelector{
+				MatchLabels: map[string]string{"app": "test"},
+			},
+			NamespaceSelector: &kube_types.NamespaceSelector{
+				NameSelector: &kube_types.NameSelector{MatchNames: []string{"default", "prod"}},
+			},
+			FilterFunc: func(obj *unstructured.Unstructured) (go_hook.FilterResult, error) {
+				return obj.GetName(), nil
+			},
+		},
+	},
+	Schedule: []go_hook.ScheduleConfig{
+		{Name: "every-hour", Crontab: "0 * * * *"},
+	},
+}
+
+func handleConfigMaps(input *go_hook.HookInput) error {
+	names := make([]string, 0)
+	for _, name := range input.Snapshots["configmaps"] {
+		names = append(names, name.(string))
+	}
+	input.Values.Set("moduleOne.internal.configMaps", names)
+	input.MetricsCollector.Set("config_maps", float64(len(names)), nil)
+	input.PatchCollector.Create(&unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "count", "namespace": "default"},
+		"stringData": map[string]interface{}{"count": strconv.Itoa(len(names))},
+	}}, object_patch.UpdateIfExists())
+	return nil
+}
+
+const kubeState = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm-default
+  labels:
+    app: test
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm-other
+  namespace: other
+  labels:
+    app: test
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm-unlabeled
+  namespace: prod
+`
+
+func Test_HookTest(t *testing.T) {
+	g := NewWithT(t)
+
+	ht := hooktesting.NewHookTest(hookConfig, handleConfigMaps).
+		WithValues(utils.Values{"moduleOne": map[string]interface{}{"internal": map[string]interface{}{}}})
+	g.Expect(ht.SetKubeState(kubeState)).Should(Succeed())
+
+	res, err := ht.RunSynchronization()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(res.BindingContext.Type).To(Equal(hooktesting.Synchronization))
+	g.Expect(res.Snapshots["configmaps"]).To(Equal([]go_hook.FilterResult{"cm-default"}))
+	g.Expect(res.ValuesPatches).To(HaveLen(1))
+	g.Expect(res.Values.SectionByKey("moduleOne")).To(Equal(utils.Values{
+		"moduleOne": map[string]interface{}{"internal": map[string]interface{}{"configMaps": []interface{}{"cm-default"}}},
+	}))
+	g.Expect(res.Metrics).To(HaveLen(1))
+	g.Expect(*res.Metrics[0].Value).To(Equal(1.0))
+	g.Expect(res.ObjectPatches).To(HaveLen(1))
+
+	secret, err := ht.KubeObject("v1", "Secret", "default", "count")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(secret).ToNot(BeNil())
+
+	// Event changes the cluster state before the hook execution.
+	res, err = ht.RunEvent("configmaps", kube_types.WatchEventAdded, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm-prod
+  namespace: prod
+  labels:
+    app: test
+`)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(res.BindingContext.WatchEvent).To(Equal(kube_types.WatchEventAdded))
+	g.Expect(res.Snapshots["configmaps"]).To(ConsistOf(go_hook.FilterResult("cm-default"), go_hook.FilterResult("cm-prod")))
+	g.Expect(ht.Values().SectionByKey("moduleOne")).To(Equal(res.Values.SectionByKey("moduleOne")))
+
+	res, err = ht.RunEvent("configmaps", kube_types.WatchEventDeleted, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm-default
+`)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(res.Snapshots["configmaps"]).To(Equal([]go_hook.FilterResult{"cm-prod"}))
+
+	res, err = ht.RunSchedule("every-hour")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(res.BindingContext.Type).To(Equal(hooktesting.Schedule))
+
+	_, err = ht.RunSchedule("unknown")
+	g.Expect(err).Should(HaveOccurred())
+	_, err = ht.RunEvent("unknown", kube_types.WatchEventAdded, kubeState)
+	g.Expect(err).Should(HaveOccurred())
+}
+
+func Test_HookTest_CustomResources(t *testing.T) {
+	g := NewWithT(t)
+
+	config := &go_hook.HookConfig{
+		Kubernetes: []go_hook.KubernetesConfig{
+			{
+				Name:       "crs",
+				ApiVersion: "example.com/v1",
+				Kind:       "Example",
+				FieldSelector: &kube_types.FieldSelector{
+					MatchExpressions: []kube_types.FieldSelectorRequirement{
+						{Field: "spec.enabled", Operator: "Equals", Value: "true"},
+					},
+				},
+				FilterFunc: func(obj *unstructured.Unstructured) (go_hook.FilterResult, error) {
+					return obj.GetName(), nil
+				},
+			},
+		},
+	}
+	ht := hooktesting.NewHookTest(config, func(input *go_hook.HookInput) error {
+		input.ConfigValues.Set("moduleOne.count", len(input.Snapshots["crs"]))
+		return nil
+	})
+
+	g.Expect(ht.SetKubeState(`
+apiVersion: example.com/v1
+kind: Example
+metadata:
+  name: one
+spec:
+  enabled: true
+`)).Should(HaveOccurred())
+
+	ht.RegisterCRD("example.com", "v1", "Example", false).
+		WithConfigValues(utils.Values{"moduleOne": map[string]interface{}{}})
+	g.Expect(ht.SetKubeState(`
+apiVersion: example.com/v1
+kind: Example
+metadata:
+  name: one
+spec:
+  enabled: true
+---
+apiVersion: example.com/v1
+kind: Example
+metadata:
+  name: two
+spec:
+  enabled: false
+`)).Should(Succeed())
+
+	res, err := ht.RunSynchronization()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(res.Snapshots["crs"]).To(Equal([]go_hook.FilterResult{"one"}))
+	g.Expect(res.ConfigValues).To(Equal(utils.Values{"moduleOne": map[string]interface{}{"count": 1.0}}))
+}
@@ -0,0 +1,251 @@
+package testing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/flant/kube-client/fake"
+	"github.com/flant/kube-client/manifest"
+	kube_types "github.com/flant/shell-operator/pkg/kube_events_manager/types"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/flant/addon-operator/pkg/module_manager/go_hook"
+)
+
+// RegisterCRD registers a custom resource in the fake cluster. Objects of custom
+// resources can be used in the cluster state only after registration.
+func (t *HookTest) RegisterCRD(group, version, kind string, namespaced bool) *HookTest {
+	t.cluster.RegisterCRD(group, version, kind, namespaced)
+	return t
+}
+
+// SetKubeState replaces objects in the fake cluster with objects from YAML documents.
+// Namespaced objects without namespace are created in the 'default' namespace.
+// Namespace objects are required only for label selectors in namespaceSelector.
+func (t *HookTest) SetKubeState(manifestsYAML string) error {
+	manifests, err := manifest.ListFromYamlDocs(manifestsYAML)
+	if err != nil {
+		return fmt.Errorf("parse cluster state: %v", err)
+	}
+
+	// Keep custom resources registered in the previous cluster.
+	resources := t.cluster.Discovery.Resources
+	t.cluster = fake.NewFakeCluster("")
+	t.cluster.Discovery.Resources = resources
+
+	for _, m := range manifests {
+		if err := t.applyObject(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// KubeObject returns the object from the cluster state or nil if the object is absent.
+// Use it to check the cluster state after object patches of the hook are applied.
+func (t *HookTest) KubeObject(apiVersion, kind, namespace, name string) (*unstructured.Unstructured, error) {
+	gvr, namespaced, err := t.findResource(apiVersion, kind)
+	if err != nil {
+		return nil, err
+	}
+	if !namespaced {
+		namespace = ""
+	}
+	obj, err := t.cluster.Client.Dynamic().Resource(gvr).Namespace(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	return obj, err
+}
+
+// Snapshots returns objects from the cluster state filtered by kubernetes bindings of the hook.
+func (t *HookTest) Snapshots() (go_hook.Snapshots, error) {
+	snapshots := make(go_hook.Snapshots)
+	for _, kubeCfg := range t.hook.Config().Kubernetes {
+		objects, err := t.listObjects(kubeCfg)
+		if err != nil {
+			return nil, fmt.Errorf("binding '%s': %v", kubeCfg.Name, err)
+		}
+
+		snapshots[kubeCfg.Name] = make([]go_hook.FilterResult, 0, len(objects))
+		for _, obj := range objects {
+			filterResult, err := kubeCfg.FilterFunc(obj)
+			if err != nil {
+				return nil, fmt.Errorf("binding '%s': filter %s/%s: %v", kubeCfg.Name, obj.GetNamespace(), obj.GetName(), err)
+			}
+			snapshots[kubeCfg.Name] = append(snapshots[kubeCfg.Name], filterResult)
+		}
+	}
+	return snapshots, nil
+}
+
+// listObjects returns objects matched by selectors of the binding.
+func (t *HookTest) listObjects(kubeCfg go_hook.KubernetesConfig) ([]*unstructured.Unstructured, error) {
+	if kubeCfg.FilterFunc == nil {
+		return nil, fmt.Errorf("FilterFunc is nil")
+	}
+
+	gvr, _, err := t.findResource(kubeCfg.ApiVersion, kubeCfg.Kind)
+	if err != nil {
+		return nil, err
+	}
+	list, err := t.cluster.Client.Dynamic().Resource(gvr).Namespace(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	labelSelector := labels.Everything()
+	if kubeCfg.LabelSelector != nil {
+		labelSelector, err = metav1.LabelSelectorAsSelector(kubeCfg.LabelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("labelSelector: %v", err)
+		}
+	}
+
+	res := make([]*unstructured.Unstructured, 0, len(list.Items))
+	for i := range list.Items {
+		obj := &list.Items[i]
+		if !matchNames(kubeCfg.NameSelector, obj.GetName()) {
+			continue
+		}
+		if !labelSelector.Matches(labels.Set(obj.GetLabels())) {
+			continue
+		}
+		matched, err := t.matchNamespace(kubeCfg.NamespaceSelector, obj.GetNamespace())
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			continue
+		}
+		matched, err = matchFields(kubeCfg.FieldSelector, obj)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			continue
+		}
+		res = append(res, obj)
+	}
+	return res, nil
+}
+
+func matchNames(sel *kube_types.NameSelector, name string) bool {
+	if sel == nil || len(sel.MatchNames) == 0 {
+		return true
+	}
+	for _, n := range sel.MatchNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *HookTest) matchNamespace(sel *kube_types.NamespaceSelector, namespace string) (bool, error) {
+	if sel == nil {
+		return true, nil
+	}
+	if sel.NameSelector != nil && !matchNames(sel.NameSelector, namespace) {
+		return false, nil
+	}
+	if sel.LabelSelector == nil {
+		return true, nil
+	}
+
+	labelSelector, err := metav1.LabelSelectorAsSelector(sel.LabelSelector)
+	if err != nil {
+		return false, fmt.Errorf("namespace labelSelector: %v", err)
+	}
+	ns, err := t.KubeObject("v1", "Namespace", "", namespace)
+	if err != nil || ns == nil {
+		return false, err
+	}
+	return labelSelector.Matches(labels.Set(ns.GetLabels())), nil
+}
+
+// matchFields supports equality operators of field selectors for any field of the object.
+func matchFields(sel *kube_types.FieldSelector, obj *unstructured.Unstructured) (bool, error) {
+	if sel == nil {
+		return true, nil
+	}
+	for _, req := range sel.MatchExpressions {
+		value, _, err := unstructured.NestedFieldNoCopy(obj.Object, strings.Split(req.Field, ".")...)
+		if err != nil {
+			return false, fmt.Errorf("fieldSelector '%s': %v", req.Field, err)
+		}
+		actual := ""
+		if value != nil {
+			actual = fmt.Sprintf("%v", value)
+		}
+		switch req.Operator {
+		case "=", "==", "Equals":
+			if actual != req.Value {
+				return false, nil
+			}
+		case "!=", "NotEquals":
+			if actual == req.Value {
+				return false, nil
+			}
+		default:
+			return false, fmt.Errorf("fieldSelector '%s': unsupported operator '%s'", req.Field, req.Operator)
+		}
+	}
+	return true, nil
+}
+
+// applyObject creates the object or updates it if the object exists.
+func (t *HookTest) applyObject(m manifest.Manifest) error {
+	gvr, namespaced, err := t.findResource(m.ApiVersion(), m.Kind())
+	if err != nil {
+		return err
+	}
+
+	obj := m.Unstructured()
+	if namespaced && obj.GetNamespace() == "" {
+		obj.SetNamespace(metav1.NamespaceDefault)
+	}
+	if !namespaced {
+		obj.SetNamespace("")
+	}
+
+	client := t.cluster.Client.Dynamic().Resource(gvr).Namespace(obj.GetNamespace())
+	_, err = client.Create(context.TODO(), obj, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		_, err = client.Update(context.TODO(), obj, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("apply %s: %v", m.Id(), err)
+	}
+	return nil
+}
+
+func (t *HookTest) deleteObject(m manifest.Manifest) error {
+	gvr, namespaced, err := t.findResource(m.ApiVersion(), m.Kind())
+	if err != nil {
+		return err
+	}
+	namespace := ""
+	if namespaced {
+		namespace = m.Namespace(metav1.NamespaceDefault)
+	}
+	err = t.cluster.Client.Dynamic().Resource(gvr).Namespace(namespace).Delete(context.TODO(), m.Name(), metav1.DeleteOptions{})
+	if err != nil {
+		return fmt.Errorf("delete %s: %v", m.Id(), err)
+	}
+	return nil
+}
+
+func (t *HookTest) findResource(apiVersion, kind string) (schema.GroupVersionResource, bool, error) {
+	apiRes, err := t.cluster.Client.APIResource(apiVersion, kind)
+	if err != nil {
+		return schema.GroupVersionResource{}, false, fmt.Errorf("kind '%s' is not known, use RegisterCRD for custom resources: %v", kind, err)
+	}
+	gvr := schema.GroupVersionResource{Group: apiRes.Group, Version: apiRes.Version, Resource: apiRes.Name}
+	return gvr, apiRes.Namespaced, nil
+}